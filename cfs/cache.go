@@ -0,0 +1,178 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/creiht/formic/proto"
+)
+
+// Most entries kept in each part of the cache before it is emptied out
+const maxCached = 100000
+
+type cachedAttr struct {
+	attr    *pb.Attr
+	expires time.Time
+}
+
+type dirent struct {
+	parent uint64
+	name   string
+}
+
+type cachedEntry struct {
+	inode   uint64
+	expires time.Time
+}
+
+// metaCache keeps the attributes of inodes and the dir entries looked up, so
+// they aren't asked for again until they expire or formicd says they changed.
+// The ttls are only used while watching formicd for changes, without a watch
+// nothing is kept for longer than the old fixed times.
+type metaCache struct {
+	sync.Mutex
+	attrTTL  time.Duration
+	entryTTL time.Duration
+	watching bool
+	// Bumped on every invalidation, so what was read from formicd before it
+	// isn't cached after
+	gen     uint64
+	attrs   map[uint64]*cachedAttr
+	entries map[dirent]*cachedEntry
+}
+
+func newMetaCache(attrTTL, entryTTL time.Duration) *metaCache {
+	return &metaCache{
+		attrTTL:  attrTTL,
+		entryTTL: entryTTL,
+		attrs:    make(map[uint64]*cachedAttr),
+		entries:  make(map[dirent]*cachedEntry),
+	}
+}
+
+// attrValid is how long the attributes can be cached, here and in the kernel
+func (c *metaCache) attrValid() time.Duration {
+	c.Lock()
+	defer c.Unlock()
+	return c.ttl(c.attrTTL, attrValidTime)
+}
+
+// entryValid is how long the dir entries can be cached
+func (c *metaCache) entryValid() time.Duration {
+	c.Lock()
+	defer c.Unlock()
+	return c.ttl(c.entryTTL, entryValidTime)
+}
+
+func (c *metaCache) ttl(ttl, unwatched time.Duration) time.Duration {
+	if !c.watching && ttl > unwatched {
+		return unwatched
+	}
+	return ttl
+}
+
+// setWatching says if formicd is being watched for changes. Anything could
+// have changed while it wasn't, so the cache is emptied either way.
+func (c *metaCache) setWatching(watching bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.watching = watching
+	c.clear()
+}
+
+func (c *metaCache) clear() {
+	c.gen++
+	c.attrs = make(map[uint64]*cachedAttr)
+	c.entries = make(map[dirent]*cachedEntry)
+}
+
+// generation is passed back to putAttr and putEntry, which don't cache
+// anything if there were invalidations in between
+func (c *metaCache) generation() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.gen
+}
+
+func (c *metaCache) getAttr(inode uint64) *pb.Attr {
+	c.Lock()
+	defer c.Unlock()
+	a, ok := c.attrs[inode]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(a.expires) {
+		delete(c.attrs, inode)
+		return nil
+	}
+	return a.attr
+}
+
+func (c *metaCache) putAttr(gen uint64, attr *pb.Attr) {
+	c.Lock()
+	defer c.Unlock()
+	if gen != c.gen || attr == nil {
+		return
+	}
+	if len(c.attrs) >= maxCached {
+		c.attrs = make(map[uint64]*cachedAttr)
+	}
+	c.attrs[attr.Inode] = &cachedAttr{
+		attr:    attr,
+		expires: time.Now().Add(c.ttl(c.attrTTL, attrValidTime)),
+	}
+}
+
+// lookup returns the attributes of the entry name in parent, or nil if either
+// isn't cached
+func (c *metaCache) lookup(parent uint64, name string) *pb.Attr {
+	c.Lock()
+	e, ok := c.entries[dirent{parent, name}]
+	if ok && time.Now().After(e.expires) {
+		delete(c.entries, dirent{parent, name})
+		ok = false
+	}
+	c.Unlock()
+	if !ok {
+		return nil
+	}
+	return c.getAttr(e.inode)
+}
+
+// putEntry caches the entry name in parent along with its attributes
+func (c *metaCache) putEntry(gen, parent uint64, name string, attr *pb.Attr) {
+	c.Lock()
+	if gen != c.gen || attr == nil {
+		c.Unlock()
+		return
+	}
+	if len(c.entries) >= maxCached {
+		c.entries = make(map[dirent]*cachedEntry)
+	}
+	c.entries[dirent{parent, name}] = &cachedEntry{
+		inode:   attr.Inode,
+		expires: time.Now().Add(c.ttl(c.entryTTL, entryValidTime)),
+	}
+	c.Unlock()
+	c.putAttr(gen, attr)
+}
+
+// invalidate drops the attributes of the inode
+func (c *metaCache) invalidate(inode uint64) {
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	delete(c.attrs, inode)
+}
+
+// invalidateEntry drops the entry name in parent, and the attributes of the
+// inode it was for, as its link count and ctime change with it
+func (c *metaCache) invalidateEntry(parent uint64, name string) {
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	if e, ok := c.entries[dirent{parent, name}]; ok {
+		delete(c.attrs, e.inode)
+		delete(c.entries, dirent{parent, name})
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"sync"
+	"syscall"
 	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 
 	"golang.org/x/net/context"
@@ -17,23 +22,73 @@ import (
 )
 
 const (
+	// How long attributes and entries are cached when formicd isn't being
+	// watched for changes
 	attrValidTime  = 5 * time.Second
 	entryValidTime = 5 * time.Second
+	// How long they are cached by default when it is. The watch only tells
+	// of changes made through the same formicd, so changes made through the
+	// others are only seen once these expire, and they are kept as short.
+	defaultAttrTTL  = attrValidTime
+	defaultEntryTTL = entryValidTime
+	// How long to wait before watching again after the watch breaks
+	watchRetry = 5 * time.Second
+	// Reads and writes larger than this use the streaming rpcs
+	streamThreshold = 64 * 1024
+	// File data is cached and written back in blocks of the file system's
+	// block size, or this if formicd doesn't say, the default of formicd
+	defaultBlockSize = 64 * 1024
 )
 
 type fs struct {
 	conn    *fuse.Conn
 	rpc     *rpc
 	handles *fileHandles
+	cache   *metaCache
+	wb      *writeback
+	blocks  *blockCache
 	fsid    string
+	// Set when mounting a snapshot, which is read only
+	snapshot  string
+	opts      *fsOptions
+	blockSize int64
 }
 
-func newfs(c *fuse.Conn, r *rpc, fsid string) *fs {
+// fsOptions are the mount options that tune the client
+type fsOptions struct {
+	// How long attributes and entries are cached while watching for changes
+	attrTTL  time.Duration
+	entryTTL time.Duration
+	// The most writes kept before sending them to formicd, and for how long
+	wbMax      int64
+	wbInterval time.Duration
+	// The most file data cached, 0 turns off the cache and readahead
+	raCache int64
+}
+
+func defaultFsOptions() *fsOptions {
+	return &fsOptions{
+		attrTTL:    defaultAttrTTL,
+		entryTTL:   defaultEntryTTL,
+		wbMax:      defaultWbMax,
+		wbInterval: defaultWbInterval,
+		raCache:    defaultRaCache,
+	}
+}
+
+func newfs(c *fuse.Conn, r *rpc, fsid, snapshot string, opts *fsOptions) *fs {
 	fs := &fs{
-		conn:    c,
-		rpc:     r,
-		handles: newFileHandles(),
-		fsid:    fsid,
+		conn:     c,
+		rpc:      r,
+		handles:  newFileHandles(),
+		cache:    newMetaCache(opts.attrTTL, opts.entryTTL),
+		fsid:     fsid,
+		snapshot: snapshot,
+		opts:     opts,
+	}
+	if snapshot != "" {
+		// A snapshot never changes, so there is nothing to watch for
+		fs.cache.setWatching(true)
 	}
 	return fs
 }
@@ -111,6 +166,12 @@ func (f *fs) handle(r fuse.Request) {
 	case *fuse.StatfsRequest:
 		f.handleStatfs(r)
 
+	case *fuse.LinkRequest:
+		f.handleLink(r)
+
+	case *fuse.FsyncRequest:
+		f.handleFsync(r)
+
 		/*
 			case *fuse.InitRequest:
 				f.handleInit(r)
@@ -118,15 +179,8 @@ func (f *fs) handle(r fuse.Request) {
 			case *fuse.MknodRequest:
 				f.handleMknod(r)
 
-
-			case *fuse.LinkRequest:
-				f.handleLink(r)
-
 			case *fuse.DestroyRequest:
 				f.handleDestroy(r)
-
-			case *fuse.FsyncRequest:
-				f.handleFsync(r)
 		*/
 	}
 }
@@ -134,6 +188,11 @@ func (f *fs) handle(r fuse.Request) {
 type fileHandle struct {
 	inode     fuse.NodeID
 	readCache []byte
+	// Where the next read starts if it carries on from the last, how many
+	// blocks to read ahead and the block after the last one read ahead
+	nextRead int64
+	window   uint64
+	raEnd    uint64
 }
 
 type fileHandles struct {
@@ -189,23 +248,125 @@ func copyAttr(dst *fuse.Attr, src *pb.Attr) {
 	dst.Crtime = time.Unix(src.Crtime, 0)
 	dst.Uid = src.Uid
 	dst.Gid = src.Gid
+	dst.Nlink = src.Nlink
+	if dst.Nlink == 0 {
+		// Inodes from before links were counted
+		dst.Nlink = 1
+	}
+}
+
+// withDirty makes the size take in writes that haven't been sent yet
+func (f *fs) withDirty(dst *fuse.Attr) {
+	if end := f.wb.end(dst.Inode); end > dst.Size {
+		dst.Size = end
+	}
+}
+
+// Map the grpc error codes formicd uses to fuse errors, anything else is an EIO
+func fuseError(err error) error {
+	switch grpc.Code(err) {
+	case codes.PermissionDenied:
+		return fuse.Errno(syscall.EPERM)
+	case codes.FailedPrecondition:
+		return fuse.Errno(syscall.ENOTEMPTY)
+	case codes.NotFound:
+		return fuse.ENOENT
+	case codes.AlreadyExists:
+		return fuse.EEXIST
+	case codes.ResourceExhausted:
+		// Over the quota of the file system
+		return fuse.Errno(syscall.EDQUOT)
+	case codes.DataLoss:
+		// The data failed its checksum in formicd
+		return fuse.EIO
+	default:
+		return fuse.EIO
+	}
 }
 
-// Get a context that includes fsid
+// Get a context that includes fsid, and the snapshot if there is one
 func (f *fs) getContext() context.Context {
 	// TODO: Make timeout configurable
 	c, _ := context.WithTimeout(context.Background(), 10*time.Second)
-	c = metadata.NewContext(
-		c,
-		metadata.Pairs("fsid", f.fsid),
-	)
-	return c
+	return f.withMetadata(c)
 }
 
+func (f *fs) withMetadata(c context.Context) context.Context {
+	md := metadata.Pairs("fsid", f.fsid)
+	if f.snapshot != "" {
+		md = metadata.Pairs("fsid", f.fsid, "snapshot", f.snapshot)
+	}
+	return metadata.NewContext(c, md)
+}
+
+// Watch formicd for changes to the file system, dropping them from the cache
+// here and in the kernel. The cache falls back to the short times whenever
+// the watch is broken.
+func (f *fs) watch() {
+	if f.snapshot != "" {
+		return
+	}
+	if !f.conn.Protocol().HasInvalidate() {
+		log.Println("Kernel can't invalidate its cache, not watching for changes")
+		return
+	}
+	for {
+		err := f.watchChanges()
+		f.cache.setWatching(false)
+		log.Printf("Watch failed: %s", err)
+		time.Sleep(watchRetry)
+	}
+}
+
+func (f *fs) watchChanges() error {
+	ctx, cancel := context.WithCancel(f.withMetadata(context.Background()))
+	defer cancel()
+	stream, err := f.rpc.api.Watch(ctx, &pb.WatchRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if e.Inode == 0 {
+			// Formicd is watching now
+			f.cache.setWatching(true)
+			continue
+		}
+		if e.Name == "" {
+			f.cache.invalidate(e.Inode)
+			f.blocks.invalidate(e.Inode)
+			err = f.conn.InvalidateNode(fuse.NodeID(e.Inode), 0, -1)
+		} else {
+			f.cache.invalidateEntry(e.Inode, e.Name)
+			err = f.conn.InvalidateEntry(fuse.NodeID(e.Inode), e.Name)
+		}
+		if err != nil && err != fuse.ErrNotCached {
+			log.Printf("Invalidate failed(%d %s): %s", e.Inode, e.Name, err)
+		}
+	}
+}
+
+// InitFs sets up the file system, and the caches for its block size
 func (f *fs) InitFs() error {
 	log.Println("Inside InitFs")
 	_, err := f.rpc.api.InitFs(f.getContext(), &pb.InitFsRequest{})
-	return err
+	if err != nil {
+		return err
+	}
+	resp, err := f.rpc.api.Statfs(f.getContext(), &pb.StatfsRequest{})
+	if err != nil {
+		return err
+	}
+	f.blockSize = defaultBlockSize
+	if resp.Blocksize > 0 {
+		f.blockSize = int64(resp.Blocksize)
+	}
+	f.wb = newWriteback(f.writeThrough, f.blockSize, f.opts.wbMax, f.opts.wbInterval)
+	f.blocks = newBlockCache(f.readInto, f.blockSize, f.opts.raCache)
+	return nil
 }
 
 func (f *fs) handleGetattr(r *fuse.GetattrRequest) {
@@ -213,15 +374,21 @@ func (f *fs) handleGetattr(r *fuse.GetattrRequest) {
 	log.Println(r)
 	resp := &fuse.GetattrResponse{}
 
-	a, err := f.rpc.api.GetAttr(f.getContext(), &pb.GetAttrRequest{Inode: uint64(r.Node)})
-	if err != nil {
-		log.Printf("GetAttr fail: %s", err)
-		r.RespondError(fuse.EIO)
-		return
+	attr := f.cache.getAttr(uint64(r.Node))
+	if attr == nil {
+		gen := f.cache.generation()
+		a, err := f.rpc.api.GetAttr(f.getContext(), &pb.GetAttrRequest{Inode: uint64(r.Node)})
+		if err != nil {
+			log.Printf("GetAttr fail: %s", err)
+			r.RespondError(fuse.EIO)
+			return
+		}
+		f.cache.putAttr(gen, a.Attr)
+		attr = a.Attr
 	}
-	copyAttr(&resp.Attr, a.Attr)
-	// TODO: should we make these configurable?
-	resp.Attr.Valid = attrValidTime
+	copyAttr(&resp.Attr, attr)
+	f.withDirty(&resp.Attr)
+	resp.Attr.Valid = f.cache.attrValid()
 
 	log.Println(resp)
 	r.Respond(resp)
@@ -233,24 +400,30 @@ func (f *fs) handleLookup(r *fuse.LookupRequest) {
 	log.Println(r)
 	resp := &fuse.LookupResponse{}
 
-	l, err := f.rpc.api.Lookup(f.getContext(), &pb.LookupRequest{Name: r.Name, Parent: uint64(r.Node)})
+	attr := f.cache.lookup(uint64(r.Node), r.Name)
+	if attr == nil {
+		gen := f.cache.generation()
+		l, err := f.rpc.api.Lookup(f.getContext(), &pb.LookupRequest{Name: r.Name, Parent: uint64(r.Node)})
 
-	if err != nil {
-		log.Printf("Lookup failed(%s): %s", r.Name, err)
-		r.RespondError(fuse.EIO)
-		return
-	}
-	// If there is no name then it wasn't found
-	if l.Name != r.Name {
-		log.Printf("ENOENT Lookup(%s)", r.Name)
-		r.RespondError(fuse.ENOENT)
-		return
+		if err != nil {
+			log.Printf("Lookup failed(%s): %s", r.Name, err)
+			r.RespondError(fuse.EIO)
+			return
+		}
+		// If there is no name then it wasn't found
+		if l.Name != r.Name {
+			log.Printf("ENOENT Lookup(%s)", r.Name)
+			r.RespondError(fuse.ENOENT)
+			return
+		}
+		f.cache.putEntry(gen, uint64(r.Node), r.Name, l.Attr)
+		attr = l.Attr
 	}
-	resp.Node = fuse.NodeID(l.Attr.Inode)
-	copyAttr(&resp.Attr, l.Attr)
-	// TODO: should we make these configureable?
-	resp.Attr.Valid = attrValidTime
-	resp.EntryValid = entryValidTime
+	resp.Node = fuse.NodeID(attr.Inode)
+	copyAttr(&resp.Attr, attr)
+	f.withDirty(&resp.Attr)
+	resp.Attr.Valid = f.cache.attrValid()
+	resp.EntryValid = f.cache.entryValid()
 
 	log.Println(resp)
 	r.Respond(resp)
@@ -261,10 +434,11 @@ func (f *fs) handleMkdir(r *fuse.MkdirRequest) {
 	log.Println(r)
 	resp := &fuse.MkdirResponse{}
 
+	gen := f.cache.generation()
 	m, err := f.rpc.api.MkDir(f.getContext(), &pb.MkDirRequest{Name: r.Name, Parent: uint64(r.Node), Attr: &pb.Attr{Uid: r.Uid, Gid: r.Gid, Mode: uint32(r.Mode)}})
 	if err != nil {
 		log.Printf("Mkdir failed(%s): %s", r.Name, err)
-		r.RespondError(fuse.EIO)
+		r.RespondError(fuseError(err))
 		return
 	}
 	// If the name is empty, then the dir already exists
@@ -273,10 +447,12 @@ func (f *fs) handleMkdir(r *fuse.MkdirRequest) {
 		r.RespondError(fuse.EEXIST)
 		return
 	}
+	f.cache.putEntry(gen, uint64(r.Node), r.Name, m.Attr)
+	f.cache.invalidate(uint64(r.Node))
 	resp.Node = fuse.NodeID(m.Attr.Inode)
 	copyAttr(&resp.Attr, m.Attr)
-	resp.Attr.Valid = attrValidTime
-	resp.EntryValid = entryValidTime
+	resp.Attr.Valid = f.cache.attrValid()
+	resp.EntryValid = f.cache.entryValid()
 
 	log.Println(resp)
 	r.Respond(resp)
@@ -328,60 +504,191 @@ func (f *fs) handleRead(r *fuse.ReadRequest) {
 		fuseutil.HandleRead(r, resp, data)
 		r.Respond(resp)
 		return
+	}
+	// Reads have to see the writes that haven't been sent yet
+	if err := f.wb.flushInode(uint64(r.Node)); err != nil {
+		log.Printf("Flush before read failed: %s", err)
+		r.RespondError(fuseError(err))
+		return
+	}
+	var n int
+	var err error
+	if f.blocks.max == 0 {
+		n, err = f.readInto(uint64(r.Node), r.Offset, resp.Data)
 	} else {
-		// handle file read
-		data, err := f.rpc.api.Read(f.getContext(), &pb.ReadRequest{
-			Inode:  uint64(r.Node),
-			Offset: int64(r.Offset),
-			Size:   int64(r.Size),
-		})
+		n, err = f.readCached(r, resp.Data)
+	}
+	if err != nil {
+		log.Printf("Read on file failed: %s", err)
+		r.RespondError(fuseError(err))
+		return
+	}
+	// Short when reading past the end of the file
+	resp.Data = resp.Data[:n]
+	r.Respond(resp)
+}
+
+// readCached reads the file data from the block cache, and reads the blocks
+// after it ahead of time if the reads are sequential
+func (f *fs) readCached(r *fuse.ReadRequest, data []byte) (int, error) {
+	inode := uint64(r.Node)
+	ttl := f.cache.attrValid()
+	first := uint64(r.Offset / f.blockSize)
+	last := uint64((r.Offset + int64(len(data)) - 1) / f.blockSize)
+	blocks, err := f.blocks.get(inode, first, last-first+1, ttl)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	eof := false
+	for i, b := range blocks {
+		if skip := r.Offset - int64(first+uint64(i))*f.blockSize; skip > 0 {
+			if skip < int64(len(b)) {
+				n += copy(data[n:], b[skip:])
+			}
+		} else {
+			n += copy(data[n:], b)
+		}
+		if int64(len(b)) < f.blockSize {
+			eof = true
+			break
+		}
+	}
+	if first, count := f.handles.readahead(r.Handle, r.Offset, n, f.blockSize); count > 0 && !eof {
+		go func() {
+			if _, err := f.blocks.get(inode, first, count, ttl); err != nil {
+				log.Printf("Readahead failed: %s", err)
+			}
+		}()
+	}
+	return n, nil
+}
+
+// readInto reads the file data at offset into data, using ReadStream for
+// large reads. Returns how much was read, which is short at the end of the
+// file.
+func (f *fs) readInto(inode uint64, offset int64, data []byte) (int, error) {
+	if len(data) > streamThreshold {
+		return f.readStream(inode, offset, data)
+	}
+	resp, err := f.rpc.api.Read(f.getContext(), &pb.ReadRequest{
+		Inode:  inode,
+		Offset: offset,
+		Size:   int64(len(data)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	// The payload is short when reading past the end of the file
+	return copy(data, resp.Payload), nil
+}
+
+// Read the file data with ReadStream, copying each frame into place.
+// Returns how much data was read, which is short at the end of the file.
+func (f *fs) readStream(inode uint64, offset int64, data []byte) (int, error) {
+	stream, err := f.rpc.api.ReadStream(f.getContext(), &pb.ReadRequest{
+		Inode:  inode,
+		Offset: offset,
+		Size:   int64(len(data)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for {
+		frame, err := stream.Recv()
+		if err == io.EOF {
+			return n, nil
+		}
 		if err != nil {
-			log.Printf("Read on file failed: %s", err)
-			r.RespondError(fuse.EIO)
-			return
+			return 0, err
+		}
+		if frame.Offset < offset || frame.Offset-offset >= int64(len(data)) {
+			return 0, fmt.Errorf("Read stream frame out of range at offset %d", frame.Offset)
+		}
+		end := int(frame.Offset-offset) + copy(data[frame.Offset-offset:], frame.Payload)
+		if end > n {
+			n = end
 		}
-		copy(resp.Data, data.Payload)
-		r.Respond(resp)
 	}
 }
 
+// Write the data with WriteStream, sending it in streamThreshold sized frames
+func (f *fs) writeStream(inode uint64, offset int64, data []byte) (*pb.WriteResponse, error) {
+	stream, err := f.rpc.api.WriteStream(f.getContext())
+	if err != nil {
+		return nil, err
+	}
+	for cur := 0; cur < len(data); cur += streamThreshold {
+		end := cur + streamThreshold
+		if end > len(data) {
+			end = len(data)
+		}
+		err = stream.Send(&pb.WriteRequest{Inode: inode, Offset: offset + int64(cur), Payload: data[cur:end]})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
 func (f *fs) handleWrite(r *fuse.WriteRequest) {
 	log.Println("Inside handleWrite")
 	log.Printf("Writing %d bytes at offset %d", len(r.Data), r.Offset)
 	log.Println(r)
-	// TODO: Implement write
-	// Currently this is stupid simple and doesn't handle all the possibilities
 	resp := &fuse.WriteResponse{}
-	w, err := f.rpc.api.Write(f.getContext(), &pb.WriteRequest{Inode: uint64(r.Node), Offset: r.Offset, Payload: r.Data})
+	// Kept until there is enough to send, or the file is flushed
+	err := f.wb.writeTo(r.Handle, uint64(r.Node), r.Offset, r.Data)
 	if err != nil {
 		log.Printf("Write to file failed: %s", err)
-		r.RespondError(fuse.EIO)
+		r.RespondError(fuseError(err))
 		return
 	}
+	resp.Size = len(r.Data)
+	r.Respond(resp)
+}
+
+// writeThrough sends the data to formicd
+func (f *fs) writeThrough(inode uint64, offset int64, data []byte) error {
+	var w *pb.WriteResponse
+	var err error
+	if len(data) > streamThreshold {
+		w, err = f.writeStream(inode, offset, data)
+	} else {
+		w, err = f.rpc.api.Write(f.getContext(), &pb.WriteRequest{Inode: inode, Offset: offset, Payload: data})
+	}
+	// The size and mtime change, even if the write failed part way
+	f.cache.invalidate(inode)
+	f.blocks.invalidate(inode)
+	if err != nil {
+		return err
+	}
 	if w.Status != 0 {
 		log.Printf("Write status non zero(%d)\n", w.Status)
 	}
-	resp.Size = len(r.Data)
-	r.Respond(resp)
+	return nil
 }
 
 func (f *fs) handleCreate(r *fuse.CreateRequest) {
 	log.Println("Inside handleCreate")
 	log.Println(r)
 	resp := &fuse.CreateResponse{}
+	gen := f.cache.generation()
 	c, err := f.rpc.api.Create(f.getContext(), &pb.CreateRequest{Parent: uint64(r.Node), Name: r.Name, Attr: &pb.Attr{Uid: r.Uid, Gid: r.Gid, Mode: uint32(r.Mode)}})
 	if err != nil {
 		log.Printf("Failed to create file: %s", err)
-		r.RespondError(fuse.EIO)
+		r.RespondError(fuseError(err))
 		return
 	}
+	f.cache.putEntry(gen, uint64(r.Node), r.Name, c.Attr)
+	f.cache.invalidate(uint64(r.Node))
 	resp.Node = fuse.NodeID(c.Attr.Inode)
 	copyAttr(&resp.Attr, c.Attr)
-	resp.EntryValid = entryValidTime
-	resp.Attr.Valid = attrValidTime
+	resp.EntryValid = f.cache.entryValid()
+	resp.Attr.Valid = f.cache.attrValid()
 	copyAttr(&resp.LookupResponse.Attr, c.Attr)
-	resp.LookupResponse.EntryValid = entryValidTime
-	resp.LookupResponse.Attr.Valid = attrValidTime
+	resp.LookupResponse.EntryValid = resp.EntryValid
+	resp.LookupResponse.Attr.Valid = resp.Attr.Valid
 	r.Respond(resp)
 }
 
@@ -395,6 +702,13 @@ func (f *fs) handleSetattr(r *fuse.SetattrRequest) {
 	}
 	if r.Valid.Size() {
 		a.Size = r.Size
+		// Writes sent after the truncate would undo it
+		if err := f.wb.flushInode(uint64(r.Node)); err != nil {
+			log.Printf("Flush before setattr failed: %s", err)
+			r.RespondError(fuseError(err))
+			return
+		}
+		defer f.blocks.invalidate(uint64(r.Node))
 	}
 	if r.Valid.Mode() {
 		a.Mode = uint32(r.Mode)
@@ -414,26 +728,40 @@ func (f *fs) handleSetattr(r *fuse.SetattrRequest) {
 	if r.Valid.Gid() {
 		a.Gid = r.Gid
 	}
+	gen := f.cache.generation()
 	setAttrResp, err := f.rpc.api.SetAttr(f.getContext(), &pb.SetAttrRequest{Attr: a, Valid: uint32(r.Valid)})
 	if err != nil {
 		log.Printf("Setattr failed: %s", err)
-		r.RespondError(fuse.EIO)
+		r.RespondError(fuseError(err))
 		return
 	}
+	f.cache.putAttr(gen, setAttrResp.Attr)
 	copyAttr(&resp.Attr, setAttrResp.Attr)
-	resp.Attr.Valid = attrValidTime
+	f.withDirty(&resp.Attr)
+	resp.Attr.Valid = f.cache.attrValid()
 	log.Println(resp)
 	r.Respond(resp)
 }
 
 func (f *fs) handleFlush(r *fuse.FlushRequest) {
 	log.Println("Inside handleFlush")
+	if err := f.wb.flush(r.Handle); err != nil {
+		log.Printf("Flush failed: %s", err)
+		r.RespondError(fuseError(err))
+		return
+	}
 	r.Respond()
 }
 
 func (f *fs) handleRelease(r *fuse.ReleaseRequest) {
 	log.Println("Inside handleRelease")
+	err := f.wb.release(r.Handle)
 	f.handles.removeFileHandle(r.Handle)
+	if err != nil {
+		log.Printf("Release failed: %s", err)
+		r.RespondError(fuseError(err))
+		return
+	}
 	r.Respond()
 }
 
@@ -450,13 +778,14 @@ func (f *fs) handleForget(r *fuse.ForgetRequest) {
 }
 
 func (f *fs) handleRemove(r *fuse.RemoveRequest) {
-	// TODO: Handle dir deletions correctly
 	log.Println("Inside handleRemove")
 	log.Println(r)
 	_, err := f.rpc.api.Remove(f.getContext(), &pb.RemoveRequest{Parent: uint64(r.Node), Name: r.Name})
+	f.cache.invalidateEntry(uint64(r.Node), r.Name)
+	f.cache.invalidate(uint64(r.Node))
 	if err != nil {
 		log.Printf("Failed to delete file: %s", err)
-		r.RespondError(fuse.EIO)
+		r.RespondError(fuseError(err))
 		return
 	}
 	r.Respond()
@@ -510,16 +839,19 @@ func (f *fs) handleSymlink(r *fuse.SymlinkRequest) {
 	log.Println("Inside handleSymlink")
 	log.Println(r)
 	resp := &fuse.SymlinkResponse{}
+	gen := f.cache.generation()
 	symlink, err := f.rpc.api.Symlink(f.getContext(), &pb.SymlinkRequest{Parent: uint64(r.Node), Name: r.NewName, Target: r.Target, Uid: r.Uid, Gid: r.Gid})
 	if err != nil {
 		log.Printf("Symlink failed: %s", err)
-		r.RespondError(fuse.EIO)
+		r.RespondError(fuseError(err))
 		return
 	}
+	f.cache.putEntry(gen, uint64(r.Node), r.NewName, symlink.Attr)
+	f.cache.invalidate(uint64(r.Node))
 	resp.Node = fuse.NodeID(symlink.Attr.Inode)
 	copyAttr(&resp.Attr, symlink.Attr)
-	resp.Attr.Valid = attrValidTime
-	resp.EntryValid = entryValidTime
+	resp.Attr.Valid = f.cache.attrValid()
+	resp.EntryValid = f.cache.entryValid()
 	log.Println(resp)
 	r.Respond(resp)
 }
@@ -539,7 +871,29 @@ func (f *fs) handleReadlink(r *fuse.ReadlinkRequest) {
 
 func (f *fs) handleLink(r *fuse.LinkRequest) {
 	log.Println("Inside handleLink")
-	r.RespondError(fuse.ENOSYS)
+	log.Println(r)
+	resp := &fuse.LookupResponse{}
+	gen := f.cache.generation()
+	l, err := f.rpc.api.Link(f.getContext(), &pb.LinkRequest{Inode: uint64(r.OldNode), Parent: uint64(r.Node), Name: r.NewName})
+	if err != nil {
+		log.Printf("Link failed(%s): %s", r.NewName, err)
+		r.RespondError(fuseError(err))
+		return
+	}
+	// If the name is empty, then the name already exists
+	if l.Name != r.NewName {
+		log.Printf("EEXIST Link(%s)", r.NewName)
+		r.RespondError(fuse.EEXIST)
+		return
+	}
+	f.cache.putEntry(gen, uint64(r.Node), r.NewName, l.Attr)
+	f.cache.invalidate(uint64(r.Node))
+	resp.Node = fuse.NodeID(l.Attr.Inode)
+	copyAttr(&resp.Attr, l.Attr)
+	resp.Attr.Valid = f.cache.attrValid()
+	resp.EntryValid = f.cache.entryValid()
+	log.Println(resp)
+	r.Respond(resp)
 }
 
 func (f *fs) handleGetxattr(r *fuse.GetxattrRequest) {
@@ -631,15 +985,26 @@ func (f *fs) handleRename(r *fuse.RenameRequest) {
 	log.Println("Inside handleRename")
 	log.Println(r)
 	_, err := f.rpc.api.Rename(f.getContext(), &pb.RenameRequest{OldParent: uint64(r.Node), NewParent: uint64(r.NewDir), OldName: r.OldName, NewName: r.NewName})
+	f.cache.invalidateEntry(uint64(r.Node), r.OldName)
+	f.cache.invalidateEntry(uint64(r.NewDir), r.NewName)
+	f.cache.invalidate(uint64(r.Node))
+	f.cache.invalidate(uint64(r.NewDir))
 	if err != nil {
 		log.Printf("Rename failed: %s", err)
-		r.RespondError(fuse.EIO)
+		r.RespondError(fuseError(err))
 		return
 	}
 	r.Respond()
 }
 
+// Once formicd has the writes they are in the store, with the size updates
+// in its journal, so sending them is all there is to do
 func (f *fs) handleFsync(r *fuse.FsyncRequest) {
 	log.Println("Inside handleFsync")
-	r.RespondError(fuse.ENOSYS)
+	if err := f.wb.flushInode(uint64(r.Node)); err != nil {
+		log.Printf("Fsync failed: %s", err)
+		r.RespondError(fuseError(err))
+		return
+	}
+	r.Respond()
 }
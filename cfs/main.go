@@ -1,15 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -135,13 +139,36 @@ func main() {
 		{
 			Name:      "create",
 			Usage:     "Create a File Systems",
-			ArgsUsage: "<region>:// -N <file system name>",
+			ArgsUsage: "<region>:// -N <file system name> [-B <block size>] [-C <compression>] [-E | -D] [-R <retention>]",
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "name, N",
 					Value: "",
 					Usage: "Name of the file system",
 				},
+				cli.IntFlag{
+					Name:  "blocksize, B",
+					Value: 0,
+					Usage: "Block size of the file system in bytes (default 64K)",
+				},
+				cli.StringFlag{
+					Name:  "compression, C",
+					Value: "",
+					Usage: "Compress blocks with snappy or gzip (default none)",
+				},
+				cli.BoolFlag{
+					Name:  "encrypt, E",
+					Usage: "Encrypt the file system's data at rest",
+				},
+				cli.BoolFlag{
+					Name:  "dedup, D",
+					Usage: "Store identical blocks only once, can't be used with -E",
+				},
+				cli.StringFlag{
+					Name:  "retention, R",
+					Value: "",
+					Usage: "Keep removed files this long so they can be undeleted, like 72h (default off)",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				if !c.Args().Present() {
@@ -159,7 +186,7 @@ func main() {
 				}
 				conn := setupWS(serverAddr)
 				ws := pb.NewFileSystemAPIClient(conn)
-				result, err := ws.CreateFS(context.Background(), &pb.CreateFSRequest{Token: token, FSName: c.String("name")})
+				result, err := ws.CreateFS(context.Background(), &pb.CreateFSRequest{Token: token, FSName: c.String("name"), BlockSize: int64(c.Int("blocksize")), Compression: c.String("compression"), Encrypt: c.Bool("encrypt"), Dedup: c.Bool("dedup"), Retention: c.String("retention")})
 				if err != nil {
 					log.Fatalf("Bad Request: %v", err)
 					conn.Close()
@@ -362,10 +389,301 @@ func main() {
 				return nil
 			},
 		},
+		{
+			Name:      "rotatekeys",
+			Usage:     "Re-wrap data keys with the current master key, needs the admin token",
+			ArgsUsage: "<region>://[<file system uuid>]",
+			Action: func(c *cli.Context) error {
+				if !c.Args().Present() {
+					fmt.Println("Invalid syntax for rotatekeys.")
+					os.Exit(1)
+				}
+				if token == "" {
+					fmt.Println("Token is required")
+					os.Exit(1)
+				}
+				// Without a file system id every file system is rotated
+				serverAddr, fsNum = parseurl(c.Args().Get(0), "8445")
+				conn := setupWS(serverAddr)
+				ws := pb.NewFileSystemAPIClient(conn)
+				result, err := ws.RotateKeys(context.Background(), &pb.RotateKeysRequest{Token: token, FSid: fsNum})
+				if err != nil {
+					log.Fatalf("Bad Request: %v", err)
+					conn.Close()
+					os.Exit(1)
+				}
+				conn.Close()
+				var out bytes.Buffer
+				json.Indent(&out, []byte(result.Data), "", "  ")
+				fmt.Println(out.String())
+				return nil
+			},
+		},
+		{
+			Name:      "quota",
+			Usage:     "Set the quota of a File System, needs the admin token",
+			ArgsUsage: "<region>://<file system uuid> [-bytes <n>] [-inodes <n>] [-softbytes <n>] [-softinodes <n>] [-grace <duration>]",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "bytes",
+					Usage: "Hard limit on the bytes in the file system (default none)",
+				},
+				cli.IntFlag{
+					Name:  "inodes",
+					Usage: "Hard limit on the files and directories in the file system (default none)",
+				},
+				cli.IntFlag{
+					Name:  "softbytes",
+					Usage: "Limit on the bytes that can be gone over for the grace period (default none)",
+				},
+				cli.IntFlag{
+					Name:  "softinodes",
+					Usage: "Limit on the files and directories that can be gone over for the grace period (default none)",
+				},
+				cli.StringFlag{
+					Name:  "grace",
+					Value: "",
+					Usage: "How long the soft limits can be gone over (default 168h)",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if !c.Args().Present() {
+					fmt.Println("Invalid syntax for quota.")
+					os.Exit(1)
+				}
+				if token == "" {
+					fmt.Println("Token is required")
+					os.Exit(1)
+				}
+				serverAddr, fsNum = parseurl(c.Args().Get(0), "8445")
+				if fsNum == "" {
+					fmt.Println("Missing file system id")
+					os.Exit(1)
+				}
+				conn := setupWS(serverAddr)
+				ws := pb.NewFileSystemAPIClient(conn)
+				result, err := ws.SetQuota(context.Background(), &pb.SetQuotaRequest{
+					Token:      token,
+					FSid:       fsNum,
+					Bytes:      int64(c.Int("bytes")),
+					Inodes:     int64(c.Int("inodes")),
+					SoftBytes:  int64(c.Int("softbytes")),
+					SoftInodes: int64(c.Int("softinodes")),
+					Grace:      c.String("grace"),
+				})
+				if err != nil {
+					log.Fatalf("Bad Request: %v", err)
+					conn.Close()
+					os.Exit(1)
+				}
+				conn.Close()
+				log.Printf("Result: %s\n", result.Data)
+				return nil
+			},
+		},
+		{
+			Name:      "fsck",
+			Usage:     "Check a File System for consistency",
+			ArgsUsage: "<region>://<file system uuid> [-repair]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "repair",
+					Usage: "Make the fixes that are safe while the file system is in use",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if !c.Args().Present() {
+					fmt.Println("Invalid syntax for fsck.")
+					os.Exit(1)
+				}
+				if token == "" {
+					fmt.Println("Token is required")
+					os.Exit(1)
+				}
+				serverAddr, fsNum = parseurl(c.Args().Get(0), "8445")
+				if fsNum == "" {
+					fmt.Println("Missing file system id")
+					os.Exit(1)
+				}
+				conn := setupWS(serverAddr)
+				ws := pb.NewFileSystemAPIClient(conn)
+				result, err := ws.CheckFS(context.Background(), &pb.CheckFSRequest{Token: token, FSid: fsNum, Repair: c.Bool("repair")})
+				if err != nil {
+					log.Fatalf("Bad Request: %v", err)
+					conn.Close()
+					os.Exit(1)
+				}
+				conn.Close()
+				var out bytes.Buffer
+				json.Indent(&out, []byte(result.Data), "", "  ")
+				fmt.Println(out.String())
+				// Exit with an error if anything is left to fix
+				var report struct {
+					Problems []struct {
+						Repaired bool `json:"repaired"`
+					} `json:"problems"`
+				}
+				json.Unmarshal([]byte(result.Data), &report)
+				for _, p := range report.Problems {
+					if !p.Repaired {
+						os.Exit(1)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "snapshot",
+			Usage: "Manage the snapshots of a File System",
+			Subcommands: []cli.Command{
+				{
+					Name:      "create",
+					Usage:     "Snapshot a File System",
+					ArgsUsage: "<region>://<file system uuid> <snapshot name>",
+					Action: func(c *cli.Context) error {
+						return snapshotCmd(c, "create")
+					},
+				},
+				{
+					Name:      "list",
+					Usage:     "List the snapshots of a File System",
+					ArgsUsage: "<region>://<file system uuid>",
+					Action: func(c *cli.Context) error {
+						return snapshotCmd(c, "list")
+					},
+				},
+				{
+					Name:      "delete",
+					Usage:     "Delete a snapshot",
+					ArgsUsage: "<region>://<file system uuid> <snapshot name>",
+					Action: func(c *cli.Context) error {
+						return snapshotCmd(c, "delete")
+					},
+				},
+				{
+					Name:      "restore",
+					Usage:     "Roll a File System back to a snapshot, it should be unmounted first",
+					ArgsUsage: "<region>://<file system uuid> <snapshot name>",
+					Action: func(c *cli.Context) error {
+						return snapshotCmd(c, "restore")
+					},
+				},
+			},
+		},
+		{
+			Name:      "clone",
+			Usage:     "Make a writable copy of a File System from one of its snapshots",
+			ArgsUsage: "<region>://<file system uuid> <snapshot name> -N <clone name>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "name, N",
+					Value: "",
+					Usage: "Name of the clone, defaults to <name>@<snapshot>",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if !c.Args().Present() {
+					fmt.Println("Invalid syntax for clone.")
+					os.Exit(1)
+				}
+				if token == "" {
+					fmt.Println("Token is required")
+					os.Exit(1)
+				}
+				serverAddr, fsNum = parseurl(c.Args().Get(0), "8445")
+				if fsNum == "" {
+					fmt.Println("Missing file system id")
+					os.Exit(1)
+				}
+				snapshot := c.Args().Get(1)
+				if snapshot == "" {
+					fmt.Println("Missing snapshot name")
+					os.Exit(1)
+				}
+				conn := setupWS(serverAddr)
+				ws := pb.NewFileSystemAPIClient(conn)
+				result, err := ws.CloneFS(context.Background(), &pb.CloneFSRequest{Token: token, FSid: fsNum, Snapshot: snapshot, FSName: c.String("name")})
+				if err != nil {
+					log.Fatalf("Bad Request: %v", err)
+					conn.Close()
+					os.Exit(1)
+				}
+				conn.Close()
+				log.Printf("Result: %s\n", result.Data)
+				return nil
+			},
+		},
+		{
+			Name:      "deleted",
+			Usage:     "List removed files that can still be undeleted",
+			ArgsUsage: "<region>://<file system uuid>",
+			Action: func(c *cli.Context) error {
+				if !c.Args().Present() {
+					fmt.Println("Invalid syntax for deleted.")
+					os.Exit(1)
+				}
+				if token == "" {
+					fmt.Println("Token is required")
+					os.Exit(1)
+				}
+				serverAddr, fsNum = parseurl(c.Args().Get(0), "8445")
+				if fsNum == "" {
+					fmt.Println("Missing file system id")
+					os.Exit(1)
+				}
+				conn := setupWS(serverAddr)
+				ws := pb.NewFileSystemAPIClient(conn)
+				result, err := ws.ListDeleted(context.Background(), &pb.ListDeletedRequest{Token: token, FSid: fsNum})
+				if err != nil {
+					log.Fatalf("Bad Request: %v", err)
+					conn.Close()
+					os.Exit(1)
+				}
+				conn.Close()
+				log.Printf("Deleted: %s\n", result.Data)
+				return nil
+			},
+		},
+		{
+			Name:      "undelete",
+			Usage:     "Put back a removed file or directory",
+			ArgsUsage: "<region>://<file system uuid> <path>",
+			Action: func(c *cli.Context) error {
+				if !c.Args().Present() {
+					fmt.Println("Invalid syntax for undelete.")
+					os.Exit(1)
+				}
+				if token == "" {
+					fmt.Println("Token is required")
+					os.Exit(1)
+				}
+				serverAddr, fsNum = parseurl(c.Args().Get(0), "8445")
+				if fsNum == "" {
+					fmt.Println("Missing file system id")
+					os.Exit(1)
+				}
+				p := c.Args().Get(1)
+				if p == "" {
+					fmt.Println("Missing path")
+					os.Exit(1)
+				}
+				conn := setupWS(serverAddr)
+				ws := pb.NewFileSystemAPIClient(conn)
+				result, err := ws.Undelete(context.Background(), &pb.UndeleteRequest{Token: token, FSid: fsNum, Path: p})
+				if err != nil {
+					log.Fatalf("Bad Request: %v", err)
+					conn.Close()
+					os.Exit(1)
+				}
+				conn.Close()
+				log.Printf("Undeleted: %s\n", result.Data)
+				return nil
+			},
+		},
 		{
 			Name:      "mount",
 			Usage:     "mount a file system",
-			ArgsUsage: "<region>://<file system uuid> <mount point> -o [OPTIONS]",
+			ArgsUsage: "<region>://<file system uuid>[@<snapshot>] <mount point> -o [OPTIONS]",
 			Flags: []cli.Flag{
 				cli.StringFlag{
 					Name:  "o",
@@ -379,6 +697,11 @@ func main() {
 					os.Exit(1)
 				}
 				serverAddr, fsNum = parseurl(c.Args().Get(0), "8445")
+				// <file system uuid>@<snapshot> mounts the snapshot read only
+				snapshot := ""
+				if i := strings.Index(fsNum, "@"); i >= 0 {
+					fsNum, snapshot = fsNum[:i], fsNum[i+1:]
+				}
 				fsnum, err := uuid.FromString(fsNum)
 				if err != nil {
 					fmt.Print("File System id is not valid: ", err)
@@ -392,6 +715,7 @@ func main() {
 				fusermountPath()
 				// process file system options
 				allowOther := false
+				fsOpts := defaultFsOptions()
 				if c.String("o") != "" {
 					clargs := getArgs(c.String("o"))
 					// crapy debug log handling :)
@@ -405,6 +729,37 @@ func main() {
 						log.SetOutput(ioutil.Discard)
 					}
 					_, allowOther = clargs["allow_other"]
+					// How long to cache attributes and entries while
+					// watching for changes
+					if ttl, ok := clargs["attr_ttl"]; ok {
+						fsOpts.attrTTL = parseTTL("attr_ttl", ttl)
+					}
+					if ttl, ok := clargs["entry_ttl"]; ok {
+						fsOpts.entryTTL = parseTTL("entry_ttl", ttl)
+					}
+					// How much to write back, 0 writes everything through
+					if max, ok := clargs["wb_max"]; ok {
+						fsOpts.wbMax, err = strconv.ParseInt(max, 10, 64)
+						if err != nil || fsOpts.wbMax < 0 {
+							log.Printf("Invalid option wb_max, %s is not a size in bytes\n\n", max)
+							os.Exit(1)
+						}
+					}
+					// How much file data to cache, 0 turns off readahead
+					if max, ok := clargs["ra_cache"]; ok {
+						fsOpts.raCache, err = strconv.ParseInt(max, 10, 64)
+						if err != nil || fsOpts.raCache < 0 {
+							log.Printf("Invalid option ra_cache, %s is not a size in bytes\n\n", max)
+							os.Exit(1)
+						}
+					}
+					if interval, ok := clargs["wb_interval"]; ok {
+						fsOpts.wbInterval = parseTTL("wb_interval", interval)
+						if fsOpts.wbInterval == 0 {
+							log.Printf("Invalid option wb_interval, can't be 0\n\n")
+							os.Exit(1)
+						}
+					}
 				}
 				// Setup grpc
 				var opts []grpc.DialOption
@@ -418,45 +773,36 @@ func main() {
 				}
 				defer conn.Close()
 				// Work with fuse
-				var cfs *fuse.Conn
-				// TODO: Make setting the fuse config cleaner
+				options := []fuse.MountOption{
+					fuse.FSName("cfs"),
+					fuse.Subtype("cfs"),
+					fuse.LocalVolume(),
+					fuse.VolumeName("CFS"),
+					fuse.DefaultPermissions(),
+					fuse.MaxReadahead(128 * 1024),
+					fuse.AsyncRead(),
+					//fuse.WritebackCache(), // Waiting on concurrent chunk update fix
+					//fuse.AutoInvalData(),  // requires https://github.com/bazil/fuse/pull/137
+				}
 				if allowOther {
-					cfs, err = fuse.Mount(
-						mountpoint,
-						fuse.FSName("cfs"),
-						fuse.Subtype("cfs"),
-						fuse.LocalVolume(),
-						fuse.VolumeName("CFS"),
-						fuse.AllowOther(),
-						fuse.DefaultPermissions(),
-						fuse.MaxReadahead(128*1024),
-						fuse.AsyncRead(),
-					)
-				} else {
-					cfs, err = fuse.Mount(
-						mountpoint,
-						fuse.FSName("cfs"),
-						fuse.Subtype("cfs"),
-						fuse.LocalVolume(),
-						fuse.VolumeName("CFS"),
-						fuse.DefaultPermissions(),
-						fuse.MaxReadahead(128*1024),
-						fuse.AsyncRead(),
-						//fuse.WritebackCache(), // Waiting on concurrent chunk update fix
-						//fuse.AutoInvalData(),  // requires https://github.com/bazil/fuse/pull/137
-					)
+					options = append(options, fuse.AllowOther())
 				}
+				if snapshot != "" {
+					options = append(options, fuse.ReadOnly())
+				}
+				cfs, err := fuse.Mount(mountpoint, options...)
 				if err != nil {
 					log.Fatal(err)
 				}
 				defer cfs.Close()
 
 				rpc := newrpc(conn)
-				fs := newfs(cfs, rpc, fsnum.String())
+				fs := newfs(cfs, rpc, fsnum.String(), snapshot, fsOpts)
 				err = fs.InitFs()
 				if err != nil {
 					log.Fatal(err)
 				}
+				go fs.watch()
 				srv := newserver(fs)
 
 				if err := srv.serve(); err != nil {
@@ -474,6 +820,67 @@ func main() {
 	app.Run(os.Args)
 }
 
+// snapshotCmd runs one of the snapshot commands
+func snapshotCmd(c *cli.Context, cmd string) error {
+	if !c.Args().Present() {
+		fmt.Printf("Invalid syntax for snapshot %s.\n", cmd)
+		os.Exit(1)
+	}
+	token := c.GlobalString("token")
+	if token == "" {
+		fmt.Println("Token is required")
+		os.Exit(1)
+	}
+	serverAddr, fsNum := parseurl(c.Args().Get(0), "8445")
+	if fsNum == "" {
+		fmt.Println("Missing file system id")
+		os.Exit(1)
+	}
+	name := c.Args().Get(1)
+	if cmd != "list" && name == "" {
+		fmt.Println("Missing snapshot name")
+		os.Exit(1)
+	}
+	conn := setupWS(serverAddr)
+	defer conn.Close()
+	ws := pb.NewFileSystemAPIClient(conn)
+	var data string
+	var err error
+	switch cmd {
+	case "create":
+		var result *pb.CreateSnapshotResponse
+		result, err = ws.CreateSnapshot(context.Background(), &pb.CreateSnapshotRequest{Token: token, FSid: fsNum, Name: name})
+		if err == nil {
+			data = result.Data
+		}
+	case "list":
+		var result *pb.ListSnapshotsResponse
+		result, err = ws.ListSnapshots(context.Background(), &pb.ListSnapshotsRequest{Token: token, FSid: fsNum})
+		if err == nil {
+			data = result.Data
+		}
+	case "delete":
+		_, err = ws.DeleteSnapshot(context.Background(), &pb.DeleteSnapshotRequest{Token: token, FSid: fsNum, Name: name})
+		if err == nil {
+			fmt.Printf("Deleted snapshot %s\n", name)
+			return nil
+		}
+	case "restore":
+		var result *pb.RestoreSnapshotResponse
+		result, err = ws.RestoreSnapshot(context.Background(), &pb.RestoreSnapshotRequest{Token: token, FSid: fsNum, Name: name})
+		if err == nil {
+			data = result.Data
+		}
+	}
+	if err != nil {
+		log.Fatalf("Bad Request: %v", err)
+	}
+	var out bytes.Buffer
+	json.Indent(&out, []byte(data), "", "  ")
+	fmt.Println(out.String())
+	return nil
+}
+
 // getArgs is passed a command line and breaks it up into commands
 // the valid format is <device> <mount point> -o [Options]
 func getArgs(args string) map[string]string {
@@ -511,6 +918,16 @@ func getArgs(args string) map[string]string {
 	return clargs
 }
 
+// parseTTL parses the duration given for the mount option
+func parseTTL(option, value string) time.Duration {
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		log.Printf("Invalid option %s, %s is not a duration\n\n", option, value)
+		os.Exit(1)
+	}
+	return ttl
+}
+
 func fusermountPath() {
 	// Grab the current path
 	currentPath := os.Getenv("PATH")
@@ -553,5 +970,9 @@ func parseurl(urlstr string, port string) (string, string) {
 		fmt.Printf("Invalid region %s\n", u.Scheme)
 		os.Exit(1)
 	}
+	if u.User != nil {
+		// <file system uuid>@<snapshot>
+		return srv, u.User.Username() + "@" + u.Host
+	}
 	return srv, u.Host
 }
@@ -0,0 +1,210 @@
+package main
+
+// File data is cached in blocks, so reads that carry on from the last one on
+// the same handle can be served from blocks read ahead of them in the
+// background. The blocks of an inode are dropped when it is written here, or
+// when formicd says it changed.
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/getcfs/fuse"
+)
+
+const (
+	// How many blocks are read ahead once reads are found to be sequential,
+	// doubling up to the max as they carry on
+	raMinBlocks = 2
+	raMaxBlocks = 32
+	// Default for the most file data cached
+	defaultRaCache = 64 * 1024 * 1024
+)
+
+type blockKey struct {
+	inode uint64
+	block uint64
+}
+
+// cachedBlock is a block of a file, which is being read until ready is
+// closed. The data is short at the end of the file.
+type cachedBlock struct {
+	key     blockKey
+	data    []byte
+	err     error
+	ready   chan struct{}
+	expires time.Time
+	elem    *list.Element
+}
+
+// blockCache keeps the most recently used blocks, up to max bytes of them
+type blockCache struct {
+	sync.Mutex
+	// Reads the file data at offset into data, returning how much was read
+	read      func(inode uint64, offset int64, data []byte) (int, error)
+	blockSize int64
+	max       int64
+	size      int64
+	blocks    map[uint64]map[uint64]*cachedBlock
+	lru       *list.List
+}
+
+func newBlockCache(read func(inode uint64, offset int64, data []byte) (int, error), blockSize, max int64) *blockCache {
+	return &blockCache{
+		read:      read,
+		blockSize: blockSize,
+		max:       max,
+		blocks:    make(map[uint64]map[uint64]*cachedBlock),
+		lru:       list.New(),
+	}
+}
+
+// get returns count blocks of the inode starting at first, reading the ones
+// that aren't cached. The blocks read are kept for ttl.
+func (c *blockCache) get(inode, first, count uint64, ttl time.Duration) ([][]byte, error) {
+	entries := make([]*cachedBlock, count)
+	var missing []*cachedBlock
+	c.Lock()
+	now := time.Now()
+	blocks, ok := c.blocks[inode]
+	if !ok {
+		blocks = make(map[uint64]*cachedBlock)
+		c.blocks[inode] = blocks
+	}
+	for i := range entries {
+		block := first + uint64(i)
+		b, ok := blocks[block]
+		if ok && b.elem != nil && now.After(b.expires) {
+			c.remove(b)
+			ok = false
+		}
+		if !ok {
+			b = &cachedBlock{key: blockKey{inode, block}, ready: make(chan struct{})}
+			blocks[block] = b
+			missing = append(missing, b)
+		} else if b.elem != nil {
+			c.lru.MoveToFront(b.elem)
+		}
+		entries[i] = b
+	}
+	c.Unlock()
+	// Read each run of missing blocks at once
+	for len(missing) > 0 {
+		run := 1
+		for run < len(missing) && missing[run].key.block == missing[run-1].key.block+1 {
+			run++
+		}
+		c.fill(missing[:run], ttl)
+		missing = missing[run:]
+	}
+	data := make([][]byte, count)
+	for i, b := range entries {
+		<-b.ready
+		if b.err != nil {
+			return nil, b.err
+		}
+		data[i] = b.data
+	}
+	return data, nil
+}
+
+// fill reads the run of blocks and caches them, unless they were invalidated
+// while being read
+func (c *blockCache) fill(run []*cachedBlock, ttl time.Duration) {
+	buf := make([]byte, int64(len(run))*c.blockSize)
+	n, err := c.read(run[0].key.inode, int64(run[0].key.block)*c.blockSize, buf)
+	c.Lock()
+	expires := time.Now().Add(ttl)
+	for i, b := range run {
+		cached := c.blocks[b.key.inode][b.key.block] == b
+		if err != nil {
+			b.err = err
+			if cached {
+				delete(c.blocks[b.key.inode], b.key.block)
+			}
+			continue
+		}
+		start, end := i*int(c.blockSize), (i+1)*int(c.blockSize)
+		if end > n {
+			end = n
+		}
+		if start > end {
+			start = end
+		}
+		b.data = buf[start:end:end]
+		b.expires = expires
+		if cached {
+			b.elem = c.lru.PushFront(b)
+			c.size += int64(len(b.data))
+		}
+	}
+	for c.size > c.max && c.lru.Len() > 0 {
+		c.remove(c.lru.Back().Value.(*cachedBlock))
+	}
+	c.Unlock()
+	for _, b := range run {
+		close(b.ready)
+	}
+}
+
+func (c *blockCache) remove(b *cachedBlock) {
+	if b.elem != nil {
+		c.lru.Remove(b.elem)
+		c.size -= int64(len(b.data))
+		b.elem = nil
+	}
+	if blocks := c.blocks[b.key.inode]; blocks[b.key.block] == b {
+		delete(blocks, b.key.block)
+		if len(blocks) == 0 {
+			delete(c.blocks, b.key.inode)
+		}
+	}
+}
+
+// invalidate drops the blocks of the inode, blocks being read are still
+// handed to who is waiting for them but aren't kept
+func (c *blockCache) invalidate(inode uint64) {
+	c.Lock()
+	defer c.Unlock()
+	for _, b := range c.blocks[inode] {
+		c.remove(b)
+	}
+	delete(c.blocks, inode)
+}
+
+// readahead records a read through the handle, and returns the blocks of
+// blockSize to read ahead of it if reads have been carrying on from each other
+func (f *fileHandles) readahead(h fuse.HandleID, offset int64, size int, blockSize int64) (uint64, uint64) {
+	f.Lock()
+	defer f.Unlock()
+	fh, ok := f.handles[h]
+	if !ok || size == 0 {
+		return 0, 0
+	}
+	if offset == fh.nextRead {
+		if fh.window == 0 {
+			fh.window = raMinBlocks
+		} else if fh.window < raMaxBlocks {
+			fh.window *= 2
+		}
+	} else {
+		fh.window = 0
+		fh.raEnd = 0
+	}
+	fh.nextRead = offset + int64(size)
+	if fh.window == 0 {
+		return 0, 0
+	}
+	next := uint64((fh.nextRead-1)/blockSize) + 1
+	if fh.raEnd < next {
+		fh.raEnd = next
+	}
+	if fh.raEnd-next > fh.window/2 {
+		// Still far enough ahead
+		return 0, 0
+	}
+	first, count := fh.raEnd, next+fh.window-fh.raEnd
+	fh.raEnd = next + fh.window
+	return first, count
+}
@@ -0,0 +1,294 @@
+package main
+
+// Writes are kept per file handle and sent to formicd once there is enough of
+// them to fill whole blocks, when the file is flushed, synced or closed, or
+// when they have been kept for the flush interval. Writes next to or over
+// each other are merged first, so formicd gets a few large writes instead of
+// many small ones and doesn't have to read back partial blocks.
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getcfs/fuse"
+)
+
+const (
+	// How much a handle keeps before sending the whole blocks it has
+	wbFlushSize = 1024 * 1024
+	// Defaults for the most kept across all handles, and for how long
+	defaultWbMax      = 64 * 1024 * 1024
+	defaultWbInterval = 5 * time.Second
+)
+
+// extent is a run of data written to a file
+type extent struct {
+	offset int64
+	data   []byte
+}
+
+func (e *extent) end() int64 {
+	return e.offset + int64(len(e.data))
+}
+
+// writeBuffer is what has been written through a handle and not sent yet
+type writeBuffer struct {
+	sync.Mutex
+	inode   uint64
+	extents []*extent // In order, with none touching
+	size    int64
+	dirtied time.Time
+	// From a background flush, reported on the next flush
+	err error
+}
+
+// add merges the data into the extents, and returns how many more bytes are
+// kept
+func (b *writeBuffer) add(offset int64, data []byte) int64 {
+	n := &extent{offset: offset, data: append([]byte(nil), data...)}
+	before := b.size
+	var extents []*extent
+	for _, e := range b.extents {
+		if e.end() < n.offset || e.offset > n.end() {
+			extents = append(extents, e)
+			continue
+		}
+		b.size -= int64(len(e.data))
+		if n.offset >= e.offset && n.end() >= e.end() {
+			// Runs on from it, as sequential writes do
+			n = &extent{offset: e.offset, data: append(e.data[:n.offset-e.offset], n.data...)}
+			continue
+		}
+		// Touching, so merge them with the new data on top
+		start, end := e.offset, e.end()
+		if n.offset < start {
+			start = n.offset
+		}
+		if n.end() > end {
+			end = n.end()
+		}
+		merged := make([]byte, end-start)
+		copy(merged[e.offset-start:], e.data)
+		copy(merged[n.offset-start:], n.data)
+		n = &extent{offset: start, data: merged}
+	}
+	extents = append(extents, n)
+	sort.Sort(byOffset(extents))
+	b.extents = extents
+	b.size += int64(len(n.data))
+	if before == 0 {
+		b.dirtied = time.Now()
+	}
+	return b.size - before
+}
+
+type byOffset []*extent
+
+func (s byOffset) Len() int           { return len(s) }
+func (s byOffset) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byOffset) Less(i, j int) bool { return s[i].offset < s[j].offset }
+
+// writeback keeps the write buffers of all the handles
+type writeback struct {
+	sync.Mutex
+	// Sends the data to formicd
+	write     func(inode uint64, offset int64, data []byte) error
+	blockSize int64
+	max       int64
+	interval  time.Duration
+	dirty     int64
+	buffers   map[fuse.HandleID]*writeBuffer
+}
+
+// newWriteback returns a writeback that keeps at most max bytes, for at most
+// interval, and sends whole blocks of blockSize once it can. With a max of 0
+// everything is written through.
+func newWriteback(write func(inode uint64, offset int64, data []byte) error, blockSize, max int64, interval time.Duration) *writeback {
+	wb := &writeback{
+		write:     write,
+		blockSize: blockSize,
+		max:       max,
+		interval:  interval,
+		buffers:   make(map[fuse.HandleID]*writeBuffer),
+	}
+	if max > 0 {
+		go wb.run()
+	}
+	return wb
+}
+
+// run sends what has been kept for longer than the interval
+func (wb *writeback) run() {
+	for range time.Tick(wb.interval / 2) {
+		wb.Lock()
+		buffers := make([]*writeBuffer, 0, len(wb.buffers))
+		for _, b := range wb.buffers {
+			buffers = append(buffers, b)
+		}
+		wb.Unlock()
+		for _, b := range buffers {
+			b.Lock()
+			if b.size > 0 && time.Since(b.dirtied) >= wb.interval {
+				if err := wb.send(b, false); err != nil && b.err == nil {
+					b.err = err
+				}
+			}
+			b.Unlock()
+		}
+	}
+}
+
+func (wb *writeback) buffer(h fuse.HandleID, inode uint64) *writeBuffer {
+	wb.Lock()
+	defer wb.Unlock()
+	b, ok := wb.buffers[h]
+	if !ok {
+		b = &writeBuffer{inode: inode}
+		wb.buffers[h] = b
+	}
+	return b
+}
+
+func (wb *writeback) addDirty(n int64) int64 {
+	wb.Lock()
+	defer wb.Unlock()
+	wb.dirty += n
+	return wb.dirty
+}
+
+// writeTo keeps the data written through the handle, sending what it can once
+// there is enough
+func (wb *writeback) writeTo(h fuse.HandleID, inode uint64, offset int64, data []byte) error {
+	if wb.max == 0 {
+		return wb.write(inode, offset, data)
+	}
+	b := wb.buffer(h, inode)
+	b.Lock()
+	defer b.Unlock()
+	dirty := wb.addDirty(b.add(offset, data))
+	if dirty > wb.max {
+		// Over the limit, so this handle waits for all of its writes
+		return wb.send(b, false)
+	}
+	if b.size >= wbFlushSize {
+		return wb.send(b, true)
+	}
+	return nil
+}
+
+// send writes the extents of the buffer to formicd. If wholeBlocks is set,
+// only the whole blocks are sent and the rest is kept for later. What
+// couldn't be sent is kept as well.
+func (wb *writeback) send(b *writeBuffer, wholeBlocks bool) error {
+	var kept []*extent
+	var err error
+	sent := int64(0)
+	for i, e := range b.extents {
+		if err != nil {
+			kept = append(kept, b.extents[i:]...)
+			break
+		}
+		start, end := e.offset, e.end()
+		if wholeBlocks {
+			start = (start + wb.blockSize - 1) / wb.blockSize * wb.blockSize
+			end = end / wb.blockSize * wb.blockSize
+			if start >= end {
+				kept = append(kept, e)
+				continue
+			}
+		}
+		if err = wb.write(b.inode, start, e.data[start-e.offset:end-e.offset]); err != nil {
+			kept = append(kept, e)
+			continue
+		}
+		sent += end - start
+		if start > e.offset {
+			// Capped, so appending to it doesn't write over the rest
+			kept = append(kept, &extent{offset: e.offset, data: e.data[: start-e.offset : start-e.offset]})
+		}
+		if end < e.end() {
+			kept = append(kept, &extent{offset: end, data: e.data[end-e.offset:]})
+		}
+	}
+	b.extents = kept
+	b.size -= sent
+	b.dirtied = time.Now()
+	wb.addDirty(-sent)
+	return err
+}
+
+// flush sends everything written through the handle, and returns the first
+// error since the last flush
+func (wb *writeback) flush(h fuse.HandleID) error {
+	wb.Lock()
+	b, ok := wb.buffers[h]
+	wb.Unlock()
+	if !ok {
+		return nil
+	}
+	b.Lock()
+	defer b.Unlock()
+	err := wb.send(b, false)
+	if b.err != nil {
+		err = b.err
+		b.err = nil
+	}
+	return err
+}
+
+// flushInode flushes every handle of the inode
+func (wb *writeback) flushInode(inode uint64) error {
+	wb.Lock()
+	var handles []fuse.HandleID
+	for h, b := range wb.buffers {
+		if b.inode == inode {
+			handles = append(handles, h)
+		}
+	}
+	wb.Unlock()
+	var err error
+	for _, h := range handles {
+		if ferr := wb.flush(h); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// release flushes the handle and drops its buffer, even if the flush failed
+func (wb *writeback) release(h fuse.HandleID) error {
+	err := wb.flush(h)
+	wb.Lock()
+	b, ok := wb.buffers[h]
+	delete(wb.buffers, h)
+	wb.Unlock()
+	if ok {
+		b.Lock()
+		wb.addDirty(-b.size)
+		b.Unlock()
+	}
+	return err
+}
+
+// end returns where the last write kept for the inode ends, or 0 if there are
+// none, as the file is at least that big
+func (wb *writeback) end(inode uint64) uint64 {
+	wb.Lock()
+	var buffers []*writeBuffer
+	for _, b := range wb.buffers {
+		if b.inode == inode {
+			buffers = append(buffers, b)
+		}
+	}
+	wb.Unlock()
+	end := int64(0)
+	for _, b := range buffers {
+		b.Lock()
+		if len(b.extents) > 0 && b.extents[len(b.extents)-1].end() > end {
+			end = b.extents[len(b.extents)-1].end()
+		}
+		b.Unlock()
+	}
+	return uint64(end)
+}
@@ -3,20 +3,26 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 
 	"github.com/creiht/formic"
 	"github.com/creiht/formic/flother"
 	pb "github.com/creiht/formic/proto"
+	"github.com/getcfs/fuse"
+	"github.com/gholt/brimtime"
 	"github.com/gholt/store"
 	"github.com/satori/go.uuid"
 	"github.com/spaolacci/murmur3"
@@ -25,27 +31,52 @@ import (
 
 var ErrUnauthorized = errors.New("Unknown or unauthorized filesystem")
 
+const (
+	DefaultBlockSize = int64(1024 * 64) // Used for file systems created without a block size
+	MinBlockSize     = int64(1024 * 4)
+	MaxBlockSize     = int64(1024 * 1024 * 4)
+)
+
+// Whence values for Seek, these match lseek
+const (
+	SeekData = 3
+	SeekHole = 4
+)
+
 type apiServer struct {
 	sync.RWMutex
 	fs         FileService
 	fl         *flother.Flother
 	blocksize  int64
-	updateChan chan *UpdateItem
+	inFlight   int
+	updates    *queue
 	comms      *StoreComms
 	validIPs   map[string]map[string]bool
+	blocksizes map[string]int64
+	watch      *watchers
+	// Serializes the merges into each block through this formicd
+	blockLocks stripedLocks
 }
 
-func NewApiServer(fs FileService, nodeId int, comms *StoreComms) *apiServer {
+// NewApiServer returns an apiServer that applies size updates from the updates
+// queue in the background. If updates is nil pending updates are only kept in
+// memory.
+func NewApiServer(fs FileService, nodeId int, comms *StoreComms, updates *queue) *apiServer {
 	s := new(apiServer)
 	s.fs = fs
 	s.comms = comms
 	s.validIPs = make(map[string]map[string]bool)
+	s.blocksizes = make(map[string]int64)
+	s.watch = newWatchers()
 	log.Println("NodeID: ", nodeId)
 	s.fl = flother.NewFlother(time.Time{}, uint64(nodeId))
-	s.blocksize = int64(1024 * 64) // Default Block Size (64K)
-	s.updateChan = make(chan *UpdateItem, 1000)
-	updates := newUpdatinator(s.updateChan, fs)
-	go updates.run()
+	s.blocksize = DefaultBlockSize // Used when the file system doesn't record one
+	s.inFlight = 16                // Max blocks in flight per request
+	if updates == nil {
+		updates, _ = newQueue("")
+	}
+	s.updates = updates
+	go newUpdatinator(s.updates, fs, s.watch).run()
 	return s
 }
 
@@ -77,6 +108,12 @@ func GetFsId(ctx context.Context) (uuid.UUID, error) {
 	return u, nil
 }
 
+// withFsId returns a context that carries the fsid the same way a client
+// request does, for work that isn't started by a client.
+func withFsId(ctx context.Context, fsid uuid.UUID) context.Context {
+	return metadata.NewContext(ctx, metadata.Pairs("fsid", fsid.String()))
+}
+
 func (s *apiServer) validateIP(ctx context.Context) error {
 	if s.comms == nil {
 		// TODO: Fix abstraction so that we don't have to do this for tests
@@ -106,7 +143,7 @@ func (s *apiServer) validateIP(ctx context.Context) error {
 	if ok && valid {
 		return nil
 	}
-	_, err = s.comms.ReadGroupItem(ctx, []byte(fmt.Sprintf("/fs/%s/addr", fsid)), []byte(ip))
+	_, err = s.comms.ReadGroupItem(unversioned(ctx), []byte(fmt.Sprintf("/fs/%s/addr", fsid)), []byte(ip))
 	if store.IsNotFound(err) {
 		log.Println("Invalid IP: ", ip)
 		// No access
@@ -130,6 +167,9 @@ func (s *apiServer) GetAttr(ctx context.Context, r *pb.GetAttrRequest) (*pb.GetA
 		return nil, err
 	}
 	attr, err := s.fs.GetAttr(ctx, formic.GetID(fsid.Bytes(), r.Inode, 0))
+	if err == ErrChecksumMismatch {
+		return nil, errf(codes.DataLoss, "Inode %d is corrupt", r.Inode)
+	}
 	return &pb.GetAttrResponse{Attr: attr}, err
 }
 
@@ -142,7 +182,21 @@ func (s *apiServer) SetAttr(ctx context.Context, r *pb.SetAttrRequest) (*pb.SetA
 	if err != nil {
 		return nil, err
 	}
+	if fuse.SetattrValid(r.Valid).Size() {
+		// Growing the file counts against the quota, like writing past its end
+		_, filesize, err := s.getFileInfo(ctx, fsid, r.Attr.Inode)
+		if err != nil {
+			return nil, err
+		}
+		err = s.checkQuota(ctx, growth(int64(r.Attr.Size), filesize), 0)
+		if err != nil {
+			return nil, err
+		}
+	}
 	attr, err := s.fs.SetAttr(ctx, formic.GetID(fsid.Bytes(), r.Attr.Inode, 0), r.Attr, r.Valid)
+	if err == nil {
+		s.watch.notify(fsid, r.Attr.Inode, "")
+	}
 	return &pb.SetAttrResponse{Attr: attr}, err
 }
 
@@ -155,6 +209,10 @@ func (s *apiServer) Create(ctx context.Context, r *pb.CreateRequest) (*pb.Create
 	if err != nil {
 		return nil, err
 	}
+	err = s.checkQuota(ctx, 0, 1)
+	if err != nil {
+		return nil, err
+	}
 	ts := time.Now().Unix()
 	inode := s.fl.GetID()
 	attr := &pb.Attr{
@@ -166,11 +224,13 @@ func (s *apiServer) Create(ctx context.Context, r *pb.CreateRequest) (*pb.Create
 		Mode:   r.Attr.Mode,
 		Uid:    r.Attr.Uid,
 		Gid:    r.Attr.Gid,
+		Nlink:  1,
 	}
 	rname, rattr, err := s.fs.Create(ctx, formic.GetID(fsid.Bytes(), r.Parent, 0), formic.GetID(fsid.Bytes(), inode, 0), inode, r.Name, attr, false)
 	if err != nil {
 		return nil, err
 	}
+	s.notifyEntry(fsid, r.Parent, rname)
 	return &pb.CreateResponse{Name: rname, Attr: rattr}, err
 }
 
@@ -183,6 +243,10 @@ func (s *apiServer) MkDir(ctx context.Context, r *pb.MkDirRequest) (*pb.MkDirRes
 	if err != nil {
 		return nil, err
 	}
+	err = s.checkQuota(ctx, 0, 1)
+	if err != nil {
+		return nil, err
+	}
 	ts := time.Now().Unix()
 	inode := s.fl.GetID()
 	attr := &pb.Attr{
@@ -194,8 +258,12 @@ func (s *apiServer) MkDir(ctx context.Context, r *pb.MkDirRequest) (*pb.MkDirRes
 		Mode:   uint32(os.ModeDir) | r.Attr.Mode,
 		Uid:    r.Attr.Uid,
 		Gid:    r.Attr.Gid,
+		Nlink:  1,
 	}
 	rname, rattr, err := s.fs.Create(ctx, formic.GetID(fsid.Bytes(), r.Parent, 0), formic.GetID(fsid.Bytes(), inode, 0), inode, r.Name, attr, true)
+	if err == nil {
+		s.notifyEntry(fsid, r.Parent, rname)
+	}
 	return &pb.MkDirResponse{Name: rname, Attr: rattr}, err
 }
 
@@ -209,37 +277,196 @@ func (s *apiServer) Read(ctx context.Context, r *pb.ReadRequest) (*pb.ReadRespon
 		return nil, err
 	}
 	log.Printf("READ: Inode: %d Offset: %d Size: %d", r.Inode, r.Offset, r.Size)
-	block := uint64(r.Offset / s.blocksize)
-	data := make([]byte, r.Size)
-	firstOffset := int64(0)
-	if r.Offset%s.blocksize != 0 {
-		// Handle non-aligned offset
-		firstOffset = r.Offset - int64(block)*s.blocksize
+	blocksize, filesize, err := s.getFileInfo(ctx, fsid, r.Inode)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.readRange(ctx, fsid.Bytes(), r.Inode, blocksize, filesize, r.Offset, r.Size)
+	if err != nil {
+		return nil, err
+	}
+	f := &pb.ReadResponse{Inode: r.Inode, Payload: data}
+	return f, nil
+}
+
+// readRange reads size bytes at offset, stopping at the end of the file. Holes
+// in the file read as zeros. If filesize is < 0 the size isn't known, and the
+// first missing or short block is taken as the end of the data.
+func (s *apiServer) readRange(ctx context.Context, fsid []byte, inode uint64, blocksize, filesize, offset, size int64) ([]byte, error) {
+	if filesize >= 0 {
+		if offset >= filesize {
+			return []byte{}, nil
+		}
+		if offset+size > filesize {
+			size = filesize - offset
+		}
+	}
+	block, firstOffset := blockOffset(offset, blocksize)
+	count := uint64((firstOffset + size + blocksize - 1) / blocksize)
+	chunks, errs := s.getBlocks(ctx, fsid, inode, block, count)
+	data := make([]byte, size)
+	cur := int64(0)
+	for i, chunk := range chunks {
+		if errs[i] == ErrChecksumMismatch {
+			return nil, errf(codes.DataLoss, "Block %d of inode %d is corrupt", block+uint64(i), inode)
+		}
+		if errs[i] != nil && errs[i] != ErrNotFound {
+			log.Print("Err: Failed to read block: ", errs[i])
+			return nil, fmt.Errorf("Read failed on block %d of inode %d: %s", block+uint64(i), inode, errs[i])
+		}
+		if filesize < 0 && int64(len(chunk)) <= firstOffset {
+			return data[:cur], nil
+		}
+		// Missing blocks and the unwritten end of a block are holes, and stay zeros
+		if int64(len(chunk)) > firstOffset {
+			copy(data[cur:], chunk[firstOffset:])
+		}
+		if filesize < 0 && int64(len(chunk)) < blocksize {
+			return data[:min(size, cur+int64(len(chunk))-firstOffset)], nil
+		}
+		cur += blocksize - firstOffset
+		firstOffset = 0
+	}
+	return data, nil
+}
+
+// getBlocks fetches count blocks of the inode starting at block, with at most
+// s.inFlight fetches running at once. The results are in block order.
+func (s *apiServer) getBlocks(ctx context.Context, fsid []byte, inode, block, count uint64) ([][]byte, []error) {
+	chunks := make([][]byte, count)
+	errs := make([]error, count)
+	sem := make(chan struct{}, s.inFlight)
+	wg := &sync.WaitGroup{}
+	for i := uint64(0); i < count; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i uint64) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			chunks[i], errs[i] = s.fs.GetBlock(ctx, fsid, inode, block+i)
+		}(i)
+	}
+	wg.Wait()
+	return chunks, errs
+}
+
+// hasBlocks looks up whether count blocks from block exist, without reading
+// them, at most s.inFlight at once
+func (s *apiServer) hasBlocks(ctx context.Context, fsid []byte, inode, block, count uint64) ([]bool, []error) {
+	found := make([]bool, count)
+	errs := make([]error, count)
+	sem := make(chan struct{}, s.inFlight)
+	wg := &sync.WaitGroup{}
+	for i := uint64(0); i < count; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i uint64) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			found[i], errs[i] = s.fs.HasBlock(ctx, fsid, inode, block+i)
+		}(i)
+	}
+	wg.Wait()
+	return found, errs
+}
+
+// ReadStream sends the requested range back as a series of block sized frames
+// so that large reads don't have to be buffered in a single message.
+func (s *apiServer) ReadStream(r *pb.ReadRequest, stream pb.Api_ReadStreamServer) error {
+	ctx := stream.Context()
+	err := s.validateIP(ctx)
+	if err != nil {
+		return err
+	}
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("READSTREAM: Inode: %d Offset: %d Size: %d", r.Inode, r.Offset, r.Size)
+	blocksize, filesize, err := s.getFileInfo(ctx, fsid, r.Inode)
+	if err != nil {
+		return err
 	}
+	// Read s.inFlight blocks at a time, and send them back a block at a time
+	window := blocksize * int64(s.inFlight)
 	cur := int64(0)
 	for cur < r.Size {
-		id := formic.GetID(fsid.Bytes(), r.Inode, block+1) // block 0 is for inode data
-		chunk, err := s.fs.GetChunk(ctx, id)
+		want := min(window, r.Size-cur)
+		data, err := s.readRange(ctx, fsid.Bytes(), r.Inode, blocksize, filesize, r.Offset+cur, want)
 		if err != nil {
-			log.Print("Err: Failed to read block: ", err)
-			// NOTE: This returns basically 0's to the client.for this block in this case
-			//       It is totally valid for a fs to request an invalid block
-			// TODO: Do we need to differentiate between real errors and bad requests?
-			return &pb.ReadResponse{}, nil
+			return err
 		}
-		if len(chunk) == 0 {
-			break
+		for sent := int64(0); sent < int64(len(data)); {
+			_, firstOffset := blockOffset(r.Offset+cur, blocksize)
+			payload := data[sent:min(int64(len(data)), sent+blocksize-firstOffset)]
+			err = stream.Send(&pb.ReadResponse{Inode: r.Inode, Offset: r.Offset + cur, Payload: payload})
+			if err != nil {
+				return err
+			}
+			sent += int64(len(payload))
+			cur += int64(len(payload))
 		}
-		count := copy(data[cur:], chunk[firstOffset:])
-		firstOffset = 0
-		block += 1
-		cur += int64(count)
-		if int64(len(chunk)) < s.blocksize {
+		if int64(len(data)) < want {
+			// End of the file
 			break
 		}
 	}
-	f := &pb.ReadResponse{Inode: r.Inode, Payload: data}
-	return f, nil
+	return nil
+}
+
+// Seek finds the first data or hole at or after the offset, like lseek with
+// SEEK_DATA or SEEK_HOLE. The end of the file counts as a hole.
+func (s *apiServer) Seek(ctx context.Context, r *pb.SeekRequest) (*pb.SeekResponse, error) {
+	err := s.validateIP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if r.Whence != SeekData && r.Whence != SeekHole {
+		return nil, errf(codes.InvalidArgument, "Unsupported whence %d", r.Whence)
+	}
+	blocksize, filesize, err := s.getFileInfo(ctx, fsid, r.Inode)
+	if err != nil {
+		return nil, err
+	}
+	if filesize < 0 {
+		return nil, errf(codes.NotFound, "Inode %d not found", r.Inode)
+	}
+	if r.Offset < 0 || r.Offset >= filesize {
+		// Same as ENXIO from lseek
+		return nil, errf(codes.OutOfRange, "Offset %d is past the end of the file", r.Offset)
+	}
+	block, _ := blockOffset(r.Offset, blocksize)
+	blocks := uint64((filesize + blocksize - 1) / blocksize)
+	for block < blocks {
+		count := uint64(min(int64(s.inFlight), int64(blocks-block)))
+		found, errs := s.hasBlocks(ctx, fsid.Bytes(), r.Inode, block, count)
+		for i, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+			hole := !found[i]
+			if (r.Whence == SeekData && !hole) || (r.Whence == SeekHole && hole) {
+				offset := int64(block+uint64(i)) * blocksize
+				if offset < r.Offset {
+					offset = r.Offset
+				}
+				return &pb.SeekResponse{Offset: offset}, nil
+			}
+		}
+		block += count
+	}
+	if r.Whence == SeekHole {
+		return &pb.SeekResponse{Offset: filesize}, nil
+	}
+	return nil, errf(codes.OutOfRange, "No data after offset %d", r.Offset)
 }
 
 func min(a, b int64) int64 {
@@ -259,55 +486,247 @@ func (s *apiServer) Write(ctx context.Context, r *pb.WriteRequest) (*pb.WriteRes
 	if err != nil {
 		return nil, err
 	}
+	err = s.writeBlocks(ctx, fsid, r)
+	if err != nil {
+		return &pb.WriteResponse{Status: 1}, err
+	}
+	s.watch.notify(fsid, r.Inode, "")
+	return &pb.WriteResponse{Status: 0}, nil
+}
+
+// WriteStream accepts a series of write frames, each with its own offset, and
+// writes them in order. The response is sent once the client closes the stream.
+func (s *apiServer) WriteStream(stream pb.Api_WriteStreamServer) error {
+	ctx := stream.Context()
+	err := s.validateIP(ctx)
+	if err != nil {
+		return err
+	}
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.WriteResponse{Status: 0})
+		}
+		if err != nil {
+			return err
+		}
+		err = s.writeBlocks(ctx, fsid, r)
+		if err != nil {
+			return err
+		}
+		s.watch.notify(fsid, r.Inode, "")
+	}
+}
+
+// blockOffset returns the block that contains offset, and where in that block
+// the offset falls.
+func blockOffset(offset, blocksize int64) (uint64, int64) {
+	block := uint64(offset / blocksize)
+	return block, offset - int64(block)*blocksize
+}
+
+// growth returns how much a file of filesize grows by when it reaches end. A
+// filesize < 0 isn't known, and is taken as empty.
+func growth(end, filesize int64) int64 {
+	if filesize < 0 {
+		filesize = 0
+	}
+	if end < filesize {
+		return 0
+	}
+	return end - filesize
+}
+
+// getFileInfo returns the block size to use for the inode and the size of the
+// file, or -1 if the size isn't known. Files keep the block size they were
+// first written with, otherwise the file system's block size is used.
+func (s *apiServer) getFileInfo(ctx context.Context, fsid uuid.UUID, inode uint64) (int64, int64, error) {
+	n, err := s.fs.GetInode(ctx, formic.GetID(fsid.Bytes(), inode, 0))
+	if err == ErrChecksumMismatch {
+		return 0, 0, errf(codes.DataLoss, "Inode %d is corrupt", inode)
+	}
+	if err != nil && err != ErrNotFound {
+		return 0, 0, err
+	}
+	filesize := int64(-1)
+	if n != nil && n.Attr != nil {
+		filesize = int64(n.Attr.Size)
+	}
+	if n != nil && n.BlockSize > 0 {
+		return int64(n.BlockSize), filesize, nil
+	}
+	blocksize, err := s.fsBlocksize(ctx, fsid.String())
+	return blocksize, filesize, err
+}
+
+// fsBlocksize returns the block size recorded for the file system when it was
+// created. File systems created before that was recorded use the default.
+func (s *apiServer) fsBlocksize(ctx context.Context, fsid string) (int64, error) {
+	if s.comms == nil {
+		// Assume that it is a unit test
+		return s.blocksize, nil
+	}
+	// First check the cache
+	s.RLock()
+	blocksize, ok := s.blocksizes[fsid]
+	s.RUnlock()
+	if ok {
+		return blocksize, nil
+	}
+	b, err := s.comms.ReadGroupItem(unversioned(ctx), []byte(fmt.Sprintf("/fs/%s", fsid)), []byte("blocksize"))
+	if store.IsNotFound(err) {
+		blocksize = s.blocksize
+	} else if err != nil {
+		return 0, err
+	} else {
+		attr := FileSysAttr{}
+		err = json.Unmarshal(b, &attr)
+		if err != nil {
+			return 0, err
+		}
+		blocksize, err = strconv.ParseInt(attr.Value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	s.Lock()
+	s.blocksizes[fsid] = blocksize
+	s.Unlock()
+	return blocksize, nil
+}
+
+// writeBlocks splits the write up into blocks and stores them, with at most
+// s.inFlight blocks being written at once.
+func (s *apiServer) writeBlocks(ctx context.Context, fsid uuid.UUID, r *pb.WriteRequest) error {
 	log.Printf("WRITE: Inode %d Offset: %d Size: %d", r.Inode, r.Offset, len(r.Payload))
-	block := uint64(r.Offset / s.blocksize)
-	firstOffset := int64(0)
-	if r.Offset%s.blocksize != 0 {
-		// Handle non-aligned offset
-		firstOffset = r.Offset - int64(block)*s.blocksize
+	blocksize, filesize, err := s.getFileInfo(ctx, fsid, r.Inode)
+	if err != nil {
+		return err
+	}
+	// Only what grows the file counts against the quota
+	err = s.checkQuota(ctx, growth(r.Offset+int64(len(r.Payload)), filesize), 0)
+	if err != nil {
+		return err
 	}
+	// Taken before any block is written, so a truncate while this is writing
+	// makes its updates stale
+	written := brimtime.TimeToUnixMicro(time.Now())
+	block, firstOffset := blockOffset(r.Offset, blocksize)
+	sem := make(chan struct{}, s.inFlight)
+	wg := &sync.WaitGroup{}
+	errLock := &sync.Mutex{}
+	failed := 0
+	var firstErr error
+	var firstErrBlock uint64
 	cur := int64(0)
 	for cur < int64(len(r.Payload)) {
-		sendSize := min(s.blocksize, int64(len(r.Payload))-cur)
-		if sendSize+firstOffset > s.blocksize {
-			sendSize = s.blocksize - firstOffset
+		sendSize := min(blocksize, int64(len(r.Payload))-cur)
+		if sendSize+firstOffset > blocksize {
+			sendSize = blocksize - firstOffset
 		}
-		payload := r.Payload[cur : cur+sendSize]
-		id := formic.GetID(fsid.Bytes(), r.Inode, block+1) // 0 block is for inode data
-		if firstOffset > 0 || sendSize < s.blocksize {
-			// need to get the block and update
-			chunk := make([]byte, firstOffset+int64(len(payload)))
-			data, err := s.fs.GetChunk(ctx, id)
-			if firstOffset > 0 && err != nil {
-				// TODO: How do we differentiate a block that hasn't been created yet, and a block that is truely missing?
-				log.Printf("WARN: couldn't get block id %d", id)
-			} else {
-				if len(data) > len(chunk) {
-					chunk = data
-				} else {
-					copy(chunk, data)
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(block uint64, firstOffset int64, payload []byte) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := s.writeBlock(ctx, fsid.Bytes(), r.Inode, block, blocksize, firstOffset, payload, written)
+			if err != nil {
+				log.Printf("Err: Failed to write block %d: %s", block, err)
+				errLock.Lock()
+				failed += 1
+				if firstErr == nil || block < firstErrBlock {
+					firstErr = err
+					firstErrBlock = block
 				}
+				errLock.Unlock()
 			}
-			copy(chunk[firstOffset:], payload)
-			payload = chunk
-			firstOffset = 0
-		}
-		err := s.fs.WriteChunk(ctx, id, payload)
-		// TODO: Need better error handling for failing with multiple chunks
-		if err != nil {
-			return &pb.WriteResponse{Status: 1}, err
-		}
-		s.updateChan <- &UpdateItem{
-			id:        formic.GetID(fsid.Bytes(), r.Inode, 0),
-			block:     block,
-			blocksize: uint64(s.blocksize),
-			size:      uint64(len(payload)),
-			mtime:     time.Now().Unix(),
-		}
+		}(block, firstOffset, r.Payload[cur:cur+sendSize])
+		firstOffset = 0
 		cur += sendSize
 		block += 1
 	}
-	return &pb.WriteResponse{Status: 0}, nil
+	wg.Wait()
+	if firstErr == ErrChecksumMismatch {
+		return errf(codes.DataLoss, "Block %d of inode %d is corrupt", firstErrBlock, r.Inode)
+	}
+	if firstErr == ErrConflict {
+		return errf(codes.Aborted, "Block %d of inode %d kept changing while being written", firstErrBlock, r.Inode)
+	}
+	if firstErr != nil {
+		return fmt.Errorf("Write failed on %d block(s) of inode %d starting at block %d: %s", failed, r.Inode, firstErrBlock, firstErr)
+	}
+	end := r.Offset + int64(len(r.Payload))
+	if filesize >= 0 && end > filesize {
+		// Reads stop at the size of the file, so it is grown before returning
+		// rather than waiting for the queued updates. Without an inode reads
+		// don't know the size anyway.
+		last, lastOffset := blockOffset(end-1, blocksize)
+		return s.fs.Update(ctx, formic.GetID(fsid.Bytes(), r.Inode, 0), last, uint64(blocksize), uint64(lastOffset+1), time.Now().Unix(), written)
+	}
+	return nil
+}
+
+// writeBlock stores a single block, merging the payload into the existing
+// block if it doesn't cover the whole thing. written is when the write
+// started, timestamp micro.
+func (s *apiServer) writeBlock(ctx context.Context, fsid []byte, inode, block uint64, blocksize, firstOffset int64, payload []byte, written int64) error {
+	var err error
+	if firstOffset > 0 || int64(len(payload)) < blocksize {
+		payload, err = s.mergeBlock(ctx, fsid, inode, block, firstOffset, payload)
+	} else {
+		err = s.fs.WriteBlock(ctx, fsid, inode, block, payload)
+	}
+	if err != nil {
+		return err
+	}
+	return s.updates.push(&UpdateItem{
+		fsid:      fsid,
+		id:        formic.GetID(fsid, inode, 0),
+		block:     block,
+		blocksize: uint64(blocksize),
+		size:      uint64(len(payload)),
+		mtime:     time.Now().Unix(),
+		inode:     inode,
+		written:   written,
+	})
+}
+
+// mergeBlock writes the payload into the block at firstOffset, keeping the
+// rest of what is in the block, and returns the whole block as written. Only
+// one merge into a block is done at a time, so writes to different parts of
+// the same block don't lose each other.
+func (s *apiServer) mergeBlock(ctx context.Context, fsid []byte, inode, block uint64, firstOffset int64, payload []byte) ([]byte, error) {
+	id := formic.GetID(fsid, inode, block+1) // 0 block is for inode data
+	defer s.blockLocks.lock(id).Unlock()
+	var chunk []byte
+	err := optimistically(ctx, s.fs, id, func(check func() error) error {
+		chunk = make([]byte, firstOffset+int64(len(payload)))
+		// A cached copy could be older than the timestamp being checked
+		data, err := s.fs.GetBlock(uncached(ctx), fsid, inode, block)
+		if err != nil && err != ErrNotFound {
+			// Only a hole starts out as zeros, anything else would write over
+			// what is left of the block
+			return err
+		}
+		if len(data) > len(chunk) {
+			chunk = data
+		} else {
+			copy(chunk, data)
+		}
+		copy(chunk[firstOffset:], payload)
+		err = check()
+		if err != nil {
+			return err
+		}
+		return s.fs.WriteBlock(ctx, fsid, inode, block, chunk)
+	})
+	return chunk, err
 }
 
 func (s *apiServer) Lookup(ctx context.Context, r *pb.LookupRequest) (*pb.LookupResponse, error) {
@@ -345,6 +764,12 @@ func (s *apiServer) Remove(ctx context.Context, r *pb.RemoveRequest) (*pb.Remove
 		return nil, err
 	}
 	status, err := s.fs.Remove(ctx, formic.GetID(fsid.Bytes(), r.Parent, 0), r.Name)
+	if err == ErrNotEmpty {
+		return nil, errf(codes.FailedPrecondition, "Directory not empty")
+	}
+	if err == nil {
+		s.notifyEntry(fsid, r.Parent, r.Name)
+	}
 	return &pb.RemoveResponse{Status: status}, err
 }
 
@@ -357,6 +782,10 @@ func (s *apiServer) Symlink(ctx context.Context, r *pb.SymlinkRequest) (*pb.Syml
 	if err != nil {
 		return nil, err
 	}
+	err = s.checkQuota(ctx, int64(len(r.Target)), 1)
+	if err != nil {
+		return nil, err
+	}
 	ts := time.Now().Unix()
 	inode := s.fl.GetID()
 	attr := &pb.Attr{
@@ -369,8 +798,34 @@ func (s *apiServer) Symlink(ctx context.Context, r *pb.SymlinkRequest) (*pb.Syml
 		Size:   uint64(len(r.Target)),
 		Uid:    r.Uid,
 		Gid:    r.Gid,
+		Nlink:  1,
+	}
+	resp, err := s.fs.Symlink(ctx, formic.GetID(fsid.Bytes(), r.Parent, 0), formic.GetID(fsid.Bytes(), inode, 0), r.Name, r.Target, attr, inode)
+	if err == nil {
+		s.notifyEntry(fsid, r.Parent, r.Name)
+	}
+	return resp, err
+}
+
+func (s *apiServer) Link(ctx context.Context, r *pb.LinkRequest) (*pb.LinkResponse, error) {
+	err := s.validateIP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name, attr, err := s.fs.Link(ctx, formic.GetID(fsid.Bytes(), r.Parent, 0), formic.GetID(fsid.Bytes(), r.Inode, 0), r.Name)
+	if err == ErrIsDir {
+		return nil, errf(codes.PermissionDenied, "Can't link to a directory")
 	}
-	return s.fs.Symlink(ctx, formic.GetID(fsid.Bytes(), r.Parent, 0), formic.GetID(fsid.Bytes(), inode, 0), r.Name, r.Target, attr, inode)
+	if err == nil {
+		s.notifyEntry(fsid, r.Parent, name)
+		// The link count went up
+		s.watch.notify(fsid, r.Inode, "")
+	}
+	return &pb.LinkResponse{Name: name, Attr: attr}, err
 }
 
 func (s *apiServer) Readlink(ctx context.Context, r *pb.ReadlinkRequest) (*pb.ReadlinkResponse, error) {
@@ -406,7 +861,11 @@ func (s *apiServer) Setxattr(ctx context.Context, r *pb.SetxattrRequest) (*pb.Se
 	if err != nil {
 		return nil, err
 	}
-	return s.fs.Setxattr(ctx, formic.GetID(fsid.Bytes(), r.Inode, 0), r.Name, r.Value)
+	resp, err := s.fs.Setxattr(ctx, formic.GetID(fsid.Bytes(), r.Inode, 0), r.Name, r.Value)
+	if err == nil {
+		s.watch.notify(fsid, r.Inode, "")
+	}
+	return resp, err
 }
 
 func (s *apiServer) Listxattr(ctx context.Context, r *pb.ListxattrRequest) (*pb.ListxattrResponse, error) {
@@ -430,7 +889,11 @@ func (s *apiServer) Removexattr(ctx context.Context, r *pb.RemovexattrRequest) (
 	if err != nil {
 		return nil, err
 	}
-	return s.fs.Removexattr(ctx, formic.GetID(fsid.Bytes(), r.Inode, 0), r.Name)
+	resp, err := s.fs.Removexattr(ctx, formic.GetID(fsid.Bytes(), r.Inode, 0), r.Name)
+	if err == nil {
+		s.watch.notify(fsid, r.Inode, "")
+	}
+	return resp, err
 }
 
 func (s *apiServer) Rename(ctx context.Context, r *pb.RenameRequest) (*pb.RenameResponse, error) {
@@ -442,7 +905,23 @@ func (s *apiServer) Rename(ctx context.Context, r *pb.RenameRequest) (*pb.Rename
 	if err != nil {
 		return nil, err
 	}
-	return s.fs.Rename(ctx, formic.GetID(fsid.Bytes(), r.OldParent, 0), formic.GetID(fsid.Bytes(), r.NewParent, 0), r.OldName, r.NewName)
+	if r.Flags&^(RenameNoReplace|RenameExchange) != 0 || r.Flags == RenameNoReplace|RenameExchange {
+		return nil, errf(codes.InvalidArgument, "Invalid rename flags %d", r.Flags)
+	}
+	resp, err := s.fs.Rename(ctx, formic.GetID(fsid.Bytes(), r.OldParent, 0), formic.GetID(fsid.Bytes(), r.NewParent, 0), r.OldName, r.NewName, r.Flags)
+	switch err {
+	case ErrNotFound:
+		return nil, errf(codes.NotFound, "%s not found", r.OldName)
+	case ErrExists:
+		return nil, errf(codes.AlreadyExists, "%s already exists", r.NewName)
+	case ErrNotEmpty:
+		return nil, errf(codes.FailedPrecondition, "Directory not empty")
+	}
+	if err == nil {
+		s.notifyEntry(fsid, r.OldParent, r.OldName)
+		s.notifyEntry(fsid, r.NewParent, r.NewName)
+	}
+	return resp, err
 }
 
 func (s *apiServer) Statfs(ctx context.Context, r *pb.StatfsRequest) (*pb.StatfsResponse, error) {
@@ -460,9 +939,102 @@ func (s *apiServer) Statfs(ctx context.Context, r *pb.StatfsRequest) (*pb.Statfs
 		Namelen: 256,
 		Frsize:  4096, // this should probably match Bsize so we don't allow fragmented blocks
 	}
+	if fsid, err := GetFsId(ctx); err == nil {
+		// Clients line their writes up with the blocks
+		blocksize, err := s.fsBlocksize(ctx, fsid.String())
+		if err != nil {
+			return nil, err
+		}
+		resp.Blocksize = uint32(blocksize)
+	}
+	q, u, err := s.fs.GetQuota(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if q == nil {
+		u, err = s.fs.GetUsage(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The quota is the size of the file system as far as the tenant can tell
+	frsize := int64(resp.Frsize)
+	if bytes := q.limitBytes(); bytes > 0 {
+		resp.Blocks = uint64(bytes / frsize)
+	}
+	if inodes := q.limitInodes(); inodes > 0 {
+		resp.Files = uint64(inodes)
+	}
+	// Counts can be off until the next scan, but never below nothing
+	used := (u.Bytes + frsize - 1) / frsize
+	resp.Bfree = subFloor(resp.Blocks, used)
+	resp.Bavail = resp.Bfree
+	resp.Ffree = subFloor(resp.Files, u.Inodes)
 	return resp, nil
 }
 
+// subFloor returns total less used, or 0 if used is more than total
+func subFloor(total uint64, used int64) uint64 {
+	if used <= 0 {
+		return total
+	}
+	if uint64(used) > total {
+		return 0
+	}
+	return total - uint64(used)
+}
+
+// checkQuota returns an error ready to send to the client if adding bytes and
+// inodes would go over the quota of the file system
+func (s *apiServer) checkQuota(ctx context.Context, bytes, inodes int64) error {
+	err := s.fs.CheckQuota(ctx, bytes, inodes)
+	if err == ErrQuotaExceeded {
+		return errf(codes.ResourceExhausted, "%v", err)
+	}
+	return err
+}
+
+// notifyEntry tells the watchers that the entry name in parent changed, along
+// with parent itself
+func (s *apiServer) notifyEntry(fsid uuid.UUID, parent uint64, name string) {
+	s.watch.notify(fsid, parent, name)
+	s.watch.notify(fsid, parent, "")
+}
+
+// Watch sends an Invalidation for each change made through this formicd to
+// the file system, until the client goes away. One with no inode is sent
+// first, once the changes are being watched. The stream ends with an error if
+// the client can't keep up, as it has missed changes.
+func (s *apiServer) Watch(r *pb.WatchRequest, stream pb.Api_WatchServer) error {
+	ctx := stream.Context()
+	err := s.validateIP(ctx)
+	if err != nil {
+		return err
+	}
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return err
+	}
+	ch := s.watch.add(fsid)
+	defer s.watch.remove(fsid, ch)
+	if err = stream.Send(&pb.Invalidation{}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-ch:
+			if !ok {
+				return errf(codes.ResourceExhausted, "Watch fell too far behind")
+			}
+			if err = stream.Send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 func (s *apiServer) InitFs(ctx context.Context, r *pb.InitFsRequest) (*pb.InitFsResponse, error) {
 	err := s.validateIP(ctx)
 	if err != nil {
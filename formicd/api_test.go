@@ -2,10 +2,19 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
 	"testing"
 	"time"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 
@@ -13,20 +22,40 @@ import (
 
 	"github.com/creiht/formic"
 	pb "github.com/creiht/formic/proto"
+	"github.com/getcfs/fuse"
 	"github.com/gogo/protobuf/proto"
 	"github.com/satori/go.uuid"
 )
 
+// Fsid used for all test requests so that block ids are predictable
+var testFsid = uuid.NewV4()
+
 // Minimal FileService for testing
+// Blocks are tracked by id since they may be read and written concurrently.
 type TestFS struct {
-	writes [][]byte
-	reads  [][]byte
+	sync.Mutex
+	writes map[string][]byte
+	reads  map[string][]byte
+	fails  map[string]error
+	// Only fail reading, the block is still there
+	readfails map[string]error
+	nreads    uint64
+	// Bumped by every write, and by writes through another formicd
+	stamps map[string]int64
+	races  map[string]int
+	// Returned for every inode if set
+	inode *pb.InodeEntry
+	quota *Quota
 }
 
 func NewTestFS() *TestFS {
 	return &TestFS{
-		writes: make([][]byte, 0),
-		reads:  make([][]byte, 0),
+		writes:    make(map[string][]byte),
+		reads:     make(map[string][]byte),
+		fails:     make(map[string]error),
+		readfails: make(map[string]error),
+		stamps:    make(map[string]int64),
+		races:     make(map[string]int),
 	}
 }
 
@@ -38,22 +67,105 @@ func (fs *TestFS) GetDirent(ctx context.Context, parent []byte, name string) (*p
 	return nil, nil
 }
 
-func (fs *TestFS) GetInode(ctx context.Context, id []byte) (*pb.InodeEntry, error) {
+func (fs *TestFS) ReadDirents(ctx context.Context, id []byte) ([]*pb.DirEntry, error) {
 	return nil, nil
 }
 
+func (fs *TestFS) VerifyChunk(ctx context.Context, id []byte) error {
+	return nil
+}
+
+func (fs *TestFS) GetTrash(ctx context.Context, key []byte) (*TrashEntry, error) {
+	return nil, ErrNotFound
+}
+
+func (fs *TestFS) DeleteTrash(ctx context.Context, key []byte, tsm int64) error {
+	return nil
+}
+
+func (fs *TestFS) AddUsage(ctx context.Context, bytes, blocks, inodes int64) {
+}
+
+func (fs *TestFS) GetUsage(ctx context.Context) (*FileSysStats, error) {
+	return &FileSysStats{}, nil
+}
+
+func (fs *TestFS) GetQuota(ctx context.Context) (*Quota, *FileSysStats, error) {
+	return fs.quota, &FileSysStats{}, nil
+}
+
+func (fs *TestFS) CheckQuota(ctx context.Context, bytes, inodes int64) error {
+	if fs.quota != nil && bytes > fs.quota.Bytes {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (fs *TestFS) GetInode(ctx context.Context, id []byte) (*pb.InodeEntry, error) {
+	if fs.inode != nil {
+		return fs.inode, nil
+	}
+	return nil, ErrNotFound
+}
+
 func (fs *TestFS) GetChunk(ctx context.Context, id []byte) ([]byte, error) {
-	if len(fs.reads) > 0 {
-		chunk := fs.reads[0]
-		fs.reads = fs.reads[1:]
+	fs.Lock()
+	defer fs.Unlock()
+	if err := fs.fails[string(id)]; err != nil {
+		return nil, err
+	}
+	if err := fs.readfails[string(id)]; err != nil {
+		return nil, err
+	}
+	if fs.races[string(id)] > 0 {
+		fs.races[string(id)]--
+		fs.stamps[string(id)]++
+	}
+	if chunk, ok := fs.reads[string(id)]; ok {
 		return chunk, nil
 	} else {
-		return []byte(""), nil
+		return nil, ErrNotFound
 	}
 }
 
+func (fs *TestFS) ChunkTimestamp(ctx context.Context, id []byte) (int64, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.stamps[string(id)], nil
+}
+
+func (fs *TestFS) GetBlock(ctx context.Context, fsid []byte, inode, block uint64) ([]byte, error) {
+	return fs.GetChunk(ctx, formic.GetID(fsid, inode, block+1))
+}
+
+func (fs *TestFS) HasBlock(ctx context.Context, fsid []byte, inode, block uint64) (bool, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	id := string(formic.GetID(fsid, inode, block+1))
+	// Only the data can be corrupt, and it isn't read
+	if err := fs.fails[id]; err != nil && err != ErrChecksumMismatch {
+		return false, err
+	}
+	_, ok := fs.reads[id]
+	return ok, nil
+}
+
 func (fs *TestFS) WriteChunk(ctx context.Context, id, data []byte) error {
-	fs.writes = append(fs.writes, data)
+	fs.Lock()
+	defer fs.Unlock()
+	if err := fs.fails[string(id)]; err != nil {
+		return err
+	}
+	fs.writes[string(id)] = data
+	fs.stamps[string(id)]++
+	return nil
+}
+
+func (fs *TestFS) WriteBlock(ctx context.Context, fsid []byte, inode, block uint64, data []byte) error {
+	return fs.WriteChunk(ctx, formic.GetID(fsid, inode, block+1), data)
+}
+
+func (fs *TestFS) DropBlockRefs(ctx context.Context, ts *pb.Tombstone, whole bool) error {
 	return nil
 }
 
@@ -66,11 +178,44 @@ func (fs *TestFS) DeleteListing(ctx context.Context, parent []byte, name string,
 }
 
 func (fs *TestFS) clearwrites() {
-	fs.writes = make([][]byte, 0)
+	fs.writes = make(map[string][]byte)
 }
 
+// Add the data for the next block of inode 0
 func (fs *TestFS) addread(d []byte) {
-	fs.reads = append(fs.reads, d)
+	fs.nreads += 1
+	fs.reads[string(formic.GetID(testFsid.Bytes(), 0, fs.nreads))] = d
+}
+
+// Make all requests for the given block of inode 0 fail
+func (fs *TestFS) addfail(block uint64) {
+	fs.fails[string(formic.GetID(testFsid.Bytes(), 0, block+1))] = errors.New("Test failure")
+}
+
+// Make reading the given block of inode 0 fail, while writing it works
+func (fs *TestFS) addreadfail(block uint64) {
+	fs.readfails[string(formic.GetID(testFsid.Bytes(), 0, block+1))] = errors.New("Test read failure")
+}
+
+// Make the given block of inode 0 fail its checksum
+func (fs *TestFS) addcorrupt(block uint64) {
+	fs.fails[string(formic.GetID(testFsid.Bytes(), 0, block+1))] = ErrChecksumMismatch
+}
+
+// Make the next n reads of the given block of inode 0 race with a write
+// through another formicd
+func (fs *TestFS) addrace(block uint64, n int) {
+	fs.races[string(formic.GetID(testFsid.Bytes(), 0, block+1))] = n
+}
+
+// Leave a hole at the next block of inode 0
+func (fs *TestFS) addhole() {
+	fs.nreads += 1
+}
+
+// Get the data written to the given block of inode 0
+func (fs *TestFS) written(block uint64) []byte {
+	return fs.writes[string(formic.GetID(testFsid.Bytes(), 0, block+1))]
 }
 
 func (ds *TestFS) GetAttr(ctx context.Context, id []byte) (*pb.Attr, error) {
@@ -97,7 +242,7 @@ func (ds *TestFS) Remove(ctx context.Context, parent []byte, name string) (int32
 	return 1, nil
 }
 
-func (ds *TestFS) Update(ctx context.Context, id []byte, block, blocksize, size uint64, mtime int64) error {
+func (ds *TestFS) Update(ctx context.Context, id []byte, block, blocksize, size uint64, mtime, written int64) error {
 	return nil
 }
 
@@ -105,6 +250,10 @@ func (ds *TestFS) Symlink(ctx context.Context, parent, id []byte, name string, t
 	return &pb.SymlinkResponse{}, nil
 }
 
+func (ds *TestFS) Link(ctx context.Context, parent, id []byte, name string) (string, *pb.Attr, error) {
+	return name, &pb.Attr{}, nil
+}
+
 func (ds *TestFS) Readlink(ctx context.Context, id []byte) (*pb.ReadlinkResponse, error) {
 	return &pb.ReadlinkResponse{}, nil
 }
@@ -125,7 +274,7 @@ func (ds *TestFS) Removexattr(ctx context.Context, id []byte, name string) (*pb.
 	return &pb.RemovexattrResponse{}, nil
 }
 
-func (ds *TestFS) Rename(ctx context.Context, oldParent, newParent []byte, oldName, newName string) (*pb.RenameResponse, error) {
+func (ds *TestFS) Rename(ctx context.Context, oldParent, newParent []byte, oldName, newName string, flags uint32) (*pb.RenameResponse, error) {
 	return &pb.RenameResponse{}, nil
 }
 
@@ -141,11 +290,10 @@ func (f fakePeerAddr) String() string {
 }
 
 func getContext() context.Context {
-	fsid := uuid.NewV4()
 	c, _ := context.WithTimeout(context.Background(), 5*time.Second)
 	c = metadata.NewContext(
 		c,
-		metadata.Pairs("fsid", fsid.String()),
+		metadata.Pairs("fsid", testFsid.String()),
 	)
 	p := &peer.Peer{
 		Addr: fakePeerAddr{},
@@ -167,7 +315,7 @@ func TestGetID(t *testing.T) {
 }
 
 func TestCreate(t *testing.T) {
-	api := NewApiServer(NewTestFS(), 1, nil)
+	api := NewApiServer(NewTestFS(), 1, nil, nil)
 	_, err := api.Create(getContext(), &pb.CreateRequest{Parent: 1, Name: "Test", Attr: &pb.Attr{Gid: 1001, Uid: 1001}})
 	if err != nil {
 		t.Error("Create Failed: ", err)
@@ -175,9 +323,113 @@ func TestCreate(t *testing.T) {
 
 }
 
+func TestLink(t *testing.T) {
+	api := NewApiServer(NewTestFS(), 1, nil, nil)
+	l, err := api.Link(getContext(), &pb.LinkRequest{Inode: 2, Parent: 1, Name: "Test"})
+	if err != nil {
+		t.Error("Link Failed: ", err)
+	}
+	if l.Name != "Test" {
+		t.Errorf("Expected link name: 'Test' received: '%s'", l.Name)
+	}
+}
+
+func TestRename_Flags(t *testing.T) {
+	api := NewApiServer(NewTestFS(), 1, nil, nil)
+	for _, flags := range []uint32{0, RenameNoReplace, RenameExchange} {
+		_, err := api.Rename(getContext(), &pb.RenameRequest{OldParent: 1, NewParent: 1, OldName: "a", NewName: "b", Flags: flags})
+		if err != nil {
+			t.Errorf("Rename with flags %d failed: %s", flags, err)
+		}
+	}
+	for _, flags := range []uint32{RenameNoReplace | RenameExchange, 4} {
+		_, err := api.Rename(getContext(), &pb.RenameRequest{OldParent: 1, NewParent: 1, OldName: "a", NewName: "b", Flags: flags})
+		if grpc.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for flags %d, received: %v", flags, err)
+		}
+	}
+}
+
+type fakeWatchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *pb.Invalidation
+}
+
+func (s *fakeWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeWatchStream) Send(e *pb.Invalidation) error {
+	s.sent <- e
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	api := NewApiServer(NewTestFS(), 1, nil, nil)
+	ctx, cancel := context.WithCancel(getContext())
+	stream := &fakeWatchStream{ctx: ctx, sent: make(chan *pb.Invalidation, 10)}
+	done := make(chan error)
+	go func() {
+		done <- api.Watch(&pb.WatchRequest{}, stream)
+	}()
+	// Sent once the watch has started
+	select {
+	case e := <-stream.sent:
+		if e.Inode != 0 {
+			t.Errorf("Expected invalidation 0 first, received: %d", e.Inode)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not start")
+	}
+	_, err := api.Create(getContext(), &pb.CreateRequest{Parent: 1, Name: "Test", Attr: &pb.Attr{}})
+	if err != nil {
+		t.Fatal("Create Failed: ", err)
+	}
+	_, err = api.SetAttr(getContext(), &pb.SetAttrRequest{Attr: &pb.Attr{Inode: 2}})
+	if err != nil {
+		t.Fatal("SetAttr Failed: ", err)
+	}
+	expected := []pb.Invalidation{{Inode: 1, Name: "Test"}, {Inode: 1}, {Inode: 2}}
+	for _, want := range expected {
+		select {
+		case e := <-stream.sent:
+			if e.Inode != want.Inode || e.Name != want.Name {
+				t.Errorf("Expected invalidation %d '%s' received: %d '%s'", want.Inode, want.Name, e.Inode, e.Name)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected invalidation %d '%s'", want.Inode, want.Name)
+		}
+	}
+	cancel()
+	if err = <-done; err != nil {
+		t.Error("Watch Failed: ", err)
+	}
+	if len(api.watch.fs) != 0 {
+		t.Error("Watcher was not removed")
+	}
+}
+
+func TestWatch_Behind(t *testing.T) {
+	w := newWatchers()
+	ch := w.add(testFsid)
+	for i := 0; i <= watchBacklog; i++ {
+		w.notify(testFsid, uint64(i), "")
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != watchBacklog {
+		t.Errorf("Expected %d invalidations before being dropped, received: %d", watchBacklog, n)
+	}
+	// Already dropped
+	w.remove(testFsid, ch)
+}
+
 func TestWrite_Basic(t *testing.T) {
 	fs := NewTestFS()
-	api := NewApiServer(fs, 1, nil)
+	api := NewApiServer(fs, 1, nil, nil)
 	api.blocksize = 10
 	chunk := pb.WriteRequest{
 		Inode:   0,
@@ -191,9 +443,9 @@ func TestWrite_Basic(t *testing.T) {
 	if r.Status != 0 {
 		t.Error("Write status expected: 0, received: ", r.Status)
 	}
-	if !bytes.Equal(chunk.Payload, fs.writes[0]) {
+	if !bytes.Equal(chunk.Payload, fs.written(0)) {
 		fmt.Println(fs.writes)
-		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.writes[0])
+		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.written(0))
 	}
 	chunk.Payload = []byte("1")
 	fs.clearwrites()
@@ -204,16 +456,16 @@ func TestWrite_Basic(t *testing.T) {
 	if r.Status != 0 {
 		t.Error("Write status expected: 0, received: ", r.Status)
 	}
-	if !bytes.Equal(chunk.Payload, fs.writes[0]) {
+	if !bytes.Equal(chunk.Payload, fs.written(0)) {
 		fmt.Println(fs.writes)
-		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.writes[0])
+		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.written(0))
 	}
 
 }
 
 func TestWrite_Chunk(t *testing.T) {
 	fs := NewTestFS()
-	api := NewApiServer(fs, 1, nil)
+	api := NewApiServer(fs, 1, nil, nil)
 	api.blocksize = 5
 	chunk := pb.WriteRequest{
 		Inode:   0,
@@ -227,19 +479,19 @@ func TestWrite_Chunk(t *testing.T) {
 	if r.Status != 0 {
 		t.Error("Write status expected: 0, received: ", r.Status)
 	}
-	if !bytes.Equal(chunk.Payload[:5], fs.writes[0]) {
+	if !bytes.Equal(chunk.Payload[:5], fs.written(0)) {
 		fmt.Println(fs.writes)
-		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload[:5], fs.writes[0])
+		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload[:5], fs.written(0))
 	}
-	if !bytes.Equal(chunk.Payload[5:], fs.writes[1]) {
+	if !bytes.Equal(chunk.Payload[5:], fs.written(1)) {
 		fmt.Println(fs.writes)
-		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload[5:], fs.writes[1])
+		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload[5:], fs.written(1))
 	}
 }
 
 func TestWrite_Offset(t *testing.T) {
 	fs := NewTestFS()
-	api := NewApiServer(fs, 1, nil)
+	api := NewApiServer(fs, 1, nil, nil)
 	api.blocksize = 10
 	chunk := pb.WriteRequest{
 		Offset:  5,
@@ -253,9 +505,9 @@ func TestWrite_Offset(t *testing.T) {
 	if r.Status != 0 {
 		t.Error("Write status expected: 0, received: ", r.Status)
 	}
-	if !bytes.Equal(chunk.Payload, fs.writes[0][5:]) {
+	if !bytes.Equal(chunk.Payload, fs.written(0)[5:]) {
 		fmt.Println(fs.writes)
-		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.writes[0][5:])
+		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.written(0)[5:])
 	}
 	fs.clearwrites()
 	chunk = pb.WriteRequest{
@@ -270,16 +522,16 @@ func TestWrite_Offset(t *testing.T) {
 	if r.Status != 0 {
 		t.Error("Write status expected: 0, received: ", r.Status)
 	}
-	if !bytes.Equal(chunk.Payload, fs.writes[0][2:7]) {
+	if !bytes.Equal(chunk.Payload, fs.written(0)[2:7]) {
 		fmt.Println(fs.writes)
-		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.writes[0][5:])
+		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.written(0)[5:])
 	}
 
 }
 
 func TestWrite_MultiOffset(t *testing.T) {
 	fs := NewTestFS()
-	api := NewApiServer(fs, 1, nil)
+	api := NewApiServer(fs, 1, nil, nil)
 	api.blocksize = 20
 	chunk := pb.WriteRequest{
 		Offset:  5,
@@ -293,15 +545,15 @@ func TestWrite_MultiOffset(t *testing.T) {
 	if r.Status != 0 {
 		t.Error("Write status expected: 0, received: ", r.Status)
 	}
-	if !bytes.Equal(chunk.Payload, fs.writes[0][5:]) {
+	if !bytes.Equal(chunk.Payload, fs.written(0)[5:]) {
 		fmt.Println(fs.writes)
-		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.writes[0][5:])
+		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload, fs.written(0)[5:])
 	}
 }
 
 func TestRead_Basic(t *testing.T) {
 	fs := NewTestFS()
-	api := NewApiServer(fs, 1, nil)
+	api := NewApiServer(fs, 1, nil, nil)
 	api.blocksize = 10
 	write := []byte("0123456789")
 	fs.addread(write)
@@ -314,9 +566,53 @@ func TestRead_Basic(t *testing.T) {
 	}
 }
 
+func TestRead_FileSize(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 10
+	fs.addread([]byte("0123456789"))
+	fs.addread([]byte("abcdefghij"))
+	// Blocks past the end of the file are waiting to be deleted
+	fs.inode = &pb.InodeEntry{Attr: &pb.Attr{Size: 15}}
+	data, err := api.Read(getContext(), &pb.ReadRequest{Inode: 0, Offset: 5, Size: 20})
+	if err != nil {
+		t.Error("Read Failed: ", err)
+	}
+	if string(data.Payload) != "56789abcde" {
+		t.Errorf("Expected read: '56789abcde' received: '%s'", data.Payload)
+	}
+}
+
+func TestRead_AfterWrite(t *testing.T) {
+	o := newTestOortFS()
+	api := NewApiServer(o, 1, nil, nil)
+	api.blocksize = 4
+	ctx := getContext()
+	attr := &pb.Attr{Inode: 2, Mode: 0644, Nlink: 1}
+	if _, _, err := o.Create(ctx, formic.GetID(testFsid.Bytes(), 1, 0), formic.GetID(testFsid.Bytes(), 2, 0), 2, "a", attr, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	// The size is grown by the write, not only by the queued updates
+	_, err := api.Write(ctx, &pb.WriteRequest{Inode: 2, Offset: 0, Payload: []byte("hello world")})
+	if err != nil {
+		t.Fatal("Write Failed: ", err)
+	}
+	n, _ := o.GetInode(ctx, formic.GetID(testFsid.Bytes(), 2, 0))
+	if n.Attr.Size != 11 {
+		t.Errorf("Expected size 11, received %d", n.Attr.Size)
+	}
+	data, err := api.Read(ctx, &pb.ReadRequest{Inode: 2, Offset: 0, Size: 100})
+	if err != nil {
+		t.Fatal("Read Failed: ", err)
+	}
+	if string(data.Payload) != "hello world" {
+		t.Errorf("Expected read: 'hello world' received: '%s'", data.Payload)
+	}
+}
+
 func TestRead_Offset(t *testing.T) {
 	fs := NewTestFS()
-	api := NewApiServer(fs, 1, nil)
+	api := NewApiServer(fs, 1, nil, nil)
 	api.blocksize = 10
 	write := []byte("0123456789")
 	fs.addread(write)
@@ -331,7 +627,7 @@ func TestRead_Offset(t *testing.T) {
 
 func TestRead_Chunk(t *testing.T) {
 	fs := NewTestFS()
-	api := NewApiServer(fs, 1, nil)
+	api := NewApiServer(fs, 1, nil, nil)
 	api.blocksize = 10
 	write1 := []byte("0123456789")
 	write2 := []byte("9876543210")
@@ -349,6 +645,435 @@ func TestRead_Chunk(t *testing.T) {
 	}
 }
 
+type fakeReadStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	frames []*pb.ReadResponse
+}
+
+func (s *fakeReadStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeReadStream) Send(r *pb.ReadResponse) error {
+	s.frames = append(s.frames, r)
+	return nil
+}
+
+type fakeWriteStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	frames []*pb.WriteRequest
+	resp   *pb.WriteResponse
+}
+
+func (s *fakeWriteStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeWriteStream) Recv() (*pb.WriteRequest, error) {
+	if len(s.frames) == 0 {
+		return nil, io.EOF
+	}
+	r := s.frames[0]
+	s.frames = s.frames[1:]
+	return r, nil
+}
+
+func (s *fakeWriteStream) SendAndClose(r *pb.WriteResponse) error {
+	s.resp = r
+	return nil
+}
+
+func TestReadStream(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 10
+	write1 := []byte("0123456789")
+	write2 := []byte("98765")
+	fs.addread(write1)
+	fs.addread(write2)
+	stream := &fakeReadStream{ctx: getContext()}
+	err := api.ReadStream(&pb.ReadRequest{Inode: 0, Offset: 5, Size: 20}, stream)
+	if err != nil {
+		t.Error("ReadStream Failed: ", err)
+	}
+	if len(stream.frames) != 2 {
+		t.Fatalf("Expected 2 frames, received: %d", len(stream.frames))
+	}
+	if stream.frames[0].Offset != 5 || !bytes.Equal(stream.frames[0].Payload, write1[5:]) {
+		t.Errorf("Expected frame at 5: '%s' received at %d: '%s'", write1[5:], stream.frames[0].Offset, stream.frames[0].Payload)
+	}
+	if stream.frames[1].Offset != 10 || !bytes.Equal(stream.frames[1].Payload, write2) {
+		t.Errorf("Expected frame at 10: '%s' received at %d: '%s'", write2, stream.frames[1].Offset, stream.frames[1].Payload)
+	}
+}
+
+func TestWriteStream(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 5
+	stream := &fakeWriteStream{
+		ctx: getContext(),
+		frames: []*pb.WriteRequest{
+			{Inode: 0, Offset: 0, Payload: []byte("12345")},
+			{Inode: 0, Offset: 5, Payload: []byte("67890")},
+		},
+	}
+	err := api.WriteStream(stream)
+	if err != nil {
+		t.Error("WriteStream Failed: ", err)
+	}
+	if stream.resp == nil || stream.resp.Status != 0 {
+		t.Error("WriteStream status expected: 0, received: ", stream.resp)
+	}
+	if len(fs.writes) != 2 {
+		t.Fatalf("Expected 2 writes, received: %d", len(fs.writes))
+	}
+	if !bytes.Equal(fs.written(0), []byte("12345")) || !bytes.Equal(fs.written(1), []byte("67890")) {
+		t.Errorf("Unexpected writes: %s", fs.writes)
+	}
+}
+
+func TestRead_Parallel(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 2
+	api.inFlight = 3
+	write := []byte("0123456789abcdefghij")
+	for i := 0; i < len(write); i += 2 {
+		fs.addread(write[i : i+2])
+	}
+	data, err := api.Read(getContext(), &pb.ReadRequest{Inode: 0, Offset: 1, Size: 18})
+	if err != nil {
+		t.Error("Read Failed: ", err)
+	}
+	if !bytes.Equal(data.Payload, write[1:19]) {
+		t.Errorf("Expected read: '%s' received: '%s'", write[1:19], data.Payload)
+	}
+}
+
+func TestRead_PartialFailure(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 10
+	fs.addread([]byte("0123456789"))
+	fs.addread([]byte("9876543210"))
+	fs.addfail(1)
+	_, err := api.Read(getContext(), &pb.ReadRequest{Inode: 0, Offset: 0, Size: 20})
+	if err == nil {
+		t.Error("Read expected to fail on block 1")
+	}
+}
+
+func TestRead_ChecksumMismatch(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 10
+	fs.addread([]byte("0123456789"))
+	fs.addread([]byte("9876543210"))
+	fs.addcorrupt(1)
+	_, err := api.Read(getContext(), &pb.ReadRequest{Inode: 0, Offset: 0, Size: 20})
+	if grpc.Code(err) != codes.DataLoss {
+		t.Errorf("Expected DataLoss, received: %v", err)
+	}
+	// A partial write can't merge into a corrupt block
+	_, err = api.Write(getContext(), &pb.WriteRequest{Inode: 0, Offset: 12, Payload: []byte("ab")})
+	if grpc.Code(err) != codes.DataLoss {
+		t.Errorf("Expected DataLoss, received: %v", err)
+	}
+}
+
+func TestWrite_Parallel(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 2
+	api.inFlight = 3
+	chunk := pb.WriteRequest{
+		Inode:   0,
+		Offset:  0,
+		Payload: []byte("0123456789abcdefghij"),
+	}
+	_, err := api.Write(getContext(), &chunk)
+	if err != nil {
+		t.Error("Write Failed: ", err)
+	}
+	for i := 0; i < len(chunk.Payload)/2; i++ {
+		if !bytes.Equal(chunk.Payload[i*2:i*2+2], fs.written(uint64(i))) {
+			t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload[i*2:i*2+2], fs.written(uint64(i)))
+		}
+	}
+}
+
+func TestWrite_SameBlock(t *testing.T) {
+	o := newTestOortFS()
+	api := NewApiServer(o, 1, nil, nil)
+	api.blocksize = 64
+	// Every write merges into the same block
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			payload := bytes.Repeat([]byte{byte('a' + i)}, 4)
+			_, err := api.Write(getContext(), &pb.WriteRequest{Inode: 2, Offset: int64(i * 4), Payload: payload})
+			if err != nil {
+				t.Error("Write Failed: ", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	got, err := o.GetBlock(getContext(), testFsid.Bytes(), 2, 0)
+	if err != nil {
+		t.Fatal("GetBlock failed: ", err)
+	}
+	for i := 0; i < 16; i++ {
+		expected := bytes.Repeat([]byte{byte('a' + i)}, 4)
+		if len(got) < i*4+4 || !bytes.Equal(got[i*4:i*4+4], expected) {
+			t.Fatalf("Expected '%s' at %d, received '%s'", expected, i*4, got)
+		}
+	}
+}
+
+func TestWrite_Conflict(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 10
+	fs.addread([]byte("0123456789"))
+	fs.addrace(0, 1)
+	_, err := api.Write(getContext(), &pb.WriteRequest{Inode: 0, Offset: 2, Payload: []byte("ab")})
+	if err != nil {
+		t.Fatal("Write Failed: ", err)
+	}
+	// The write is merged again on top of the one that got in first
+	if string(fs.written(0)) != "01ab456789" {
+		t.Errorf("Expected write: '01ab456789' received: '%s'", fs.written(0))
+	}
+	// Giving up once it keeps happening
+	fs.clearwrites()
+	fs.addrace(0, maxUpdateTries)
+	_, err = api.Write(getContext(), &pb.WriteRequest{Inode: 0, Offset: 2, Payload: []byte("cd")})
+	if grpc.Code(err) != codes.Aborted {
+		t.Errorf("Expected Aborted, received %v", err)
+	}
+	if fs.written(0) != nil {
+		t.Errorf("Expected nothing written, received '%s'", fs.written(0))
+	}
+}
+
+func TestWrite_MergeReadFailure(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 10
+	fs.addread([]byte("0123456789"))
+	fs.addreadfail(0)
+	// Merging into a block that couldn't be read would zero the rest of it
+	for _, offset := range []int64{0, 2} {
+		_, err := api.Write(getContext(), &pb.WriteRequest{Inode: 0, Offset: offset, Payload: []byte("ab")})
+		if err == nil {
+			t.Errorf("Write at %d expected to fail", offset)
+		}
+		if fs.written(0) != nil {
+			t.Errorf("Expected nothing written, received '%s'", fs.written(0))
+		}
+	}
+}
+
+func TestWrite_PartialFailure(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 5
+	fs.addfail(1)
+	r, err := api.Write(getContext(), &pb.WriteRequest{Inode: 0, Offset: 0, Payload: []byte("1234567890abcde")})
+	if err == nil {
+		t.Error("Write expected to fail on block 1")
+	}
+	if r.Status == 0 {
+		t.Error("Write status expected: 1, received: ", r.Status)
+	}
+	if !bytes.Equal(fs.written(0), []byte("12345")) || !bytes.Equal(fs.written(2), []byte("abcde")) {
+		t.Errorf("Expected the other blocks to be written: %s", fs.writes)
+	}
+}
+
+func TestWrite_Quota(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 5
+	fs.quota = &Quota{Bytes: 10}
+	_, err := api.Write(getContext(), &pb.WriteRequest{Inode: 0, Offset: 0, Payload: []byte("1234567890abcde")})
+	if grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted, received: %v", err)
+	}
+	if len(fs.writes) != 0 {
+		t.Errorf("Expected nothing to be written: %s", fs.writes)
+	}
+	// The size of a file that doesn't exist yet isn't known, and counts as 0
+	_, err = api.Write(getContext(), &pb.WriteRequest{Inode: 0, Offset: 0, Payload: []byte("1234567890")})
+	if err != nil {
+		t.Error("Write Failed: ", err)
+	}
+	fs.inode = &pb.InodeEntry{Attr: &pb.Attr{Size: 10}}
+	_, err = api.Write(getContext(), &pb.WriteRequest{Inode: 0, Offset: 5, Payload: []byte("12345")})
+	if err != nil {
+		t.Error("Write Failed: ", err)
+	}
+}
+
+func TestSetAttr_Quota(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	fs.quota = &Quota{Bytes: 10}
+	fs.inode = &pb.InodeEntry{Attr: &pb.Attr{Size: 5}}
+	size := uint32(fuse.SetattrSize)
+	_, err := api.SetAttr(getContext(), &pb.SetAttrRequest{Attr: &pb.Attr{Size: 20}, Valid: size})
+	if grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted, received: %v", err)
+	}
+	_, err = api.SetAttr(getContext(), &pb.SetAttrRequest{Attr: &pb.Attr{Size: 15}, Valid: size})
+	if err != nil {
+		t.Error("SetAttr Failed: ", err)
+	}
+	// Only the size is checked
+	_, err = api.SetAttr(getContext(), &pb.SetAttrRequest{Attr: &pb.Attr{Size: 20}})
+	if err != nil {
+		t.Error("SetAttr Failed: ", err)
+	}
+}
+
+func TestWrite_InodeBlocksize(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 10
+	fs.inode = &pb.InodeEntry{BlockSize: 5}
+	chunk := pb.WriteRequest{
+		Inode:   0,
+		Offset:  0,
+		Payload: []byte("1234567890"),
+	}
+	_, err := api.Write(getContext(), &chunk)
+	if err != nil {
+		t.Error("Write Failed: ", err)
+	}
+	if !bytes.Equal(chunk.Payload[:5], fs.written(0)) {
+		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload[:5], fs.written(0))
+	}
+	if !bytes.Equal(chunk.Payload[5:], fs.written(1)) {
+		t.Errorf("Expected write: '%s' recieved: '%s'", chunk.Payload[5:], fs.written(1))
+	}
+}
+
+func TestRead_InodeBlocksize(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	api.blocksize = 10
+	fs.inode = &pb.InodeEntry{BlockSize: 5}
+	fs.addread([]byte("01234"))
+	fs.addread([]byte("56789"))
+	data, err := api.Read(getContext(), &pb.ReadRequest{Inode: 0, Offset: 3, Size: 5})
+	if err != nil {
+		t.Error("Read Failed: ", err)
+	}
+	if !bytes.Equal(data.Payload, []byte("34567")) {
+		t.Errorf("Expected read: '%s' received: '%s'", "34567", data.Payload)
+	}
+}
+
+func TestBlocksForSize(t *testing.T) {
+	tests := []struct {
+		size, blocks, last uint64
+	}{
+		{0, 0, 0},
+		{1, 1, 1},
+		{10, 1, 10},
+		{11, 2, 1},
+		{25, 3, 5},
+	}
+	for _, tt := range tests {
+		blocks, last := blocksForSize(tt.size, 10)
+		if blocks != tt.blocks || last != tt.last {
+			t.Errorf("Size %d expected blocks: %d last: %d, received blocks: %d last: %d", tt.size, tt.blocks, tt.last, blocks, last)
+		}
+	}
+}
+
+func TestRead_Holes(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	fs.inode = &pb.InodeEntry{BlockSize: 5, Attr: &pb.Attr{Size: 22}}
+	fs.addread([]byte("01234"))
+	fs.addhole()
+	fs.addread([]byte("012"))
+	fs.addhole()
+	fs.addread([]byte("01"))
+	data, err := api.Read(getContext(), &pb.ReadRequest{Inode: 0, Offset: 0, Size: 30})
+	if err != nil {
+		t.Error("Read Failed: ", err)
+	}
+	expected := []byte("01234\x00\x00\x00\x00\x00012\x00\x00\x00\x00\x00\x00\x0001")
+	if !bytes.Equal(data.Payload, expected) {
+		t.Errorf("Expected read: %q received: %q", expected, data.Payload)
+	}
+	data, err = api.Read(getContext(), &pb.ReadRequest{Inode: 0, Offset: 30, Size: 10})
+	if err != nil {
+		t.Error("Read Failed: ", err)
+	}
+	if len(data.Payload) != 0 {
+		t.Errorf("Expected empty read past the end, received: %q", data.Payload)
+	}
+}
+
+func TestStatfs_Blocksize(t *testing.T) {
+	api := NewApiServer(NewTestFS(), 1, nil, nil)
+	api.blocksize = 1024 * 1024
+	resp, err := api.Statfs(getContext(), &pb.StatfsRequest{})
+	if err != nil {
+		t.Fatal("Statfs failed: ", err)
+	}
+	if resp.Blocksize != 1024*1024 {
+		t.Errorf("Expected blocksize %d, received %d", 1024*1024, resp.Blocksize)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	fs := NewTestFS()
+	api := NewApiServer(fs, 1, nil, nil)
+	fs.inode = &pb.InodeEntry{BlockSize: 5, Attr: &pb.Attr{Size: 22}}
+	fs.addread([]byte("01234"))
+	fs.addhole()
+	fs.addread([]byte("01234"))
+	fs.addhole()
+	fs.addread([]byte("01"))
+	// Seek only looks up the blocks, so this isn't noticed
+	fs.addcorrupt(2)
+	tests := []struct {
+		offset   int64
+		whence   uint32
+		expected int64
+	}{
+		{0, SeekData, 0},
+		{0, SeekHole, 5},
+		{6, SeekData, 10},
+		{11, SeekHole, 15},
+		{16, SeekData, 20},
+		{21, SeekHole, 22},
+	}
+	for _, tt := range tests {
+		r, err := api.Seek(getContext(), &pb.SeekRequest{Inode: 0, Offset: tt.offset, Whence: tt.whence})
+		if err != nil {
+			t.Errorf("Seek(%d, %d) Failed: %s", tt.offset, tt.whence, err)
+			continue
+		}
+		if r.Offset != tt.expected {
+			t.Errorf("Seek(%d, %d) expected: %d received: %d", tt.offset, tt.whence, tt.expected, r.Offset)
+		}
+	}
+	_, err := api.Seek(getContext(), &pb.SeekRequest{Inode: 0, Offset: 22, Whence: SeekData})
+	if err == nil {
+		t.Error("Seek past the end expected to fail")
+	}
+}
+
 func TestProtoWriteSize(t *testing.T) {
 	data := make([]byte, 64*1024)
 	block := &pb.FileBlock{
@@ -358,3 +1083,58 @@ func TestProtoWriteSize(t *testing.T) {
 	b, _ := proto.Marshal(block)
 	fmt.Printf("Storing 64K and checksum in protobufs takes %d bytes.", len(b))
 }
+
+func TestQueue_Replay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "formicd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "queue/updates")
+	q, err := newQueue(file)
+	if err != nil {
+		t.Fatal("Couldn't open queue: ", err)
+	}
+	for i := uint64(0); i < 3; i++ {
+		err = q.push(&UpdateItem{id: []byte("id"), block: i, size: 10})
+		if err != nil {
+			t.Fatal("Push failed: ", err)
+		}
+	}
+	err = q.done(q.pop())
+	if err != nil {
+		t.Fatal("Done failed: ", err)
+	}
+	// The popped but unfinished entry has to come back too
+	q.pop()
+	// Reopen as if formicd restarted
+	q, err = newQueue(file)
+	if err != nil {
+		t.Fatal("Couldn't reopen queue: ", err)
+	}
+	for i := uint64(1); i < 3; i++ {
+		u := &UpdateItem{}
+		err = json.Unmarshal(q.pop().Item, u)
+		if err != nil {
+			t.Fatal("Bad queue item: ", err)
+		}
+		if u.block != i {
+			t.Errorf("Expected block %d from the queue, received %d", i, u.block)
+		}
+	}
+	if len(q.pending) != 0 {
+		t.Errorf("Expected the queue to be empty, %d left", len(q.pending))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if backoff(1) != retryMin {
+		t.Errorf("Expected first backoff of %s, received %s", retryMin, backoff(1))
+	}
+	if backoff(2) != 2*retryMin {
+		t.Errorf("Expected second backoff of %s, received %s", 2*retryMin, backoff(2))
+	}
+	if backoff(100) != retryMax {
+		t.Errorf("Expected backoff to stop at %s, received %s", retryMax, backoff(100))
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+// The blocks of files read through this formicd can be kept in memory, so hot
+// files aren't read from the value store by every client. Blocks written or
+// deleted through this formicd are dropped right away, but ones written
+// through other formicds are only seen once the cached copy expires, so the
+// ttl bounds how stale a read can be.
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+)
+
+var (
+	blockCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "formicd",
+		Name:      "block_cache_hits_total",
+		Help:      "Number of block reads served from the block cache.",
+	})
+	blockCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "formicd",
+		Name:      "block_cache_misses_total",
+		Help:      "Number of block reads that weren't in the block cache.",
+	})
+	blockCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "formicd",
+		Name:      "block_cache_evictions_total",
+		Help:      "Number of blocks dropped from the block cache to make room.",
+	})
+	blockCacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "formicd",
+		Name:      "block_cache_bytes",
+		Help:      "Number of bytes of blocks in the block cache.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(blockCacheHits)
+	prometheus.MustRegister(blockCacheMisses)
+	prometheus.MustRegister(blockCacheEvictions)
+	prometheus.MustRegister(blockCacheBytes)
+}
+
+type cachedBlock struct {
+	id      string
+	data    []byte
+	expires time.Time
+}
+
+// blockCache keeps the most recently used blocks by id, up to max bytes of
+// them. A nil blockCache caches nothing.
+type blockCache struct {
+	sync.Mutex
+	max    int64
+	ttl    time.Duration
+	size   int64
+	blocks map[string]*list.Element
+	lru    *list.List
+	// Bumped on every invalidation, so a block read before it isn't cached
+	// after
+	gen uint64
+}
+
+// newBlockCache returns a cache of up to max bytes, or nil if max is 0
+func newBlockCache(max int64, ttl time.Duration) *blockCache {
+	if max <= 0 {
+		return nil
+	}
+	return &blockCache{
+		max:    max,
+		ttl:    ttl,
+		blocks: make(map[string]*list.Element),
+		lru:    list.New(),
+	}
+}
+
+// get returns a copy of the block, and the generation to put it back with if
+// it wasn't cached
+func (c *blockCache) get(id []byte) ([]byte, uint64, bool) {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.blocks[string(id)]
+	if ok && time.Now().After(e.Value.(*cachedBlock).expires) {
+		c.remove(e)
+		ok = false
+	}
+	if !ok {
+		blockCacheMisses.Inc()
+		return nil, c.gen, false
+	}
+	blockCacheHits.Inc()
+	c.lru.MoveToFront(e)
+	return append([]byte(nil), e.Value.(*cachedBlock).data...), 0, true
+}
+
+// put caches a copy of the block, unless there were invalidations since gen
+func (c *blockCache) put(id, data []byte, gen uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if gen != c.gen || int64(len(data)) > c.max {
+		return
+	}
+	if e, ok := c.blocks[string(id)]; ok {
+		c.remove(e)
+	}
+	b := &cachedBlock{
+		id:      string(id),
+		data:    append([]byte(nil), data...),
+		expires: time.Now().Add(c.ttl),
+	}
+	c.blocks[b.id] = c.lru.PushFront(b)
+	c.size += int64(len(b.data))
+	for c.size > c.max {
+		c.remove(c.lru.Back())
+		blockCacheEvictions.Inc()
+	}
+	blockCacheBytes.Set(float64(c.size))
+}
+
+func (c *blockCache) remove(e *list.Element) {
+	b := e.Value.(*cachedBlock)
+	c.lru.Remove(e)
+	delete(c.blocks, b.id)
+	c.size -= int64(len(b.data))
+	blockCacheBytes.Set(float64(c.size))
+}
+
+// invalidate drops the block, once it has been written or deleted
+func (c *blockCache) invalidate(id []byte) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	if e, ok := c.blocks[string(id)]; ok {
+		c.remove(e)
+	}
+}
+
+// Context key for reads that have to come from the store
+type uncachedKey struct{}
+
+// uncached returns a context that reads blocks from the store even if they are
+// cached, for blocks about to be changed
+func uncached(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncachedKey{}, true)
+}
+
+// getBlockChunk is GetChunk for the blocks of files, which are kept in the
+// block cache. Reads of the file system as of a snapshot aren't cached.
+func (o *OortFS) getBlockChunk(ctx context.Context, id []byte) ([]byte, error) {
+	_, skip := ctx.Value(uncachedKey{}).(bool)
+	if o.blocks == nil || skip || pastView(ctx) {
+		return o.GetChunk(ctx, id)
+	}
+	data, gen, ok := o.blocks.get(id)
+	if ok {
+		return data, nil
+	}
+	data, err := o.GetChunk(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	o.blocks.put(id, data, gen)
+	return data, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+// A clone starts out with a copy of the inodes and dir entries of a snapshot,
+// but not the blocks. Each copied inode records the file system and snapshot
+// it came from, and a block the clone hasn't written itself is read from there
+// as of the snapshot. The snapshot keeps those blocks around however the
+// original file system changes, so it can't be deleted while it has clones.
+// Blocks the clone writes or deletes only ever use the clone's own ids, so
+// its Deletinator never touches the blocks it shares.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/creiht/formic"
+	pb "github.com/creiht/formic/proto"
+	"github.com/gholt/store"
+	"github.com/gogo/protobuf/proto"
+	"github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+)
+
+var ErrSnapshotInUse = errors.New("Snapshot has clones")
+
+// Attributes of the file system that are carried over to a clone, the data
+// key is made new for it
+var cloneAttrs = []string{"blocksize", "compression", "dedup", "retention"}
+
+// GetBlock reads block of the inode, falling back to the file system the
+// inode was cloned from for blocks the clone hasn't written
+func (o *OortFS) GetBlock(ctx context.Context, fsid []byte, inode, block uint64) ([]byte, error) {
+	fs, err := o.fsSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if fs.dedup {
+		// Found through the block map in the inode
+		n, err := o.GetInode(ctx, formic.GetID(fsid, inode, 0))
+		if err != nil {
+			return nil, err
+		}
+		return o.readFileBlock(ctx, n, block)
+	}
+	data, err := o.getBlockChunk(ctx, formic.GetID(fsid, inode, block+1)) // block 0 is for inode data
+	if err != ErrNotFound {
+		return data, err
+	}
+	if !fs.clone {
+		return nil, ErrNotFound
+	}
+	n, err := o.GetInode(ctx, formic.GetID(fsid, inode, 0))
+	if err != nil {
+		return nil, err
+	}
+	return o.originBlock(ctx, n, block)
+}
+
+// HasBlock returns whether block of the inode exists, looking in the file
+// system the inode was cloned from like GetBlock, without reading any data
+func (o *OortFS) HasBlock(ctx context.Context, fsid []byte, inode, block uint64) (bool, error) {
+	fs, err := o.fsSettings(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !fs.dedup {
+		ok, err := o.comms.HasValue(ctx, formic.GetID(fsid, inode, block+1)) // block 0 is for inode data
+		if ok || err != nil || !fs.clone {
+			return ok, err
+		}
+	}
+	n, err := o.GetInode(ctx, formic.GetID(fsid, inode, 0))
+	if err != nil {
+		return false, err
+	}
+	if blockHash(n, block) != nil {
+		return true, nil
+	}
+	if n.Origin == nil || block >= n.OriginBlocks {
+		return false, nil
+	}
+	origin, err := uuid.FromBytes(n.Origin)
+	if err != nil {
+		return false, err
+	}
+	return o.HasBlock(asOf(withFsId(ctx, origin), n.OriginTime), n.Origin, n.Inode, block)
+}
+
+// originBlock reads the block from where the inode was cloned from
+func (o *OortFS) originBlock(ctx context.Context, n *pb.InodeEntry, block uint64) ([]byte, error) {
+	if n.Origin == nil || block >= n.OriginBlocks {
+		return nil, ErrNotFound
+	}
+	origin, err := uuid.FromBytes(n.Origin)
+	if err != nil {
+		return nil, err
+	}
+	return o.GetBlock(asOf(withFsId(ctx, origin), n.OriginTime), n.Origin, n.Inode, block)
+}
+
+// readFileBlock is GetBlock for when the inode has already been read
+func (o *OortFS) readFileBlock(ctx context.Context, n *pb.InodeEntry, block uint64) ([]byte, error) {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id := formic.GetID(fsid.Bytes(), n.Inode, block+1) // block 0 is for inode data
+	if hash := blockHash(n, block); hash != nil {
+		fb, err := o.readContent(ctx, id, hash)
+		if err != nil {
+			return nil, err
+		}
+		return fb.Data, nil
+	}
+	fs, err := o.fsSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !fs.dedup {
+		data, err := o.getBlockChunk(ctx, id)
+		if err != ErrNotFound {
+			return data, err
+		}
+	}
+	return o.originBlock(ctx, n, block)
+}
+
+// CloneReport is what was copied to make a clone
+type CloneReport struct {
+	FSID     string `json:"fsid"`
+	Origin   string `json:"origin"`
+	Snapshot string `json:"snapshot"`
+	Dirs     int    `json:"dirs"`
+	Inodes   int    `json:"inodes"`
+	Entries  int    `json:"entries"`
+}
+
+// CloneFS fills in the new file system dst with the file system src as of the
+// snapshot. The time this takes depends on the number of files, not how much
+// data they have.
+func (o *OortFS) CloneFS(ctx context.Context, src uuid.UUID, snapshot string, dst uuid.UUID) (*CloneReport, error) {
+	snap, _, err := o.getSnapshot(ctx, src, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if snap.Deleting {
+		return nil, ErrNoSnapshot
+	}
+	if !snap.taken() {
+		return nil, ErrSnapshotPending
+	}
+	// Keep the snapshot first, so it can't go away while this is copying
+	snap.Clones = append(snap.Clones, dst.String())
+	if err = o.writeSnapshot(ctx, src, snap); err != nil {
+		return nil, err
+	}
+	if err = o.cloneAttrs(ctx, src, snapshot, dst); err != nil {
+		return nil, err
+	}
+	r := &CloneReport{FSID: dst.String(), Origin: src.String(), Snapshot: snapshot}
+	then := asOf(withFsId(ctx, src), snap.Time)
+	live := withFsId(ctx, dst)
+	copied := make(map[uint64]bool)
+	root, err := o.GetInode(then, formic.GetID(src.Bytes(), 1, 0))
+	if err != nil {
+		return nil, err
+	}
+	if err = o.cloneInode(live, src, dst, snap, root); err != nil {
+		return nil, err
+	}
+	copied[root.Inode] = true
+	r.Inodes++
+	dirs := []uint64{root.Inode}
+	for i := 0; i < len(dirs); i++ {
+		r.Dirs++
+		items, err := o.comms.ReadGroup(then, formic.GetID(src.Bytes(), dirs[i], 0))
+		if err != nil && !store.IsNotFound(err) {
+			return nil, err
+		}
+		parent := formic.GetID(dst.Bytes(), dirs[i], 0)
+		for _, item := range items {
+			d := &pb.DirEntry{}
+			if err = proto.Unmarshal(item.Value, d); err != nil {
+				return nil, err
+			}
+			if d.Tombstone != nil {
+				continue
+			}
+			n, err := o.GetInode(then, d.Id)
+			if err == ErrNotFound {
+				// Deleted without the entry being marked, scrub cleans
+				// these up
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !copied[n.Inode] {
+				if err = o.cloneInode(live, src, dst, snap, n); err != nil {
+					return nil, err
+				}
+				copied[n.Inode] = true
+				r.Inodes++
+				if n.IsDir {
+					dirs = append(dirs, n.Inode)
+				}
+			}
+			d.Id = formic.GetID(dst.Bytes(), n.Inode, 0)
+			// The rename never finished as of the snapshot, so the entry is
+			// still where it was
+			d.Rename = nil
+			b, err := proto.Marshal(d)
+			if err != nil {
+				return nil, err
+			}
+			if err = o.comms.WriteGroup(live, parent, []byte(d.Name), b); err != nil {
+				return nil, err
+			}
+			r.Entries++
+		}
+	}
+	return r, nil
+}
+
+// cloneInode writes the inode to the clone, reading its blocks from the
+// snapshot
+func (o *OortFS) cloneInode(live context.Context, src, dst uuid.UUID, snap *Snapshot, n *pb.InodeEntry) error {
+	// A clone of a clone reads through its origin in turn
+	n.Origin = src.Bytes()
+	n.OriginTime = snap.Time
+	n.OriginBlocks = n.Blocks
+	n.FsId = dst.Bytes()
+	// The snapshot's copy of the inode keeps the references to deduplicated
+	// content, the clone reads those blocks through it as well
+	n.BlockHashes = nil
+	b, err := proto.Marshal(n)
+	if err != nil {
+		return err
+	}
+	err = o.WriteChunk(live, formic.GetID(dst.Bytes(), n.Inode, 0), b)
+	if err != nil {
+		return err
+	}
+	o.addInodeUsage(live, n, 1)
+	return nil
+}
+
+// cloneAttrs writes the attributes of the clone that say how its blocks are
+// stored
+func (o *OortFS) cloneAttrs(ctx context.Context, src uuid.UUID, snapshot string, dst uuid.UUID) error {
+	ctx = unversioned(ctx)
+	srcKey := []byte(fmt.Sprintf("/fs/%s", src))
+	dstKey := []byte(fmt.Sprintf("/fs/%s", dst))
+	write := func(name, value string) error {
+		b, err := json.Marshal(&FileSysAttr{Attr: name, Value: value, FSID: dst.String()})
+		if err != nil {
+			return err
+		}
+		return o.comms.WriteGroup(ctx, dstKey, []byte(name), b)
+	}
+	for _, name := range cloneAttrs {
+		b, err := o.comms.ReadGroupItem(ctx, srcKey, []byte(name))
+		if store.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		attr := FileSysAttr{}
+		if err = json.Unmarshal(b, &attr); err != nil {
+			return err
+		}
+		if err = write(name, attr.Value); err != nil {
+			return err
+		}
+	}
+	_, err := o.comms.ReadGroupItem(ctx, srcKey, []byte("datakey"))
+	if err == nil {
+		// The clone's own blocks are encrypted with its own key
+		dataKey, err := o.keys.newDataKey(dst.Bytes())
+		if err != nil {
+			return err
+		}
+		if err = write("datakey", dataKey); err != nil {
+			return err
+		}
+	} else if !store.IsNotFound(err) {
+		return err
+	}
+	return write("origin", src.String()+"@"+snapshot)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gholt/store"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+)
+
+// Compression used for a FileBlock
+const (
+	CompressionNone   = 0
+	CompressionSnappy = 1
+	CompressionGzip   = 2
+)
+
+// Names of the compressions, as set on a file system
+var compressionNames = map[string]uint32{
+	"":       CompressionNone,
+	"none":   CompressionNone,
+	"snappy": CompressionSnappy,
+	"gzip":   CompressionGzip,
+}
+
+// How often the bytes saved by compression and the usage counters are written
+// to the group store
+const statsInterval = time.Minute
+
+var compressionSaved = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "formicd",
+	Name:      "compression_saved_bytes_total",
+	Help:      "Number of bytes saved by compressing blocks.",
+})
+
+func init() {
+	prometheus.MustRegister(compressionSaved)
+}
+
+// FileSysStats is what each formicd keeps track of for a file system, stored
+// under /fs/<fsid>/stats with the node id as the key. The totals for the file
+// system are the sum over the nodes.
+type FileSysStats struct {
+	Node             string `json:"node"`
+	CompressionSaved int64  `json:"compressionsaved"`
+	Bytes            int64  `json:"bytes"`
+	Blocks           int64  `json:"blocks"`
+	Inodes           int64  `json:"inodes"`
+}
+
+// add adds the counters of other to s
+func (s *FileSysStats) add(other *FileSysStats) {
+	s.CompressionSaved += other.CompressionSaved
+	s.Bytes += other.Bytes
+	s.Blocks += other.Blocks
+	s.Inodes += other.Inodes
+}
+
+func compress(compression uint32, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionGzip:
+		b := &bytes.Buffer{}
+		w := gzip.NewWriter(b)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	return nil, fmt.Errorf("Unknown compression %d", compression)
+}
+
+func decompress(compression uint32, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		return snappy.Decode(nil, data)
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, fmt.Errorf("Unknown compression %d", compression)
+}
+
+// addSaved records the bytes saved by compression for the file system in the
+// context
+func (o *OortFS) addSaved(ctx context.Context, saved int64) {
+	compressionSaved.Add(float64(saved))
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return
+	}
+	o.addStats(fsid, &FileSysStats{CompressionSaved: saved})
+}
+
+// addStats adds to the stats of the file system that haven't been written yet
+func (o *OortFS) addStats(fsid uuid.UUID, delta *FileSysStats) {
+	o.Lock()
+	stats, ok := o.stats[fsid.String()]
+	if !ok {
+		stats = &FileSysStats{}
+		o.stats[fsid.String()] = stats
+	}
+	stats.add(delta)
+	o.Unlock()
+}
+
+// flushStats periodically adds the stats to the totals kept for this node in
+// the group store
+func (o *OortFS) flushStats() {
+	node := []byte(strconv.Itoa(o.nodeId))
+	for {
+		time.Sleep(statsInterval)
+		o.Lock()
+		deltas := o.stats
+		o.stats = make(map[string]*FileSysStats)
+		o.Unlock()
+		ctx := unversioned(context.Background())
+		for fsid, delta := range deltas {
+			key := []byte(fmt.Sprintf("/fs/%s/stats", fsid))
+			stats := &FileSysStats{Node: string(node)}
+			b, err := o.comms.ReadGroupItem(ctx, key, node)
+			if err == nil {
+				err = json.Unmarshal(b, stats)
+			}
+			if err == nil || store.IsNotFound(err) {
+				stats.add(delta)
+				b, err = json.Marshal(stats)
+				if err == nil {
+					err = o.comms.WriteGroup(ctx, key, node, b)
+				}
+			}
+			if err != nil {
+				log.Printf("ERR: Couldn't write stats for %s: %s", fsid, err)
+				if id, err := uuid.FromString(fsid); err == nil {
+					o.addStats(id, delta)
+				}
+			}
+		}
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"log"
 	"os"
+	"path"
 	"strconv"
+	"time"
 )
 
 type config struct {
@@ -19,6 +21,12 @@ type config struct {
 	metricsCollectors          string
 	concurrentRequestsPerStore int
 	debug                      bool
+	scrubInterval              time.Duration
+	scrubReclaim               bool
+	masterKeys                 string
+	adminToken                 string
+	blockCache                 int64
+	blockCacheTTL              time.Duration
 }
 
 func resolveConfig(c *config) *config {
@@ -76,5 +84,41 @@ func resolveConfig(c *config) *config {
 	if env := os.Getenv("FORMICD_DEBUG"); env == "true" {
 		cfg.debug = true
 	}
+	if env := os.Getenv("FORMICD_SCRUB_INTERVAL"); env != "" {
+		if val, err := time.ParseDuration(env); err == nil {
+			cfg.scrubInterval = val
+		}
+	}
+	if cfg.scrubInterval == 0 {
+		cfg.scrubInterval = 24 * time.Hour
+	}
+	// The scrubber only reports what it finds unless reclaim is turned on
+	if env := os.Getenv("FORMICD_SCRUB_RECLAIM"); env == "true" {
+		cfg.scrubReclaim = true
+	}
+	if env := os.Getenv("FORMICD_MASTER_KEYS"); env != "" {
+		cfg.masterKeys = env
+	}
+	if cfg.masterKeys == "" {
+		cfg.masterKeys = path.Join(cfg.path, "master.keys")
+	}
+	// Admin calls like RotateKeys are turned off without an admin token
+	if env := os.Getenv("FORMICD_ADMIN_TOKEN"); env != "" {
+		cfg.adminToken = env
+	}
+	// Blocks are only cached in memory if given a size in bytes
+	if env := os.Getenv("FORMICD_BLOCK_CACHE"); env != "" {
+		if val, err := strconv.ParseInt(env, 10, 64); err == nil {
+			cfg.blockCache = val
+		}
+	}
+	if env := os.Getenv("FORMICD_BLOCK_CACHE_TTL"); env != "" {
+		if val, err := time.ParseDuration(env); err == nil {
+			cfg.blockCacheTTL = val
+		}
+	}
+	if cfg.blockCacheTTL == 0 {
+		cfg.blockCacheTTL = time.Minute
+	}
 	return cfg
 }
@@ -0,0 +1,277 @@
+package main
+
+// Deduplicated blocks are stored once in the value store under their content
+// hash. The inode keeps the block map of the file, the hash of each of its
+// blocks, and the blocks' own ids are left unwritten. Reading a block looks
+// its hash up in the inode, and writing one changes the inode under its lock
+// (see locks.go). As the block's own id has no timestamp, a merge into a block
+// is only kept from losing changes made through this formicd.
+//
+// The references to the content are kept in the group store under
+// /dedup/<hash>, one item per block id that refers to it, so a reference can
+// be added or dropped again without throwing the count off. A snapshot's copy
+// of an inode refers to the content in its block map with its versioned id.
+// Content is always written after its reference is added, and deleted with the
+// timestamp from before the check that found no references, so a write racing
+// a delete leaves the content in place. References are dropped only after the
+// inode no longer has them in its block map, and after a snapshot that still
+// needs it has its copy. The content and references are shared by every file
+// system, so they are never versioned by snapshots.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/creiht/formic"
+	pb "github.com/creiht/formic/proto"
+	"github.com/gholt/brimtime"
+	"github.com/gholt/store"
+	"github.com/gogo/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+// contentID is the value store id the content is kept under
+func contentID(hash []byte) []byte {
+	return append([]byte("/dedup/content/"), hash...)
+}
+
+// refsKey is the group the references to the content are kept in
+func refsKey(hash []byte) []byte {
+	return []byte("/dedup/" + hex.EncodeToString(hash))
+}
+
+// blockHash returns the hash of the block in the inode's block map, or nil if
+// it isn't deduplicated
+func blockHash(n *pb.InodeEntry, block uint64) []byte {
+	if block < uint64(len(n.BlockHashes)) && len(n.BlockHashes[block]) > 0 {
+		return n.BlockHashes[block]
+	}
+	return nil
+}
+
+// setBlockHash puts the hash of the block in the inode's block map, returning
+// the hash it had before
+func setBlockHash(n *pb.InodeEntry, block uint64, hash []byte) []byte {
+	for uint64(len(n.BlockHashes)) <= block {
+		n.BlockHashes = append(n.BlockHashes, nil)
+	}
+	old := blockHash(n, block)
+	n.BlockHashes[block] = hash
+	return old
+}
+
+// trimBlockHashes cuts the inode's block map down to blocks, returning the
+// hashes that were cut off
+func trimBlockHashes(n *pb.InodeEntry, blocks uint64) [][]byte {
+	if uint64(len(n.BlockHashes)) <= blocks {
+		return nil
+	}
+	trimmed := append([][]byte{}, n.BlockHashes[blocks:]...)
+	n.BlockHashes = n.BlockHashes[:blocks]
+	return trimmed
+}
+
+// WriteBlock writes file data for the block of the inode, deduplicating it if
+// the file system has dedup turned on
+func (o *OortFS) WriteBlock(ctx context.Context, fsid []byte, inode, block uint64, data []byte) error {
+	id := formic.GetID(fsid, inode, block+1) // block 0 is for inode data
+	defer o.blocks.invalidate(id)
+	fs, err := o.fsSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if !fs.dedup {
+		return o.WriteChunk(ctx, id, data)
+	}
+	hash, err := o.writeContent(ctx, id, data)
+	if err != nil {
+		return err
+	}
+	var old []byte
+	_, err = o.updateInode(ctx, formic.GetID(fsid, inode, 0), func(n *pb.InodeEntry) error {
+		old = setBlockHash(n, block, hash)
+		return nil
+	})
+	if err != nil {
+		// Leaves the reference, and the content, around
+		return err
+	}
+	if old != nil && !bytes.Equal(old, hash) {
+		// The write is done, so failing to drop the old reference only
+		// leaves the old content around
+		if err = o.comms.dropRef(ctx, old, id); err != nil {
+			log.Printf("ERR: Couldn't drop reference from %x to %x: %s", id, old, err)
+		}
+	}
+	return nil
+}
+
+// writeContent stores the data under its hash, with a reference to it from
+// id, and returns the hash
+func (o *OortFS) writeContent(ctx context.Context, id, data []byte) ([]byte, error) {
+	// The references aren't versioned, so check up front
+	if _, _, err := o.comms.writable(ctx, 0); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	hash := sum[:]
+	err := o.comms.WriteGroup(unversioned(ctx), refsKey(hash), id, []byte{})
+	if err != nil {
+		return nil, err
+	}
+	// Anything newer is the same content
+	err = o.WriteChunk(unversioned(ctx), contentID(hash), data)
+	if err != nil && err != ErrStoreHasNewerValue {
+		return nil, err
+	}
+	return hash, nil
+}
+
+// readContent reads deduplicated content, checking it still matches its hash
+func (o *OortFS) readContent(ctx context.Context, id, hash []byte) (*pb.FileBlock, error) {
+	fb, err := o.readBlock(unversioned(ctx), contentID(hash))
+	if err == ErrNotFound {
+		log.Printf("ERR: Missing content %x for block %x", hash, id)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(fb.Data); !bytes.Equal(sum[:], hash) {
+		return nil, o.checksumMismatch(id)
+	}
+	return fb, nil
+}
+
+// DropBlockRefs drops the references the blocks in the tombstone have to
+// deduplicated content. Blocks cut off by a truncate have their hashes in the
+// tombstone, and are left alone if they have been written again since. When
+// the whole inode is being deleted they are in its block map, unless the inode
+// was written after the tombstone, and the inode is kept for snapshots first
+// so they have references of their own.
+func (o *OortFS) DropBlockRefs(ctx context.Context, ts *pb.Tombstone, whole bool) error {
+	fs, err := o.fsSettings(ctx)
+	if err != nil || !fs.dedup {
+		return err
+	}
+	id := formic.GetID(ts.FsId, ts.Inode, 0)
+	n, err := o.GetInode(ctx, id)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	hashes := ts.Hashes
+	if whole {
+		if n == nil || uint64(len(n.BlockHashes)) <= ts.FirstBlock {
+			return nil
+		}
+		tsm, err := o.ChunkTimestamp(ctx, id)
+		if err != nil || tsm >= ts.Dtime {
+			// Written since, so the inode and its references are still in
+			// use
+			return err
+		}
+		if err = o.comms.keepValue(ctx, id, brimtime.TimeToUnixMicro(time.Now())); err != nil {
+			return err
+		}
+		hashes = n.BlockHashes[ts.FirstBlock:]
+	}
+	for i, hash := range hashes {
+		block := ts.FirstBlock + uint64(i)
+		if len(hash) == 0 || !whole && n != nil && bytes.Equal(blockHash(n, block), hash) {
+			continue
+		}
+		err = o.comms.dropRef(ctx, hash, formic.GetID(ts.FsId, ts.Inode, block+1))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addBlockRefs adds the references the inode's block map needs, for when it
+// is put back the way it was in a snapshot
+func (o *OortFS) addBlockRefs(ctx context.Context, fsid []byte, n *pb.InodeEntry) error {
+	for block := range n.BlockHashes {
+		hash := blockHash(n, uint64(block))
+		if hash == nil {
+			continue
+		}
+		err := o.comms.WriteGroup(unversioned(ctx), refsKey(hash), formic.GetID(fsid, n.Inode, uint64(block)+1), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropReplacedRefs drops the references of the blocks in old's block map that
+// n no longer has
+func (o *OortFS) dropReplacedRefs(ctx context.Context, fsid []byte, old, n *pb.InodeEntry) error {
+	for block := range old.BlockHashes {
+		hash := blockHash(old, uint64(block))
+		if hash == nil || bytes.Equal(blockHash(n, uint64(block)), hash) {
+			continue
+		}
+		err := o.comms.dropRef(ctx, hash, formic.GetID(fsid, old.Inode, uint64(block)+1))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentRefs returns the deduplicated content the inode stored in b refers
+// to, each only once, so a snapshot's copy of it can keep references of its
+// own. Nothing else in a deduplicated file system refers to content.
+func (o *OortFS) contentRefs(ctx context.Context, id, b []byte) ([][]byte, error) {
+	fs, err := o.fsSettings(ctx)
+	if err != nil || !fs.dedup {
+		return nil, err
+	}
+	fb, err := o.decodeBlock(ctx, id, b)
+	if err != nil {
+		return nil, err
+	}
+	n := &pb.InodeEntry{}
+	if proto.Unmarshal(fb.Data, n) != nil {
+		return nil, nil
+	}
+	var hashes [][]byte
+	seen := make(map[string]bool)
+	for block := range n.BlockHashes {
+		hash := blockHash(n, uint64(block))
+		if hash != nil && !seen[string(hash)] {
+			seen[string(hash)] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+// dropRef removes the block's reference to the content, deleting the content
+// once nothing refers to it
+func (o *StoreComms) dropRef(ctx context.Context, hash, id []byte) error {
+	ctx = unversioned(ctx)
+	key := refsKey(hash)
+	err := o.DeleteGroupItem(ctx, key, id)
+	if err != nil && !store.IsNotFound(err) && err != ErrStoreHasNewerValue {
+		return err
+	}
+	tsm := brimtime.TimeToUnixMicro(time.Now())
+	refs, err := o.LookupGroup(ctx, key)
+	if err != nil && !store.IsNotFound(err) {
+		return err
+	}
+	if len(refs) > 0 {
+		return nil
+	}
+	err = o.DeleteValueTS(ctx, contentID(hash), tsm)
+	if err == ErrStoreHasNewerValue || store.IsNotFound(err) {
+		// Written again since the check
+		return nil
+	}
+	return err
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"hash"
 	"hash/crc32"
 	"log"
 	"os"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/getcfs/fuse"
@@ -16,6 +21,7 @@ import (
 	"github.com/gholt/brimtime"
 	"github.com/gholt/store"
 	"github.com/gogo/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spaolacci/murmur3"
 	"golang.org/x/net/context"
 )
@@ -23,7 +29,31 @@ import (
 const (
 	InodeEntryVersion = 1
 	DirEntryVersion   = 1
-	FileBlockVersion  = 1
+	FileBlockVersion  = 2
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// The checksum used for each FileBlockVersion
+var blockChecksums = map[uint32]func() hash.Hash32{
+	1: crc32.NewIEEE,
+	2: func() hash.Hash32 { return crc32.New(castagnoli) },
+}
+
+var checksumMismatches = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "formicd",
+	Name:      "checksum_mismatches_total",
+	Help:      "Number of blocks read that didn't match their checksum.",
+})
+
+func init() {
+	prometheus.MustRegister(checksumMismatches)
+}
+
+// Flags for Rename, these match renameat2
+const (
+	RenameNoReplace = 1
+	RenameExchange  = 2
 )
 
 type FileService interface {
@@ -31,52 +61,124 @@ type FileService interface {
 	GetAttr(ctx context.Context, id []byte) (*pb.Attr, error)
 	SetAttr(ctx context.Context, id []byte, attr *pb.Attr, valid uint32) (*pb.Attr, error)
 	Create(ctx context.Context, parent, id []byte, inode uint64, name string, attr *pb.Attr, isdir bool) (string, *pb.Attr, error)
-	Update(ctx context.Context, id []byte, block, size, blocksize uint64, mtime int64) error
+	Update(ctx context.Context, id []byte, block, size, blocksize uint64, mtime, written int64) error
 	Lookup(ctx context.Context, parent []byte, name string) (string, *pb.Attr, error)
 	ReadDirAll(ctx context.Context, id []byte) (*pb.ReadDirAllResponse, error)
 	Remove(ctx context.Context, parent []byte, name string) (int32, error)
 	Symlink(ctx context.Context, parent, id []byte, name string, target string, attr *pb.Attr, inode uint64) (*pb.SymlinkResponse, error)
+	Link(ctx context.Context, parent, id []byte, name string) (string, *pb.Attr, error)
 	Readlink(ctx context.Context, id []byte) (*pb.ReadlinkResponse, error)
 	Getxattr(ctx context.Context, id []byte, name string) (*pb.GetxattrResponse, error)
 	Setxattr(ctx context.Context, id []byte, name string, value []byte) (*pb.SetxattrResponse, error)
 	Listxattr(ctx context.Context, id []byte) (*pb.ListxattrResponse, error)
 	Removexattr(ctx context.Context, id []byte, name string) (*pb.RemovexattrResponse, error)
-	Rename(ctx context.Context, oldParent, newParent []byte, oldName, newName string) (*pb.RenameResponse, error)
+	Rename(ctx context.Context, oldParent, newParent []byte, oldName, newName string, flags uint32) (*pb.RenameResponse, error)
 	GetChunk(ctx context.Context, id []byte) ([]byte, error)
+	ChunkTimestamp(ctx context.Context, id []byte) (int64, error)
+	GetBlock(ctx context.Context, fsid []byte, inode, block uint64) ([]byte, error)
+	HasBlock(ctx context.Context, fsid []byte, inode, block uint64) (bool, error)
 	WriteChunk(ctx context.Context, id, data []byte) error
+	WriteBlock(ctx context.Context, fsid []byte, inode, block uint64, data []byte) error
+	DropBlockRefs(ctx context.Context, ts *pb.Tombstone, whole bool) error
 	DeleteChunk(ctx context.Context, id []byte, tsm int64) error
 	DeleteListing(ctx context.Context, parent []byte, name string, tsm int64) error
 	GetInode(ctx context.Context, id []byte) (*pb.InodeEntry, error)
 	GetDirent(ctx context.Context, parent []byte, name string) (*pb.DirEntry, error)
+	ReadDirents(ctx context.Context, id []byte) ([]*pb.DirEntry, error)
+	VerifyChunk(ctx context.Context, id []byte) error
+	GetTrash(ctx context.Context, key []byte) (*TrashEntry, error)
+	DeleteTrash(ctx context.Context, key []byte, tsm int64) error
+	AddUsage(ctx context.Context, bytes, blocks, inodes int64)
+	GetUsage(ctx context.Context) (*FileSysStats, error)
+	GetQuota(ctx context.Context) (*Quota, *FileSysStats, error)
+	CheckQuota(ctx context.Context, bytes, inodes int64) error
 }
 
 var ErrStoreHasNewerValue = errors.New("Error store already has newer value")
 var ErrNotFound = errors.New("Not found")
+var ErrIsDir = errors.New("Is a directory")
+var ErrNotEmpty = errors.New("Directory not empty")
+var ErrExists = errors.New("Already exists")
+var ErrChecksumMismatch = errors.New("Checksum mismatch")
+
+// errTruncated is returned by the change in Update when the write is older
+// than the last truncate
+var errTruncated = errors.New("Truncated since written")
 
+// StoreComms reads and writes the stores, keeping what snapshots need of the
+// file system in the context
 type StoreComms struct {
 	vstore store.ValueStore
 	gstore store.GroupStore
+	snaps  *snapshots
+	// contentRefs returns the deduplicated content the value b of id refers
+	// to, which copies of it kept for snapshots need references to as well
+	contentRefs func(ctx context.Context, id, b []byte) ([][]byte, error)
 }
 
 func NewStoreComms(vstore store.ValueStore, gstore store.GroupStore) (*StoreComms, error) {
 	return &StoreComms{
 		vstore: vstore,
 		gstore: gstore,
+		snaps:  newSnapshots(gstore),
 	}, nil
 }
 
 // Helper methods to get data from value and group store
 func (o *StoreComms) ReadValue(ctx context.Context, id []byte) ([]byte, error) {
+	_, v, err := o.ReadValueTS(ctx, id)
+	return v, err
+}
+
+func (o *StoreComms) ReadValueTS(ctx context.Context, id []byte) (int64, []byte, error) {
 	// TODO: You might want to make this whole area pass in reusable []byte to
 	// lessen gc pressure.
+	view, err := o.snaps.view(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if view != nil && view.at != 0 {
+		return o.readValueAt(ctx, view, id)
+	}
 	keyA, keyB := murmur3.Sum128(id)
-	_, v, err := o.vstore.Read(ctx, keyA, keyB, nil)
-	return v, err
+	return o.vstore.Read(ctx, keyA, keyB, nil)
+}
+
+// HasValue returns whether the value exists, without reading it
+func (o *StoreComms) HasValue(ctx context.Context, id []byte) (bool, error) {
+	view, err := o.snaps.view(ctx)
+	if err != nil {
+		return false, err
+	}
+	if view != nil && view.at != 0 {
+		err = o.lookupValueAt(ctx, view, id)
+	} else {
+		keyA, keyB := murmur3.Sum128(id)
+		_, _, err = o.vstore.Lookup(ctx, keyA, keyB)
+	}
+	if store.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// LookupValueTS returns when the value was last written, or 0 if it doesn't
+// exist. Snapshots aren't looked in, as this is for values about to be changed.
+func (o *StoreComms) LookupValueTS(ctx context.Context, id []byte) (int64, error) {
+	keyA, keyB := murmur3.Sum128(id)
+	tsm, _, err := o.vstore.Lookup(ctx, keyA, keyB)
+	if store.IsNotFound(err) {
+		return 0, nil
+	}
+	return tsm, err
 }
 
 func (o *StoreComms) WriteValue(ctx context.Context, id, data []byte) error {
 	keyA, keyB := murmur3.Sum128(id)
 	timestampMicro := brimtime.TimeToUnixMicro(time.Now())
+	if err := o.keepValue(ctx, id, timestampMicro); err != nil {
+		return err
+	}
 	oldTimestampMicro, err := o.vstore.Write(ctx, keyA, keyB, timestampMicro, data)
 	if err != nil {
 		return err
@@ -93,6 +195,9 @@ func (o *StoreComms) DeleteValue(ctx context.Context, id []byte) error {
 }
 
 func (o *StoreComms) DeleteValueTS(ctx context.Context, id []byte, tsm int64) error {
+	if err := o.keepValue(ctx, id, tsm); err != nil {
+		return err
+	}
 	keyA, keyB := murmur3.Sum128(id)
 	oldTimestampMicro, err := o.vstore.Delete(ctx, keyA, keyB, tsm)
 	if oldTimestampMicro >= tsm {
@@ -107,11 +212,14 @@ func (o *StoreComms) WriteGroup(ctx context.Context, key, childKey, value []byte
 }
 
 func (o *StoreComms) WriteGroupTS(ctx context.Context, key, childKey, value []byte, tsm int64) error {
+	if err := o.keepGroupItem(ctx, key, childKey, tsm); err != nil {
+		return err
+	}
 	keyA, keyB := murmur3.Sum128(key)
 	childKeyA, childKeyB := murmur3.Sum128(childKey)
 	oldTimestampMicro, err := o.gstore.Write(ctx, keyA, keyB, childKeyA, childKeyB, tsm, value)
 	if err != nil {
-		return nil
+		return err
 	}
 	if oldTimestampMicro >= tsm {
 		return ErrStoreHasNewerValue
@@ -125,6 +233,13 @@ func (o *StoreComms) ReadGroupItem(ctx context.Context, key, childKey []byte) ([
 }
 
 func (o *StoreComms) ReadGroupItemByKey(ctx context.Context, key []byte, childKeyA, childKeyB uint64) ([]byte, error) {
+	view, err := o.snaps.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if view != nil && view.at != 0 {
+		return o.readGroupItemAt(ctx, view, key, childKeyA, childKeyB)
+	}
 	keyA, keyB := murmur3.Sum128(key)
 	_, v, err := o.gstore.Read(ctx, keyA, keyB, childKeyA, childKeyB, nil)
 	return v, err
@@ -136,6 +251,9 @@ func (o *StoreComms) DeleteGroupItem(ctx context.Context, key, childKey []byte)
 }
 
 func (o *StoreComms) DeleteGroupItemTS(ctx context.Context, key, childKey []byte, tsm int64) error {
+	if err := o.keepGroupItem(ctx, key, childKey, tsm); err != nil {
+		return err
+	}
 	keyA, keyB := murmur3.Sum128(key)
 	childKeyA, childKeyB := murmur3.Sum128(childKey)
 	oldTimestampMicro, err := o.gstore.Delete(ctx, keyA, keyB, childKeyA, childKeyB, tsm)
@@ -149,6 +267,26 @@ func (o *StoreComms) DeleteGroupItemTS(ctx context.Context, key, childKey []byte
 }
 
 func (o *StoreComms) LookupGroup(ctx context.Context, key []byte) ([]store.LookupGroupItem, error) {
+	view, err := o.snaps.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if view != nil && view.at != 0 {
+		items, err := o.readGroupAt(ctx, view, key)
+		if err != nil {
+			return nil, err
+		}
+		lookup := make([]store.LookupGroupItem, len(items))
+		for i, item := range items {
+			lookup[i] = store.LookupGroupItem{
+				ChildKeyA:      item.ChildKeyA,
+				ChildKeyB:      item.ChildKeyB,
+				TimestampMicro: item.TimestampMicro,
+				Length:         uint32(len(item.Value)),
+			}
+		}
+		return lookup, nil
+	}
 	keyA, keyB := murmur3.Sum128(key)
 	items, err := o.gstore.LookupGroup(ctx, keyA, keyB)
 	if err != nil {
@@ -158,6 +296,13 @@ func (o *StoreComms) LookupGroup(ctx context.Context, key []byte) ([]store.Looku
 }
 
 func (o *StoreComms) ReadGroup(ctx context.Context, key []byte) ([]store.ReadGroupItem, error) {
+	view, err := o.snaps.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if view != nil && view.at != 0 {
+		return o.readGroupAt(ctx, view, key)
+	}
 	keyA, keyB := murmur3.Sum128(key)
 	items, err := o.gstore.ReadGroup(ctx, keyA, keyB)
 	if err != nil {
@@ -167,23 +312,131 @@ func (o *StoreComms) ReadGroup(ctx context.Context, key []byte) ([]store.ReadGro
 }
 
 type OortFS struct {
-	hasher     func() hash.Hash32
-	comms      *StoreComms
-	deleteChan chan *DeleteItem
+	sync.RWMutex
+	comms    *StoreComms
+	deletes  *queue
+	nodeId   int
+	keys     *keyRing
+	settings map[string]*fsSettings
+	stats    map[string]*FileSysStats // Not written to the group store yet
+	quotas   map[string]*quotaState
+	blocks   *blockCache // Nil unless blocks are cached
+	// Serializes the changes to each inode through this formicd
+	inodeLocks stripedLocks
 }
 
-func NewOortFS(comms *StoreComms) *OortFS {
-	o := &OortFS{
-		hasher: crc32.NewIEEE,
-		comms:  comms,
+// NewOortFS returns an OortFS that works through the deletes queue in the
+// background. If deletes is nil pending deletes are only kept in memory, and
+// if keys is nil nothing can be encrypted.
+func NewOortFS(comms *StoreComms, deletes *queue, nodeId int, keys *keyRing) *OortFS {
+	if deletes == nil {
+		deletes, _ = newQueue("")
+	}
+	if keys == nil {
+		keys, _ = newKeyRing("")
 	}
-	// TODO: How big should the chan be, or should we have another in memory queue that feeds the chan?
-	o.deleteChan = make(chan *DeleteItem, 1000)
-	deletes := newDeletinator(o.deleteChan, o)
-	go deletes.run()
+	o := &OortFS{
+		comms:    comms,
+		deletes:  deletes,
+		nodeId:   nodeId,
+		keys:     keys,
+		settings: make(map[string]*fsSettings),
+		stats:    make(map[string]*FileSysStats),
+		quotas:   make(map[string]*quotaState),
+	}
+	comms.contentRefs = o.contentRefs
+	go newDeletinator(o.deletes, o).run()
+	go o.flushStats()
 	return o
 }
 
+// fsSettings is how the blocks of a file system are stored, these are set when
+// the file system is created and never change
+type fsSettings struct {
+	compression uint32
+	aead        cipher.AEAD
+	dedup       bool
+	clone       bool          // Blocks not written yet are read from the origin
+	retention   time.Duration // How long removed files are kept in the trash
+}
+
+var noSettings = &fsSettings{}
+
+// fsSettings returns the settings for the file system in the context. Anything
+// without a file system is stored as is.
+func (o *OortFS) fsSettings(ctx context.Context) (*fsSettings, error) {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return noSettings, nil
+	}
+	o.RLock()
+	fs, ok := o.settings[fsid.String()]
+	o.RUnlock()
+	if ok {
+		return fs, nil
+	}
+	fs = &fsSettings{}
+	ctx = unversioned(ctx)
+	key := []byte(fmt.Sprintf("/fs/%s", fsid))
+	attr := FileSysAttr{}
+	b, err := o.comms.ReadGroupItem(ctx, key, []byte("compression"))
+	if err == nil {
+		err = json.Unmarshal(b, &attr)
+		if err == nil {
+			fs.compression, ok = compressionNames[attr.Value]
+			if !ok {
+				err = fmt.Errorf("Unknown compression %s", attr.Value)
+			}
+		}
+	}
+	if err != nil && !store.IsNotFound(err) {
+		return nil, err
+	}
+	b, err = o.comms.ReadGroupItem(ctx, key, []byte("datakey"))
+	if err == nil {
+		err = json.Unmarshal(b, &attr)
+		var dataKey []byte
+		if err == nil {
+			dataKey, err = o.keys.unwrap(fsid.Bytes(), attr.Value)
+		}
+		if err == nil {
+			fs.aead, err = newAEAD(dataKey)
+		}
+	}
+	if err != nil && !store.IsNotFound(err) {
+		return nil, err
+	}
+	b, err = o.comms.ReadGroupItem(ctx, key, []byte("dedup"))
+	if err == nil {
+		err = json.Unmarshal(b, &attr)
+		// Encrypted data differs for every file system, so there is nothing
+		// to share
+		fs.dedup = err == nil && attr.Value == "true" && fs.aead == nil
+	}
+	if err != nil && !store.IsNotFound(err) {
+		return nil, err
+	}
+	_, err = o.comms.ReadGroupItem(ctx, key, []byte("origin"))
+	fs.clone = err == nil
+	if err != nil && !store.IsNotFound(err) {
+		return nil, err
+	}
+	b, err = o.comms.ReadGroupItem(ctx, key, []byte("retention"))
+	if err == nil {
+		err = json.Unmarshal(b, &attr)
+		if err == nil {
+			fs.retention, err = time.ParseDuration(attr.Value)
+		}
+	}
+	if err != nil && !store.IsNotFound(err) {
+		return nil, err
+	}
+	o.Lock()
+	o.settings[fsid.String()] = fs
+	o.Unlock()
+	return fs, nil
+}
+
 func (o *OortFS) InitFs(ctx context.Context, fsid []byte) error {
 	id := formic.GetID(fsid, 1, 0)
 	n, _ := o.GetChunk(ctx, id)
@@ -215,6 +468,7 @@ func (o *OortFS) InitFs(ctx context.Context, fsid []byte) error {
 		if err != nil {
 			return err
 		}
+		o.addInodeUsage(ctx, r, 1)
 	}
 	return nil
 }
@@ -234,47 +488,143 @@ func (o *OortFS) GetAttr(ctx context.Context, id []byte) (*pb.Attr, error) {
 
 func (o *OortFS) SetAttr(ctx context.Context, id []byte, attr *pb.Attr, v uint32) (*pb.Attr, error) {
 	valid := fuse.SetattrValid(v)
-	b, err := o.GetChunk(ctx, id)
-	if err != nil {
-		return &pb.Attr{}, err
-	}
-	n := &pb.InodeEntry{}
-	err = proto.Unmarshal(b, n)
+	var was *FileSysStats
+	var stale []byte
+	n, err := o.updateInode(ctx, id, func(n *pb.InodeEntry) error {
+		was = inodeUsage(n)
+		stale = nil
+		if valid.Mode() {
+			n.Attr.Mode = attr.Mode
+		}
+		if valid.Size() {
+			var err error
+			stale, err = o.truncate(ctx, n, attr.Size)
+			if err != nil {
+				return err
+			}
+		}
+		if valid.Mtime() {
+			n.Attr.Mtime = attr.Mtime
+		}
+		if valid.Atime() {
+			n.Attr.Atime = attr.Atime
+		}
+		if valid.Uid() {
+			n.Attr.Uid = attr.Uid
+		}
+		if valid.Gid() {
+			n.Attr.Gid = attr.Gid
+		}
+		return nil
+	})
 	if err != nil {
 		return &pb.Attr{}, err
 	}
-	if valid.Mode() {
-		n.Attr.Mode = attr.Mode
-	}
-	if valid.Size() {
-		if n.Attr.Size == 0 {
-			n.Blocks = 0
-			n.LastBlock = 0
+	is := inodeUsage(n)
+	o.addUsage(ctx, is.Bytes-was.Bytes, is.Blocks-was.Blocks, 0)
+	if stale != nil {
+		// The trimmed last block no longer refers to its old content
+		fsid, err := GetFsId(ctx)
+		if err == nil {
+			block := formic.GetID(fsid.Bytes(), n.Inode, n.Blocks)
+			err = o.comms.dropRef(ctx, stale, block)
+		}
+		if err != nil {
+			log.Printf("ERR: Couldn't drop reference to %x: %s", stale, err)
 		}
-		n.Attr.Size = attr.Size
-	}
-	if valid.Mtime() {
-		n.Attr.Mtime = attr.Mtime
-	}
-	if valid.Atime() {
-		n.Attr.Atime = attr.Atime
-	}
-	if valid.Uid() {
-		n.Attr.Uid = attr.Uid
-	}
-	if valid.Gid() {
-		n.Attr.Gid = attr.Gid
 	}
-	b, err = proto.Marshal(n)
+
+	return n.Attr, nil
+}
+
+// truncate sets the size of the file. Blocks past the new end of the file are
+// queued for deletion and the new last block is trimmed, so that growing the
+// file again reads back zeros. If the trimmed block is deduplicated, the hash
+// of the content it had is returned to drop once the inode is written.
+func (o *OortFS) truncate(ctx context.Context, n *pb.InodeEntry, size uint64) ([]byte, error) {
+	if size < n.Attr.Size {
+		// Updates for writes before now are stale, see Update
+		n.Truncated = brimtime.TimeToUnixMicro(time.Now())
+	}
+	if n.BlockSize == 0 {
+		// Nothing has been written yet, so there are no blocks
+		n.Attr.Size = size
+		return nil, nil
+	}
+	fsid, err := GetFsId(ctx)
 	if err != nil {
-		return &pb.Attr{}, err
+		return nil, err
 	}
-	err = o.WriteChunk(ctx, id, b)
+	fs, err := o.fsSettings(ctx)
 	if err != nil {
-		return &pb.Attr{}, err
+		return nil, err
+	}
+	var stale []byte
+	blocks, lastBlock := blocksForSize(size, n.BlockSize)
+	if size < n.Attr.Size {
+		if blocks > 0 && blocks <= n.Blocks && lastBlock < n.BlockSize {
+			id := formic.GetID(fsid.Bytes(), n.Inode, blocks) // block 0 is for inode data
+			data, err := o.readFileBlock(ctx, n, blocks-1)
+			if err != nil && err != ErrNotFound {
+				return nil, err
+			}
+			if uint64(len(data)) > lastBlock && fs.dedup {
+				// The inode is being changed already, so the block map is
+				// set here rather than through WriteBlock
+				hash, err := o.writeContent(ctx, id, data[:lastBlock])
+				if err != nil {
+					return nil, err
+				}
+				stale = setBlockHash(n, blocks-1, hash)
+			} else if uint64(len(data)) > lastBlock {
+				err = o.WriteChunk(ctx, id, data[:lastBlock])
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		// Blocks written but not yet added to the size are cut off as well
+		hashes := trimBlockHashes(n, blocks)
+		end := n.Blocks
+		if blocks+uint64(len(hashes)) > end {
+			end = blocks + uint64(len(hashes))
+		}
+		if blocks < end {
+			tsm := brimtime.TimeToUnixMicro(time.Now())
+			err = o.deletes.push(&DeleteItem{
+				ts: &pb.Tombstone{
+					Dtime:      tsm,
+					Qtime:      tsm,
+					FsId:       fsid.Bytes(),
+					Inode:      n.Inode,
+					FirstBlock: blocks,
+					Blocks:     end,
+					Hashes:     hashes,
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
+	n.Attr.Size = size
+	n.Blocks = blocks
+	n.LastBlock = lastBlock
+	if n.OriginBlocks > blocks {
+		// Growing the file again mustn't bring back the origin's blocks
+		n.OriginBlocks = blocks
+	}
+	return stale, nil
+}
 
-	return n.Attr, nil
+// blocksForSize returns how many blocks a file of size takes up, and how much
+// of the last block is used.
+func blocksForSize(size, blocksize uint64) (uint64, uint64) {
+	if size == 0 {
+		return 0, 0
+	}
+	blocks := (size + blocksize - 1) / blocksize
+	return blocks, size - (blocks-1)*blocksize
 }
 
 func (o *OortFS) Create(ctx context.Context, parent, id []byte, inode uint64, name string, attr *pb.Attr, isdir bool) (string, *pb.Attr, error) {
@@ -316,11 +666,12 @@ func (o *OortFS) Create(ctx context.Context, parent, id []byte, inode uint64, na
 	}
 	// Add the inode entry
 	n := &pb.InodeEntry{
-		Version: InodeEntryVersion,
-		Inode:   inode,
-		IsDir:   isdir,
-		Attr:    attr,
-		Blocks:  0,
+		Version:   InodeEntryVersion,
+		Inode:     inode,
+		IsDir:     isdir,
+		Attr:      attr,
+		Blocks:    0,
+		NodeCount: 1,
 	}
 	b, err = proto.Marshal(n)
 	if err != nil {
@@ -330,27 +681,20 @@ func (o *OortFS) Create(ctx context.Context, parent, id []byte, inode uint64, na
 	if err != nil {
 		return "", &pb.Attr{}, err
 	}
+	o.addInodeUsage(ctx, n, 1)
 	return name, attr, nil
 }
 
 func (o *OortFS) Lookup(ctx context.Context, parent []byte, name string) (string, *pb.Attr, error) {
 	// Get the id
-	b, err := o.comms.ReadGroupItem(ctx, parent, []byte(name))
-	if store.IsNotFound(err) {
+	d, err := o.getDirent(ctx, parent, name)
+	if err == ErrNotFound {
 		return "", &pb.Attr{}, nil
 	} else if err != nil {
 		return "", &pb.Attr{}, err
 	}
-	d := &pb.DirEntry{}
-	err = proto.Unmarshal(b, d)
-	if err != nil {
-		return "", &pb.Attr{}, err
-	}
-	if d.Tombstone != nil {
-		return "", &pb.Attr{}, nil
-	}
 	// Get the Inode entry
-	b, err = o.GetChunk(ctx, d.Id)
+	b, err := o.GetChunk(ctx, d.Id)
 	if err != nil {
 		return "", &pb.Attr{}, err
 	}
@@ -397,6 +741,17 @@ func (o *OortFS) ReadDirAll(ctx context.Context, id []byte) (*pb.ReadDirAllRespo
 			// Skip deleted entries
 			continue
 		}
+		if dirent.Rename != nil {
+			// Finish the rename that was interrupted
+			err = o.finishRename(ctx, id, dirent)
+			if err != nil {
+				return &pb.ReadDirAllResponse{}, err
+			}
+			if !dirent.Rename.Exchange {
+				continue
+			}
+			dirent.Type = dirent.Rename.ReplacedType
+		}
 		e.DirEntries = append(e.DirEntries, &pb.DirEnt{Name: dirent.Name, Type: dirent.Type})
 	}
 	sort.Sort(ByDirent(e.DirEntries))
@@ -405,33 +760,66 @@ func (o *OortFS) ReadDirAll(ctx context.Context, id []byte) (*pb.ReadDirAllRespo
 
 func (o *OortFS) Remove(ctx context.Context, parent []byte, name string) (int32, error) {
 	// Get the ID from the group list
-	b, err := o.comms.ReadGroupItem(ctx, parent, []byte(name))
-	if store.IsNotFound(err) {
+	d, err := o.getDirent(ctx, parent, name)
+	if err == ErrNotFound {
 		return 1, nil
 	} else if err != nil {
 		return 1, err
 	}
-	d := &pb.DirEntry{}
-	err = proto.Unmarshal(b, d)
+	// TODO: More error handling needed
+	// TODO: Handle possible race conditions where user writes and deletes the same file over and over
+	inode, err := o.GetInode(ctx, d.Id)
 	if err != nil {
 		return 1, err
 	}
-	// TODO: More error handling needed
-	// TODO: Handle possible race conditions where user writes and deletes the same file over and over
+	if inode.IsDir {
+		empty, err := o.isEmpty(ctx, d.Id)
+		if err != nil {
+			return 1, err
+		}
+		if !empty {
+			return 1, ErrNotEmpty
+		}
+	}
+	if linkCount(inode) > 1 {
+		// Other links still point at the inode, so only the name goes away.
+		// The name is removed before the count is dropped, so a failure in
+		// between leaves the count too high instead of too low
+		err = o.comms.DeleteGroupItem(ctx, parent, []byte(name))
+		if err != nil {
+			return 1, err
+		}
+		err = o.dropLink(ctx, d.Id)
+		if err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+	fs, err := o.fsSettings(ctx)
+	if err != nil {
+		return 1, err
+	}
+	if fs.retention > 0 && !skipTrash(ctx) {
+		err = o.trash(ctx, parent, d, inode, fs.retention)
+		if err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
 	// Mark the item deleted in the group
 	t := &pb.Tombstone{}
 	tsm := brimtime.TimeToUnixMicro(time.Now())
 	t.Dtime = tsm
 	t.Qtime = tsm
-	t.FsId = []byte("1") // TODO: Make sure this gets set when we are tracking fsids
-	inode, err := o.GetInode(ctx, d.Id)
+	fsid, err := GetFsId(ctx)
 	if err != nil {
 		return 1, err
 	}
+	t.FsId = fsid.Bytes()
 	t.Blocks = inode.Blocks
 	t.Inode = inode.Inode
 	d.Tombstone = t
-	b, err = proto.Marshal(d)
+	b, err := proto.Marshal(d)
 	if err != nil {
 		return 1, err
 	}
@@ -440,44 +828,74 @@ func (o *OortFS) Remove(ctx context.Context, parent []byte, name string) (int32,
 	if err != nil {
 		return 1, err // Not really sure what should be done here to try to recover from err
 	}
-	o.deleteChan <- &DeleteItem{
+	err = o.deletes.push(&DeleteItem{
 		parent: parent,
 		name:   name,
+	})
+	if err != nil {
+		return 1, err
 	}
+	o.addInodeUsage(ctx, inode, -1)
 	return 0, nil
 }
 
-func (o *OortFS) Update(ctx context.Context, id []byte, block, blocksize, size uint64, mtime int64) error {
-	b, err := o.GetChunk(ctx, id)
-	if err != nil {
-		return err
+// isEmpty returns true if the directory has no entries that haven't been deleted
+func (o *OortFS) isEmpty(ctx context.Context, id []byte) (bool, error) {
+	items, err := o.comms.ReadGroup(ctx, id)
+	if store.IsNotFound(err) {
+		return true, nil
 	}
-	n := &pb.InodeEntry{}
-	err = proto.Unmarshal(b, n)
 	if err != nil {
-		return err
+		return false, err
 	}
-	blocks := n.Blocks
-	if block >= blocks {
-		n.Blocks = block + 1
-		n.LastBlock = size
-		n.BlockSize = blocksize
-		n.Attr.Size = blocksize*block + size
-	} else if block == (blocks - 1) {
-		n.LastBlock = size
-		n.Attr.Size = blocksize*block + size
-	}
-	if mtime > n.Attr.Mtime {
-		n.Attr.Mtime = mtime
+	dirent := &pb.DirEntry{}
+	for _, item := range items {
+		err = proto.Unmarshal(item.Value, dirent)
+		if err != nil {
+			return false, err
+		}
+		if dirent.Tombstone == nil {
+			return false, nil
+		}
 	}
-	b, err = proto.Marshal(n)
-	if err != nil {
-		return err
+	return true, nil
+}
+
+// Update grows the file to cover a write done at written, timestamp micro,
+// unless the file was shrunk since. The write's blocks past the new end are
+// being deleted then, and it can't grow the file back over them.
+func (o *OortFS) Update(ctx context.Context, id []byte, block, blocksize, size uint64, mtime, written int64) error {
+	var was *FileSysStats
+	n, err := o.updateInode(ctx, id, func(n *pb.InodeEntry) error {
+		if written < n.Truncated {
+			return errTruncated
+		}
+		bs := blocksize
+		if n.BlockSize > 0 {
+			// Files keep the block size they were first written with
+			bs = n.BlockSize
+		} else {
+			n.BlockSize = bs
+		}
+		was = inodeUsage(n)
+		// Writes only grow the file, shrinking is done with a truncate
+		if bs*block+size > n.Attr.Size {
+			n.Attr.Size = bs*block + size
+		}
+		n.Blocks, n.LastBlock = blocksForSize(n.Attr.Size, bs)
+		if mtime > n.Attr.Mtime {
+			n.Attr.Mtime = mtime
+		}
+		return nil
+	})
+	if err == errTruncated {
+		return nil
 	}
-	err = o.WriteChunk(ctx, id, b)
 	if err != nil {
 		return err
 	}
+	is := inodeUsage(n)
+	o.addUsage(ctx, is.Bytes-was.Bytes, is.Blocks-was.Blocks, 0)
 	return nil
 }
 
@@ -492,12 +910,13 @@ func (o *OortFS) Symlink(ctx context.Context, parent, id []byte, name string, ta
 		return &pb.SymlinkResponse{}, nil
 	}
 	n := &pb.InodeEntry{
-		Version: InodeEntryVersion,
-		Inode:   inode,
-		IsDir:   false,
-		IsLink:  true,
-		Target:  target,
-		Attr:    attr,
+		Version:   InodeEntryVersion,
+		Inode:     inode,
+		IsDir:     false,
+		IsLink:    true,
+		Target:    target,
+		Attr:      attr,
+		NodeCount: 1,
 	}
 	b, err := proto.Marshal(n)
 	if err != nil {
@@ -507,6 +926,7 @@ func (o *OortFS) Symlink(ctx context.Context, parent, id []byte, name string, ta
 	if err != nil {
 		return &pb.SymlinkResponse{}, err
 	}
+	o.addInodeUsage(ctx, n, 1)
 	// Add the name to the group
 	d := &pb.DirEntry{
 		Version: DirEntryVersion,
@@ -525,6 +945,60 @@ func (o *OortFS) Symlink(ctx context.Context, parent, id []byte, name string, ta
 	return &pb.SymlinkResponse{Name: name, Attr: attr}, nil
 }
 
+func (o *OortFS) Link(ctx context.Context, parent, id []byte, name string) (string, *pb.Attr, error) {
+	// Check to see if the name already exists
+	b, err := o.comms.ReadGroupItem(ctx, parent, []byte(name))
+	if err != nil && !store.IsNotFound(err) {
+		return "", &pb.Attr{}, err
+	}
+	p := &pb.DirEntry{}
+	err = proto.Unmarshal(b, p)
+	if err != nil {
+		return "", &pb.Attr{}, err
+	}
+	if len(b) > 0 && p.Tombstone == nil {
+		return "", &pb.Attr{}, nil
+	}
+	// Bump the link count before adding the name, so a failure in between
+	// leaves the count too high instead of too low
+	n, err := o.updateInode(ctx, id, func(n *pb.InodeEntry) error {
+		if n.IsDir {
+			return ErrIsDir
+		}
+		n.NodeCount = linkCount(n) + 1
+		n.Attr.Nlink = uint32(n.NodeCount)
+		n.Attr.Ctime = time.Now().Unix()
+		return nil
+	})
+	if err != nil {
+		return "", &pb.Attr{}, err
+	}
+	d := &pb.DirEntry{
+		Version: DirEntryVersion,
+		Name:    name,
+		Id:      id,
+		Type:    uint32(fuse.DT_File),
+	}
+	b, err = proto.Marshal(d)
+	if err != nil {
+		return "", &pb.Attr{}, err
+	}
+	err = o.comms.WriteGroup(ctx, parent, []byte(name), b)
+	if err != nil {
+		return "", &pb.Attr{}, err
+	}
+	return name, n.Attr, nil
+}
+
+// linkCount returns the number of links to the inode. Inodes created before
+// links were counted have a count of 0, but always have one link.
+func linkCount(n *pb.InodeEntry) uint64 {
+	if n.NodeCount == 0 {
+		return 1
+	}
+	return n.NodeCount
+}
+
 func (o *OortFS) Readlink(ctx context.Context, id []byte) (*pb.ReadlinkResponse, error) {
 	b, err := o.GetChunk(ctx, id)
 	if err != nil {
@@ -555,24 +1029,13 @@ func (o *OortFS) Getxattr(ctx context.Context, id []byte, name string) (*pb.Getx
 }
 
 func (o *OortFS) Setxattr(ctx context.Context, id []byte, name string, value []byte) (*pb.SetxattrResponse, error) {
-	b, err := o.GetChunk(ctx, id)
-	if err != nil {
-		return &pb.SetxattrResponse{}, err
-	}
-	n := &pb.InodeEntry{}
-	err = proto.Unmarshal(b, n)
-	if err != nil {
-		return &pb.SetxattrResponse{}, err
-	}
-	if n.Xattr == nil {
-		n.Xattr = make(map[string][]byte)
-	}
-	n.Xattr[name] = value
-	b, err = proto.Marshal(n)
-	if err != nil {
-		return &pb.SetxattrResponse{}, err
-	}
-	err = o.WriteChunk(ctx, id, b)
+	_, err := o.updateInode(ctx, id, func(n *pb.InodeEntry) error {
+		if n.Xattr == nil {
+			n.Xattr = make(map[string][]byte)
+		}
+		n.Xattr[name] = value
+		return nil
+	})
 	if err != nil {
 		return &pb.SetxattrResponse{}, err
 	}
@@ -600,60 +1063,266 @@ func (o *OortFS) Listxattr(ctx context.Context, id []byte) (*pb.ListxattrRespons
 }
 
 func (o *OortFS) Removexattr(ctx context.Context, id []byte, name string) (*pb.RemovexattrResponse, error) {
-	b, err := o.GetChunk(ctx, id)
+	_, err := o.updateInode(ctx, id, func(n *pb.InodeEntry) error {
+		delete(n.Xattr, name)
+		return nil
+	})
 	if err != nil {
 		return &pb.RemovexattrResponse{}, err
 	}
-	n := &pb.InodeEntry{}
-	err = proto.Unmarshal(b, n)
+	return &pb.RemovexattrResponse{}, nil
+}
+
+func (o *OortFS) Rename(ctx context.Context, oldParent, newParent []byte, oldName, newName string, flags uint32) (*pb.RenameResponse, error) {
+	d, err := o.getDirent(ctx, oldParent, oldName)
 	if err != nil {
-		return &pb.RemovexattrResponse{}, err
+		return &pb.RenameResponse{}, err
 	}
-	delete(n.Xattr, name)
-	b, err = proto.Marshal(n)
+	target, err := o.getDirent(ctx, newParent, newName)
+	if err != nil && err != ErrNotFound {
+		return &pb.RenameResponse{}, err
+	}
+	if target != nil && bytes.Equal(target.Id, d.Id) {
+		// Both names are links to the same inode, so there is nothing to do
+		return &pb.RenameResponse{}, nil
+	}
+	tsm := brimtime.TimeToUnixMicro(time.Now())
+	intent := &pb.RenameIntent{
+		NewParent: newParent,
+		NewName:   newName,
+		Tsm:       tsm,
+	}
+	if flags&RenameExchange != 0 {
+		if target == nil {
+			return &pb.RenameResponse{}, ErrNotFound
+		}
+		intent.Exchange = true
+		intent.Replaced = target.Id
+		intent.ReplacedType = target.Type
+	} else if target != nil {
+		if flags&RenameNoReplace != 0 {
+			return &pb.RenameResponse{}, ErrExists
+		}
+		if target.Type == uint32(fuse.DT_Dir) {
+			empty, err := o.isEmpty(ctx, target.Id)
+			if err != nil {
+				return &pb.RenameResponse{}, err
+			}
+			if !empty {
+				return &pb.RenameResponse{}, ErrNotEmpty
+			}
+		}
+		intent.Replaced = target.Id
+		intent.ReplacedType = target.Type
+	}
+	// Record the rename on the old entry first, so that if we fail part way
+	// through whoever reads the entry next can finish the rename.
+	// NOTE: tsm-1 is for the same reason as in Remove, the old entry is deleted with tsm
+	d.Rename = intent
+	b, err := proto.Marshal(d)
 	if err != nil {
-		return &pb.RemovexattrResponse{}, err
+		return &pb.RenameResponse{}, err
 	}
-	err = o.WriteChunk(ctx, id, b)
+	err = o.comms.WriteGroupTS(ctx, oldParent, []byte(oldName), b, tsm-1)
 	if err != nil {
-		return &pb.RemovexattrResponse{}, err
+		return &pb.RenameResponse{}, err
 	}
-	return &pb.RemovexattrResponse{}, nil
+	return &pb.RenameResponse{}, o.finishRename(ctx, oldParent, d)
 }
 
-func (o *OortFS) Rename(ctx context.Context, oldParent, newParent []byte, oldName, newName string) (*pb.RenameResponse, error) {
-	// Get the ID from the group list
-	b, err := o.comms.ReadGroupItem(ctx, oldParent, []byte(oldName))
+// finishRename completes the rename recorded on the entry. It is safe to run
+// more than once, so it is used both by Rename and to recover interrupted
+// renames.
+func (o *OortFS) finishRename(ctx context.Context, parent []byte, d *pb.DirEntry) error {
+	r := d.Rename
+	moved := &pb.DirEntry{
+		Version: DirEntryVersion,
+		Name:    r.NewName,
+		Id:      d.Id,
+		Type:    d.Type,
+	}
+	b, err := proto.Marshal(moved)
+	if err != nil {
+		return err
+	}
+	err = o.comms.WriteGroupTS(ctx, r.NewParent, []byte(r.NewName), b, r.Tsm)
+	if err != nil && err != ErrStoreHasNewerValue {
+		return err
+	}
+	if r.Exchange {
+		swapped := &pb.DirEntry{
+			Version: DirEntryVersion,
+			Name:    d.Name,
+			Id:      r.Replaced,
+			Type:    r.ReplacedType,
+		}
+		b, err = proto.Marshal(swapped)
+		if err != nil {
+			return err
+		}
+		err = o.comms.WriteGroupTS(ctx, parent, []byte(d.Name), b, r.Tsm)
+		if err != nil && err != ErrStoreHasNewerValue {
+			return err
+		}
+		return nil
+	}
+	err = o.comms.DeleteGroupItemTS(ctx, parent, []byte(d.Name), r.Tsm)
+	if err != nil && err != ErrStoreHasNewerValue && !store.IsNotFound(err) {
+		return err
+	}
+	// The replaced entry is only unlinked once the old name is gone, so this
+	// can't happen twice. A failure here leaves the replaced data orphaned
+	// rather than dropping a link that is still in use.
+	if r.Replaced != nil {
+		replaced := &pb.DirEntry{
+			Version: DirEntryVersion,
+			Name:    r.NewName,
+			Id:      r.Replaced,
+			Type:    r.ReplacedType,
+		}
+		return o.unlink(ctx, r.NewParent, replaced, r.Tsm)
+	}
+	return nil
+}
+
+// getDirent returns the entry for name if it exists and hasn't been deleted,
+// finishing any interrupted rename of the entry first.
+func (o *OortFS) getDirent(ctx context.Context, parent []byte, name string) (*pb.DirEntry, error) {
+	b, err := o.comms.ReadGroupItem(ctx, parent, []byte(name))
 	if store.IsNotFound(err) {
-		return &pb.RenameResponse{}, nil
+		return nil, ErrNotFound
 	}
 	if err != nil {
-		return &pb.RenameResponse{}, err
+		return nil, err
 	}
 	d := &pb.DirEntry{}
 	err = proto.Unmarshal(b, d)
 	if err != nil {
-		return &pb.RenameResponse{}, err
+		return nil, err
+	}
+	if d.Tombstone != nil {
+		return nil, ErrNotFound
+	}
+	if d.Rename != nil {
+		err = o.finishRename(ctx, parent, d)
+		if err != nil {
+			return nil, err
+		}
+		if !d.Rename.Exchange {
+			return nil, ErrNotFound
+		}
+		// The name now belongs to the entry it was exchanged with
+		return &pb.DirEntry{
+			Version: DirEntryVersion,
+			Name:    name,
+			Id:      d.Rename.Replaced,
+			Type:    d.Rename.ReplacedType,
+		}, nil
+	}
+	return d, nil
+}
+
+// unlink drops a link to the inode of the entry once its name is gone,
+// queueing the inode and its blocks for deletion when it was the last link.
+// With a retention period the entry goes to the trash instead, as in Remove.
+func (o *OortFS) unlink(ctx context.Context, parent []byte, d *pb.DirEntry, tsm int64) error {
+	id := d.Id
+	n, err := o.GetInode(ctx, id)
+	if err == ErrNotFound {
+		return nil
 	}
-	// TODO: Handle orphaned data from overwrites
-	// Create new entry
-	d.Name = newName
-	b, err = proto.Marshal(d)
-	err = o.comms.WriteGroup(ctx, newParent, []byte(newName), b)
 	if err != nil {
-		return &pb.RenameResponse{}, err
+		return err
 	}
-	// Delete old entry
-	err = o.comms.DeleteGroupItem(ctx, oldParent, []byte(oldName))
+	if linkCount(n) > 1 {
+		return o.dropLink(ctx, id)
+	}
+	fs, err := o.fsSettings(ctx)
 	if err != nil {
-		// TODO: Handle errors
-		// If we fail here then we will have two entries
-		return &pb.RenameResponse{}, err
+		return err
+	}
+	if fs.retention > 0 {
+		return o.trashReplaced(ctx, parent, d, n, fs.retention)
+	}
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return err
+	}
+	err = o.deletes.push(&DeleteItem{
+		ts: &pb.Tombstone{
+			Dtime:  tsm,
+			Qtime:  tsm,
+			FsId:   fsid.Bytes(),
+			Inode:  n.Inode,
+			Blocks: n.Blocks,
+		},
+		id: id,
+	})
+	if err != nil {
+		return err
 	}
-	return &pb.RenameResponse{}, nil
+	o.addInodeUsage(ctx, n, -1)
+	return nil
+}
+
+// dropLink decrements the link count of the inode
+func (o *OortFS) dropLink(ctx context.Context, id []byte) error {
+	_, err := o.updateInode(ctx, id, func(n *pb.InodeEntry) error {
+		n.NodeCount = linkCount(n) - 1
+		n.Attr.Nlink = uint32(n.NodeCount)
+		n.Attr.Ctime = time.Now().Unix()
+		return nil
+	})
+	return err
+}
+
+// updateInode reads the inode, changes it and writes it back, one change to
+// the inode at a time. change is run again if the inode is written through
+// another formicd in the meantime.
+func (o *OortFS) updateInode(ctx context.Context, id []byte, change func(n *pb.InodeEntry) error) (*pb.InodeEntry, error) {
+	defer o.inodeLocks.lock(id).Unlock()
+	var n *pb.InodeEntry
+	err := optimistically(ctx, o, id, func(check func() error) error {
+		var err error
+		n, err = o.GetInode(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = change(n)
+		if err != nil {
+			return err
+		}
+		b, err := proto.Marshal(n)
+		if err != nil {
+			return err
+		}
+		err = check()
+		if err != nil {
+			return err
+		}
+		return o.WriteChunk(ctx, id, b)
+	})
+	return n, err
 }
 
 func (o *OortFS) GetChunk(ctx context.Context, id []byte) ([]byte, error) {
+	fb, err := o.readBlock(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return fb.Data, nil
+}
+
+// ChunkTimestamp returns when the chunk was last written, or 0 if it doesn't
+// exist
+func (o *OortFS) ChunkTimestamp(ctx context.Context, id []byte) (int64, error) {
+	return o.comms.LookupValueTS(ctx, id)
+}
+
+// readBlock reads, decrypts and decompresses the block, returning
+// ErrChecksumMismatch if the data doesn't match the checksum for the block's
+// version
+func (o *OortFS) readBlock(ctx context.Context, id []byte) (*pb.FileBlock, error) {
 	b, err := o.comms.ReadValue(ctx, id)
 	if store.IsNotFound(err) {
 		return nil, ErrNotFound
@@ -661,23 +1330,107 @@ func (o *OortFS) GetChunk(ctx context.Context, id []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return o.decodeBlock(ctx, id, b)
+}
+
+// decodeBlock is readBlock for the block b already read from the store
+func (o *OortFS) decodeBlock(ctx context.Context, id, b []byte) (*pb.FileBlock, error) {
 	fb := &pb.FileBlock{}
-	err = proto.Unmarshal(b, fb)
+	err := proto.Unmarshal(b, fb)
 	if err != nil {
 		return nil, err
 	}
-	// TODO: Validate checksum and handle errors
-	return fb.Data, nil
+	hasher, ok := blockChecksums[fb.Version]
+	if !ok {
+		return nil, fmt.Errorf("Unknown file block version %d", fb.Version)
+	}
+	crc := hasher()
+	encrypted := fb.Encryption != EncryptionNone
+	if encrypted {
+		// Encrypted blocks are checked before decrypting, so the checksum
+		// doesn't give anything away about the data
+		crc.Write(fb.Data)
+		if crc.Sum32() != fb.Checksum {
+			return nil, o.checksumMismatch(id)
+		}
+		if fb.Encryption != EncryptionAESGCM {
+			return nil, fmt.Errorf("Unknown encryption %d", fb.Encryption)
+		}
+		fs, err := o.fsSettings(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if fs.aead == nil {
+			return nil, fmt.Errorf("No data key for encrypted block %x", id)
+		}
+		fb.Data, err = decrypt(fs.aead, id, fb.Data)
+		if err != nil {
+			return nil, o.checksumMismatch(id)
+		}
+		fb.Encryption = EncryptionNone
+	}
+	if fb.Compression != CompressionNone {
+		fb.Data, err = decompress(fb.Compression, fb.Data)
+		if err != nil {
+			// Corrupt compressed data can't be trusted any more than a bad
+			// checksum
+			log.Printf("ERR: Couldn't decompress block %x: %s", id, err)
+			return nil, o.checksumMismatch(id)
+		}
+		fb.Compression = CompressionNone
+	}
+	if !encrypted {
+		crc.Write(fb.Data)
+		if crc.Sum32() != fb.Checksum {
+			return nil, o.checksumMismatch(id)
+		}
+	}
+	return fb, nil
+}
+
+func (o *OortFS) checksumMismatch(id []byte) error {
+	checksumMismatches.Inc()
+	log.Printf("ERR: Checksum mismatch on block %x", id)
+	return ErrChecksumMismatch
 }
 
 func (o *OortFS) WriteChunk(ctx context.Context, id, data []byte) error {
-	crc := o.hasher()
-	crc.Write(data)
+	defer o.blocks.invalidate(id)
+	fs, err := o.fsSettings(ctx)
+	if err != nil {
+		return err
+	}
 	fb := &pb.FileBlock{
-		Version:  FileBlockVersion,
-		Data:     data,
-		Checksum: crc.Sum32(),
+		Version: FileBlockVersion,
+		Data:    data,
 	}
+	if fs.compression != CompressionNone {
+		c, err := compress(fs.compression, data)
+		if err != nil {
+			return err
+		}
+		// Only keep it compressed if it saves enough to be worth the cost of
+		// decompressing on every read
+		if len(c) < len(data)-len(data)/8 {
+			fb.Data = c
+			fb.Compression = fs.compression
+			o.addSaved(ctx, int64(len(data)-len(c)))
+		}
+	}
+	if fs.aead != nil {
+		fb.Data, err = encrypt(fs.aead, id, fb.Data)
+		if err != nil {
+			return err
+		}
+		fb.Encryption = EncryptionAESGCM
+	}
+	crc := blockChecksums[FileBlockVersion]()
+	if fb.Encryption != EncryptionNone {
+		crc.Write(fb.Data)
+	} else {
+		crc.Write(data)
+	}
+	fb.Checksum = crc.Sum32()
 	b, err := proto.Marshal(fb)
 	if err != nil {
 		return err
@@ -686,6 +1439,7 @@ func (o *OortFS) WriteChunk(ctx context.Context, id, data []byte) error {
 }
 
 func (o *OortFS) DeleteChunk(ctx context.Context, id []byte, tsm int64) error {
+	defer o.blocks.invalidate(id)
 	return o.comms.DeleteValueTS(ctx, id, tsm)
 }
 
@@ -722,3 +1476,30 @@ func (o *OortFS) GetDirent(ctx context.Context, parent []byte, name string) (*pb
 	}
 	return d, nil
 }
+
+// ReadDirents returns every entry in the directory, including the ones that
+// are deleted or being renamed
+func (o *OortFS) ReadDirents(ctx context.Context, id []byte) ([]*pb.DirEntry, error) {
+	items, err := o.comms.ReadGroup(ctx, id)
+	if store.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dirents := make([]*pb.DirEntry, len(items))
+	for i, item := range items {
+		dirents[i] = &pb.DirEntry{}
+		err = proto.Unmarshal(item.Value, dirents[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirents, nil
+}
+
+// VerifyChunk checks the stored data against its checksum
+func (o *OortFS) VerifyChunk(ctx context.Context, id []byte) error {
+	_, err := o.readBlock(ctx, id)
+	return err
+}
@@ -0,0 +1,1151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/creiht/formic"
+	pb "github.com/creiht/formic/proto"
+	"github.com/getcfs/fuse"
+	"github.com/gholt/brimtime"
+	"github.com/gholt/store"
+	"github.com/gogo/protobuf/proto"
+	"github.com/satori/go.uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+type memValue struct {
+	ts      int64
+	value   []byte
+	deleted bool
+}
+
+// memValueStore is an in memory value store for testing OortFS
+type memValueStore struct {
+	store.ValueStore
+	sync.Mutex
+	values map[[2]uint64]*memValue
+}
+
+func (m *memValueStore) Read(ctx context.Context, keyA, keyB uint64, value []byte) (int64, []byte, error) {
+	m.Lock()
+	defer m.Unlock()
+	v, ok := m.values[[2]uint64{keyA, keyB}]
+	if !ok || v.deleted {
+		return 0, nil, store.ErrNotFound
+	}
+	return v.ts, append(value, v.value...), nil
+}
+
+func (m *memValueStore) Lookup(ctx context.Context, keyA, keyB uint64) (int64, uint32, error) {
+	m.Lock()
+	defer m.Unlock()
+	v, ok := m.values[[2]uint64{keyA, keyB}]
+	if !ok || v.deleted {
+		return 0, 0, store.ErrNotFound
+	}
+	return v.ts, uint32(len(v.value)), nil
+}
+
+func (m *memValueStore) Write(ctx context.Context, keyA, keyB uint64, ts int64, value []byte) (int64, error) {
+	return m.set(keyA, keyB, &memValue{ts: ts, value: append([]byte{}, value...)}), nil
+}
+
+func (m *memValueStore) Delete(ctx context.Context, keyA, keyB uint64, ts int64) (int64, error) {
+	return m.set(keyA, keyB, &memValue{ts: ts, deleted: true}), nil
+}
+
+func (m *memValueStore) set(keyA, keyB uint64, v *memValue) int64 {
+	m.Lock()
+	defer m.Unlock()
+	old, ok := m.values[[2]uint64{keyA, keyB}]
+	if ok && old.ts >= v.ts {
+		return old.ts
+	}
+	m.values[[2]uint64{keyA, keyB}] = v
+	if ok {
+		return old.ts
+	}
+	return 0
+}
+
+// memGroupStore is an in memory group store for testing OortFS
+type memGroupStore struct {
+	store.GroupStore
+	sync.Mutex
+	groups map[[2]uint64]map[[2]uint64]*memValue
+	// Returned by every write if set
+	fail error
+}
+
+func (m *memGroupStore) Read(ctx context.Context, parentKeyA, parentKeyB, childKeyA, childKeyB uint64, value []byte) (int64, []byte, error) {
+	m.Lock()
+	defer m.Unlock()
+	v, ok := m.groups[[2]uint64{parentKeyA, parentKeyB}][[2]uint64{childKeyA, childKeyB}]
+	if !ok || v.deleted {
+		return 0, nil, store.ErrNotFound
+	}
+	return v.ts, append(value, v.value...), nil
+}
+
+func (m *memGroupStore) ReadGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.ReadGroupItem, error) {
+	m.Lock()
+	defer m.Unlock()
+	var items []store.ReadGroupItem
+	for k, v := range m.groups[[2]uint64{parentKeyA, parentKeyB}] {
+		if v.deleted {
+			continue
+		}
+		items = append(items, store.ReadGroupItem{ChildKeyA: k[0], ChildKeyB: k[1], TimestampMicro: v.ts, Value: v.value})
+	}
+	return items, nil
+}
+
+func (m *memGroupStore) LookupGroup(ctx context.Context, parentKeyA, parentKeyB uint64) ([]store.LookupGroupItem, error) {
+	m.Lock()
+	defer m.Unlock()
+	var items []store.LookupGroupItem
+	for k, v := range m.groups[[2]uint64{parentKeyA, parentKeyB}] {
+		if v.deleted {
+			continue
+		}
+		items = append(items, store.LookupGroupItem{ChildKeyA: k[0], ChildKeyB: k[1], TimestampMicro: v.ts, Length: uint32(len(v.value))})
+	}
+	return items, nil
+}
+
+func (m *memGroupStore) Write(ctx context.Context, parentKeyA, parentKeyB, childKeyA, childKeyB uint64, ts int64, value []byte) (int64, error) {
+	if m.fail != nil {
+		return 0, m.fail
+	}
+	return m.set(parentKeyA, parentKeyB, childKeyA, childKeyB, &memValue{ts: ts, value: append([]byte{}, value...)}), nil
+}
+
+func (m *memGroupStore) Delete(ctx context.Context, parentKeyA, parentKeyB, childKeyA, childKeyB uint64, ts int64) (int64, error) {
+	return m.set(parentKeyA, parentKeyB, childKeyA, childKeyB, &memValue{ts: ts, deleted: true}), nil
+}
+
+func (m *memGroupStore) set(parentKeyA, parentKeyB, childKeyA, childKeyB uint64, v *memValue) int64 {
+	m.Lock()
+	defer m.Unlock()
+	group, ok := m.groups[[2]uint64{parentKeyA, parentKeyB}]
+	if !ok {
+		group = make(map[[2]uint64]*memValue)
+		m.groups[[2]uint64{parentKeyA, parentKeyB}] = group
+	}
+	old, ok := group[[2]uint64{childKeyA, childKeyB}]
+	if ok && old.ts >= v.ts {
+		return old.ts
+	}
+	group[[2]uint64{childKeyA, childKeyB}] = v
+	if ok {
+		return old.ts
+	}
+	return 0
+}
+
+// newTestOortFS returns an OortFS on in memory stores. Nothing works through
+// the delete queue, so tests can look at what was queued.
+func newTestOortFS() *OortFS {
+	comms, _ := NewStoreComms(
+		&memValueStore{values: make(map[[2]uint64]*memValue)},
+		&memGroupStore{groups: make(map[[2]uint64]map[[2]uint64]*memValue)},
+	)
+	deletes, _ := newQueue("")
+	keys, _ := newKeyRing("")
+	o := &OortFS{
+		comms:    comms,
+		deletes:  deletes,
+		keys:     keys,
+		settings: make(map[string]*fsSettings),
+		stats:    make(map[string]*FileSysStats),
+		quotas:   make(map[string]*quotaState),
+	}
+	comms.contentRefs = o.contentRefs
+	o.InitFs(getContext(), testFsid.Bytes())
+	return o
+}
+
+func TestScrub(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	old := time.Now().Add(-2 * scrubGrace)
+	oldtsm := brimtime.TimeToUnixMicro(old)
+	// A file with a block past its end
+	attr := &pb.Attr{Inode: 2, Mode: 0644, Ctime: old.Unix(), Mtime: old.Unix(), Nlink: 1}
+	_, _, err := o.Create(ctx, root, formic.GetID(fs, 2, 0), 2, "a", attr, false)
+	if err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	o.WriteChunk(ctx, formic.GetID(fs, 2, 1), []byte("orphan"))
+	// A delete that never finished, from before tombstones had the fsid
+	d := &pb.DirEntry{
+		Version:   DirEntryVersion,
+		Name:      "b",
+		Id:        formic.GetID(fs, 3, 0),
+		Tombstone: &pb.Tombstone{FsId: []byte("1"), Inode: 3, Dtime: oldtsm, Qtime: oldtsm},
+	}
+	b, _ := proto.Marshal(d)
+	o.comms.WriteGroupTS(ctx, root, []byte("b"), b, oldtsm-1)
+	// An entry whose inode is gone
+	d = &pb.DirEntry{Version: DirEntryVersion, Name: "c", Id: formic.GetID(fs, 4, 0)}
+	b, _ = proto.Marshal(d)
+	o.comms.WriteGroupTS(ctx, root, []byte("c"), b, oldtsm)
+
+	r, err := o.Scrub(context.Background(), testFsid, true)
+	if err != nil {
+		t.Fatal("Scrub failed: ", err)
+	}
+	expected := ScrubReport{
+		FSID:            testFsid.String(),
+		DryRun:          true,
+		Dirs:            1,
+		Files:           1,
+		Tombstones:      1,
+		StuckDeletes:    1,
+		BadTombstones:   1,
+		DanglingEntries: 1,
+		OrphanBlocks:    1,
+	}
+	if *r != expected {
+		t.Errorf("Expected report: %+v received: %+v", expected, *r)
+	}
+	if len(o.deletes.pending) != 0 {
+		t.Errorf("Dry run queued %d deletes", len(o.deletes.pending))
+	}
+	if _, err = o.comms.ReadGroupItem(ctx, root, []byte("c")); err != nil {
+		t.Error("Dry run removed the dangling entry")
+	}
+
+	r, err = o.Scrub(context.Background(), testFsid, false)
+	if err != nil {
+		t.Fatal("Scrub failed: ", err)
+	}
+	if len(o.deletes.pending) != 2 {
+		t.Fatalf("Expected 2 deletes queued, received %d", len(o.deletes.pending))
+	}
+	for _, e := range o.deletes.pending {
+		todelete := &DeleteItem{}
+		if err := todelete.UnmarshalJSON(e.Item); err != nil {
+			t.Fatal("Bad delete queued: ", err)
+		}
+		if string(todelete.ts.FsId) != string(fs) {
+			t.Errorf("Expected delete with fsid %x, received %x", fs, todelete.ts.FsId)
+		}
+	}
+	if _, err = o.comms.ReadGroupItem(ctx, root, []byte("c")); !store.IsNotFound(err) {
+		t.Error("Expected the dangling entry to be removed")
+	}
+}
+
+func TestScrub_Links(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	old := time.Now().Add(-2 * scrubGrace).Unix()
+	attr := &pb.Attr{Inode: 2, Mode: 0644, Ctime: old, Mtime: old, Nlink: 1}
+	id := formic.GetID(fs, 2, 0)
+	o.Create(ctx, root, id, 2, "a", attr, false)
+	// A second name for the inode without the link count
+	d := &pb.DirEntry{Version: DirEntryVersion, Name: "b", Id: id}
+	b, _ := proto.Marshal(d)
+	o.comms.WriteGroup(ctx, root, []byte("b"), b)
+
+	r, err := o.Scrub(context.Background(), testFsid, false)
+	if err != nil {
+		t.Fatal("Scrub failed: ", err)
+	}
+	if r.LinkMismatches != 1 {
+		t.Errorf("Expected 1 link mismatch, received %d", r.LinkMismatches)
+	}
+	n, err := o.GetInode(ctx, id)
+	if err != nil {
+		t.Fatal("GetInode failed: ", err)
+	}
+	if n.NodeCount != 2 || n.Attr.Nlink != 2 {
+		t.Errorf("Expected 2 links, received %d (nlink %d)", n.NodeCount, n.Attr.Nlink)
+	}
+}
+
+func TestFsck(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	old := time.Now().Add(-2 * fsckStuckAfter)
+	oldtsm := brimtime.TimeToUnixMicro(old)
+	// A file with a corrupt block and a size that doesn't match its blocks
+	id := formic.GetID(fs, 2, 0)
+	attr := &pb.Attr{Inode: 2, Mode: 0644, Ctime: old.Unix(), Mtime: old.Unix(), Nlink: 1, Size: 10}
+	o.Create(ctx, root, id, 2, "a", attr, false)
+	n, _ := o.GetInode(ctx, id)
+	n.BlockSize = 4
+	n.Blocks = 2
+	n.LastBlock = 4
+	b, _ := proto.Marshal(n)
+	o.WriteChunk(ctx, id, b)
+	o.WriteChunk(ctx, formic.GetID(fs, 2, 1), []byte("1234"))
+	b, _ = proto.Marshal(&pb.FileBlock{Version: FileBlockVersion, Data: []byte("5678"), Checksum: 1})
+	o.comms.WriteValue(ctx, formic.GetID(fs, 2, 2), b)
+	// An entry whose inode is gone
+	d := &pb.DirEntry{Version: DirEntryVersion, Name: "b", Id: formic.GetID(fs, 3, 0)}
+	b, _ = proto.Marshal(d)
+	o.comms.WriteGroup(ctx, root, []byte("b"), b)
+	// A delete that never finished
+	d = &pb.DirEntry{
+		Version:   DirEntryVersion,
+		Name:      "c",
+		Id:        formic.GetID(fs, 4, 0),
+		Tombstone: &pb.Tombstone{FsId: fs, Inode: 4, Dtime: oldtsm, Qtime: oldtsm},
+	}
+	b, _ = proto.Marshal(d)
+	o.comms.WriteGroupTS(ctx, root, []byte("c"), b, oldtsm-1)
+
+	r, err := Fsck(context.Background(), o, testFsid, false)
+	if err != nil {
+		t.Fatal("Fsck failed: ", err)
+	}
+	found := make(map[string]*FsckProblem)
+	for _, p := range r.Problems {
+		found[p.Kind] = p
+	}
+	for kind, path := range map[string]string{FsckSize: "/a", FsckChecksum: "/a", FsckDangling: "/b", FsckStuckTombstone: "/c"} {
+		if found[kind] == nil {
+			t.Errorf("Expected a %s problem", kind)
+		} else if found[kind].Path != path {
+			t.Errorf("Expected %s problem at %s, received %s", kind, path, found[kind].Path)
+		}
+	}
+	if len(r.Problems) != 4 {
+		t.Errorf("Expected 4 problems, received %d: %+v", len(r.Problems), r.Problems)
+	}
+
+	r, err = Fsck(context.Background(), o, testFsid, true)
+	if err != nil {
+		t.Fatal("Fsck failed: ", err)
+	}
+	for _, p := range r.Problems {
+		if p.Kind != FsckChecksum && !p.Repaired {
+			t.Errorf("Expected %s problem to be repaired", p.Kind)
+		}
+	}
+	r, err = Fsck(context.Background(), o, testFsid, false)
+	if err != nil {
+		t.Fatal("Fsck failed: ", err)
+	}
+	if len(r.Problems) != 1 || r.Problems[0].Kind != FsckChecksum {
+		t.Errorf("Expected only the checksum problem after repair, received %+v", r.Problems)
+	}
+}
+
+func TestGetChunk_Checksum(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	id := formic.GetID(testFsid.Bytes(), 2, 1)
+	err := o.WriteChunk(ctx, id, []byte("1234"))
+	if err != nil {
+		t.Fatal("WriteChunk failed: ", err)
+	}
+	data, err := o.GetChunk(ctx, id)
+	if err != nil || string(data) != "1234" {
+		t.Errorf("Expected '1234', received '%s' (%v)", data, err)
+	}
+	// Blocks written with an older version use its checksum
+	id = formic.GetID(testFsid.Bytes(), 2, 2)
+	b, _ := proto.Marshal(&pb.FileBlock{Version: 1, Data: []byte("5678"), Checksum: crc32.ChecksumIEEE([]byte("5678"))})
+	o.comms.WriteValue(ctx, id, b)
+	data, err = o.GetChunk(ctx, id)
+	if err != nil || string(data) != "5678" {
+		t.Errorf("Expected '5678', received '%s' (%v)", data, err)
+	}
+	id = formic.GetID(testFsid.Bytes(), 2, 3)
+	b, _ = proto.Marshal(&pb.FileBlock{Version: 2, Data: []byte("5678"), Checksum: crc32.ChecksumIEEE([]byte("5678"))})
+	o.comms.WriteValue(ctx, id, b)
+	_, err = o.GetChunk(ctx, id)
+	if err != ErrChecksumMismatch {
+		t.Errorf("Expected ErrChecksumMismatch, received %v", err)
+	}
+}
+
+func TestWriteChunk_Compression(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	attr, _ := json.Marshal(&FileSysAttr{Attr: "compression", Value: "snappy", FSID: testFsid.String()})
+	o.comms.WriteGroup(ctx, []byte("/fs/"+testFsid.String()), []byte("compression"), attr)
+	// Creating the root already looked up the compression
+	delete(o.settings, testFsid.String())
+	read := func(id []byte) *pb.FileBlock {
+		b, _ := o.comms.ReadValue(ctx, id)
+		fb := &pb.FileBlock{}
+		proto.Unmarshal(b, fb)
+		return fb
+	}
+	// Compressible data is stored compressed
+	data := bytes.Repeat([]byte("1234"), 1024)
+	id := formic.GetID(testFsid.Bytes(), 2, 1)
+	err := o.WriteChunk(ctx, id, data)
+	if err != nil {
+		t.Fatal("WriteChunk failed: ", err)
+	}
+	fb := read(id)
+	if fb.Compression != CompressionSnappy || len(fb.Data) >= len(data) {
+		t.Errorf("Expected snappy compressed block, received compression %d with %d bytes", fb.Compression, len(fb.Data))
+	}
+	got, err := o.GetChunk(ctx, id)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Compressed block didn't read back (%v)", err)
+	}
+	if o.stats[testFsid.String()].CompressionSaved != int64(len(data)-len(fb.Data)) {
+		t.Errorf("Expected %d bytes saved, received %d", len(data)-len(fb.Data), o.stats[testFsid.String()].CompressionSaved)
+	}
+	// Data that doesn't compress is stored as is
+	data = make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+	id = formic.GetID(testFsid.Bytes(), 2, 2)
+	err = o.WriteChunk(ctx, id, data)
+	if err != nil {
+		t.Fatal("WriteChunk failed: ", err)
+	}
+	fb = read(id)
+	if fb.Compression != CompressionNone || !bytes.Equal(fb.Data, data) {
+		t.Errorf("Expected uncompressed block, received compression %d", fb.Compression)
+	}
+	got, err = o.GetChunk(ctx, id)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Uncompressed block didn't read back (%v)", err)
+	}
+}
+
+func TestWriteChunk_Encryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "formicd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "master.keys")
+	ioutil.WriteFile(file, []byte("1 "+strings.Repeat("11", keySize)+"\n"), 0600)
+	o := newTestOortFS()
+	ctx := getContext()
+	o.keys, err = newKeyRing(file)
+	if err != nil {
+		t.Fatal("Couldn't load keys: ", err)
+	}
+	dataKey, err := o.keys.newDataKey(testFsid.Bytes())
+	if err != nil {
+		t.Fatal("Couldn't make data key: ", err)
+	}
+	attr, _ := json.Marshal(&FileSysAttr{Attr: "datakey", Value: dataKey, FSID: testFsid.String()})
+	o.comms.WriteGroup(ctx, []byte("/fs/"+testFsid.String()), []byte("datakey"), attr)
+	// Creating the root already looked up the settings
+	delete(o.settings, testFsid.String())
+	data := []byte("secret tenant data")
+	id := formic.GetID(testFsid.Bytes(), 2, 1)
+	err = o.WriteChunk(ctx, id, data)
+	if err != nil {
+		t.Fatal("WriteChunk failed: ", err)
+	}
+	b, _ := o.comms.ReadValue(ctx, id)
+	if bytes.Contains(b, data) {
+		t.Error("Data stored in plaintext")
+	}
+	got, err := o.GetChunk(ctx, id)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected '%s', received '%s' (%v)", data, got, err)
+	}
+	// A block moved to another id doesn't decrypt
+	other := formic.GetID(testFsid.Bytes(), 2, 2)
+	o.comms.WriteValue(ctx, other, b)
+	_, err = o.GetChunk(ctx, other)
+	if err != ErrChecksumMismatch {
+		t.Errorf("Expected ErrChecksumMismatch, received %v", err)
+	}
+	// Rotating to a new master key keeps the data readable
+	ioutil.WriteFile(file, []byte("1 "+strings.Repeat("11", keySize)+"\n2 "+strings.Repeat("22", keySize)+"\n"), 0600)
+	o.keys.load()
+	rotated, err := o.rotateKey(ctx, testFsid)
+	if err != nil || !rotated {
+		t.Fatalf("Expected rotation, received %v (%v)", rotated, err)
+	}
+	b, _ = o.comms.ReadGroupItem(ctx, []byte("/fs/"+testFsid.String()), []byte("datakey"))
+	if !bytes.Contains(b, []byte(`"2:`)) {
+		t.Errorf("Expected data key wrapped with master key 2, received %s", b)
+	}
+	ioutil.WriteFile(file, []byte("2 "+strings.Repeat("22", keySize)+"\n"), 0600)
+	o.keys.load()
+	delete(o.settings, testFsid.String())
+	got, err = o.GetChunk(ctx, id)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected '%s' after rotation, received '%s' (%v)", data, got, err)
+	}
+	rotated, err = o.rotateKey(ctx, testFsid)
+	if err != nil || rotated {
+		t.Errorf("Expected no rotation, received %v (%v)", rotated, err)
+	}
+}
+
+func TestWriteBlock_Dedup(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	attr, _ := json.Marshal(&FileSysAttr{Attr: "dedup", Value: "true", FSID: testFsid.String()})
+	o.comms.WriteGroup(ctx, []byte("/fs/"+testFsid.String()), []byte("dedup"), attr)
+	// Creating the root already looked up the settings
+	delete(o.settings, testFsid.String())
+	root := formic.GetID(fs, 1, 0)
+	a := formic.GetID(fs, 2, 0)
+	b := formic.GetID(fs, 3, 0)
+	for i, id := range [][]byte{a, b} {
+		inode := uint64(i + 2)
+		attr := &pb.Attr{Inode: inode, Mode: 0644, Nlink: 1}
+		if _, _, err := o.Create(ctx, root, id, inode, fmt.Sprint(inode), attr, false); err != nil {
+			t.Fatal("Create failed: ", err)
+		}
+	}
+	data := []byte("build artifact")
+	sum := sha256.Sum256(data)
+	for inode := uint64(2); inode <= 3; inode++ {
+		if err := o.WriteBlock(ctx, fs, inode, 0, data); err != nil {
+			t.Fatal("WriteBlock failed: ", err)
+		}
+		o.Update(ctx, formic.GetID(fs, inode, 0), 0, 16, uint64(len(data)), time.Now().Unix(), brimtime.TimeToUnixMicro(time.Now()))
+		got, err := o.GetBlock(ctx, fs, inode, 0)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Expected '%s', received '%s' (%v)", data, got, err)
+		}
+	}
+	// The block map in the inode has the hash, nothing is kept by block id
+	n, _ := o.GetInode(ctx, a)
+	if !bytes.Equal(blockHash(n, 0), sum[:]) {
+		t.Errorf("Expected hash %x in the block map, received %x", sum, blockHash(n, 0))
+	}
+	if _, err := o.comms.ReadValue(ctx, formic.GetID(fs, 2, 1)); !store.IsNotFound(err) {
+		t.Errorf("Expected nothing stored by block id, received %v", err)
+	}
+	if ok, err := o.HasBlock(ctx, fs, 2, 0); !ok || err != nil {
+		t.Errorf("Expected the block to exist, received %v (%v)", ok, err)
+	}
+	refs, _ := o.comms.LookupGroup(ctx, refsKey(sum[:]))
+	if len(refs) != 2 {
+		t.Errorf("Expected 2 references, received %d", len(refs))
+	}
+	// Overwriting a block drops its reference
+	if err := o.WriteBlock(ctx, fs, 2, 0, []byte("something else")); err != nil {
+		t.Fatal("WriteBlock failed: ", err)
+	}
+	refs, _ = o.comms.LookupGroup(ctx, refsKey(sum[:]))
+	if len(refs) != 1 {
+		t.Errorf("Expected 1 reference, received %d", len(refs))
+	}
+	// Truncating the last block writes the trimmed content and drops the
+	// old reference
+	if _, err := o.SetAttr(ctx, b, &pb.Attr{Size: 5}, uint32(fuse.SetattrSize)); err != nil {
+		t.Fatal("SetAttr failed: ", err)
+	}
+	got, err := o.GetBlock(ctx, fs, 3, 0)
+	if err != nil || string(got) != "build" {
+		t.Errorf("Expected 'build', received '%s' (%v)", got, err)
+	}
+	if _, err = o.comms.ReadValue(ctx, contentID(sum[:])); !store.IsNotFound(err) {
+		t.Errorf("Expected content to be deleted, received %v", err)
+	}
+	// The whole file going drops the rest, once a snapshot has its own
+	// reference
+	takeSnapshot(t, o, "snap")
+	trimmed := sha256.Sum256([]byte("build"))
+	d := newDeletinator(o.deletes, o)
+	ts := &pb.Tombstone{Dtime: brimtime.TimeToUnixMicro(time.Now()), FsId: fs, Inode: 3, Blocks: 1}
+	if !d.delete(&DeleteItem{ts: ts, id: b}) {
+		t.Fatal("Expected the delete to finish")
+	}
+	refs, _ = o.comms.LookupGroup(ctx, refsKey(trimmed[:]))
+	if len(refs) != 1 {
+		t.Errorf("Expected only the snapshot's reference, received %d", len(refs))
+	}
+	got, err = o.GetBlock(snapshotContext("snap"), fs, 3, 0)
+	if err != nil || string(got) != "build" {
+		t.Errorf("Expected 'build' in the snapshot, received '%s' (%v)", got, err)
+	}
+}
+
+func TestBlockCache(t *testing.T) {
+	o := newTestOortFS()
+	o.blocks = newBlockCache(8, time.Minute)
+	ctx := getContext()
+	a := formic.GetID(testFsid.Bytes(), 2, 1)
+	if err := o.WriteBlock(ctx, testFsid.Bytes(), 2, 0, []byte("1234")); err != nil {
+		t.Fatal("WriteBlock failed: ", err)
+	}
+	got, err := o.GetBlock(ctx, testFsid.Bytes(), 2, 0)
+	if err != nil || string(got) != "1234" {
+		t.Errorf("Expected '1234', received '%s' (%v)", got, err)
+	}
+	if _, _, ok := o.blocks.get(a); !ok {
+		t.Error("Expected the block to be cached")
+	}
+	// Changing what was read doesn't change the cached copy
+	got[0] = 'x'
+	got, _ = o.GetBlock(ctx, testFsid.Bytes(), 2, 0)
+	if string(got) != "1234" {
+		t.Errorf("Expected '1234', received '%s'", got)
+	}
+	// Writes drop the cached block
+	time.Sleep(time.Millisecond)
+	if err = o.WriteBlock(ctx, testFsid.Bytes(), 2, 0, []byte("5678")); err != nil {
+		t.Fatal("WriteBlock failed: ", err)
+	}
+	got, err = o.GetBlock(ctx, testFsid.Bytes(), 2, 0)
+	if err != nil || string(got) != "5678" {
+		t.Errorf("Expected '5678', received '%s' (%v)", got, err)
+	}
+	// The least recently used block makes room for the next
+	b := formic.GetID(testFsid.Bytes(), 2, 2)
+	o.WriteBlock(ctx, testFsid.Bytes(), 2, 1, []byte("abcd"))
+	o.WriteBlock(ctx, testFsid.Bytes(), 2, 2, []byte("efgh"))
+	o.GetBlock(ctx, testFsid.Bytes(), 2, 0)
+	o.GetBlock(ctx, testFsid.Bytes(), 2, 1)
+	o.GetBlock(ctx, testFsid.Bytes(), 2, 0)
+	o.GetBlock(ctx, testFsid.Bytes(), 2, 2)
+	if _, _, ok := o.blocks.get(b); ok {
+		t.Error("Expected the least recently used block to be dropped")
+	}
+	if _, _, ok := o.blocks.get(a); !ok {
+		t.Error("Expected the recently used block to be kept")
+	}
+	// Blocks read before a write aren't cached after it
+	_, gen, _ := o.blocks.get(b)
+	o.blocks.invalidate(b)
+	o.blocks.put(b, []byte("abcd"), gen)
+	if _, _, ok := o.blocks.get(b); ok {
+		t.Error("Expected a block read before the write not to be cached")
+	}
+}
+
+func TestUpdateInode_Parallel(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	a := formic.GetID(fs, 2, 0)
+	attr := &pb.Attr{Inode: 2, Mode: 0644, Nlink: 1}
+	if _, _, err := o.Create(ctx, root, a, 2, "a", attr, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	// Size updates and xattrs set at the same time all make it
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := o.Update(ctx, a, uint64(i), 10, 10, time.Now().Unix(), brimtime.TimeToUnixMicro(time.Now())); err != nil {
+				t.Error("Update failed: ", err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := o.Setxattr(ctx, a, fmt.Sprintf("user.%d", i), []byte("x")); err != nil {
+				t.Error("Setxattr failed: ", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	n, err := o.GetInode(ctx, a)
+	if err != nil {
+		t.Fatal("GetInode failed: ", err)
+	}
+	if n.Attr.Size != 160 || n.Blocks != 16 {
+		t.Errorf("Expected size 160 in 16 blocks, received %d in %d", n.Attr.Size, n.Blocks)
+	}
+	if len(n.Xattr) != 16 {
+		t.Errorf("Expected 16 xattrs, received %d", len(n.Xattr))
+	}
+}
+
+// takeSnapshot takes a snapshot without waiting for every formicd to know
+// about it
+func takeSnapshot(t *testing.T, o *OortFS, name string) {
+	snap := &Snapshot{Name: name, Time: brimtime.TimeToUnixMicro(time.Now())}
+	if err := o.writeSnapshot(getContext(), testFsid, snap); err != nil {
+		t.Fatal("writeSnapshot failed: ", err)
+	}
+	time.Sleep(time.Millisecond)
+}
+
+func snapshotContext(name string) context.Context {
+	return metadata.NewContext(context.Background(), metadata.Pairs("fsid", testFsid.String(), "snapshot", name))
+}
+
+func TestSnapshot(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	a := formic.GetID(fs, 2, 0)
+	block := formic.GetID(fs, 2, 1)
+	attr := &pb.Attr{Inode: 2, Mode: 0644, Nlink: 1}
+	if _, _, err := o.Create(ctx, root, a, 2, "a", attr, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	o.WriteBlock(ctx, fs, 2, 0, []byte("before"))
+	o.Update(ctx, a, 0, 6, 6, time.Now().Unix(), brimtime.TimeToUnixMicro(time.Now()))
+	takeSnapshot(t, o, "snap")
+
+	// Change everything after the snapshot
+	o.WriteBlock(ctx, fs, 2, 0, []byte("after!"))
+	attr = &pb.Attr{Inode: 3, Mode: 0644, Nlink: 1}
+	if _, _, err := o.Create(ctx, root, formic.GetID(fs, 3, 0), 3, "b", attr, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+
+	snap := snapshotContext("snap")
+	got, err := o.GetChunk(snap, block)
+	if err != nil || string(got) != "before" {
+		t.Errorf("Expected 'before', received '%s' (%v)", got, err)
+	}
+	got, err = o.GetChunk(ctx, block)
+	if err != nil || string(got) != "after!" {
+		t.Errorf("Expected 'after!', received '%s' (%v)", got, err)
+	}
+	d, err := o.ReadDirAll(snap, root)
+	if err != nil || len(d.DirEntries) != 1 || d.DirEntries[0].Name != "a" {
+		t.Errorf("Expected only a in the snapshot, received %v (%v)", d, err)
+	}
+	if err = o.WriteChunk(snap, block, []byte("nope")); err != ErrReadOnly {
+		t.Errorf("Expected ErrReadOnly, received %v", err)
+	}
+	if _, err = o.GetChunk(snapshotContext("missing"), block); err != ErrNoSnapshot {
+		t.Errorf("Expected ErrNoSnapshot, received %v", err)
+	}
+
+	// Restoring puts the block back and removes b
+	r, err := o.RestoreSnapshot(context.Background(), testFsid, "snap")
+	if err != nil {
+		t.Fatal("RestoreSnapshot failed: ", err)
+	}
+	if r.Removed != 1 || r.Blocks != 1 || r.Errors != 0 {
+		t.Errorf("Unexpected restore %+v", r)
+	}
+	got, err = o.GetChunk(ctx, block)
+	if err != nil || string(got) != "before" {
+		t.Errorf("Expected 'before', received '%s' (%v)", got, err)
+	}
+	d, err = o.ReadDirAll(ctx, root)
+	if err != nil || len(d.DirEntries) != 1 || d.DirEntries[0].Name != "a" {
+		t.Errorf("Expected only a after restoring, received %v (%v)", d, err)
+	}
+}
+
+func TestCreateSnapshot_Pending(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	start := time.Now()
+	snap, err := o.CreateSnapshot(ctx, testFsid, "snap")
+	if err != nil {
+		t.Fatal("CreateSnapshot failed: ", err)
+	}
+	if time.Since(start) >= snapshotDelay {
+		t.Errorf("CreateSnapshot waited for the snapshot to be taken")
+	}
+	if !snap.Pending {
+		t.Errorf("Expected the snapshot to be pending")
+	}
+	snaps, err := o.ListSnapshots(ctx, testFsid)
+	if err != nil || len(snaps) != 1 || !snaps[0].Pending {
+		t.Errorf("Expected the snapshot to be listed as pending, received %v (%v)", snaps, err)
+	}
+	if _, err = o.RestoreSnapshot(ctx, testFsid, "snap"); err != ErrSnapshotPending {
+		t.Errorf("Expected ErrSnapshotPending, received %v", err)
+	}
+	if _, err = o.CloneFS(ctx, testFsid, "snap", uuid.NewV4()); err != ErrSnapshotPending {
+		t.Errorf("Expected ErrSnapshotPending, received %v", err)
+	}
+}
+
+func TestDeleteSnapshot(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	block := formic.GetID(testFsid.Bytes(), 2, 1)
+	o.WriteChunk(ctx, block, []byte("first"))
+	takeSnapshot(t, o, "one")
+	takeSnapshot(t, o, "two")
+	o.WriteChunk(ctx, block, []byte("second"))
+
+	// The copy made for two is what one needs as well
+	if err := o.DeleteSnapshot(ctx, testFsid, "two"); err != nil {
+		t.Fatal("DeleteSnapshot failed: ", err)
+	}
+	got, err := o.GetChunk(snapshotContext("one"), block)
+	if err != nil || string(got) != "first" {
+		t.Errorf("Expected 'first', received '%s' (%v)", got, err)
+	}
+	if _, err = o.GetChunk(snapshotContext("two"), block); err != ErrNoSnapshot {
+		t.Errorf("Expected ErrNoSnapshot, received %v", err)
+	}
+	snaps, _ := o.ListSnapshots(ctx, testFsid)
+	if len(snaps) != 1 || snaps[0].Name != "one" {
+		t.Errorf("Expected only one, received %v", snaps)
+	}
+}
+
+func TestCloneFS(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	a := formic.GetID(fs, 2, 0)
+	attr := &pb.Attr{Inode: 2, Mode: 0644, Nlink: 1}
+	if _, _, err := o.Create(ctx, formic.GetID(fs, 1, 0), a, 2, "a", attr, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	o.WriteBlock(ctx, fs, 2, 0, []byte("shared"))
+	o.Update(ctx, a, 0, 6, 6, time.Now().Unix(), brimtime.TimeToUnixMicro(time.Now()))
+	takeSnapshot(t, o, "base")
+
+	clone := uuid.NewV4()
+	r, err := o.CloneFS(ctx, testFsid, "base", clone)
+	if err != nil {
+		t.Fatal("CloneFS failed: ", err)
+	}
+	if r.Inodes != 2 || r.Entries != 1 {
+		t.Errorf("Unexpected clone %+v", r)
+	}
+	cctx := withFsId(context.Background(), clone)
+	name, _, err := o.Lookup(cctx, formic.GetID(clone.Bytes(), 1, 0), "a")
+	if err != nil || name != "a" {
+		t.Errorf("Expected a in the clone, received '%s' (%v)", name, err)
+	}
+	got, err := o.GetBlock(cctx, clone.Bytes(), 2, 0)
+	if err != nil || string(got) != "shared" {
+		t.Errorf("Expected 'shared', received '%s' (%v)", got, err)
+	}
+	if ok, err := o.HasBlock(cctx, clone.Bytes(), 2, 0); !ok || err != nil {
+		t.Errorf("Expected the clone to have block 0 (%v)", err)
+	}
+	if ok, err := o.HasBlock(cctx, clone.Bytes(), 2, 1); ok || err != nil {
+		t.Errorf("Expected the clone not to have block 1 (%v)", err)
+	}
+
+	// Each side's writes only show up on that side
+	o.WriteBlock(ctx, fs, 2, 0, []byte("origin"))
+	got, err = o.GetBlock(cctx, clone.Bytes(), 2, 0)
+	if err != nil || string(got) != "shared" {
+		t.Errorf("Expected 'shared', received '%s' (%v)", got, err)
+	}
+	o.WriteBlock(cctx, clone.Bytes(), 2, 0, []byte("clone"))
+	got, err = o.GetBlock(cctx, clone.Bytes(), 2, 0)
+	if err != nil || string(got) != "clone" {
+		t.Errorf("Expected 'clone', received '%s' (%v)", got, err)
+	}
+	got, err = o.GetBlock(ctx, fs, 2, 0)
+	if err != nil || string(got) != "origin" {
+		t.Errorf("Expected 'origin', received '%s' (%v)", got, err)
+	}
+
+	if err = o.DeleteSnapshot(ctx, testFsid, "base"); err != ErrSnapshotInUse {
+		t.Errorf("Expected ErrSnapshotInUse, received %v", err)
+	}
+}
+
+func TestUndelete(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	attr, _ := json.Marshal(&FileSysAttr{Attr: "retention", Value: "1h", FSID: testFsid.String()})
+	o.comms.WriteGroup(ctx, []byte("/fs/"+testFsid.String()), []byte("retention"), attr)
+	// Creating the root already looked up the settings
+	delete(o.settings, testFsid.String())
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	dir := formic.GetID(fs, 2, 0)
+	if _, _, err := o.Create(ctx, root, dir, 2, "dir", &pb.Attr{Inode: 2, Mode: uint32(os.ModeDir | 0755)}, true); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	if _, _, err := o.Create(ctx, dir, formic.GetID(fs, 3, 0), 3, "file", &pb.Attr{Inode: 3, Mode: 0644, Nlink: 1}, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	o.WriteBlock(ctx, fs, 3, 0, []byte("keep me"))
+	o.Update(ctx, formic.GetID(fs, 3, 0), 0, 7, 7, time.Now().Unix(), brimtime.TimeToUnixMicro(time.Now()))
+	if _, err := o.Remove(ctx, dir, "file"); err != nil {
+		t.Fatal("Remove failed: ", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := o.Remove(ctx, root, "dir"); err != nil {
+		t.Fatal("Remove failed: ", err)
+	}
+	if name, _, _ := o.Lookup(ctx, root, "dir"); name != "" {
+		t.Errorf("Expected dir to be gone, received '%s'", name)
+	}
+
+	deleted, err := o.ListDeleted(ctx, testFsid)
+	if err != nil {
+		t.Fatal("ListDeleted failed: ", err)
+	}
+	if len(deleted) != 2 || deleted[0].Path != "/dir" || deleted[1].Path != "/dir/file" {
+		t.Fatalf("Unexpected deleted entries %+v", deleted)
+	}
+	// The deletes are only held while the entries are in the trash
+	d := newDeletinator(o.deletes, o)
+	for i := 0; i < 2; i++ {
+		item := &DeleteItem{}
+		json.Unmarshal(o.deletes.pop().Item, item)
+		if item.trash == nil || d.retained(item) <= 0 {
+			t.Errorf("Expected the delete to be held, received %+v", item)
+		}
+	}
+
+	// Putting the file back brings back the directory it was in
+	n, err := o.Undelete(ctx, testFsid, "dir/file")
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 entries put back, received %d (%v)", n, err)
+	}
+	if _, _, err = o.Lookup(ctx, dir, "file"); err != nil {
+		t.Errorf("Expected file to be back, received %v", err)
+	}
+	got, err := o.GetBlock(ctx, fs, 3, 0)
+	if err != nil || string(got) != "keep me" {
+		t.Errorf("Expected 'keep me', received '%s' (%v)", got, err)
+	}
+	deleted, _ = o.ListDeleted(ctx, testFsid)
+	if len(deleted) != 0 {
+		t.Errorf("Expected an empty trash, received %+v", deleted)
+	}
+	if _, err = o.Undelete(ctx, testFsid, "/dir/file"); err != ErrNotInTrash {
+		t.Errorf("Expected ErrNotInTrash, received %v", err)
+	}
+}
+
+func TestRename_IntentFailure(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	if _, _, err := o.Create(ctx, root, formic.GetID(fs, 2, 0), 2, "a", &pb.Attr{Inode: 2, Mode: 0644, Nlink: 1}, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	// Without the intent saved the rename can't go ahead
+	gstore := o.comms.gstore.(*memGroupStore)
+	gstore.fail = errors.New("Test failure")
+	if _, err := o.Rename(ctx, root, root, "a", "b", 0); err == nil {
+		t.Error("Rename expected to fail")
+	}
+	gstore.fail = nil
+	if _, a, err := o.Lookup(ctx, root, "a"); err != nil || a.Inode != 2 {
+		t.Errorf("Expected a to be left alone, received %v (%v)", a, err)
+	}
+	if name, _, _ := o.Lookup(ctx, root, "b"); name != "" {
+		t.Errorf("Expected no b, received '%s'", name)
+	}
+}
+
+func TestRename_Trash(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	attr, _ := json.Marshal(&FileSysAttr{Attr: "retention", Value: "1h", FSID: testFsid.String()})
+	o.comms.WriteGroup(ctx, []byte("/fs/"+testFsid.String()), []byte("retention"), attr)
+	delete(o.settings, testFsid.String())
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	for i, name := range []string{"a", "b"} {
+		inode := uint64(i + 2)
+		if _, _, err := o.Create(ctx, root, formic.GetID(fs, inode, 0), inode, name, &pb.Attr{Inode: inode, Mode: 0644, Nlink: 1}, false); err != nil {
+			t.Fatal("Create failed: ", err)
+		}
+	}
+	o.WriteBlock(ctx, fs, 2, 0, []byte("keep me"))
+	// Saving by renaming over the file keeps the old one in the trash
+	if _, err := o.Rename(ctx, root, root, "b", "a", 0); err != nil {
+		t.Fatal("Rename failed: ", err)
+	}
+	_, a, err := o.Lookup(ctx, root, "a")
+	if err != nil || a.Inode != 3 {
+		t.Errorf("Expected a to be inode 3, received %v (%v)", a, err)
+	}
+	deleted, err := o.ListDeleted(ctx, testFsid)
+	if err != nil {
+		t.Fatal("ListDeleted failed: ", err)
+	}
+	if len(deleted) != 1 || deleted[0].Path != "/a" || deleted[0].Inode != 2 {
+		t.Fatalf("Unexpected deleted entries %+v", deleted)
+	}
+	item := &DeleteItem{}
+	json.Unmarshal(o.deletes.pop().Item, item)
+	if item.trash == nil || newDeletinator(o.deletes, o).retained(item) <= 0 {
+		t.Errorf("Expected the delete to be held, received %+v", item)
+	}
+	got, err := o.GetBlock(ctx, fs, 2, 0)
+	if err != nil || string(got) != "keep me" {
+		t.Errorf("Expected 'keep me', received '%s' (%v)", got, err)
+	}
+	// The name is taken until the new file is moved out of the way
+	if _, err = o.Undelete(ctx, testFsid, "/a"); err != ErrExists {
+		t.Errorf("Expected ErrExists, received %v", err)
+	}
+}
+
+func TestDeleteTrash_Children(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	attr, _ := json.Marshal(&FileSysAttr{Attr: "retention", Value: "1h", FSID: testFsid.String()})
+	o.comms.WriteGroup(ctx, []byte("/fs/"+testFsid.String()), []byte("retention"), attr)
+	delete(o.settings, testFsid.String())
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	dir := formic.GetID(fs, 2, 0)
+	if _, _, err := o.Create(ctx, root, dir, 2, "dir", &pb.Attr{Inode: 2, Mode: uint32(os.ModeDir | 0755)}, true); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	if _, err := o.Remove(ctx, root, "dir"); err != nil {
+		t.Fatal("Remove failed: ", err)
+	}
+	// Created in the directory after it was removed
+	if _, _, err := o.Create(ctx, dir, formic.GetID(fs, 3, 0), 3, "file", &pb.Attr{Inode: 3, Mode: 0644, Nlink: 1}, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	item := &DeleteItem{}
+	json.Unmarshal(o.deletes.pop().Item, item)
+	if !newDeletinator(o.deletes, o).delete(item) {
+		t.Fatal("Expected the directory to be deleted")
+	}
+	// The file is deleted right away rather than waiting in the trash
+	json.Unmarshal(o.deletes.pop().Item, item)
+	if item.trash != nil {
+		t.Errorf("Expected the file not to go to the trash, received %+v", item)
+	}
+	deleted, _ := o.ListDeleted(ctx, testFsid)
+	if len(deleted) != 0 {
+		t.Errorf("Expected an empty trash, received %+v", deleted)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	root := formic.GetID(fs, 1, 0)
+	a := formic.GetID(fs, 2, 0)
+	if _, _, err := o.Create(ctx, root, a, 2, "a", &pb.Attr{Inode: 2, Mode: 0644, Nlink: 1}, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	o.WriteBlock(ctx, fs, 2, 0, []byte("0123456789"))
+	if err := o.Update(ctx, a, 0, 4, 10, time.Now().Unix(), brimtime.TimeToUnixMicro(time.Now())); err != nil {
+		t.Fatal("Update failed: ", err)
+	}
+	check := func(bytes, blocks, inodes int64) {
+		u, err := o.GetUsage(ctx)
+		if err != nil {
+			t.Fatal("GetUsage failed: ", err)
+		}
+		if u.Bytes != bytes || u.Blocks != blocks || u.Inodes != inodes {
+			t.Errorf("Expected %d bytes %d blocks %d inodes, received %+v", bytes, blocks, inodes, u)
+		}
+	}
+	check(10, 3, 2)
+	if _, err := o.SetAttr(ctx, a, &pb.Attr{Size: 6}, uint32(fuse.SetattrSize)); err != nil {
+		t.Fatal("SetAttr failed: ", err)
+	}
+	check(6, 2, 2)
+	if _, err := o.Remove(ctx, root, "a"); err != nil {
+		t.Fatal("Remove failed: ", err)
+	}
+	check(0, 0, 1)
+
+	// A scan puts counts that have drifted right
+	o.addUsage(ctx, 100, 10, 5)
+	scanned, err := o.ReconcileUsage(ctx, testFsid)
+	if err != nil {
+		t.Fatal("ReconcileUsage failed: ", err)
+	}
+	if scanned.Inodes != 1 {
+		t.Errorf("Expected to scan 1 inode, received %+v", scanned)
+	}
+	check(0, 0, 1)
+}
+
+func TestUpdate_AfterTruncate(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	a := formic.GetID(fs, 2, 0)
+	if _, _, err := o.Create(ctx, formic.GetID(fs, 1, 0), a, 2, "a", &pb.Attr{Inode: 2, Mode: 0644, Nlink: 1}, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	// Written before the truncate, and still queued when it lands
+	written := brimtime.TimeToUnixMicro(time.Now())
+	o.WriteBlock(ctx, fs, 2, 0, []byte("0123"))
+	o.WriteBlock(ctx, fs, 2, 1, []byte("4567"))
+	if err := o.Update(ctx, a, 0, 4, 4, time.Now().Unix(), written); err != nil {
+		t.Fatal("Update failed: ", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := o.SetAttr(ctx, a, &pb.Attr{Size: 2}, uint32(fuse.SetattrSize)); err != nil {
+		t.Fatal("SetAttr failed: ", err)
+	}
+	if err := o.Update(ctx, a, 1, 4, 4, time.Now().Unix(), written); err != nil {
+		t.Fatal("Update failed: ", err)
+	}
+	attr, err := o.GetAttr(ctx, a)
+	if err != nil || attr.Size != 2 {
+		t.Errorf("Expected the stale update to leave the size at 2, received %v (%v)", attr, err)
+	}
+	// Writes after the truncate still grow the file
+	if err = o.Update(ctx, a, 1, 4, 4, time.Now().Unix(), brimtime.TimeToUnixMicro(time.Now())); err != nil {
+		t.Fatal("Update failed: ", err)
+	}
+	attr, err = o.GetAttr(ctx, a)
+	if err != nil || attr.Size != 8 {
+		t.Errorf("Expected a size of 8, received %v (%v)", attr, err)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	o := newTestOortFS()
+	ctx := getContext()
+	fs := testFsid.Bytes()
+	a := formic.GetID(fs, 2, 0)
+	if _, _, err := o.Create(ctx, formic.GetID(fs, 1, 0), a, 2, "a", &pb.Attr{Inode: 2, Mode: 0644, Nlink: 1}, false); err != nil {
+		t.Fatal("Create failed: ", err)
+	}
+	o.Update(ctx, a, 0, 4, 4, time.Now().Unix(), brimtime.TimeToUnixMicro(time.Now()))
+	if err := o.WriteQuota(ctx, &Quota{Bytes: 10, Inodes: 2}); err != nil {
+		t.Fatal("WriteQuota failed: ", err)
+	}
+	if err := o.CheckQuota(ctx, 0, 1); err != ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded, received %v", err)
+	}
+	if err := o.CheckQuota(ctx, 6, 0); err != nil {
+		t.Errorf("Expected to fit in the quota, received %v", err)
+	}
+	if err := o.CheckQuota(ctx, 7, 0); err != ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded, received %v", err)
+	}
+
+	// The soft limit holds once the grace period is over
+	if err := o.WriteQuota(ctx, &Quota{SoftBytes: 2, Grace: "1ms"}); err != nil {
+		t.Fatal("WriteQuota failed: ", err)
+	}
+	if err := o.CheckQuota(ctx, 1, 0); err != nil {
+		t.Errorf("Expected to be in the grace period, received %v", err)
+	}
+	q, _, err := o.GetQuota(ctx)
+	if err != nil || q.Over == 0 {
+		t.Fatalf("Expected the grace period to have started, received %+v (%v)", q, err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := o.CheckQuota(ctx, 1, 0); err != ErrQuotaExceeded {
+		t.Errorf("Expected ErrQuotaExceeded, received %v", err)
+	}
+}
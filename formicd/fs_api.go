@@ -12,11 +12,13 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"reflect"
+	"strconv"
 	"time"
 
 	pb "github.com/creiht/formic/proto"
@@ -74,6 +76,19 @@ type FileSysMeta struct {
 	Name   string   `json:"name"`
 	Status string   `json:"status"`
 	Addr   []string `json:"addrs"`
+	// Block size and compression are only set for show
+	BlockSize        int64  `json:"blocksize,omitempty"`
+	Compression      string `json:"compression,omitempty"`
+	CompressionSaved int64  `json:"compressionsaved,omitempty"`
+	Encrypted        bool   `json:"encrypted,omitempty"`
+	Dedup            bool   `json:"dedup,omitempty"`
+	Origin           string `json:"origin,omitempty"` // <fsid>@<snapshot> for clones
+	Retention        string `json:"retention,omitempty"`
+	// Usage and quota are only set for show
+	Bytes  int64  `json:"bytes,omitempty"`
+	Blocks int64  `json:"blocks,omitempty"`
+	Inodes int64  `json:"inodes,omitempty"`
+	Quota  *Quota `json:"quota,omitempty"`
 }
 
 func clear(v interface{}) {
@@ -83,16 +98,20 @@ func clear(v interface{}) {
 
 // FileSystemAPIServer is used to implement oohhc
 type FileSystemAPIServer struct {
-	gstore store.GroupStore
+	gstore     store.GroupStore
+	fs         *OortFS
+	adminToken string
 }
 
 // FSAttrList ...
-var FSAttrList = []string{"name"}
+var FSAttrList = []string{"name", "blocksize", "compression", "datakey", "dedup", "origin", "retention", "quota"}
 
 // NewFileSystemAPIServer ...
-func NewFileSystemAPIServer(store store.GroupStore) *FileSystemAPIServer {
+func NewFileSystemAPIServer(store store.GroupStore, fs *OortFS, adminToken string) *FileSystemAPIServer {
 	s := new(FileSystemAPIServer)
 	s.gstore = store
+	s.fs = fs
+	s.adminToken = adminToken
 	return s
 }
 
@@ -119,7 +138,53 @@ func (s *FileSystemAPIServer) CreateFS(ctx context.Context, r *pb.CreateFSReques
 		return nil, errf(codes.PermissionDenied, "%v", "Invalid Token")
 	}
 
-	fsID := uuid.NewV4().String()
+	// Validate Block Size
+	blocksize := r.BlockSize
+	if blocksize == 0 {
+		blocksize = DefaultBlockSize
+	}
+	if blocksize < MinBlockSize || blocksize > MaxBlockSize || blocksize&(blocksize-1) != 0 {
+		log.Printf("%s CREATE FAILED %s %d\n", srcAddr, "InvalidBlockSize", r.BlockSize)
+		return nil, errf(codes.InvalidArgument, "Block size must be a power of 2 between %d and %d", MinBlockSize, MaxBlockSize)
+	}
+
+	// Validate Compression
+	if _, ok := compressionNames[r.Compression]; !ok {
+		log.Printf("%s CREATE FAILED %s %s\n", srcAddr, "InvalidCompression", r.Compression)
+		return nil, errf(codes.InvalidArgument, "Unknown compression %s", r.Compression)
+	}
+
+	// Encrypted blocks can't be shared between file systems
+	if r.Dedup && r.Encrypt {
+		log.Printf("%s CREATE FAILED %s\n", srcAddr, "DedupWithEncrypt")
+		return nil, errf(codes.InvalidArgument, "%v", "Dedup can't be used with encryption")
+	}
+
+	// Validate Retention
+	if r.Retention != "" {
+		retention, err := time.ParseDuration(r.Retention)
+		if err != nil || retention <= 0 {
+			log.Printf("%s CREATE FAILED %s %s\n", srcAddr, "InvalidRetention", r.Retention)
+			return nil, errf(codes.InvalidArgument, "Invalid retention %s", r.Retention)
+		}
+	}
+
+	fsUUID := uuid.NewV4()
+	fsID := fsUUID.String()
+
+	// Make the data key first, so nothing is created if it can't be
+	var dataKey string
+	if r.Encrypt {
+		dataKey, err = s.fs.keys.newDataKey(fsUUID.Bytes())
+		if err == ErrNoMasterKey {
+			log.Printf("%s CREATE FAILED %s\n", srcAddr, "NoMasterKey")
+			return nil, errf(codes.FailedPrecondition, "%v", "Encryption isn't set up")
+		}
+		if err != nil {
+			log.Printf("%s CREATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+	}
 	timestampMicro := brimtime.TimeToUnixMicro(time.Now())
 	// Write file system reference entries.
 	// write /fs 								FSID						FileSysRef
@@ -164,6 +229,87 @@ func (s *FileSystemAPIServer) CreateFS(ctx context.Context, r *pb.CreateFSReques
 		log.Printf("%s CREATE FAILED %v\n", srcAddr, err)
 		return nil, errf(codes.Internal, "%v", err)
 	}
+	// write /fs/FSID						blocksize					FileSysAttr
+	cKeyA, cKeyB = murmur3.Sum128([]byte("blocksize"))
+	fsSysAttr.Attr = "blocksize"
+	fsSysAttr.Value = strconv.FormatInt(blocksize, 10)
+	fsSysAttrByte, err = json.Marshal(fsSysAttr)
+	if err != nil {
+		log.Printf("%s  CREATE FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	_, err = s.gstore.Write(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, timestampMicro, fsSysAttrByte)
+	if err != nil {
+		log.Printf("%s CREATE FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	// write /fs/FSID						compression					FileSysAttr
+	if r.Compression != "" {
+		cKeyA, cKeyB = murmur3.Sum128([]byte("compression"))
+		fsSysAttr.Attr = "compression"
+		fsSysAttr.Value = r.Compression
+		fsSysAttrByte, err = json.Marshal(fsSysAttr)
+		if err != nil {
+			log.Printf("%s  CREATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		_, err = s.gstore.Write(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, timestampMicro, fsSysAttrByte)
+		if err != nil {
+			log.Printf("%s CREATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+	}
+
+	// write /fs/FSID						datakey						FileSysAttr
+	if dataKey != "" {
+		cKeyA, cKeyB = murmur3.Sum128([]byte("datakey"))
+		fsSysAttr.Attr = "datakey"
+		fsSysAttr.Value = dataKey
+		fsSysAttrByte, err = json.Marshal(fsSysAttr)
+		if err != nil {
+			log.Printf("%s  CREATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		_, err = s.gstore.Write(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, timestampMicro, fsSysAttrByte)
+		if err != nil {
+			log.Printf("%s CREATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+	}
+
+	// write /fs/FSID						dedup						FileSysAttr
+	if r.Dedup {
+		cKeyA, cKeyB = murmur3.Sum128([]byte("dedup"))
+		fsSysAttr.Attr = "dedup"
+		fsSysAttr.Value = "true"
+		fsSysAttrByte, err = json.Marshal(fsSysAttr)
+		if err != nil {
+			log.Printf("%s  CREATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		_, err = s.gstore.Write(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, timestampMicro, fsSysAttrByte)
+		if err != nil {
+			log.Printf("%s CREATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+	}
+
+	// write /fs/FSID						retention					FileSysAttr
+	if r.Retention != "" {
+		cKeyA, cKeyB = murmur3.Sum128([]byte("retention"))
+		fsSysAttr.Attr = "retention"
+		fsSysAttr.Value = r.Retention
+		fsSysAttrByte, err = json.Marshal(fsSysAttr)
+		if err != nil {
+			log.Printf("%s  CREATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		_, err = s.gstore.Write(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, timestampMicro, fsSysAttrByte)
+		if err != nil {
+			log.Printf("%s CREATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+	}
 
 	// Return File System UUID
 	// Log Operation
@@ -239,6 +385,148 @@ func (s *FileSystemAPIServer) ShowFS(ctx context.Context, r *pb.ShowFSRequest) (
 	}
 	fs.Name = fsAttrData.Value
 
+	// Read the block size, file systems created before it was configurable use the default
+	cKeyA, cKeyB = murmur3.Sum128([]byte("blocksize"))
+	_, value, err = s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+	if store.IsNotFound(err) {
+		fs.BlockSize = DefaultBlockSize
+	} else {
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		clear(&fsAttrData)
+		err = json.Unmarshal(value, &fsAttrData)
+		if err == nil {
+			fs.BlockSize, err = strconv.ParseInt(fsAttrData.Value, 10, 64)
+		}
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+	}
+
+	// Read the compression, none if it was never set
+	cKeyA, cKeyB = murmur3.Sum128([]byte("compression"))
+	_, value, err = s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+	if !store.IsNotFound(err) {
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		clear(&fsAttrData)
+		err = json.Unmarshal(value, &fsAttrData)
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		fs.Compression = fsAttrData.Value
+	}
+
+	// Encrypted file systems have a data key
+	cKeyA, cKeyB = murmur3.Sum128([]byte("datakey"))
+	_, _, err = s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+	if !store.IsNotFound(err) {
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		fs.Encrypted = true
+	}
+
+	// Read whether blocks are deduplicated
+	cKeyA, cKeyB = murmur3.Sum128([]byte("dedup"))
+	_, value, err = s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+	if !store.IsNotFound(err) {
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		clear(&fsAttrData)
+		err = json.Unmarshal(value, &fsAttrData)
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		fs.Dedup = fsAttrData.Value == "true"
+	}
+
+	// Read where a clone came from
+	cKeyA, cKeyB = murmur3.Sum128([]byte("origin"))
+	_, value, err = s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+	if !store.IsNotFound(err) {
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		clear(&fsAttrData)
+		err = json.Unmarshal(value, &fsAttrData)
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		fs.Origin = fsAttrData.Value
+	}
+
+	// Read how long removed files are kept
+	cKeyA, cKeyB = murmur3.Sum128([]byte("retention"))
+	_, value, err = s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+	if !store.IsNotFound(err) {
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		clear(&fsAttrData)
+		err = json.Unmarshal(value, &fsAttrData)
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		fs.Retention = fsAttrData.Value
+	}
+
+	// Read the quota
+	cKeyA, cKeyB = murmur3.Sum128([]byte("quota"))
+	_, value, err = s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+	if !store.IsNotFound(err) {
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		clear(&fsAttrData)
+		err = json.Unmarshal(value, &fsAttrData)
+		if err == nil {
+			fs.Quota = &Quota{}
+			err = json.Unmarshal([]byte(fsAttrData.Value), fs.Quota)
+		}
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+	}
+
+	// Add up the bytes each node has saved with compression, and the usage
+	// each node has counted
+	pKey = fmt.Sprintf("/fs/%s/stats", fs.ID)
+	pKeyA, pKeyB = murmur3.Sum128([]byte(pKey))
+	stats, err := s.gstore.ReadGroup(context.Background(), pKeyA, pKeyB)
+	if err != nil && !store.IsNotFound(err) {
+		log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	for _, v := range stats {
+		var fsStats FileSysStats
+		err = json.Unmarshal(v.Value, &fsStats)
+		if err != nil {
+			log.Printf("%s SHOW FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		fs.CompressionSaved += fsStats.CompressionSaved
+		fs.Bytes += fsStats.Bytes
+		fs.Blocks += fsStats.Blocks
+		fs.Inodes += fsStats.Inodes
+	}
+
 	// Read list of granted ip addresses
 	// group-lookup printf("/fs/%s/addr", FSID)
 	pKey = fmt.Sprintf("/fs/%s/addr", fs.ID)
@@ -493,6 +781,541 @@ func (s *FileSystemAPIServer) RevokeAddrFS(ctx context.Context, r *pb.RevokeAddr
 	return &pb.RevokeAddrFSResponse{Data: r.FSid}, nil
 }
 
+// ScrubFS ...
+func (s *FileSystemAPIServer) ScrubFS(ctx context.Context, r *pb.ScrubFSRequest) (*pb.ScrubFSResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	fsid, err := s.validateOwner(srcAddr, "SCRUB", r.Token, r.FSid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scrub the file system
+	report, err := s.fs.Scrub(ctx, fsid, r.DryRun)
+	if err != nil {
+		log.Printf("%s SCRUB FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	reportJSON, jerr := json.Marshal(report)
+	if jerr != nil {
+		return nil, errf(codes.Internal, "%s", jerr)
+	}
+	// Log Operation
+	log.Printf("%s SCRUB SUCCESS %s\n", srcAddr, r.FSid)
+	return &pb.ScrubFSResponse{Data: string(reportJSON)}, nil
+}
+
+// CheckFS ...
+func (s *FileSystemAPIServer) CheckFS(ctx context.Context, r *pb.CheckFSRequest) (*pb.CheckFSResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	fsid, err := s.validateOwner(srcAddr, "CHECK", r.Token, r.FSid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the file system
+	report, err := Fsck(ctx, s.fs, fsid, r.Repair)
+	if err != nil {
+		log.Printf("%s CHECK FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	reportJSON, jerr := json.Marshal(report)
+	if jerr != nil {
+		return nil, errf(codes.Internal, "%s", jerr)
+	}
+	// Log Operation
+	log.Printf("%s CHECK SUCCESS %s %d\n", srcAddr, r.FSid, len(report.Problems))
+	return &pb.CheckFSResponse{Data: string(reportJSON)}, nil
+}
+
+// RotateKeys ...
+func (s *FileSystemAPIServer) RotateKeys(ctx context.Context, r *pb.RotateKeysRequest) (*pb.RotateKeysResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	// Validate Admin Token
+	if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(r.Token), []byte(s.adminToken)) != 1 {
+		log.Printf("%s ROTATE FAILED %s\n", srcAddr, "PermissionDenied")
+		return nil, errf(codes.PermissionDenied, "%v", "Invalid Token")
+	}
+
+	// Pick up master keys added since startup
+	err := s.fs.keys.load()
+	if err != nil {
+		log.Printf("%s ROTATE FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	master, _, err := s.fs.keys.currentMaster()
+	if err != nil {
+		log.Printf("%s ROTATE FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.FailedPrecondition, "%v", "Encryption isn't set up")
+	}
+
+	// Rotate the one file system, or all of them
+	var fsIDs []string
+	if r.FSid != "" {
+		fsIDs = []string{r.FSid}
+	} else {
+		pKeyA, pKeyB := murmur3.Sum128([]byte("/fs"))
+		items, err := s.gstore.ReadGroup(context.Background(), pKeyA, pKeyB)
+		if err != nil && !store.IsNotFound(err) {
+			log.Printf("%s ROTATE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		for _, item := range items {
+			var fsRef FileSysRef
+			err = json.Unmarshal(item.Value, &fsRef)
+			if err != nil {
+				log.Printf("%s ROTATE FAILED %v\n", srcAddr, err)
+				return nil, errf(codes.Internal, "%v", err)
+			}
+			fsIDs = append(fsIDs, fsRef.FSID)
+		}
+	}
+	report := &RotateReport{Master: master, Failed: []string{}}
+	for _, fsID := range fsIDs {
+		fsid, err := uuid.FromString(fsID)
+		if err != nil {
+			log.Printf("%s ROTATE FAILED %s %v\n", srcAddr, fsID, err)
+			report.Failed = append(report.Failed, fsID)
+			continue
+		}
+		rotated, err := s.fs.rotateKey(ctx, fsid)
+		if err != nil {
+			log.Printf("%s ROTATE FAILED %s %v\n", srcAddr, fsID, err)
+			report.Failed = append(report.Failed, fsID)
+			continue
+		}
+		if rotated {
+			report.Rotated++
+		} else {
+			report.Current++
+		}
+	}
+	reportJSON, jerr := json.Marshal(report)
+	if jerr != nil {
+		return nil, errf(codes.Internal, "%s", jerr)
+	}
+	// Log Operation
+	log.Printf("%s ROTATE SUCCESS %s %d %d\n", srcAddr, master, report.Rotated, len(report.Failed))
+	return &pb.RotateKeysResponse{Data: string(reportJSON)}, nil
+}
+
+// snapshotErr turns a snapshot error into one ready to send to the client
+func snapshotErr(srcAddr, op string, err error) error {
+	log.Printf("%s %s FAILED %v\n", srcAddr, op, err)
+	switch err {
+	case ErrSnapshotName:
+		return errf(codes.InvalidArgument, "%v", err)
+	case ErrExists:
+		return errf(codes.AlreadyExists, "%v", "Snapshot already exists")
+	case ErrNoSnapshot:
+		return errf(codes.NotFound, "%v", err)
+	case ErrSnapshotInUse, ErrSnapshotPending:
+		return errf(codes.FailedPrecondition, "%v", err)
+	}
+	return errf(codes.Internal, "%v", err)
+}
+
+// CreateSnapshot ...
+func (s *FileSystemAPIServer) CreateSnapshot(ctx context.Context, r *pb.CreateSnapshotRequest) (*pb.CreateSnapshotResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	fsid, err := s.validateOwner(srcAddr, "SNAPSHOT", r.Token, r.FSid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Returns once the snapshot is recorded, it's pending until it's taken
+	snap, err := s.fs.CreateSnapshot(ctx, fsid, r.Name)
+	if err != nil {
+		return nil, snapshotErr(srcAddr, "SNAPSHOT", err)
+	}
+	snapJSON, jerr := json.Marshal(snap)
+	if jerr != nil {
+		return nil, errf(codes.Internal, "%s", jerr)
+	}
+	// Log Operation
+	log.Printf("%s SNAPSHOT SUCCESS %s %s\n", srcAddr, r.FSid, r.Name)
+	return &pb.CreateSnapshotResponse{Data: string(snapJSON)}, nil
+}
+
+// ListSnapshots ...
+func (s *FileSystemAPIServer) ListSnapshots(ctx context.Context, r *pb.ListSnapshotsRequest) (*pb.ListSnapshotsResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	fsid, err := s.validateOwner(srcAddr, "LIST SNAPSHOTS", r.Token, r.FSid)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps, err := s.fs.ListSnapshots(ctx, fsid)
+	if err != nil {
+		return nil, snapshotErr(srcAddr, "LIST SNAPSHOTS", err)
+	}
+	snapsJSON, jerr := json.Marshal(snaps)
+	if jerr != nil {
+		return nil, errf(codes.Internal, "%s", jerr)
+	}
+	// Log Operation
+	log.Printf("%s LIST SNAPSHOTS SUCCESS %s\n", srcAddr, r.FSid)
+	return &pb.ListSnapshotsResponse{Data: string(snapsJSON)}, nil
+}
+
+// DeleteSnapshot ...
+func (s *FileSystemAPIServer) DeleteSnapshot(ctx context.Context, r *pb.DeleteSnapshotRequest) (*pb.DeleteSnapshotResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	fsid, err := s.validateOwner(srcAddr, "DELETE SNAPSHOT", r.Token, r.FSid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.fs.DeleteSnapshot(ctx, fsid, r.Name)
+	if err != nil {
+		return nil, snapshotErr(srcAddr, "DELETE SNAPSHOT", err)
+	}
+	// Log Operation
+	log.Printf("%s DELETE SNAPSHOT SUCCESS %s %s\n", srcAddr, r.FSid, r.Name)
+	return &pb.DeleteSnapshotResponse{Data: r.Name}, nil
+}
+
+// RestoreSnapshot ...
+func (s *FileSystemAPIServer) RestoreSnapshot(ctx context.Context, r *pb.RestoreSnapshotRequest) (*pb.RestoreSnapshotResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	fsid, err := s.validateOwner(srcAddr, "RESTORE SNAPSHOT", r.Token, r.FSid)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := s.fs.RestoreSnapshot(ctx, fsid, r.Name)
+	if err != nil {
+		return nil, snapshotErr(srcAddr, "RESTORE SNAPSHOT", err)
+	}
+	reportJSON, jerr := json.Marshal(report)
+	if jerr != nil {
+		return nil, errf(codes.Internal, "%s", jerr)
+	}
+	// Log Operation
+	log.Printf("%s RESTORE SNAPSHOT SUCCESS %s %s %d\n", srcAddr, r.FSid, r.Name, report.Errors)
+	return &pb.RestoreSnapshotResponse{Data: string(reportJSON)}, nil
+}
+
+// CloneFS ...
+func (s *FileSystemAPIServer) CloneFS(ctx context.Context, r *pb.CloneFSRequest) (*pb.CloneFSResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	srcID, err := s.validateOwner(srcAddr, "CLONE", r.Token, r.FSid)
+	if err != nil {
+		return nil, err
+	}
+	acctID, err := s.validateToken(r.Token)
+	if err != nil {
+		log.Printf("%s CLONE FAILED %s\n", srcAddr, "PermissionDenied")
+		return nil, errf(codes.PermissionDenied, "%v", "Invalid Token")
+	}
+
+	// Copy the tree first, so the clone only shows up once it is complete
+	fsUUID := uuid.NewV4()
+	fsID := fsUUID.String()
+	report, err := s.fs.CloneFS(ctx, srcID, r.Snapshot, fsUUID)
+	if err != nil {
+		return nil, snapshotErr(srcAddr, "CLONE", err)
+	}
+
+	// Name the clone after where it came from unless it was given a name
+	name := r.FSName
+	if name == "" {
+		var fsSysAttr FileSysAttr
+		pKeyA, pKeyB := murmur3.Sum128([]byte(fmt.Sprintf("/fs/%s", r.FSid)))
+		cKeyA, cKeyB := murmur3.Sum128([]byte("name"))
+		_, value, err := s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+		if err == nil {
+			err = json.Unmarshal(value, &fsSysAttr)
+		}
+		if err != nil && !store.IsNotFound(err) {
+			log.Printf("%s CLONE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		name = fsSysAttr.Value + "@" + r.Snapshot
+	}
+
+	timestampMicro := brimtime.TimeToUnixMicro(time.Now())
+	// write /fs 								FSID						FileSysRef
+	// write /acct/acctID				FSID						FileSysRef
+	fsRefByte, err := json.Marshal(FileSysRef{FSID: fsID, AcctID: acctID})
+	if err != nil {
+		log.Printf("%s CLONE FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	cKeyA, cKeyB := murmur3.Sum128([]byte(fsID))
+	for _, pKey := range []string{"/fs", fmt.Sprintf("/acct/%s", acctID)} {
+		pKeyA, pKeyB := murmur3.Sum128([]byte(pKey))
+		_, err = s.gstore.Write(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, timestampMicro, fsRefByte)
+		if err != nil {
+			log.Printf("%s CLONE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+	}
+	// write /fs/FSID						name						FileSysAttr
+	fsSysAttrByte, err := json.Marshal(FileSysAttr{Attr: "name", Value: name, FSID: fsID})
+	if err != nil {
+		log.Printf("%s CLONE FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	pKeyA, pKeyB := murmur3.Sum128([]byte(fmt.Sprintf("/fs/%s", fsID)))
+	cKeyA, cKeyB = murmur3.Sum128([]byte("name"))
+	_, err = s.gstore.Write(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, timestampMicro, fsSysAttrByte)
+	if err != nil {
+		log.Printf("%s CLONE FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	// The clone gets its own copy of the address grants
+	// 		write /fs/FSID/addr			addr						AddrRef
+	pKeyA, pKeyB = murmur3.Sum128([]byte(fmt.Sprintf("/fs/%s/addr", r.FSid)))
+	addrs, err := s.gstore.ReadGroup(context.Background(), pKeyA, pKeyB)
+	if err != nil && !store.IsNotFound(err) {
+		log.Printf("%s CLONE FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	pKeyA, pKeyB = murmur3.Sum128([]byte(fmt.Sprintf("/fs/%s/addr", fsID)))
+	for _, item := range addrs {
+		var addrData AddrRef
+		err = json.Unmarshal(item.Value, &addrData)
+		if err != nil {
+			log.Printf("%s CLONE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		addrData.FSID = fsID
+		addrByte, err := json.Marshal(addrData)
+		if err != nil {
+			log.Printf("%s CLONE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+		_, err = s.gstore.Write(context.Background(), pKeyA, pKeyB, item.ChildKeyA, item.ChildKeyB, timestampMicro, addrByte)
+		if err != nil {
+			log.Printf("%s CLONE FAILED %v\n", srcAddr, err)
+			return nil, errf(codes.Internal, "%v", err)
+		}
+	}
+
+	// Return File System UUID
+	// Log Operation
+	log.Printf("%s CLONE SUCCESS %s %s@%s %d\n", srcAddr, fsID, r.FSid, r.Snapshot, report.Inodes)
+	return &pb.CloneFSResponse{Data: fsID}, nil
+}
+
+// ListDeleted ...
+func (s *FileSystemAPIServer) ListDeleted(ctx context.Context, r *pb.ListDeletedRequest) (*pb.ListDeletedResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	fsid, err := s.validateOwner(srcAddr, "LIST DELETED", r.Token, r.FSid)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := s.fs.ListDeleted(ctx, fsid)
+	if err != nil {
+		log.Printf("%s LIST DELETED FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	if deleted == nil {
+		deleted = []*DeletedEntry{}
+	}
+	deletedJSON, jerr := json.Marshal(deleted)
+	if jerr != nil {
+		return nil, errf(codes.Internal, "%s", jerr)
+	}
+	// Log Operation
+	log.Printf("%s LIST DELETED SUCCESS %s %d\n", srcAddr, r.FSid, len(deleted))
+	return &pb.ListDeletedResponse{Data: string(deletedJSON)}, nil
+}
+
+// Undelete ...
+func (s *FileSystemAPIServer) Undelete(ctx context.Context, r *pb.UndeleteRequest) (*pb.UndeleteResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	fsid, err := s.validateOwner(srcAddr, "UNDELETE", r.Token, r.FSid)
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := s.fs.Undelete(ctx, fsid, r.Path)
+	if err != nil {
+		log.Printf("%s UNDELETE FAILED %s %v\n", srcAddr, r.Path, err)
+		switch err {
+		case ErrNotInTrash:
+			return nil, errf(codes.NotFound, "%v", err)
+		case ErrExists:
+			return nil, errf(codes.AlreadyExists, "%s already exists", r.Path)
+		}
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	// Log Operation
+	log.Printf("%s UNDELETE SUCCESS %s %s %d\n", srcAddr, r.FSid, r.Path, restored)
+	return &pb.UndeleteResponse{Data: strconv.Itoa(restored)}, nil
+}
+
+// SetQuota ...
+func (s *FileSystemAPIServer) SetQuota(ctx context.Context, r *pb.SetQuotaRequest) (*pb.SetQuotaResponse, error) {
+	srcAddr := ""
+
+	// Get incomming ip
+	pr, ok := peer.FromContext(ctx)
+	if ok {
+		srcAddr = pr.Addr.String()
+	}
+
+	// Validate Admin Token, tenants can't raise their own quotas
+	if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(r.Token), []byte(s.adminToken)) != 1 {
+		log.Printf("%s QUOTA FAILED %s\n", srcAddr, "PermissionDenied")
+		return nil, errf(codes.PermissionDenied, "%v", "Invalid Token")
+	}
+	fsid, err := uuid.FromString(r.FSid)
+	if err != nil {
+		log.Printf("%s QUOTA FAILED %s %s\n", srcAddr, "InvalidFSid", r.FSid)
+		return nil, errf(codes.InvalidArgument, "Invalid file system id %s", r.FSid)
+	}
+	pKeyA, pKeyB := murmur3.Sum128([]byte("/fs"))
+	cKeyA, cKeyB := murmur3.Sum128([]byte(r.FSid))
+	_, _, err = s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+	if store.IsNotFound(err) {
+		log.Printf("%s QUOTA FAILED %s %s\n", srcAddr, "NotFound", r.FSid)
+		return nil, errf(codes.NotFound, "%v", "File System Not Found")
+	}
+	if err != nil {
+		log.Printf("%s QUOTA FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+
+	q := &Quota{
+		Bytes:      r.Bytes,
+		Inodes:     r.Inodes,
+		SoftBytes:  r.SoftBytes,
+		SoftInodes: r.SoftInodes,
+		Grace:      r.Grace,
+	}
+	if err = q.validate(); err != nil {
+		log.Printf("%s QUOTA FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.InvalidArgument, "%v", err)
+	}
+	if *q == (Quota{}) {
+		// No limits at all
+		q = nil
+	}
+	err = s.fs.WriteQuota(withFsId(ctx, fsid), q)
+	if err != nil {
+		log.Printf("%s QUOTA FAILED %v\n", srcAddr, err)
+		return nil, errf(codes.Internal, "%v", err)
+	}
+	// Log Operation
+	log.Printf("%s QUOTA SUCCESS %s %d %d %d %d\n", srcAddr, r.FSid, r.Bytes, r.Inodes, r.SoftBytes, r.SoftInodes)
+	return &pb.SetQuotaResponse{Data: r.FSid}, nil
+}
+
+// validateOwner checks the token is valid for the account that owns the file
+// system, returning an error ready to send to the client if not
+func (s *FileSystemAPIServer) validateOwner(srcAddr, op, token, fsID string) (uuid.UUID, error) {
+	var value []byte
+	var fsRef FileSysRef
+
+	// Validate Token
+	acctID, err := s.validateToken(token)
+	if err != nil {
+		log.Printf("%s %s FAILED %s\n", srcAddr, op, "PermissionDenied")
+		return uuid.UUID{}, errf(codes.PermissionDenied, "%v", "Invalid Token")
+	}
+
+	// Validate the file system belongs to the account
+	pKeyA, pKeyB := murmur3.Sum128([]byte("/fs"))
+	cKeyA, cKeyB := murmur3.Sum128([]byte(fsID))
+	_, value, err = s.gstore.Read(context.Background(), pKeyA, pKeyB, cKeyA, cKeyB, nil)
+	if store.IsNotFound(err) {
+		log.Printf("%s %s FAILED %s NOTFOUND", srcAddr, op, fsID)
+		return uuid.UUID{}, errf(codes.NotFound, "%v", "Not Found")
+	}
+	if err != nil {
+		log.Printf("%s %s FAILED %v\n", srcAddr, op, err)
+		return uuid.UUID{}, errf(codes.Internal, "%v", err)
+	}
+	err = json.Unmarshal(value, &fsRef)
+	if err != nil {
+		log.Printf("%s %s FAILED %v\n", srcAddr, op, err)
+		return uuid.UUID{}, errf(codes.Internal, "%v", err)
+	}
+	if fsRef.AcctID != acctID {
+		log.Printf("%s %s FAILED %s %s\n", srcAddr, op, fsID, "PermissionDenied")
+		return uuid.UUID{}, errf(codes.PermissionDenied, "%v", "Invalid Token")
+	}
+	fsid, err := uuid.FromString(fsID)
+	if err != nil {
+		log.Printf("%s %s FAILED %v\n", srcAddr, op, err)
+		return uuid.UUID{}, errf(codes.InvalidArgument, "%v", err)
+	}
+	return fsid, nil
+}
+
 // validateToken ...
 func (s *FileSystemAPIServer) validateToken(t string) (string, error) {
 	var tData TokenRef
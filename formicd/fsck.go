@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/creiht/formic"
+	pb "github.com/creiht/formic/proto"
+	"github.com/getcfs/fuse"
+	"github.com/gholt/brimtime"
+	"github.com/gholt/store"
+	"github.com/gogo/protobuf/proto"
+	"github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+)
+
+// Tombstones older than this are reported as stuck, and inodes changed more
+// recently than this don't have their link counts checked
+const fsckStuckAfter = time.Hour
+
+// Kinds of problems fsck finds
+const (
+	FsckDangling       = "dangling"       // Entry points to an inode that doesn't exist
+	FsckSize           = "size"           // Blocks or LastBlock don't match the size
+	FsckStuckTombstone = "stucktombstone" // Delete that hasn't finished
+	FsckPendingRename  = "pendingrename"  // Rename that didn't finish
+	FsckChecksum       = "checksum"       // Block doesn't match its checksum
+	FsckLinks          = "links"          // Link count doesn't match the entries for the inode
+	FsckError          = "error"          // Couldn't be checked
+)
+
+// FsckProblem is a single inconsistency found by fsck
+type FsckProblem struct {
+	Kind     string `json:"kind"`
+	Path     string `json:"path"`
+	Inode    uint64 `json:"inode,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+// FsckReport is the result of checking a file system
+type FsckReport struct {
+	FSID     string         `json:"fsid"`
+	Repair   bool           `json:"repair"`
+	Dirs     int            `json:"dirs"`
+	Files    int            `json:"files"`
+	Blocks   uint64         `json:"blocks"`
+	Problems []*FsckProblem `json:"problems"`
+}
+
+type fsckDir struct {
+	id   []byte
+	path string
+}
+
+// checker walks a file system through the FileService checking that it is
+// consistent. When repairing, only fixes that are safe with the file system in
+// use are made.
+type checker struct {
+	fs     FileService
+	fsid   []byte
+	repair bool
+	report *FsckReport
+	now    int64
+	stuck  int64
+}
+
+// Fsck checks the file system, repairing what it safely can if repair is set
+func Fsck(ctx context.Context, fs FileService, fsid uuid.UUID, repair bool) (*FsckReport, error) {
+	ctx = withFsId(ctx, fsid)
+	c := &checker{
+		fs:     fs,
+		fsid:   fsid.Bytes(),
+		repair: repair,
+		report: &FsckReport{FSID: fsid.String(), Repair: repair, Problems: []*FsckProblem{}},
+		now:    brimtime.TimeToUnixMicro(time.Now()),
+	}
+	c.stuck = c.now - int64(fsckStuckAfter/time.Microsecond)
+	root := formic.GetID(c.fsid, 1, 0)
+	if _, err := fs.GetInode(ctx, root); err != nil {
+		return c.report, err
+	}
+	refs := make(map[string]uint64)
+	inodes := make(map[string]*pb.InodeEntry)
+	paths := make(map[string]string)
+	seen := map[string]bool{string(root): true}
+	dirs := []fsckDir{{id: root, path: "/"}}
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		c.report.Dirs++
+		dirents, err := fs.ReadDirents(ctx, dir.id)
+		if err != nil {
+			c.problem(&FsckProblem{Kind: FsckError, Path: dir.path, Detail: err.Error()})
+			continue
+		}
+		for _, d := range dirents {
+			p := path.Join(dir.path, d.Name)
+			if d.Rename != nil {
+				c.checkRename(ctx, dir.id, p, d)
+				continue
+			}
+			if d.Tombstone != nil {
+				c.checkTombstone(ctx, dir.id, p, d)
+				continue
+			}
+			n, err := fs.GetInode(ctx, d.Id)
+			if err == ErrNotFound {
+				prob := &FsckProblem{Kind: FsckDangling, Path: p}
+				if c.repair {
+					prob.Repaired = fs.DeleteListing(ctx, dir.id, d.Name, c.now) == nil
+				}
+				c.problem(prob)
+				continue
+			}
+			if err != nil {
+				c.problem(&FsckProblem{Kind: FsckError, Path: p, Detail: err.Error()})
+				continue
+			}
+			if n.IsDir {
+				if !seen[string(d.Id)] {
+					seen[string(d.Id)] = true
+					dirs = append(dirs, fsckDir{id: d.Id, path: p})
+				}
+				continue
+			}
+			refs[string(d.Id)]++
+			if _, ok := inodes[string(d.Id)]; ok {
+				// Another link to a file that was already checked
+				continue
+			}
+			c.report.Files++
+			inodes[string(d.Id)] = n
+			paths[string(d.Id)] = p
+			c.checkFile(ctx, d.Id, p, n)
+		}
+	}
+	for id, n := range inodes {
+		if n.Attr.Ctime*int64(time.Second/time.Microsecond) > c.stuck {
+			continue
+		}
+		if linkCount(n) == refs[id] {
+			continue
+		}
+		prob := &FsckProblem{
+			Kind:   FsckLinks,
+			Path:   paths[id],
+			Inode:  n.Inode,
+			Detail: fmt.Sprintf("%d links, %d entries", linkCount(n), refs[id]),
+		}
+		if c.repair {
+			n.NodeCount = refs[id]
+			n.Attr.Nlink = uint32(refs[id])
+			prob.Repaired = c.writeInode(ctx, []byte(id), n) == nil
+		}
+		c.problem(prob)
+	}
+	return c.report, nil
+}
+
+func (c *checker) problem(p *FsckProblem) {
+	c.report.Problems = append(c.report.Problems, p)
+}
+
+func (c *checker) writeInode(ctx context.Context, id []byte, n *pb.InodeEntry) error {
+	b, err := proto.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return c.fs.WriteChunk(ctx, id, b)
+}
+
+// checkRename finishes an interrupted rename, which happens when the entry is
+// looked up
+func (c *checker) checkRename(ctx context.Context, parent []byte, p string, d *pb.DirEntry) {
+	prob := &FsckProblem{Kind: FsckPendingRename, Path: p, Detail: "to " + d.Rename.NewName}
+	if c.repair {
+		_, _, err := c.fs.Lookup(ctx, parent, d.Name)
+		prob.Repaired = err == nil
+	}
+	c.problem(prob)
+}
+
+// checkTombstone finishes deletes that are stuck. Directories are left for the
+// scrubber since their children have to be removed first.
+func (c *checker) checkTombstone(ctx context.Context, parent []byte, p string, d *pb.DirEntry) {
+	ts := d.Tombstone
+	if ts.Qtime > c.stuck {
+		return
+	}
+	prob := &FsckProblem{
+		Kind:   FsckStuckTombstone,
+		Path:   p,
+		Inode:  ts.Inode,
+		Detail: fmt.Sprintf("queued %s", brimtime.UnixMicroToTime(ts.Qtime).Format(time.RFC3339)),
+	}
+	if c.repair && d.Type != uint32(fuse.DT_Dir) {
+		prob.Repaired = c.finishDelete(ctx, parent, d.Name, ts)
+	}
+	c.problem(prob)
+}
+
+func (c *checker) finishDelete(ctx context.Context, parent []byte, name string, ts *pb.Tombstone) bool {
+	for b := ts.FirstBlock; b < ts.Blocks; b++ {
+		err := c.fs.DeleteChunk(ctx, formic.GetID(c.fsid, ts.Inode, b+1), ts.Dtime)
+		if !deleted(err) {
+			return false
+		}
+	}
+	if c.fs.DropBlockRefs(ctx, ts, true) != nil {
+		return false
+	}
+	if !deleted(c.fs.DeleteChunk(ctx, formic.GetID(c.fsid, ts.Inode, 0), ts.Dtime)) {
+		return false
+	}
+	return deleted(c.fs.DeleteListing(ctx, parent, name, ts.Dtime))
+}
+
+// deleted returns true if the delete worked or there was nothing to delete
+func deleted(err error) bool {
+	return err == nil || err == ErrNotFound || err == ErrStoreHasNewerValue || store.IsNotFound(err)
+}
+
+// checkFile checks that the size and blocks agree and that the blocks match
+// their checksums
+func (c *checker) checkFile(ctx context.Context, id []byte, p string, n *pb.InodeEntry) {
+	if n.IsLink {
+		return
+	}
+	end := n.Blocks
+	var blocks, last uint64
+	if n.BlockSize > 0 {
+		blocks, last = blocksForSize(n.Attr.Size, n.BlockSize)
+	}
+	if n.Blocks != blocks || n.LastBlock != last {
+		prob := &FsckProblem{
+			Kind:   FsckSize,
+			Path:   p,
+			Inode:  n.Inode,
+			Detail: fmt.Sprintf("size %d with %d blocks, last block %d", n.Attr.Size, n.Blocks, n.LastBlock),
+		}
+		if c.repair {
+			n.Blocks, n.LastBlock = blocks, last
+			prob.Repaired = c.writeInode(ctx, id, n) == nil
+		}
+		c.problem(prob)
+	}
+	for b := uint64(0); b < end; b++ {
+		var err error
+		if blockHash(n, b) != nil {
+			// Deduplicated, the content is checked against its hash
+			_, err = c.fs.GetBlock(uncached(ctx), c.fsid, n.Inode, b)
+		} else {
+			err = c.fs.VerifyChunk(ctx, formic.GetID(c.fsid, n.Inode, b+1)) // block 0 is for inode data
+		}
+		if err == ErrNotFound {
+			// A hole
+			continue
+		}
+		c.report.Blocks++
+		if err == ErrChecksumMismatch {
+			c.problem(&FsckProblem{Kind: FsckChecksum, Path: p, Inode: n.Inode, Detail: fmt.Sprintf("block %d", b)})
+		} else if err != nil {
+			c.problem(&FsckProblem{Kind: FsckError, Path: p, Inode: n.Inode, Detail: fmt.Sprintf("block %d: %s", b, err)})
+		}
+	}
+}
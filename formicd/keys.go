@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gholt/store"
+	"github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+)
+
+// Encryption used for a FileBlock
+const (
+	EncryptionNone   = 0
+	EncryptionAESGCM = 1
+)
+
+// Size of the master and data keys, for AES-256
+const keySize = 32
+
+var ErrNoMasterKey = errors.New("No master key")
+
+// keyRing holds the master keys that wrap each file system's data key. The
+// keys are loaded from a file with one key per line, "<id> <hex key>", and the
+// last key is the one data keys are wrapped with. Older keys are kept in the
+// file until every data key has been rotated off them.
+type keyRing struct {
+	sync.RWMutex
+	file    string
+	masters map[string][]byte
+	current string
+}
+
+// newKeyRing loads the master keys from file. A file that doesn't exist gives
+// a key ring without keys, so nothing can be encrypted until keys are added.
+func newKeyRing(file string) (*keyRing, error) {
+	k := &keyRing{file: file, masters: make(map[string][]byte)}
+	return k, k.load()
+}
+
+func (k *keyRing) load() error {
+	if k.file == "" {
+		return nil
+	}
+	f, err := os.Open(k.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	masters := make(map[string][]byte)
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: Expected <id> <hex key>", k.file, n)
+		}
+		key, err := hex.DecodeString(fields[1])
+		if err != nil || len(key) != keySize {
+			return fmt.Errorf("%s:%d: Key must be %d bytes of hex", k.file, n, keySize)
+		}
+		masters[fields[0]] = key
+		current = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	k.Lock()
+	k.masters = masters
+	k.current = current
+	k.Unlock()
+	return nil
+}
+
+// master returns the master key, reloading the key file if it isn't known yet
+// since a new key may have been added for a rotation
+func (k *keyRing) master(id string) ([]byte, error) {
+	k.RLock()
+	key, ok := k.masters[id]
+	k.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+	k.RLock()
+	key, ok = k.masters[id]
+	k.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown master key %s", id)
+	}
+	return key, nil
+}
+
+// currentMaster returns the id and key new data keys are wrapped with
+func (k *keyRing) currentMaster() (string, []byte, error) {
+	k.RLock()
+	defer k.RUnlock()
+	if k.current == "" {
+		return "", nil, ErrNoMasterKey
+	}
+	return k.current, k.masters[k.current], nil
+}
+
+// wrap encrypts the data key with the current master key, giving
+// "<master id>:<hex nonce and sealed key>". The fsid is authenticated so a
+// wrapped key can't be moved to another file system.
+func (k *keyRing) wrap(fsid, key []byte) (string, error) {
+	id, master, err := k.currentMaster()
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(master)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := encrypt(aead, fsid, key)
+	if err != nil {
+		return "", err
+	}
+	return id + ":" + hex.EncodeToString(sealed), nil
+}
+
+func (k *keyRing) unwrap(fsid []byte, wrapped string) ([]byte, error) {
+	i := strings.LastIndex(wrapped, ":")
+	if i < 0 {
+		return nil, errors.New("Invalid wrapped key")
+	}
+	master, err := k.master(wrapped[:i])
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := hex.DecodeString(wrapped[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(aead, fsid, sealed)
+}
+
+// newDataKey returns a new wrapped data key for the file system
+func (k *keyRing) newDataKey(fsid []byte) (string, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return k.wrap(fsid, key)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
+
+// encrypt seals data with a random nonce, which is put in front of it. The id is
+// authenticated along with the data.
+func encrypt(aead cipher.AEAD, id, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, id), nil
+}
+
+func decrypt(aead cipher.AEAD, id, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("Encrypted data too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], id)
+}
+
+// RotateReport is the result of re-wrapping data keys
+type RotateReport struct {
+	Master  string   `json:"master"`
+	Rotated int      `json:"rotated"`
+	Current int      `json:"current"`
+	Failed  []string `json:"failed"`
+}
+
+// rotateKey re-wraps the file system's data key with the current master key.
+// The data key itself doesn't change, so no blocks have to be rewritten.
+// Returns false if the file system isn't encrypted or already uses the
+// current master key.
+func (o *OortFS) rotateKey(ctx context.Context, fsid uuid.UUID) (bool, error) {
+	key := []byte(fmt.Sprintf("/fs/%s", fsid))
+	b, err := o.comms.ReadGroupItem(ctx, key, []byte("datakey"))
+	if store.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	attr := FileSysAttr{}
+	if err = json.Unmarshal(b, &attr); err != nil {
+		return false, err
+	}
+	id, _, err := o.keys.currentMaster()
+	if err != nil {
+		return false, err
+	}
+	if strings.HasPrefix(attr.Value, id+":") {
+		return false, nil
+	}
+	dataKey, err := o.keys.unwrap(fsid.Bytes(), attr.Value)
+	if err != nil {
+		return false, err
+	}
+	attr.Value, err = o.keys.wrap(fsid.Bytes(), dataKey)
+	if err != nil {
+		return false, err
+	}
+	b, err = json.Marshal(attr)
+	if err != nil {
+		return false, err
+	}
+	return true, o.comms.WriteGroup(ctx, key, []byte("datakey"), b)
+}
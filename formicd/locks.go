@@ -0,0 +1,74 @@
+package main
+
+// Inodes and partial blocks are changed by reading them, changing them and
+// writing them back. Changes to the same inode or block through this formicd
+// are done one at a time, under a lock picked by the id, so they never lose
+// each other.
+//
+// Changes through other formicds can't be locked out, and the store only
+// keeps whichever write is newest, without a way to write only if the value
+// is still the one read. So that is only best effort: the timestamp of the
+// value is checked again right before writing, and the change is done again
+// on top of whatever was written in the meantime. A write through another
+// formicd landing between that check and the write is still lost.
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/spaolacci/murmur3"
+	"golang.org/x/net/context"
+)
+
+// How many locks the ids are spread over
+const lockStripes = 1024
+
+// How many times a change is tried while others keep changing the same value
+const maxUpdateTries = 5
+
+var ErrConflict = errors.New("Too many conflicting updates")
+
+// errChanged is returned by the check when the value has been written since
+// the change started
+var errChanged = errors.New("Changed since it was read")
+
+// stripedLocks serializes the changes to each id, without keeping a lock for
+// every id ever changed
+type stripedLocks [lockStripes]sync.Mutex
+
+// lock locks the stripe of the id and returns it, to be unlocked once done
+func (l *stripedLocks) lock(id []byte) *sync.Mutex {
+	m := &l[murmur3.Sum64(id)%lockStripes]
+	m.Lock()
+	return m
+}
+
+// optimistically runs update, which reads, changes and writes back the value
+// with id. update calls check right before writing, which returns errChanged
+// if the value has been written since update started, and update is run again.
+// update has to be safe to run more than once. The check and the write aren't
+// atomic, see above.
+func optimistically(ctx context.Context, fs FileService, id []byte, update func(check func() error) error) error {
+	for tries := 1; ; tries++ {
+		tsm, err := fs.ChunkTimestamp(ctx, id)
+		if err != nil {
+			return err
+		}
+		err = update(func() error {
+			now, err := fs.ChunkTimestamp(ctx, id)
+			if err != nil {
+				return err
+			}
+			if now != tsm {
+				return errChanged
+			}
+			return nil
+		})
+		if err != errChanged && err != ErrStoreHasNewerValue {
+			return err
+		}
+		if tries == maxUpdateTries {
+			return ErrConflict
+		}
+	}
+}
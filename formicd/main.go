@@ -156,11 +156,19 @@ func main() {
 	if err != nil {
 		grpclog.Fatalln(err)
 	}
-	fs := NewOortFS(comms)
+	deletes, err := newQueue(path.Join(cfg.path, "queue/deletes"))
+	FatalIf(err, "Couldn't open the delete queue")
+	updates, err := newQueue(path.Join(cfg.path, "queue/updates"))
+	FatalIf(err, "Couldn't open the update queue")
+	keys, err := newKeyRing(cfg.masterKeys)
+	FatalIf(err, "Couldn't load the master keys")
+	fs := NewOortFS(comms, deletes, cfg.nodeId, keys)
+	fs.blocks = newBlockCache(cfg.blockCache, cfg.blockCacheTTL)
+	go newScrubber(fs, cfg.scrubInterval, cfg.scrubReclaim).run()
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.port))
 	FatalIf(err, "Failed to bind formicd to port")
-	pb.RegisterFileSystemAPIServer(s, NewFileSystemAPIServer(gstore))
-	pb.RegisterApiServer(s, NewApiServer(fs, cfg.nodeId, comms))
+	pb.RegisterFileSystemAPIServer(s, NewFileSystemAPIServer(gstore, fs, cfg.adminToken))
+	pb.RegisterApiServer(s, NewApiServer(fs, cfg.nodeId, comms, updates))
 	grpclog.Printf("Starting up formic and the file system api on %d...\n", cfg.port)
 	s.Serve(l)
 }
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	retryMin     = 100 * time.Millisecond
+	retryMax     = time.Minute
+	compactAfter = 10000 // Number of finished entries before the journal is rewritten
+)
+
+// queueEntry is a single piece of work in a queue. The same record format is
+// used in the journal, where a done record marks the work with that seq as
+// finished.
+type queueEntry struct {
+	Seq   uint64          `json:"seq"`
+	Done  bool            `json:"done,omitempty"`
+	Item  json.RawMessage `json:"item,omitempty"`
+	tries uint
+}
+
+// queue is a work queue backed by a journal on local disk, so that pending
+// work survives a restart. Pushing never blocks on the workers.
+type queue struct {
+	sync.Mutex
+	file     string
+	f        *os.File
+	pending  []*queueEntry
+	live     map[uint64]json.RawMessage
+	ready    chan struct{}
+	seq      uint64
+	finished int
+	// Pushes wait for the journal to be synced up to their entry, and whoever
+	// syncs it covers everything written so far
+	syncLock sync.Mutex
+	synced   uint64
+}
+
+// newQueue opens the queue journaled at file, replaying any work that was not
+// finished. If file is "" the queue is only kept in memory.
+func newQueue(file string) (*queue, error) {
+	q := &queue{
+		file:  file,
+		live:  make(map[uint64]json.RawMessage),
+		ready: make(chan struct{}, 1),
+	}
+	if file == "" {
+		return q, nil
+	}
+	err := os.MkdirAll(path.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = q.replay()
+	if err != nil {
+		return nil, err
+	}
+	err = q.compact()
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]uint64, 0, len(q.live))
+	for seq := range q.live {
+		seqs = append(seqs, seq)
+	}
+	// Replay in the order the work was queued
+	sort.Sort(seqSlice(seqs))
+	for _, seq := range seqs {
+		q.pending = append(q.pending, &queueEntry{Seq: seq, Item: q.live[seq]})
+	}
+	if len(q.pending) > 0 {
+		q.ready <- struct{}{}
+	}
+	return q, nil
+}
+
+// replay loads the unfinished entries from the journal
+func (q *queue) replay() error {
+	f, err := os.Open(q.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		e := &queueEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			// A torn write at the end of the journal from a crash
+			break
+		}
+		if e.Seq > q.seq {
+			q.seq = e.Seq
+		}
+		if e.Done {
+			delete(q.live, e.Seq)
+		} else {
+			q.live[e.Seq] = e.Item
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the journal with only the unfinished entries. Must be
+// called with the lock held, or before the queue is in use.
+func (q *queue) compact() error {
+	tmp := q.file + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for seq, item := range q.live {
+		if err = q.writeEntry(w, &queueEntry{Seq: seq, Item: item}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, q.file); err != nil {
+		return err
+	}
+	if q.f != nil {
+		q.f.Close()
+	}
+	q.f, err = os.OpenFile(q.file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	q.finished = 0
+	return nil
+}
+
+func (q *queue) writeEntry(w io.Writer, e *queueEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// push adds the item to the queue, once it is synced to the journal
+func (q *queue) push(item interface{}) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	q.Lock()
+	q.seq++
+	e := &queueEntry{Seq: q.seq, Item: b}
+	if q.f != nil {
+		if err = q.writeEntry(q.f, e); err != nil {
+			q.Unlock()
+			return err
+		}
+	}
+	q.live[e.Seq] = b
+	q.add(e)
+	journaled := q.f != nil
+	q.Unlock()
+	if !journaled {
+		return nil
+	}
+	return q.sync(e.Seq)
+}
+
+// sync makes sure the journal is on disk up to seq. Pushes made while another
+// sync was running are covered by a single sync after it. Done records aren't
+// synced, losing one only means the work is done again.
+func (q *queue) sync(seq uint64) error {
+	q.syncLock.Lock()
+	defer q.syncLock.Unlock()
+	if q.synced >= seq {
+		return nil
+	}
+	// Held so the journal isn't swapped out by a compact while syncing
+	q.Lock()
+	defer q.Unlock()
+	upTo := q.seq
+	if err := q.f.Sync(); err != nil {
+		return err
+	}
+	q.synced = upTo
+	return nil
+}
+
+// add puts the entry on the end of the in memory queue. Must be called with
+// the lock held.
+func (q *queue) add(e *queueEntry) {
+	q.pending = append(q.pending, e)
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop waits for the next entry to work on
+func (q *queue) pop() *queueEntry {
+	for {
+		q.Lock()
+		if len(q.pending) > 0 {
+			e := q.pending[0]
+			q.pending[0] = nil
+			q.pending = q.pending[1:]
+			if len(q.pending) > 0 {
+				select {
+				case q.ready <- struct{}{}:
+				default:
+				}
+			}
+			q.Unlock()
+			return e
+		}
+		q.Unlock()
+		<-q.ready
+	}
+}
+
+// done marks the work for the entry as finished
+func (q *queue) done(e *queueEntry) error {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.live, e.Seq)
+	if q.f == nil {
+		return nil
+	}
+	err := q.writeEntry(q.f, &queueEntry{Seq: e.Seq, Done: true})
+	if err != nil {
+		return err
+	}
+	q.finished++
+	if q.finished >= compactAfter {
+		return q.compact()
+	}
+	return nil
+}
+
+// retry puts the entry back on the queue after a backoff that grows with each
+// try. The entry is still in the journal, so it is safe if we restart first.
+func (q *queue) retry(e *queueEntry) {
+	e.tries++
+	q.later(e, backoff(e.tries))
+}
+
+// later puts the entry back on the queue after d, for work that can't be done
+// yet
+func (q *queue) later(e *queueEntry, d time.Duration) {
+	time.AfterFunc(d, func() {
+		q.Lock()
+		q.add(e)
+		q.Unlock()
+	})
+}
+
+func backoff(tries uint) time.Duration {
+	d := retryMin
+	for i := uint(1); i < tries && d < retryMax; i++ {
+		d *= 2
+	}
+	if d > retryMax {
+		d = retryMax
+	}
+	return d
+}
+
+type seqSlice []uint64
+
+func (s seqSlice) Len() int           { return len(s) }
+func (s seqSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s seqSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,229 @@
+package main
+
+// A quota is kept as the "quota" attribute of the file system. The hard limits
+// can't be gone over. The soft limits can, for the grace period, after which
+// they are enforced like the hard ones until the usage drops back under them.
+//
+// Each formicd checks against the usage as of the last time it looked, which
+// it does every few seconds, so a file system can go over by what is written
+// in between.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gholt/brimtime"
+	"github.com/gholt/store"
+	"golang.org/x/net/context"
+)
+
+const (
+	quotaRefresh      = 5 * time.Second
+	defaultQuotaGrace = 7 * 24 * time.Hour
+)
+
+var ErrQuotaExceeded = errors.New("Quota exceeded")
+
+// Quota limits how much of a file system can be used, zero is no limit
+type Quota struct {
+	Bytes      int64  `json:"bytes,omitempty"`
+	Inodes     int64  `json:"inodes,omitempty"`
+	SoftBytes  int64  `json:"softbytes,omitempty"`
+	SoftInodes int64  `json:"softinodes,omitempty"`
+	Grace      string `json:"grace,omitempty"` // How long the soft limits can be gone over
+	Over       int64  `json:"over,omitempty"`  // Timestamp micro the soft limits were gone over
+}
+
+// validate checks the limits make sense
+func (q *Quota) validate() error {
+	if q.Bytes < 0 || q.Inodes < 0 || q.SoftBytes < 0 || q.SoftInodes < 0 {
+		return errors.New("Limits can't be negative")
+	}
+	if q.Bytes > 0 && q.SoftBytes > q.Bytes || q.Inodes > 0 && q.SoftInodes > q.Inodes {
+		return errors.New("Soft limits can't be over the hard limits")
+	}
+	if q.Grace != "" {
+		if grace, err := time.ParseDuration(q.Grace); err != nil || grace <= 0 {
+			return fmt.Errorf("Invalid grace period %s", q.Grace)
+		}
+	}
+	return nil
+}
+
+func (q *Quota) grace() time.Duration {
+	if grace, err := time.ParseDuration(q.Grace); err == nil {
+		return grace
+	}
+	return defaultQuotaGrace
+}
+
+// limitBytes returns the lowest byte limit that can hold, or 0 if there is
+// none. A nil quota has none.
+func (q *Quota) limitBytes() int64 {
+	if q == nil {
+		return 0
+	}
+	if q.SoftBytes > 0 && q.graceOver() {
+		return q.SoftBytes
+	}
+	return q.Bytes
+}
+
+// limitInodes is limitBytes for inodes
+func (q *Quota) limitInodes() int64 {
+	if q == nil {
+		return 0
+	}
+	if q.SoftInodes > 0 && q.graceOver() {
+		return q.SoftInodes
+	}
+	return q.Inodes
+}
+
+// graceOver returns true once the soft limits have been gone over for longer
+// than the grace period
+func (q *Quota) graceOver() bool {
+	return q.Over != 0 && time.Since(brimtime.UnixMicroToTime(q.Over)) > q.grace()
+}
+
+// overSoft returns true if the usage is over either soft limit
+func (q *Quota) overSoft(u *FileSysStats) bool {
+	return q.SoftBytes > 0 && u.Bytes > q.SoftBytes || q.SoftInodes > 0 && u.Inodes > q.SoftInodes
+}
+
+// quotaState is the quota of a file system and its usage, as of read
+type quotaState struct {
+	quota *Quota
+	usage *FileSysStats
+	read  time.Time
+}
+
+// readQuota returns the quota of the file system in the context, or nil if it
+// doesn't have one
+func (o *OortFS) readQuota(ctx context.Context) (*Quota, error) {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, err := o.comms.ReadGroupItem(unversioned(ctx), []byte(fmt.Sprintf("/fs/%s", fsid)), []byte("quota"))
+	if store.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	attr := FileSysAttr{}
+	if err = json.Unmarshal(b, &attr); err != nil {
+		return nil, err
+	}
+	q := &Quota{}
+	return q, json.Unmarshal([]byte(attr.Value), q)
+}
+
+// WriteQuota sets the quota of the file system in the context, a nil quota
+// takes it away
+func (o *OortFS) WriteQuota(ctx context.Context, q *Quota) error {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return err
+	}
+	key := []byte(fmt.Sprintf("/fs/%s", fsid))
+	if q == nil {
+		err = o.comms.DeleteGroupItem(unversioned(ctx), key, []byte("quota"))
+	} else {
+		var value []byte
+		value, err = json.Marshal(q)
+		if err != nil {
+			return err
+		}
+		var b []byte
+		b, err = json.Marshal(&FileSysAttr{Attr: "quota", Value: string(value), FSID: fsid.String()})
+		if err != nil {
+			return err
+		}
+		err = o.comms.WriteGroup(unversioned(ctx), key, []byte("quota"), b)
+	}
+	o.Lock()
+	delete(o.quotas, fsid.String())
+	o.Unlock()
+	return err
+}
+
+// quotaState returns the quota of the file system in the context and its
+// usage, reading them again if they are out of date
+func (o *OortFS) quotaState(ctx context.Context) (*quotaState, error) {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.RLock()
+	s, ok := o.quotas[fsid.String()]
+	o.RUnlock()
+	if ok && time.Since(s.read) < quotaRefresh {
+		return s, nil
+	}
+	s = &quotaState{read: time.Now()}
+	s.quota, err = o.readQuota(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.quota != nil {
+		s.usage, err = o.GetUsage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// Start or stop the grace period
+		over := s.quota.overSoft(s.usage)
+		if over != (s.quota.Over != 0) {
+			q := *s.quota
+			q.Over = 0
+			if over {
+				q.Over = brimtime.TimeToUnixMicro(time.Now())
+			}
+			if err = o.WriteQuota(ctx, &q); err != nil {
+				return nil, err
+			}
+			s.quota = &q
+		}
+	}
+	o.Lock()
+	o.quotas[fsid.String()] = s
+	o.Unlock()
+	return s, nil
+}
+
+// GetQuota returns the quota of the file system in the context and its usage,
+// the quota is nil if there isn't one
+func (o *OortFS) GetQuota(ctx context.Context) (*Quota, *FileSysStats, error) {
+	s, err := o.quotaState(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.quota, s.usage, nil
+}
+
+// CheckQuota returns ErrQuotaExceeded if adding bytes and inodes to the file
+// system in the context would go over its quota
+func (o *OortFS) CheckQuota(ctx context.Context, bytes, inodes int64) error {
+	if bytes <= 0 && inodes <= 0 {
+		// Nothing is added, so it can't go over
+		return nil
+	}
+	if _, err := GetFsId(ctx); err != nil {
+		return nil
+	}
+	s, err := o.quotaState(ctx)
+	if err != nil {
+		return err
+	}
+	q, u := s.quota, s.usage
+	if limit := q.limitBytes(); bytes > 0 && limit > 0 && u.Bytes+bytes > limit {
+		return ErrQuotaExceeded
+	}
+	if limit := q.limitInodes(); inodes > 0 && limit > 0 && u.Inodes+inodes > limit {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/creiht/formic"
+	pb "github.com/creiht/formic/proto"
+	"github.com/gholt/brimtime"
+	"github.com/gholt/store"
+	"github.com/gogo/protobuf/proto"
+	"github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+)
+
+// Anything changed more recently than this is assumed to still be in flight
+// and is left alone by the scrubber
+const scrubGrace = time.Hour
+
+// errScrubbed is returned by a fix when the inode changed since it was
+// looked at, and is left alone
+var errScrubbed = errors.New("Changed since it was scrubbed")
+
+// ScrubReport is what the scrubber found in a file system, and reclaimed
+// unless it was a dry run
+type ScrubReport struct {
+	FSID            string `json:"fsid"`
+	DryRun          bool   `json:"dryrun"`
+	Dirs            int    `json:"dirs"`
+	Files           int    `json:"files"`
+	Tombstones      int    `json:"tombstones"`
+	StuckDeletes    int    `json:"stuckdeletes"`
+	BadTombstones   int    `json:"badtombstones"`
+	PendingRenames  int    `json:"pendingrenames"`
+	DanglingEntries int    `json:"danglingentries"`
+	OrphanBlocks    uint64 `json:"orphanblocks"`
+	LinkMismatches  int    `json:"linkmismatches"`
+	Errors          int    `json:"errors"`
+}
+
+// Scrub walks the file system from the root looking for data that is no
+// longer reachable. The value store can't be listed, so only orphans that the
+// tree still has a trace of are found:
+//   - tombstoned entries whose delete never finished, or that were written
+//     without the right fsid
+//   - renames that were interrupted
+//   - entries whose inode is gone
+//   - blocks past the end of a file
+//   - inodes whose link count doesn't match the entries that point at them
+func (o *OortFS) Scrub(ctx context.Context, fsid uuid.UUID, dryRun bool) (*ScrubReport, error) {
+	ctx = withFsId(ctx, fsid)
+	fs := fsid.Bytes()
+	r := &ScrubReport{FSID: fsid.String(), DryRun: dryRun}
+	now := brimtime.TimeToUnixMicro(time.Now())
+	stale := now - int64(scrubGrace/time.Microsecond)
+	root := formic.GetID(fs, 1, 0)
+	if _, err := o.GetInode(ctx, root); err != nil {
+		return r, err
+	}
+	refs := make(map[string]uint64)
+	inodes := make(map[string]*pb.InodeEntry)
+	seen := map[string]bool{string(root): true}
+	dirs := [][]byte{root}
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		r.Dirs++
+		items, err := o.comms.ReadGroup(ctx, dir)
+		if store.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Scrub error reading dir %x: %s", dir, err)
+			r.Errors++
+			continue
+		}
+		for _, item := range items {
+			d := &pb.DirEntry{}
+			if err := proto.Unmarshal(item.Value, d); err != nil {
+				r.Errors++
+				continue
+			}
+			if d.Rename != nil {
+				r.PendingRenames++
+				if !dryRun {
+					if err := o.finishRename(ctx, dir, d); err != nil {
+						log.Printf("Scrub error finishing rename of %s: %s", d.Name, err)
+						r.Errors++
+					}
+				}
+				continue
+			}
+			if d.Tombstone != nil {
+				r.Tombstones++
+				if item.TimestampMicro > stale {
+					continue
+				}
+				r.StuckDeletes++
+				var ts *pb.Tombstone
+				if !bytes.Equal(d.Tombstone.FsId, fs) {
+					r.BadTombstones++
+					t := *d.Tombstone
+					t.FsId = fs
+					ts = &t
+				}
+				if !dryRun {
+					err = o.deletes.push(&DeleteItem{parent: dir, name: d.Name, ts: ts})
+					if err != nil {
+						log.Printf("Scrub error queueing delete of %s: %s", d.Name, err)
+						r.Errors++
+					}
+				}
+				continue
+			}
+			n, err := o.GetInode(ctx, d.Id)
+			if err == ErrNotFound {
+				if item.TimestampMicro > stale {
+					continue
+				}
+				r.DanglingEntries++
+				if !dryRun {
+					err = o.comms.DeleteGroupItem(ctx, dir, []byte(d.Name))
+					if err != nil {
+						log.Printf("Scrub error removing %s: %s", d.Name, err)
+						r.Errors++
+					}
+				}
+				continue
+			}
+			if err != nil {
+				r.Errors++
+				continue
+			}
+			if n.IsDir {
+				if !seen[string(d.Id)] {
+					seen[string(d.Id)] = true
+					dirs = append(dirs, d.Id)
+				}
+				continue
+			}
+			if _, ok := inodes[string(d.Id)]; !ok {
+				r.Files++
+				inodes[string(d.Id)] = n
+			}
+			refs[string(d.Id)]++
+		}
+	}
+	recent := func(n *pb.InodeEntry) bool {
+		return n.Attr.Ctime*int64(time.Second/time.Microsecond) > stale || n.Attr.Mtime*int64(time.Second/time.Microsecond) > stale
+	}
+	for id, n := range inodes {
+		if recent(n) {
+			continue
+		}
+		o.scrubBlocks(ctx, fs, n, now, stale, r)
+		// Renames move entries around while we walk, so the counts can't be
+		// trusted until they are finished
+		if r.PendingRenames == 0 && linkCount(n) != refs[id] {
+			r.LinkMismatches++
+			if !dryRun {
+				// The inode may have changed since the walk read it
+				_, err := o.updateInode(ctx, []byte(id), func(n *pb.InodeEntry) error {
+					if recent(n) || linkCount(n) == refs[id] {
+						return errScrubbed
+					}
+					n.NodeCount = refs[id]
+					n.Attr.Nlink = uint32(refs[id])
+					return nil
+				})
+				if err == errScrubbed {
+					err = nil
+				}
+				if err != nil {
+					log.Printf("Scrub error fixing links of inode %d: %s", n.Inode, err)
+					r.Errors++
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// scrubBlocks looks for blocks past the end of the file, left by writes whose
+// size update was lost or truncates that didn't finish
+func (o *OortFS) scrubBlocks(ctx context.Context, fs []byte, n *pb.InodeEntry, now, stale int64, r *ScrubReport) {
+	if uint64(len(n.BlockHashes)) > n.Blocks {
+		o.scrubBlockMap(ctx, fs, n, now, stale, r)
+	}
+	end := n.Blocks
+	for {
+		_, err := o.GetChunk(ctx, formic.GetID(fs, n.Inode, end+1)) // block 0 is for inode data
+		if err == ErrNotFound {
+			break
+		}
+		if err != nil {
+			r.Errors++
+			break
+		}
+		end++
+	}
+	if end == n.Blocks {
+		return
+	}
+	r.OrphanBlocks += end - n.Blocks
+	if r.DryRun {
+		return
+	}
+	err := o.deletes.push(&DeleteItem{
+		ts: &pb.Tombstone{
+			Dtime:      now,
+			Qtime:      now,
+			FsId:       fs,
+			Inode:      n.Inode,
+			FirstBlock: n.Blocks,
+			Blocks:     end,
+		},
+	})
+	if err != nil {
+		log.Printf("Scrub error queueing delete of inode %d blocks: %s", n.Inode, err)
+		r.Errors++
+	}
+}
+
+// scrubBlockMap is scrubBlocks for deduplicated blocks, which are past the end
+// of the file in the block map of the inode
+func (o *OortFS) scrubBlockMap(ctx context.Context, fs []byte, n *pb.InodeEntry, now, stale int64, r *ScrubReport) {
+	id := formic.GetID(fs, n.Inode, 0)
+	// Writes add to the block map before the size, without changing the times
+	// of the inode
+	tsm, err := o.ChunkTimestamp(ctx, id)
+	if err != nil {
+		r.Errors++
+		return
+	}
+	if tsm > stale {
+		return
+	}
+	for _, hash := range n.BlockHashes[n.Blocks:] {
+		if len(hash) > 0 {
+			r.OrphanBlocks++
+		}
+	}
+	if r.DryRun {
+		return
+	}
+	var hashes [][]byte
+	n, err = o.updateInode(ctx, id, func(n *pb.InodeEntry) error {
+		hashes = trimBlockHashes(n, n.Blocks)
+		if hashes == nil {
+			return errScrubbed
+		}
+		return nil
+	})
+	if err == errScrubbed {
+		return
+	}
+	if err == nil {
+		err = o.deletes.push(&DeleteItem{
+			ts: &pb.Tombstone{
+				Dtime:      now,
+				Qtime:      now,
+				FsId:       fs,
+				Inode:      n.Inode,
+				FirstBlock: n.Blocks,
+				Blocks:     n.Blocks + uint64(len(hashes)),
+				Hashes:     hashes,
+			},
+		})
+	}
+	if err != nil {
+		log.Printf("Scrub error trimming block map of inode %d: %s", n.Inode, err)
+		r.Errors++
+	}
+}
+
+// Scrubber periodically scrubs every file system, and corrects their usage
+type Scrubber struct {
+	fs       *OortFS
+	interval time.Duration
+	reclaim  bool
+}
+
+func newScrubber(fs *OortFS, interval time.Duration, reclaim bool) *Scrubber {
+	return &Scrubber{
+		fs:       fs,
+		interval: interval,
+		reclaim:  reclaim,
+	}
+}
+
+func (s *Scrubber) run() {
+	// TODO: Every formicd scrubs everything, this should be split up
+	for {
+		time.Sleep(s.interval)
+		ctx := context.Background()
+		items, err := s.fs.comms.ReadGroup(ctx, []byte("/fs"))
+		if err != nil {
+			log.Println("Scrub error listing file systems: ", err)
+			continue
+		}
+		for _, item := range items {
+			var ref FileSysRef
+			if err := json.Unmarshal(item.Value, &ref); err != nil {
+				log.Println("Scrub error reading file system: ", err)
+				continue
+			}
+			fsid, err := uuid.FromString(ref.FSID)
+			if err != nil {
+				log.Println("Scrub error reading file system: ", err)
+				continue
+			}
+			r, err := s.fs.Scrub(ctx, fsid, !s.reclaim)
+			if err != nil {
+				log.Printf("Scrub of %s failed: %s", ref.FSID, err)
+				continue
+			}
+			log.Printf("Scrubbed %s: %+v", ref.FSID, *r)
+			u, err := s.fs.ReconcileUsage(ctx, fsid)
+			if err != nil {
+				log.Printf("Usage scan of %s failed: %s", ref.FSID, err)
+				continue
+			}
+			log.Printf("Usage of %s: %d bytes %d blocks %d inodes", ref.FSID, u.Bytes, u.Blocks, u.Inodes)
+		}
+	}
+}
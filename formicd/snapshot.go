@@ -0,0 +1,909 @@
+package main
+
+// A snapshot is a point in time, and the file system as it was then is kept by
+// copying whatever changes afterwards. The first change to a value or group
+// item after a snapshot copies what was there to a versioned key,
+// "<key>@<snapshot time>", keeping its original timestamp. Reading as of a
+// snapshot looks at the copies for it and every later snapshot, oldest first.
+// The first copy found is what was there, if it is no newer than the
+// snapshot. Without a copy, the live value is what was there, if it is no
+// newer than the snapshot. The copies made for each snapshot are listed in
+// /fs/<fsid>/snapshot/<time> so they can be cleaned up when it is deleted.
+//
+// All of this happens in StoreComms, so OortFS works the same on a snapshot,
+// it just can't change anything. Every formicd has to know about a snapshot
+// before its time comes, so snapshots are taken snapshotDelay after they are
+// created and the list of snapshots is refreshed more often than that. Until
+// then the snapshot is listed as pending, and can't be used.
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/creiht/formic"
+	pb "github.com/creiht/formic/proto"
+	"github.com/getcfs/fuse"
+	"github.com/gholt/brimtime"
+	"github.com/gholt/store"
+	"github.com/gogo/protobuf/proto"
+	"github.com/satori/go.uuid"
+	"github.com/spaolacci/murmur3"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	snapshotDelay   = 5 * time.Second
+	snapshotRefresh = time.Second
+)
+
+var ErrReadOnly = errors.New("Snapshots are read only")
+var ErrNoSnapshot = errors.New("No such snapshot")
+var ErrSnapshotPending = errors.New("Snapshot hasn't been taken yet")
+var ErrSnapshotName = errors.New("Snapshot names can only have letters, numbers, '.', '_' and '-'")
+
+var snapshotName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Snapshot is kept in /fs/<fsid>/snapshots with the name as the key
+type Snapshot struct {
+	Name     string `json:"name"`
+	Time     int64  `json:"time"` // Timestamp micro the snapshot is of
+	Created  int64  `json:"created"`
+	Deleting bool   `json:"deleting,omitempty"`
+	// Set when read, until the snapshot has been taken
+	Pending bool `json:"pending,omitempty"`
+	// File systems cloned from the snapshot, which read from it
+	Clones []string `json:"clones,omitempty"`
+}
+
+// taken returns true once the snapshot's time has come
+func (s *Snapshot) taken() bool {
+	return s.Time <= brimtime.TimeToUnixMicro(time.Now())
+}
+
+// snapshotCopy is kept in /fs/<fsid>/snapshot/<time> for each copy made for
+// the snapshot, either a value or a group item
+type snapshotCopy struct {
+	Id    []byte `json:"id,omitempty"`
+	Key   []byte `json:"key,omitempty"`
+	Child []byte `json:"child,omitempty"`
+}
+
+// Context keys for work that isn't started by a client
+type unversionedKey struct{}
+type asOfKey struct{}
+
+// unversioned returns a context that reads and writes the store as is, for
+// data that doesn't belong to the tree of a file system
+func unversioned(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unversionedKey{}, true)
+}
+
+// asOf returns a context that reads the file system as it was at tsm
+func asOf(ctx context.Context, tsm int64) context.Context {
+	return context.WithValue(ctx, asOfKey{}, tsm)
+}
+
+// pastView returns true if the context reads the file system as it was at
+// some time, rather than as it is
+func pastView(ctx context.Context) bool {
+	_, ok := ctx.Value(asOfKey{}).(int64)
+	return ok || GetSnapshot(ctx) != ""
+}
+
+// GetSnapshot returns the name of the snapshot the client is using, if any
+func GetSnapshot(ctx context.Context) string {
+	md, ok := metadata.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if snapshot, ok := md["snapshot"]; ok && len(snapshot) > 0 {
+		return snapshot[0]
+	}
+	return ""
+}
+
+func versioned(key []byte, tsm int64) []byte {
+	v := make([]byte, len(key)+9)
+	copy(v, key)
+	v[len(key)] = '@'
+	binary.BigEndian.PutUint64(v[len(key)+1:], uint64(tsm))
+	return v
+}
+
+type snapshotList struct {
+	loaded time.Time
+	byName map[string]*Snapshot
+	times  []int64 // Oldest first, including snapshots being deleted
+	taken  []int64 // Oldest first, the ones changes are kept for
+}
+
+// latest returns the time of the newest snapshot taken before tsm, or 0
+func (l *snapshotList) latest(tsm int64) int64 {
+	i := sort.Search(len(l.taken), func(i int) bool { return l.taken[i] >= tsm })
+	if i == 0 {
+		return 0
+	}
+	return l.taken[i-1]
+}
+
+// snapshots keeps the snapshots of each file system, refreshed from the group
+// store every snapshotRefresh
+type snapshots struct {
+	sync.Mutex
+	gstore store.GroupStore
+	lists  map[string]*snapshotList
+}
+
+func newSnapshots(gstore store.GroupStore) *snapshots {
+	return &snapshots{
+		gstore: gstore,
+		lists:  make(map[string]*snapshotList),
+	}
+}
+
+func (s *snapshots) list(ctx context.Context, fsid string) (*snapshotList, error) {
+	s.Lock()
+	l, ok := s.lists[fsid]
+	s.Unlock()
+	if ok && time.Since(l.loaded) < snapshotRefresh {
+		return l, nil
+	}
+	keyA, keyB := murmur3.Sum128([]byte(fmt.Sprintf("/fs/%s/snapshots", fsid)))
+	items, err := s.gstore.ReadGroup(ctx, keyA, keyB)
+	if err != nil && !store.IsNotFound(err) {
+		return nil, err
+	}
+	l = &snapshotList{loaded: time.Now(), byName: make(map[string]*Snapshot)}
+	for _, item := range items {
+		snap := &Snapshot{}
+		if err := json.Unmarshal(item.Value, snap); err != nil {
+			return nil, err
+		}
+		l.byName[snap.Name] = snap
+		l.times = append(l.times, snap.Time)
+		if !snap.Deleting {
+			l.taken = append(l.taken, snap.Time)
+		}
+	}
+	sort.Sort(int64Slice(l.times))
+	sort.Sort(int64Slice(l.taken))
+	s.Lock()
+	s.lists[fsid] = l
+	s.Unlock()
+	return l, nil
+}
+
+// forget drops the cached list, after it was changed by this formicd
+func (s *snapshots) forget(fsid string) {
+	s.Lock()
+	delete(s.lists, fsid)
+	s.Unlock()
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// snapshotView is how a request sees the store
+type snapshotView struct {
+	fsid string
+	at   int64 // Snapshot being read, 0 for the live file system
+	list *snapshotList
+}
+
+// view returns how the request sees the store, or nil if it sees it as is
+func (s *snapshots) view(ctx context.Context) (*snapshotView, error) {
+	if ctx.Value(unversionedKey{}) != nil {
+		return nil, nil
+	}
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return nil, nil
+	}
+	l, err := s.list(ctx, fsid.String())
+	if err != nil {
+		return nil, err
+	}
+	v := &snapshotView{fsid: fsid.String(), list: l}
+	if at, ok := ctx.Value(asOfKey{}).(int64); ok {
+		v.at = at
+	} else if name := GetSnapshot(ctx); name != "" {
+		snap, ok := l.byName[name]
+		if !ok || snap.Deleting || !snap.taken() {
+			return nil, ErrNoSnapshot
+		}
+		v.at = snap.Time
+	}
+	if v.at == 0 && len(l.taken) == 0 {
+		return nil, nil
+	}
+	return v, nil
+}
+
+// later returns the snapshot times whose copies can hold what was there at
+// the time being viewed
+func (v *snapshotView) later() []int64 {
+	i := sort.Search(len(v.list.times), func(i int) bool { return v.list.times[i] >= v.at })
+	return v.list.times[i:]
+}
+
+func (o *StoreComms) readValueAt(ctx context.Context, v *snapshotView, id []byte) (int64, []byte, error) {
+	for _, t := range v.later() {
+		keyA, keyB := murmur3.Sum128(versioned(id, t))
+		ts, b, err := o.vstore.Read(ctx, keyA, keyB, nil)
+		if store.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if ts > v.at {
+			// Created after the snapshot
+			return 0, nil, store.ErrNotFound
+		}
+		return ts, b, nil
+	}
+	keyA, keyB := murmur3.Sum128(id)
+	ts, b, err := o.vstore.Read(ctx, keyA, keyB, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if ts > v.at {
+		return 0, nil, store.ErrNotFound
+	}
+	return ts, b, nil
+}
+
+// lookupValueAt is readValueAt without reading the value
+func (o *StoreComms) lookupValueAt(ctx context.Context, v *snapshotView, id []byte) error {
+	for _, t := range v.later() {
+		keyA, keyB := murmur3.Sum128(versioned(id, t))
+		ts, _, err := o.vstore.Lookup(ctx, keyA, keyB)
+		if store.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if ts > v.at {
+			return store.ErrNotFound
+		}
+		return nil
+	}
+	keyA, keyB := murmur3.Sum128(id)
+	ts, _, err := o.vstore.Lookup(ctx, keyA, keyB)
+	if err != nil {
+		return err
+	}
+	if ts > v.at {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (o *StoreComms) readGroupItemAt(ctx context.Context, v *snapshotView, key []byte, childKeyA, childKeyB uint64) ([]byte, error) {
+	for _, t := range v.later() {
+		keyA, keyB := murmur3.Sum128(versioned(key, t))
+		ts, b, err := o.gstore.Read(ctx, keyA, keyB, childKeyA, childKeyB, nil)
+		if store.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ts > v.at {
+			return nil, store.ErrNotFound
+		}
+		return b, nil
+	}
+	keyA, keyB := murmur3.Sum128(key)
+	ts, b, err := o.gstore.Read(ctx, keyA, keyB, childKeyA, childKeyB, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ts > v.at {
+		return nil, store.ErrNotFound
+	}
+	return b, nil
+}
+
+func (o *StoreComms) readGroupAt(ctx context.Context, v *snapshotView, key []byte) ([]store.ReadGroupItem, error) {
+	seen := make(map[[2]uint64]bool)
+	var items []store.ReadGroupItem
+	add := func(group []store.ReadGroupItem) {
+		for _, item := range group {
+			k := [2]uint64{item.ChildKeyA, item.ChildKeyB}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			if item.TimestampMicro <= v.at {
+				items = append(items, item)
+			}
+		}
+	}
+	for _, t := range v.later() {
+		keyA, keyB := murmur3.Sum128(versioned(key, t))
+		group, err := o.gstore.ReadGroup(ctx, keyA, keyB)
+		if err != nil && !store.IsNotFound(err) {
+			return nil, err
+		}
+		add(group)
+	}
+	keyA, keyB := murmur3.Sum128(key)
+	group, err := o.gstore.ReadGroup(ctx, keyA, keyB)
+	if err != nil && !store.IsNotFound(err) {
+		return nil, err
+	}
+	add(group)
+	return items, nil
+}
+
+// writable returns the view of the store for a change at tsm, and the time of
+// the snapshot the change has to keep the old value for, if any
+func (o *StoreComms) writable(ctx context.Context, tsm int64) (*snapshotView, int64, error) {
+	v, err := o.snaps.view(ctx)
+	if err != nil || v == nil {
+		return nil, 0, err
+	}
+	if v.at != 0 {
+		return nil, 0, ErrReadOnly
+	}
+	return v, v.list.latest(tsm), nil
+}
+
+// keepValue copies the value before it is changed at tsm, if it hasn't
+// changed since the last snapshot
+func (o *StoreComms) keepValue(ctx context.Context, id []byte, tsm int64) error {
+	v, t, err := o.writable(ctx, tsm)
+	if err != nil || t == 0 {
+		return err
+	}
+	keyA, keyB := murmur3.Sum128(id)
+	ts, b, err := o.vstore.Read(ctx, keyA, keyB, nil)
+	if store.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ts > t {
+		// Changed since, so it was kept then
+		return nil
+	}
+	return o.copyValue(ctx, v.fsid, t, id, ts, b)
+}
+
+// copyValue writes a copy of the value for the snapshot at t
+func (o *StoreComms) copyValue(ctx context.Context, fsid string, t int64, id []byte, ts int64, b []byte) error {
+	ctx = unversioned(ctx)
+	err := o.trackCopy(ctx, fsid, t, &snapshotCopy{Id: id})
+	if err != nil {
+		return err
+	}
+	vid := versioned(id, t)
+	if o.contentRefs != nil {
+		// The copy needs its own references to deduplicated content
+		hashes, err := o.contentRefs(ctx, id, b)
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err = o.WriteGroup(ctx, refsKey(hash), vid, []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+	keyA, keyB := murmur3.Sum128(vid)
+	_, err = o.vstore.Write(ctx, keyA, keyB, ts, b)
+	return err
+}
+
+// keepGroupItem copies the group item before it is changed at tsm, if it
+// hasn't changed since the last snapshot
+func (o *StoreComms) keepGroupItem(ctx context.Context, key, childKey []byte, tsm int64) error {
+	v, t, err := o.writable(ctx, tsm)
+	if err != nil || t == 0 {
+		return err
+	}
+	keyA, keyB := murmur3.Sum128(key)
+	childKeyA, childKeyB := murmur3.Sum128(childKey)
+	ts, b, err := o.gstore.Read(ctx, keyA, keyB, childKeyA, childKeyB, nil)
+	if store.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ts > t {
+		return nil
+	}
+	return o.copyGroupItem(ctx, v.fsid, t, key, childKey, ts, b)
+}
+
+func (o *StoreComms) copyGroupItem(ctx context.Context, fsid string, t int64, key, childKey []byte, ts int64, b []byte) error {
+	ctx = unversioned(ctx)
+	err := o.trackCopy(ctx, fsid, t, &snapshotCopy{Key: key, Child: childKey})
+	if err != nil {
+		return err
+	}
+	keyA, keyB := murmur3.Sum128(versioned(key, t))
+	childKeyA, childKeyB := murmur3.Sum128(childKey)
+	_, err = o.gstore.Write(ctx, keyA, keyB, childKeyA, childKeyB, ts, b)
+	return err
+}
+
+func (o *StoreComms) trackCopy(ctx context.Context, fsid string, t int64, c *snapshotCopy) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	// The copy is its own key, so it is only listed once
+	return o.WriteGroup(ctx, []byte(fmt.Sprintf("/fs/%s/snapshot/%d", fsid, t)), b, b)
+}
+
+// readSnapshots returns the snapshots of the file system, oldest first
+func (o *OortFS) readSnapshots(ctx context.Context, fsid uuid.UUID) ([]*Snapshot, error) {
+	items, err := o.comms.ReadGroup(unversioned(ctx), []byte(fmt.Sprintf("/fs/%s/snapshots", fsid)))
+	if err != nil && !store.IsNotFound(err) {
+		return nil, err
+	}
+	snaps := make([]*Snapshot, 0, len(items))
+	for _, item := range items {
+		snap := &Snapshot{}
+		if err := json.Unmarshal(item.Value, snap); err != nil {
+			return nil, err
+		}
+		snap.Pending = !snap.taken()
+		snaps = append(snaps, snap)
+	}
+	sort.Sort(snapshotsByTime(snaps))
+	return snaps, nil
+}
+
+type snapshotsByTime []*Snapshot
+
+func (s snapshotsByTime) Len() int           { return len(s) }
+func (s snapshotsByTime) Less(i, j int) bool { return s[i].Time < s[j].Time }
+func (s snapshotsByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (o *OortFS) writeSnapshot(ctx context.Context, fsid uuid.UUID, snap *Snapshot) error {
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	err = o.comms.WriteGroup(unversioned(ctx), []byte(fmt.Sprintf("/fs/%s/snapshots", fsid)), []byte(snap.Name), b)
+	o.comms.snaps.forget(fsid.String())
+	return err
+}
+
+// CreateSnapshot takes a snapshot of the file system. It returns once the
+// snapshot is recorded, and it is pending until it is taken snapshotDelay
+// later.
+func (o *OortFS) CreateSnapshot(ctx context.Context, fsid uuid.UUID, name string) (*Snapshot, error) {
+	if !snapshotName.MatchString(name) {
+		return nil, ErrSnapshotName
+	}
+	snaps, err := o.readSnapshots(ctx, fsid)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		if snap.Name == name {
+			return nil, ErrExists
+		}
+	}
+	now := time.Now()
+	snap := &Snapshot{
+		Name:    name,
+		Time:    brimtime.TimeToUnixMicro(now.Add(snapshotDelay)),
+		Created: brimtime.TimeToUnixMicro(now),
+		Pending: true,
+	}
+	if err = o.writeSnapshot(ctx, fsid, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// ListSnapshots returns the snapshots of the file system, oldest first
+func (o *OortFS) ListSnapshots(ctx context.Context, fsid uuid.UUID) ([]*Snapshot, error) {
+	return o.readSnapshots(ctx, fsid)
+}
+
+func (o *OortFS) getSnapshot(ctx context.Context, fsid uuid.UUID, name string) (*Snapshot, *Snapshot, error) {
+	snaps, err := o.readSnapshots(ctx, fsid)
+	if err != nil {
+		return nil, nil, err
+	}
+	var prev *Snapshot
+	for _, snap := range snaps {
+		if snap.Name == name {
+			return snap, prev, nil
+		}
+		if !snap.Deleting {
+			prev = snap
+		}
+	}
+	return nil, nil, ErrNoSnapshot
+}
+
+// DeleteSnapshot deletes the snapshot and the copies made for it. Copies that
+// older snapshots still need are moved to the one before it.
+func (o *OortFS) DeleteSnapshot(ctx context.Context, fsid uuid.UUID, name string) error {
+	ctx = unversioned(ctx)
+	snap, prev, err := o.getSnapshot(ctx, fsid, name)
+	if err != nil {
+		return err
+	}
+	if len(snap.Clones) > 0 {
+		// TODO: Let go of the snapshot once DeleteFS deletes the clones
+		return ErrSnapshotInUse
+	}
+	if !snap.Deleting {
+		snap.Deleting = true
+		if err = o.writeSnapshot(ctx, fsid, snap); err != nil {
+			return err
+		}
+	}
+	key := []byte(fmt.Sprintf("/fs/%s/snapshot/%d", fsid, snap.Time))
+	items, err := o.comms.ReadGroup(ctx, key)
+	if err != nil && !store.IsNotFound(err) {
+		return err
+	}
+	failed := 0
+	for _, item := range items {
+		c := &snapshotCopy{}
+		if err = json.Unmarshal(item.Value, c); err == nil {
+			err = o.dropCopy(ctx, fsid, snap, prev, c)
+		}
+		if err == nil {
+			err = o.comms.DeleteGroupItem(ctx, key, item.Value)
+		}
+		if err != nil {
+			log.Printf("Snapshot %s delete error: %s", name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		// Left marked as deleting so it can be tried again
+		return fmt.Errorf("Couldn't delete %d copies", failed)
+	}
+	err = o.comms.DeleteGroupItem(ctx, []byte(fmt.Sprintf("/fs/%s/snapshots", fsid)), []byte(name))
+	o.comms.snaps.forget(fsid.String())
+	return err
+}
+
+// dropCopy deletes a copy made for the snapshot, first moving it to the
+// previous snapshot if it was there then
+func (o *OortFS) dropCopy(ctx context.Context, fsid uuid.UUID, snap, prev *Snapshot, c *snapshotCopy) error {
+	now := brimtime.TimeToUnixMicro(time.Now())
+	if c.Id != nil {
+		vid := versioned(c.Id, snap.Time)
+		ts, b, err := o.comms.ReadValueTS(ctx, vid)
+		if store.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if prev != nil && ts <= prev.Time {
+			if err = o.comms.copyValue(ctx, fsid.String(), prev.Time, c.Id, ts, b); err != nil {
+				return err
+			}
+		}
+		hashes, err := o.contentRefs(ctx, c.Id, b)
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err = o.comms.dropRef(ctx, hash, vid); err != nil {
+				return err
+			}
+		}
+		err = o.comms.DeleteValueTS(ctx, vid, now)
+		if err == ErrStoreHasNewerValue {
+			return nil
+		}
+		return err
+	}
+	vkey := versioned(c.Key, snap.Time)
+	childKeyA, childKeyB := murmur3.Sum128(c.Child)
+	keyA, keyB := murmur3.Sum128(vkey)
+	ts, b, err := o.comms.gstore.Read(ctx, keyA, keyB, childKeyA, childKeyB, nil)
+	if store.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if prev != nil && ts <= prev.Time {
+		if err = o.comms.copyGroupItem(ctx, fsid.String(), prev.Time, c.Key, c.Child, ts, b); err != nil {
+			return err
+		}
+	}
+	err = o.comms.DeleteGroupItemTS(ctx, vkey, c.Child, now)
+	if err == ErrStoreHasNewerValue {
+		return nil
+	}
+	return err
+}
+
+// RestoreReport is what was changed to roll a file system back to a snapshot
+type RestoreReport struct {
+	Snapshot string `json:"snapshot"`
+	Dirs     int    `json:"dirs"`
+	Entries  int    `json:"entries"` // Entries put back the way they were
+	Removed  int    `json:"removed"` // Entries made since the snapshot
+	Inodes   int    `json:"inodes"`
+	Blocks   int    `json:"blocks"`
+	Errors   int    `json:"errors"`
+}
+
+// RestoreSnapshot rolls the file system back to the snapshot. Anything that
+// changed since is put back, and anything made since is removed. This is
+// meant to be done with the file system unmounted.
+func (o *OortFS) RestoreSnapshot(ctx context.Context, fsid uuid.UUID, name string) (*RestoreReport, error) {
+	live := withFsId(ctx, fsid)
+	snap, _, err := o.getSnapshot(live, fsid, name)
+	if err != nil {
+		return nil, err
+	}
+	if snap.Deleting {
+		return nil, ErrNoSnapshot
+	}
+	if !snap.taken() {
+		return nil, ErrSnapshotPending
+	}
+	then := asOf(live, snap.Time)
+	r := &RestoreReport{Snapshot: name}
+	// Find everything that was in the snapshot first, so things that were
+	// moved since aren't removed from where they are now
+	root := formic.GetID(fsid.Bytes(), 1, 0)
+	keep := map[string]bool{string(root): true}
+	dirs := [][]byte{root}
+	for i := 0; i < len(dirs); i++ {
+		items, err := o.comms.ReadGroup(then, dirs[i])
+		if err != nil && !store.IsNotFound(err) {
+			return r, err
+		}
+		for _, item := range items {
+			d := &pb.DirEntry{}
+			if err := proto.Unmarshal(item.Value, d); err != nil {
+				return r, err
+			}
+			if d.Tombstone != nil || keep[string(d.Id)] {
+				continue
+			}
+			keep[string(d.Id)] = true
+			if d.Type == uint32(fuse.DT_Dir) {
+				dirs = append(dirs, d.Id)
+			}
+		}
+	}
+	for _, dir := range dirs {
+		r.Dirs++
+		o.restoreDir(then, live, dir, keep, r)
+	}
+	for id := range keep {
+		o.restoreInode(then, live, fsid, []byte(id), r)
+	}
+	return r, nil
+}
+
+func (o *OortFS) restoreDir(then, live context.Context, dir []byte, keep map[string]bool, r *RestoreReport) {
+	was, err := o.comms.ReadGroup(then, dir)
+	if err != nil && !store.IsNotFound(err) {
+		r.Errors++
+		return
+	}
+	now, err := o.comms.ReadGroup(live, dir)
+	if err != nil && !store.IsNotFound(err) {
+		r.Errors++
+		return
+	}
+	current := make(map[[2]uint64]int64)
+	for _, item := range now {
+		current[[2]uint64{item.ChildKeyA, item.ChildKeyB}] = item.TimestampMicro
+	}
+	for _, item := range was {
+		k := [2]uint64{item.ChildKeyA, item.ChildKeyB}
+		ts, ok := current[k]
+		delete(current, k)
+		if ok && ts == item.TimestampMicro {
+			continue
+		}
+		d := &pb.DirEntry{}
+		err = proto.Unmarshal(item.Value, d)
+		if err == nil {
+			err = o.comms.WriteGroup(live, dir, []byte(d.Name), item.Value)
+		}
+		if err != nil {
+			r.Errors++
+			continue
+		}
+		r.Entries++
+	}
+	for _, item := range now {
+		if _, ok := current[[2]uint64{item.ChildKeyA, item.ChildKeyB}]; !ok {
+			continue
+		}
+		d := &pb.DirEntry{}
+		if err = proto.Unmarshal(item.Value, d); err != nil {
+			r.Errors++
+			continue
+		}
+		o.restoreRemove(live, dir, d, keep, r)
+	}
+}
+
+// restoreRemove removes an entry made since the snapshot, and what it points
+// to unless that was in the snapshot
+func (o *OortFS) restoreRemove(live context.Context, parent []byte, d *pb.DirEntry, keep map[string]bool, r *RestoreReport) {
+	if d.Tombstone != nil {
+		// Already being deleted
+		return
+	}
+	if !keep[string(d.Id)] {
+		if d.Type == uint32(fuse.DT_Dir) {
+			children, err := o.comms.ReadGroup(live, d.Id)
+			if err != nil && !store.IsNotFound(err) {
+				r.Errors++
+				return
+			}
+			for _, item := range children {
+				child := &pb.DirEntry{}
+				if err = proto.Unmarshal(item.Value, child); err != nil {
+					r.Errors++
+					return
+				}
+				o.restoreRemove(live, d.Id, child, keep, r)
+			}
+		}
+		n, err := o.GetInode(live, d.Id)
+		if err != nil && err != ErrNotFound {
+			r.Errors++
+			return
+		}
+		if n != nil {
+			now := brimtime.TimeToUnixMicro(time.Now())
+			err = o.deletes.push(&DeleteItem{
+				ts: &pb.Tombstone{
+					Dtime:  now,
+					Qtime:  now,
+					FsId:   n.FsId,
+					Inode:  n.Inode,
+					Blocks: n.Blocks,
+				},
+				id: d.Id,
+			})
+			if err != nil {
+				r.Errors++
+				return
+			}
+		}
+	}
+	if err := o.comms.DeleteGroupItem(live, parent, []byte(d.Name)); err != nil {
+		r.Errors++
+		return
+	}
+	r.Removed++
+}
+
+// restoreInode puts the inode and its blocks back the way they were
+func (o *OortFS) restoreInode(then, live context.Context, fsid uuid.UUID, id []byte, r *RestoreReport) {
+	was, err := o.GetInode(then, id)
+	if err != nil {
+		r.Errors++
+		return
+	}
+	now, err := o.GetInode(live, id)
+	if err != nil && err != ErrNotFound {
+		r.Errors++
+		return
+	}
+	if changed, err := o.changedSince(then, live, id); err != nil {
+		r.Errors++
+		return
+	} else if changed {
+		if err = o.restoreBlockMap(live, fsid, id, was, now); err != nil {
+			r.Errors++
+			return
+		}
+		r.Inodes++
+	}
+	fs, err := o.fsSettings(live)
+	if err != nil {
+		r.Errors++
+		return
+	}
+	if was.IsDir || was.IsLink || fs.dedup {
+		// Deduplicated blocks came back with the block map
+		return
+	}
+	for b := uint64(0); b < was.Blocks; b++ {
+		bid := formic.GetID(fsid.Bytes(), was.Inode, b+1) // block 0 is for inode data
+		changed, err := o.changedSince(then, live, bid)
+		if err != nil {
+			r.Errors++
+			continue
+		}
+		if !changed {
+			continue
+		}
+		data, err := o.GetChunk(then, bid)
+		if err == ErrNotFound {
+			// A hole
+			err = o.DeleteChunk(live, bid, brimtime.TimeToUnixMicro(time.Now()))
+			if store.IsNotFound(err) {
+				err = nil
+			}
+		} else if err == nil {
+			err = o.WriteChunk(live, bid, data)
+		}
+		if err != nil {
+			r.Errors++
+			continue
+		}
+		r.Blocks++
+	}
+	if now != nil && now.Blocks > was.Blocks {
+		t := brimtime.TimeToUnixMicro(time.Now())
+		err = o.deletes.push(&DeleteItem{
+			ts: &pb.Tombstone{
+				Dtime:      t,
+				Qtime:      t,
+				FsId:       fsid.Bytes(),
+				Inode:      was.Inode,
+				FirstBlock: was.Blocks,
+				Blocks:     now.Blocks,
+			},
+		})
+		if err != nil {
+			r.Errors++
+		}
+	}
+}
+
+// restoreBlockMap writes the inode back the way it was. The references of
+// the block map it had are added back first, and those only the live inode
+// had are dropped once it is replaced.
+func (o *OortFS) restoreBlockMap(live context.Context, fsid uuid.UUID, id []byte, was, now *pb.InodeEntry) error {
+	if err := o.addBlockRefs(live, fsid.Bytes(), was); err != nil {
+		return err
+	}
+	b, err := proto.Marshal(was)
+	if err != nil {
+		return err
+	}
+	if err = o.WriteChunk(live, id, b); err != nil {
+		return err
+	}
+	if now == nil {
+		return nil
+	}
+	return o.dropReplacedRefs(live, fsid.Bytes(), now, was)
+}
+
+// changedSince returns true if the value isn't the one in the snapshot
+func (o *OortFS) changedSince(then, live context.Context, id []byte) (bool, error) {
+	was, _, err := o.comms.ReadValueTS(then, id)
+	if err != nil && !store.IsNotFound(err) {
+		return false, err
+	}
+	now, _, err := o.comms.ReadValueTS(live, id)
+	if err != nil && !store.IsNotFound(err) {
+		return false, err
+	}
+	return was != now, nil
+}
@@ -1,45 +1,102 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
+	"time"
+
+	"github.com/getcfs/fuse"
 
 	"github.com/creiht/formic"
+	pb "github.com/creiht/formic/proto"
+	"github.com/gholt/brimtime"
 	"github.com/gholt/store"
+	"github.com/gogo/protobuf/proto"
+	"github.com/satori/go.uuid"
 
 	"golang.org/x/net/context"
 )
 
 type UpdateItem struct {
+	fsid      []byte
 	id        []byte
 	block     uint64
 	blocksize uint64
 	size      uint64
 	mtime     int64
+	inode     uint64
+	written   int64 // Timestamp micro the write started
+}
+
+// updateRecord is how an UpdateItem is kept in the queue journal
+type updateRecord struct {
+	FsId      []byte `json:"fsid,omitempty"`
+	Id        []byte `json:"id"`
+	Block     uint64 `json:"block"`
+	Blocksize uint64 `json:"blocksize"`
+	Size      uint64 `json:"size"`
+	Mtime     int64  `json:"mtime"`
+	Inode     uint64 `json:"inode,omitempty"`
+	Written   int64  `json:"written,omitempty"`
+}
+
+func (u *UpdateItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&updateRecord{u.fsid, u.id, u.block, u.blocksize, u.size, u.mtime, u.inode, u.written})
+}
+
+func (u *UpdateItem) UnmarshalJSON(b []byte) error {
+	r := &updateRecord{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return err
+	}
+	*u = UpdateItem{r.FsId, r.Id, r.Block, r.Blocksize, r.Size, r.Mtime, r.Inode, r.Written}
+	return nil
 }
 
 type Updatinator struct {
-	in chan *UpdateItem
-	fs FileService
+	in    *queue
+	fs    FileService
+	watch *watchers
 }
 
-func newUpdatinator(in chan *UpdateItem, fs FileService) *Updatinator {
+func newUpdatinator(in *queue, fs FileService, watch *watchers) *Updatinator {
 	return &Updatinator{
-		in: in,
-		fs: fs,
+		in:    in,
+		fs:    fs,
+		watch: watch,
 	}
 }
 
 func (u *Updatinator) run() {
 	// TODO: Add fan-out based on the id of the update
 	for {
-		toupdate := <-u.in
+		e := u.in.pop()
+		toupdate := &UpdateItem{}
+		if err := json.Unmarshal(e.Item, toupdate); err != nil {
+			log.Println("Dropping bad update: ", err)
+			u.in.done(e)
+			continue
+		}
 		log.Println("Updating: ", toupdate)
 		// TODO: Need better context
 		ctx := context.Background()
-		err := u.fs.Update(ctx, toupdate.id, toupdate.block, toupdate.blocksize, toupdate.size, toupdate.mtime)
+		// Updates queued before the fsid was kept are done without it
+		fsid, fsidErr := uuid.FromBytes(toupdate.fsid)
+		if fsidErr == nil {
+			ctx = withFsId(ctx, fsid)
+		}
+		err := u.fs.Update(ctx, toupdate.id, toupdate.block, toupdate.blocksize, toupdate.size, toupdate.mtime, toupdate.written)
 		if err != nil {
 			log.Println("Update failed, requeing: ", err)
-			u.in <- toupdate
+			u.in.retry(e)
+			continue
+		}
+		if fsidErr == nil && toupdate.inode != 0 {
+			// The size is only right once the update is done
+			u.watch.notify(fsid, toupdate.inode, "")
+		}
+		if err = u.in.done(e); err != nil {
+			log.Println("Update queue error: ", err)
 		}
 	}
 }
@@ -47,14 +104,45 @@ func (u *Updatinator) run() {
 type DeleteItem struct {
 	parent []byte
 	name   string
+	// Set when there is no dir entry to work from, like when truncating or
+	// replacing a file. Only the blocks in the tombstone are deleted, and the
+	// inode entry if id is set. If parent is also set, ts is used in place of
+	// the tombstone in the dir entry.
+	ts *pb.Tombstone
+	id []byte
+	// Set when the entry was moved to the trash, the key of it there. It is
+	// held until the retention period is over, and dropped if undeleted.
+	trash []byte
+}
+
+// deleteRecord is how a DeleteItem is kept in the queue journal
+type deleteRecord struct {
+	Parent []byte        `json:"parent,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	Ts     *pb.Tombstone `json:"ts,omitempty"`
+	Id     []byte        `json:"id,omitempty"`
+	Trash  []byte        `json:"trash,omitempty"`
+}
+
+func (d *DeleteItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&deleteRecord{d.parent, d.name, d.ts, d.id, d.trash})
+}
+
+func (d *DeleteItem) UnmarshalJSON(b []byte) error {
+	r := &deleteRecord{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return err
+	}
+	*d = DeleteItem{r.Parent, r.Name, r.Ts, r.Id, r.Trash}
+	return nil
 }
 
 type Deletinator struct {
-	in chan *DeleteItem
+	in *queue
 	fs FileService
 }
 
-func newDeletinator(in chan *DeleteItem, fs FileService) *Deletinator {
+func newDeletinator(in *queue, fs FileService) *Deletinator {
 	return &Deletinator{
 		in: in,
 		fs: fs,
@@ -64,57 +152,215 @@ func newDeletinator(in chan *DeleteItem, fs FileService) *Deletinator {
 func (d *Deletinator) run() {
 	// TODO: Parallelize this thing?
 	for {
-		todelete := <-d.in
-		log.Println("Deleting: ", todelete)
-		// TODO: Need better context
-		ctx := context.Background()
-		// Get the dir entry info
-		dirent, err := d.fs.GetDirent(ctx, todelete.parent, todelete.name)
-		if store.IsNotFound(err) {
-			// NOTE: If it isn't found then it is likely deleted.
-			//       Do we need to do more to ensure this?
-			//       Skip for now
+		e := d.in.pop()
+		todelete := &DeleteItem{}
+		if err := json.Unmarshal(e.Item, todelete); err != nil {
+			log.Println("Dropping bad delete: ", err)
+			d.in.done(e)
 			continue
 		}
-		if err != nil {
-			// TODO Better error handling?
-			// re-q the id, to try again later
-			log.Print("Delete error getting dirent: ", err)
-			d.in <- todelete
+		if wait := d.retained(todelete); wait > 0 {
+			d.in.later(e, wait)
 			continue
 		}
-		ts := dirent.Tombstone
-		if ts == nil {
-			// TODO: probably an overwrite. just remove old file
-			continue
-		}
-		deleted := uint64(0)
-		for b := uint64(0); b < ts.Blocks; b++ {
-			// Delete each block
-			id := formic.GetID(ts.FsId, ts.Inode, b+1)
-			err := d.fs.DeleteChunk(ctx, id, ts.Dtime)
-			if err != nil && !store.IsNotFound(err) && err != ErrStoreHasNewerValue {
-				continue
+		if d.delete(todelete) {
+			if err := d.in.done(e); err != nil {
+				log.Println("Delete queue error: ", err)
 			}
-			deleted++
+		} else {
+			d.in.retry(e)
 		}
-		if deleted == ts.Blocks {
-			// Everything is deleted so delete the entry
-			err := d.fs.DeleteChunk(ctx, formic.GetID(ts.FsId, ts.Inode, 0), ts.Dtime)
-			if err != nil && !store.IsNotFound(err) && err != ErrStoreHasNewerValue {
-				// Couldn't delete the inode entry so try again later
-				d.in <- todelete
-				continue
-			}
-			err = d.fs.DeleteListing(ctx, todelete.parent, todelete.name, ts.Dtime)
+	}
+}
+
+// retained returns how long until a trashed item can be deleted
+func (d *Deletinator) retained(todelete *DeleteItem) time.Duration {
+	if todelete.trash == nil {
+		return 0
+	}
+	ctx := withTombstoneFsId(context.Background(), todelete.ts)
+	t, err := d.fs.GetTrash(ctx, todelete.trash)
+	if err != nil {
+		// Undeleted, or left for delete to sort out
+		return 0
+	}
+	wait := brimtime.UnixMicroToTime(t.Expires).Add(trashGrace).Sub(time.Now())
+	if wait > retryMax {
+		// Checked again now and then, in case it is undeleted
+		wait = retryMax
+	}
+	return wait
+}
+
+// delete works through the item, returning false if it needs to be tried again
+func (d *Deletinator) delete(todelete *DeleteItem) bool {
+	log.Println("Deleting: ", todelete)
+	// TODO: Need better context
+	ctx := context.Background()
+	if todelete.trash != nil {
+		return d.deleteTrash(withTombstoneFsId(ctx, todelete.ts), todelete)
+	}
+	if todelete.parent == nil {
+		ctx = withTombstoneFsId(ctx, todelete.ts)
+		if !d.deleteBlocks(ctx, todelete.ts, todelete.id != nil) {
+			return false
+		}
+		if todelete.id != nil {
+			err := d.fs.DeleteChunk(ctx, todelete.id, todelete.ts.Dtime)
 			if err != nil && !store.IsNotFound(err) && err != ErrStoreHasNewerValue {
-				log.Println("  Err: ", err)
-				// TODO: Better error handling
-				// Ignore for now to be picked up later?
+				return false
 			}
-		} else {
-			// If all artifacts are not deleted requeue for later
-			d.in <- todelete
+		}
+		return true
+	}
+	// Get the dir entry info
+	dirent, err := d.fs.GetDirent(ctx, todelete.parent, todelete.name)
+	if store.IsNotFound(err) {
+		// NOTE: If it isn't found then it is likely deleted.
+		//       Do we need to do more to ensure this?
+		//       Skip for now
+		return true
+	}
+	if err != nil {
+		// TODO Better error handling?
+		log.Print("Delete error getting dirent: ", err)
+		return false
+	}
+	ts := dirent.Tombstone
+	if ts == nil {
+		// TODO: probably an overwrite. just remove old file
+		return true
+	}
+	if todelete.ts != nil {
+		// The tombstone was corrected by the scrubber
+		ts = todelete.ts
+	}
+	ctx = withTombstoneFsId(ctx, ts)
+	if dirent.Type == uint32(fuse.DT_Dir) && !d.removeChildren(ctx, ts, dirent.Id) {
+		// Try again once the children are removed
+		return false
+	}
+	if !d.deleteBlocks(ctx, ts, true) {
+		// If all artifacts are not deleted requeue for later
+		return false
+	}
+	// Everything is deleted so delete the entry
+	err = d.fs.DeleteChunk(ctx, formic.GetID(ts.FsId, ts.Inode, 0), ts.Dtime)
+	if err != nil && !store.IsNotFound(err) && err != ErrStoreHasNewerValue {
+		// Couldn't delete the inode entry so try again later
+		return false
+	}
+	err = d.fs.DeleteListing(ctx, todelete.parent, todelete.name, ts.Dtime)
+	if err != nil && !store.IsNotFound(err) && err != ErrStoreHasNewerValue {
+		log.Println("  Err: ", err)
+		// TODO: Better error handling
+		// Ignore for now to be picked up later?
+	}
+	return true
+}
+
+// deleteTrash deletes an entry from the trash once the retention period is
+// over
+func (d *Deletinator) deleteTrash(ctx context.Context, todelete *DeleteItem) bool {
+	t, err := d.fs.GetTrash(ctx, todelete.trash)
+	if err == ErrNotFound {
+		// Undeleted
+		return true
+	}
+	if err != nil {
+		log.Print("Delete error getting trash: ", err)
+		return false
+	}
+	dirent := &pb.DirEntry{}
+	if err = proto.Unmarshal(t.Entry, dirent); err != nil {
+		log.Print("Delete error with trash entry: ", err)
+		return false
+	}
+	ts := todelete.ts
+	if dirent.Type == uint32(fuse.DT_Dir) && !d.removeChildren(ctx, ts, todelete.id) {
+		return false
+	}
+	id := formic.GetID(ts.FsId, ts.Inode, 0)
+	n, err := d.fs.GetInode(ctx, id)
+	if err != nil && err != ErrNotFound {
+		return false
+	}
+	if !d.deleteBlocks(ctx, ts, true) {
+		return false
+	}
+	err = d.fs.DeleteChunk(ctx, id, ts.Dtime)
+	if err != nil && !store.IsNotFound(err) && err != ErrStoreHasNewerValue {
+		return false
+	}
+	if n != nil {
+		// Trashed files are still counted until now
+		u := inodeUsage(n)
+		d.fs.AddUsage(ctx, -u.Bytes, -u.Blocks, -u.Inodes)
+	}
+	// The trash entry was written after the tombstone's time, so it is
+	// deleted as of now
+	err = d.fs.DeleteTrash(ctx, todelete.trash, brimtime.TimeToUnixMicro(time.Now()))
+	if err != nil && !store.IsNotFound(err) && err != ErrStoreHasNewerValue {
+		log.Println("  Err: ", err)
+	}
+	return true
+}
+
+// deleteBlocks deletes the blocks listed in the tombstone, returning true if
+// they are all gone. Deduplicated blocks only have their references to the
+// content dropped, whole is set if the inode is being deleted along with them.
+func (d *Deletinator) deleteBlocks(ctx context.Context, ts *pb.Tombstone, whole bool) bool {
+	deleted := uint64(0)
+	for b := ts.FirstBlock; b < ts.Blocks; b++ {
+		// Delete each block
+		id := formic.GetID(ts.FsId, ts.Inode, b+1)
+		err := d.fs.DeleteChunk(ctx, id, ts.Dtime)
+		if err != nil && !store.IsNotFound(err) && err != ErrStoreHasNewerValue {
+			continue
+		}
+		deleted++
+	}
+	if err := d.fs.DropBlockRefs(ctx, ts, whole); err != nil {
+		log.Print("Delete error dropping block references: ", err)
+		return false
+	}
+	return deleted == ts.Blocks-ts.FirstBlock
+}
+
+// withTombstoneFsId adds the fsid of the tombstone to the context. Tombstones
+// from before the fsid was set properly are deleted without it.
+func withTombstoneFsId(ctx context.Context, ts *pb.Tombstone) context.Context {
+	if fsid, err := uuid.FromBytes(ts.FsId); err == nil {
+		return withFsId(ctx, fsid)
+	}
+	return ctx
+}
+
+// removeChildren removes anything that was created in a directory after it was
+// checked to be empty, so that it isn't orphaned. The directory is already on
+// its way out, so they don't go through the trash. Returns true if the
+// directory is empty.
+func (d *Deletinator) removeChildren(ctx context.Context, ts *pb.Tombstone, id []byte) bool {
+	fsid, err := uuid.FromBytes(ts.FsId)
+	if err != nil {
+		// Left for the scrubber to correct the tombstone
+		log.Print("Delete error with tombstone fsid: ", err)
+		return false
+	}
+	ctx = withoutTrash(withFsId(ctx, fsid))
+	children, err := d.fs.ReadDirAll(ctx, id)
+	if err != nil {
+		log.Print("Delete error reading dir: ", err)
+		return false
+	}
+	empty := true
+	for _, child := range children.DirEntries {
+		log.Println("Removing orphaned child: ", child.Name)
+		_, err := d.fs.Remove(ctx, id, child.Name)
+		if err != nil {
+			// Subdirectories will be empty once their children are removed
+			empty = false
 		}
 	}
+	return empty
 }
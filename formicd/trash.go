@@ -0,0 +1,385 @@
+package main
+
+// File systems with a retention period keep removed files in a trash group,
+// /fs/<fsid>/trash, instead of deleting them right away. The dir entry is
+// moved there with its tombstone, and the Deletinator holds on to the delete
+// until the retention period is over. Undeleting puts the entry back and
+// drops it from the trash, which the Deletinator takes as the delete being
+// called off.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/creiht/formic"
+	pb "github.com/creiht/formic/proto"
+	"github.com/getcfs/fuse"
+	"github.com/gholt/brimtime"
+	"github.com/gholt/store"
+	"github.com/gogo/protobuf/proto"
+	"github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+)
+
+// How long after the retention period the delete is done, so an undelete
+// that just made it in time isn't raced
+const trashGrace = time.Minute
+
+var ErrNotInTrash = errors.New("Not in the trash")
+
+// TrashEntry is a removed dir entry, kept in /fs/<fsid>/trash until it
+// expires
+type TrashEntry struct {
+	Parent  []byte `json:"parent"`
+	Name    string `json:"name"`
+	Entry   []byte `json:"entry"`   // The DirEntry, with its tombstone
+	Expires int64  `json:"expires"` // Timestamp micro it can't be undeleted after
+}
+
+// DeletedEntry is a removed file or directory that can still be undeleted
+type DeletedEntry struct {
+	Path    string `json:"path"`
+	Inode   uint64 `json:"inode"`
+	IsDir   bool   `json:"isdir,omitempty"`
+	Deleted int64  `json:"deleted"`
+	Expires int64  `json:"expires"`
+	key     []byte
+	trash   *TrashEntry
+	entry   *pb.DirEntry
+}
+
+// Context key for removes that don't go through the trash
+type withoutTrashKey struct{}
+
+// withoutTrash returns a context that removes entries right away, even with a
+// retention period
+func withoutTrash(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutTrashKey{}, true)
+}
+
+func skipTrash(ctx context.Context) bool {
+	_, ok := ctx.Value(withoutTrashKey{}).(bool)
+	return ok
+}
+
+func trashKey(fsid uuid.UUID) []byte {
+	return []byte(fmt.Sprintf("/fs/%s/trash", fsid))
+}
+
+// trashEntryKey is the key of the entry in the trash group. The same name can
+// be removed again, so the time it was removed is part of it.
+func trashEntryKey(parent []byte, name string, dtime int64) []byte {
+	return []byte(fmt.Sprintf("%x/%s/%d", parent, name, dtime))
+}
+
+// trash moves the entry to the trash, and queues it to be deleted once the
+// retention period is over
+func (o *OortFS) trash(ctx context.Context, parent []byte, d *pb.DirEntry, inode *pb.InodeEntry, retention time.Duration) error {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return err
+	}
+	key, err := o.addTrash(ctx, fsid, parent, d, inode, retention)
+	if err != nil {
+		return err
+	}
+	err = o.comms.DeleteGroupItem(ctx, parent, []byte(d.Name))
+	if err != nil {
+		// Still where it was, so it mustn't be deleted
+		o.comms.DeleteGroupItem(ctx, trashKey(fsid), key)
+		return err
+	}
+	return o.deletes.push(&DeleteItem{
+		ts:    d.Tombstone,
+		id:    d.Id,
+		trash: key,
+	})
+}
+
+// trashReplaced puts the entry a rename replaced in the trash. Its name is
+// already taken by what was renamed over it, so only the trash entry is added.
+func (o *OortFS) trashReplaced(ctx context.Context, parent []byte, d *pb.DirEntry, inode *pb.InodeEntry, retention time.Duration) error {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return err
+	}
+	key, err := o.addTrash(ctx, fsid, parent, d, inode, retention)
+	if err != nil {
+		return err
+	}
+	return o.deletes.push(&DeleteItem{
+		ts:    d.Tombstone,
+		id:    d.Id,
+		trash: key,
+	})
+}
+
+// addTrash tombstones the entry and adds it to the trash, returning its key
+// there
+func (o *OortFS) addTrash(ctx context.Context, fsid uuid.UUID, parent []byte, d *pb.DirEntry, inode *pb.InodeEntry, retention time.Duration) ([]byte, error) {
+	tsm := brimtime.TimeToUnixMicro(time.Now())
+	d.Tombstone = &pb.Tombstone{
+		Dtime:  tsm,
+		Qtime:  tsm,
+		FsId:   fsid.Bytes(),
+		Inode:  inode.Inode,
+		Blocks: inode.Blocks,
+	}
+	entry, err := proto.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(&TrashEntry{
+		Parent:  parent,
+		Name:    d.Name,
+		Entry:   entry,
+		Expires: tsm + int64(retention/time.Microsecond),
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := trashEntryKey(parent, d.Name, tsm)
+	return key, o.comms.WriteGroup(ctx, trashKey(fsid), key, b)
+}
+
+// GetTrash returns the entry in the trash of the file system in the context
+func (o *OortFS) GetTrash(ctx context.Context, key []byte) (*TrashEntry, error) {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, err := o.comms.ReadGroupItem(ctx, trashKey(fsid), key)
+	if store.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := &TrashEntry{}
+	return t, json.Unmarshal(b, t)
+}
+
+// DeleteTrash drops the entry from the trash, once it has been deleted
+func (o *OortFS) DeleteTrash(ctx context.Context, key []byte, tsm int64) error {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return err
+	}
+	return o.comms.DeleteGroupItemTS(ctx, trashKey(fsid), key, tsm)
+}
+
+// ListDeleted returns what is in the trash of the file system and can still
+// be undeleted, newest first
+func (o *OortFS) ListDeleted(ctx context.Context, fsid uuid.UUID) ([]*DeletedEntry, error) {
+	deleted, _, err := o.listDeleted(withFsId(ctx, fsid), fsid)
+	return deleted, err
+}
+
+// listDeleted returns the entries in the trash, and the paths of the
+// directories that haven't been removed
+func (o *OortFS) listDeleted(ctx context.Context, fsid uuid.UUID) ([]*DeletedEntry, map[string]string, error) {
+	items, err := o.comms.ReadGroup(ctx, trashKey(fsid))
+	if err != nil && !store.IsNotFound(err) {
+		return nil, nil, err
+	}
+	now := brimtime.TimeToUnixMicro(time.Now())
+	var deleted []*DeletedEntry
+	for _, item := range items {
+		t := &TrashEntry{}
+		if err = json.Unmarshal(item.Value, t); err != nil {
+			return nil, nil, err
+		}
+		if t.Expires < now {
+			continue
+		}
+		d := &pb.DirEntry{}
+		if err = proto.Unmarshal(t.Entry, d); err != nil {
+			return nil, nil, err
+		}
+		if d.Tombstone == nil {
+			continue
+		}
+		deleted = append(deleted, &DeletedEntry{
+			Inode:   d.Tombstone.Inode,
+			IsDir:   d.Type == uint32(fuse.DT_Dir),
+			Deleted: brimtime.UnixMicroToTime(d.Tombstone.Dtime).Unix(),
+			Expires: brimtime.UnixMicroToTime(t.Expires).Unix(),
+			key:     trashEntryKey(t.Parent, t.Name, d.Tombstone.Dtime),
+			trash:   t,
+			entry:   d,
+		})
+	}
+	live, err := o.dirPaths(ctx, fsid)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Removed directories can hold removed entries in turn
+	paths := make(map[string]string, len(live))
+	for id, p := range live {
+		paths[id] = p
+	}
+	for found := true; found; {
+		found = false
+		for _, e := range deleted {
+			if e.Path != "" {
+				continue
+			}
+			if p, ok := paths[string(e.trash.Parent)]; ok {
+				e.Path = path.Join(p, e.trash.Name)
+				found = true
+				if e.IsDir {
+					if _, ok := paths[string(e.entry.Id)]; !ok {
+						paths[string(e.entry.Id)] = e.Path
+					}
+				}
+			}
+		}
+	}
+	for _, e := range deleted {
+		if e.Path == "" {
+			// The directory it was in is gone for good
+			e.Path = path.Join("?", e.trash.Name)
+		}
+	}
+	sort.Sort(deletedByTime(deleted))
+	return deleted, live, nil
+}
+
+type deletedByTime []*DeletedEntry
+
+func (s deletedByTime) Len() int      { return len(s) }
+func (s deletedByTime) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s deletedByTime) Less(i, j int) bool {
+	return s[i].entry.Tombstone.Dtime > s[j].entry.Tombstone.Dtime
+}
+
+// dirPaths returns the path of every directory in the file system by id
+func (o *OortFS) dirPaths(ctx context.Context, fsid uuid.UUID) (map[string]string, error) {
+	root := formic.GetID(fsid.Bytes(), 1, 0)
+	paths := map[string]string{string(root): "/"}
+	dirs := [][]byte{root}
+	for i := 0; i < len(dirs); i++ {
+		items, err := o.comms.ReadGroup(ctx, dirs[i])
+		if err != nil && !store.IsNotFound(err) {
+			return nil, err
+		}
+		for _, item := range items {
+			d := &pb.DirEntry{}
+			if err = proto.Unmarshal(item.Value, d); err != nil {
+				return nil, err
+			}
+			if d.Tombstone != nil || d.Type != uint32(fuse.DT_Dir) {
+				continue
+			}
+			if _, ok := paths[string(d.Id)]; ok {
+				continue
+			}
+			paths[string(d.Id)] = path.Join(paths[string(dirs[i])], d.Name)
+			dirs = append(dirs, d.Id)
+		}
+	}
+	return paths, nil
+}
+
+// Undelete puts the removed file or directory at p back, along with the
+// directories it was in if they were removed too. A directory comes back with
+// everything that was removed from it. Returns the number of entries put
+// back.
+func (o *OortFS) Undelete(ctx context.Context, fsid uuid.UUID, p string) (int, error) {
+	ctx = withFsId(ctx, fsid)
+	deleted, live, err := o.listDeleted(ctx, fsid)
+	if err != nil {
+		return 0, err
+	}
+	p = path.Clean("/" + p)
+	for _, e := range deleted {
+		// Newest first, so this is the last one removed at the path
+		if e.Path == p {
+			return o.undelete(ctx, fsid, e, deleted, live)
+		}
+	}
+	return 0, ErrNotInTrash
+}
+
+func (o *OortFS) undelete(ctx context.Context, fsid uuid.UUID, e *DeletedEntry, deleted []*DeletedEntry, live map[string]string) (int, error) {
+	restored, err := o.restoreParents(ctx, fsid, e, deleted, live)
+	if err != nil {
+		return restored, err
+	}
+	if err = o.restoreEntry(ctx, fsid, e, live); err != nil {
+		return restored, err
+	}
+	restored++
+	if !e.IsDir {
+		return restored, nil
+	}
+	for _, child := range deleted {
+		if string(child.trash.Parent) != string(e.entry.Id) {
+			continue
+		}
+		if _, err = o.getDirent(ctx, child.trash.Parent, child.trash.Name); err == nil {
+			// Made again since, or an older removal of the same name
+			continue
+		}
+		n, err := o.undelete(ctx, fsid, child, deleted, live)
+		restored += n
+		if err != nil {
+			return restored, err
+		}
+	}
+	return restored, nil
+}
+
+// restoreParents puts back the removed directories the entry was in
+func (o *OortFS) restoreParents(ctx context.Context, fsid uuid.UUID, e *DeletedEntry, deleted []*DeletedEntry, live map[string]string) (int, error) {
+	if _, ok := live[string(e.trash.Parent)]; ok {
+		return 0, nil
+	}
+	for _, dir := range deleted {
+		if !dir.IsDir || string(dir.entry.Id) != string(e.trash.Parent) {
+			continue
+		}
+		restored, err := o.restoreParents(ctx, fsid, dir, deleted, live)
+		if err != nil {
+			return restored, err
+		}
+		return restored + 1, o.restoreEntry(ctx, fsid, dir, live)
+	}
+	// The directory it was in is gone for good
+	return 0, ErrNotInTrash
+}
+
+// restoreEntry puts the entry back in its directory and takes it out of the
+// trash
+func (o *OortFS) restoreEntry(ctx context.Context, fsid uuid.UUID, e *DeletedEntry, live map[string]string) error {
+	if _, ok := live[string(e.entry.Id)]; ok {
+		// Already put back along the way
+		return nil
+	}
+	_, err := o.getDirent(ctx, e.trash.Parent, e.trash.Name)
+	if err == nil {
+		return ErrExists
+	}
+	if err != ErrNotFound {
+		return err
+	}
+	d := *e.entry
+	d.Tombstone = nil
+	b, err := proto.Marshal(&d)
+	if err != nil {
+		return err
+	}
+	err = o.comms.WriteGroup(ctx, e.trash.Parent, []byte(e.trash.Name), b)
+	if err != nil {
+		return err
+	}
+	if e.IsDir {
+		live[string(e.entry.Id)] = e.Path
+	}
+	// Without the trash entry the Deletinator leaves it be
+	return o.comms.DeleteGroupItem(ctx, trashKey(fsid), e.key)
+}
@@ -0,0 +1,193 @@
+package main
+
+// Each formicd counts the bytes, blocks and inodes its requests add to or take
+// away from a file system, and adds them to its own entry in
+// /fs/<fsid>/stats once a minute. The usage of the file system is the sum of
+// the entries. Counts can drift, from crashes before a flush or requests that
+// failed half way, so the scrubber scans the file system now and then and
+// writes the difference to the "scan" entry. Every formicd scanning writes the
+// same entry, so the correction is only made once.
+//
+// Usage is what the inodes say: the size of the files, the blocks they have
+// and the number of inodes, including directories and anything in the trash.
+// Removed files are taken off right away, not once the delete is done, unless
+// they are kept in the trash.
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/creiht/formic"
+	pb "github.com/creiht/formic/proto"
+	"github.com/gholt/store"
+	"github.com/gogo/protobuf/proto"
+	"github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+)
+
+// The key of the correction made by the last scan in /fs/<fsid>/stats
+const usageScanKey = "scan"
+
+// inodeUsage is how much of the file system the inode takes up
+func inodeUsage(n *pb.InodeEntry) *FileSysStats {
+	u := &FileSysStats{Blocks: int64(n.Blocks), Inodes: 1}
+	if !n.IsDir && n.Attr != nil {
+		u.Bytes = int64(n.Attr.Size)
+	}
+	return u
+}
+
+// addUsage adds to the usage of the file system in the context
+func (o *OortFS) addUsage(ctx context.Context, bytes, blocks, inodes int64) {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return
+	}
+	o.addStats(fsid, &FileSysStats{Bytes: bytes, Blocks: blocks, Inodes: inodes})
+}
+
+// addInodeUsage adds what the inode takes up to the usage, or takes it away
+// if sign is -1
+func (o *OortFS) addInodeUsage(ctx context.Context, n *pb.InodeEntry, sign int64) {
+	u := inodeUsage(n)
+	o.addUsage(ctx, sign*u.Bytes, sign*u.Blocks, sign*u.Inodes)
+}
+
+// AddUsage is addUsage for the Deletinator
+func (o *OortFS) AddUsage(ctx context.Context, bytes, blocks, inodes int64) {
+	o.addUsage(ctx, bytes, blocks, inodes)
+}
+
+// GetUsage returns the usage of the file system in the context, including
+// what this formicd hasn't written yet
+func (o *OortFS) GetUsage(ctx context.Context) (*FileSysStats, error) {
+	fsid, err := GetFsId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u, _, err := o.usage(ctx, fsid)
+	return u, err
+}
+
+// usage returns the usage of the file system, and the part of it that isn't
+// from the last scan
+func (o *OortFS) usage(ctx context.Context, fsid uuid.UUID) (*FileSysStats, *FileSysStats, error) {
+	items, err := o.comms.ReadGroup(unversioned(ctx), []byte(fmt.Sprintf("/fs/%s/stats", fsid)))
+	if err != nil && !store.IsNotFound(err) {
+		return nil, nil, err
+	}
+	total := &FileSysStats{}
+	counted := &FileSysStats{}
+	for _, item := range items {
+		stats := &FileSysStats{}
+		if err = json.Unmarshal(item.Value, stats); err != nil {
+			return nil, nil, err
+		}
+		total.add(stats)
+		if stats.Node != usageScanKey {
+			counted.add(stats)
+		}
+	}
+	o.RLock()
+	if pending, ok := o.stats[fsid.String()]; ok {
+		total.add(pending)
+		counted.add(pending)
+	}
+	o.RUnlock()
+	total.Node = ""
+	total.CompressionSaved = 0
+	return total, counted, nil
+}
+
+// ScanUsage adds up the usage of the file system from its inodes
+func (o *OortFS) ScanUsage(ctx context.Context, fsid uuid.UUID) (*FileSysStats, error) {
+	ctx = withFsId(ctx, fsid)
+	fs := fsid.Bytes()
+	u := &FileSysStats{}
+	seen := make(map[string]bool)
+	count := func(id []byte) (*pb.InodeEntry, error) {
+		if seen[string(id)] {
+			return nil, nil
+		}
+		seen[string(id)] = true
+		n, err := o.GetInode(ctx, id)
+		if err == ErrNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		u.add(inodeUsage(n))
+		return n, nil
+	}
+	root := formic.GetID(fs, 1, 0)
+	if _, err := count(root); err != nil {
+		return nil, err
+	}
+	dirs := [][]byte{root}
+	for i := 0; i < len(dirs); i++ {
+		items, err := o.comms.ReadGroup(ctx, dirs[i])
+		if err != nil && !store.IsNotFound(err) {
+			return nil, err
+		}
+		for _, item := range items {
+			d := &pb.DirEntry{}
+			if err = proto.Unmarshal(item.Value, d); err != nil {
+				return nil, err
+			}
+			if d.Tombstone != nil {
+				continue
+			}
+			n, err := count(d.Id)
+			if err != nil {
+				return nil, err
+			}
+			if n != nil && n.IsDir {
+				dirs = append(dirs, d.Id)
+			}
+		}
+	}
+	items, err := o.comms.ReadGroup(ctx, trashKey(fsid))
+	if err != nil && !store.IsNotFound(err) {
+		return nil, err
+	}
+	for _, item := range items {
+		t := &TrashEntry{}
+		if err = json.Unmarshal(item.Value, t); err != nil {
+			return nil, err
+		}
+		d := &pb.DirEntry{}
+		if err = proto.Unmarshal(t.Entry, d); err != nil {
+			return nil, err
+		}
+		if _, err = count(d.Id); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// ReconcileUsage scans the file system, and corrects its usage to match. The
+// usage of requests that are in flight while it scans can be off until the
+// next scan.
+func (o *OortFS) ReconcileUsage(ctx context.Context, fsid uuid.UUID) (*FileSysStats, error) {
+	scanned, err := o.ScanUsage(ctx, fsid)
+	if err != nil {
+		return nil, err
+	}
+	_, counted, err := o.usage(ctx, fsid)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(&FileSysStats{
+		Node:   usageScanKey,
+		Bytes:  scanned.Bytes - counted.Bytes,
+		Blocks: scanned.Blocks - counted.Blocks,
+		Inodes: scanned.Inodes - counted.Inodes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := []byte(fmt.Sprintf("/fs/%s/stats", fsid))
+	return scanned, o.comms.WriteGroup(unversioned(ctx), key, []byte(usageScanKey), b)
+}
@@ -0,0 +1,76 @@
+package main
+
+// Clients watch a file system to find out when what they have cached of it is
+// out of date. Each formicd only knows about the changes made through it, so
+// clients still have to let what they cache expire to pick up the changes
+// made through other formicds.
+
+import (
+	"sync"
+
+	pb "github.com/creiht/formic/proto"
+	"github.com/satori/go.uuid"
+)
+
+// How many changes a watcher can be behind before it is dropped
+const watchBacklog = 1024
+
+// watchers keeps the channels of the clients watching each file system
+type watchers struct {
+	sync.Mutex
+	fs map[string]map[chan *pb.Invalidation]bool
+}
+
+func newWatchers() *watchers {
+	return &watchers{fs: make(map[string]map[chan *pb.Invalidation]bool)}
+}
+
+// add returns a channel the changes to the file system are sent on. It is
+// closed if the watcher falls too far behind.
+func (w *watchers) add(fsid uuid.UUID) chan *pb.Invalidation {
+	ch := make(chan *pb.Invalidation, watchBacklog)
+	w.Lock()
+	defer w.Unlock()
+	chans, ok := w.fs[fsid.String()]
+	if !ok {
+		chans = make(map[chan *pb.Invalidation]bool)
+		w.fs[fsid.String()] = chans
+	}
+	chans[ch] = true
+	return ch
+}
+
+// remove stops sending changes on the channel
+func (w *watchers) remove(fsid uuid.UUID, ch chan *pb.Invalidation) {
+	w.Lock()
+	defer w.Unlock()
+	w.drop(fsid.String(), ch)
+}
+
+func (w *watchers) drop(fsid string, ch chan *pb.Invalidation) {
+	chans := w.fs[fsid]
+	if !chans[ch] {
+		return
+	}
+	delete(chans, ch)
+	close(ch)
+	if len(chans) == 0 {
+		delete(w.fs, fsid)
+	}
+}
+
+// notify tells the watchers of the file system that the inode changed, or the
+// entry name in it if name is set. A watcher that is too far behind is
+// dropped, as it can't know what it missed.
+func (w *watchers) notify(fsid uuid.UUID, inode uint64, name string) {
+	w.Lock()
+	defer w.Unlock()
+	e := &pb.Invalidation{Inode: inode, Name: name}
+	for ch := range w.fs[fsid.String()] {
+		select {
+		case ch <- e:
+		default:
+			w.drop(fsid.String(), ch)
+		}
+	}
+}
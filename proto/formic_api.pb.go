@@ -32,6 +32,8 @@ It has these top-level messages:
 	ReadDirAllResponse
 	SymlinkRequest
 	SymlinkResponse
+	LinkRequest
+	LinkResponse
 	ReadlinkRequest
 	ReadlinkResponse
 	GetxattrRequest
@@ -48,9 +50,14 @@ It has these top-level messages:
 	StatfsResponse
 	InitFsRequest
 	InitFsResponse
+	SeekRequest
+	SeekResponse
+	WatchRequest
+	Invalidation
 	InodeEntry
 	Tombstone
 	DirEntry
+	RenameIntent
 	FileBlock
 	ModFS
 	CreateFSRequest
@@ -67,6 +74,28 @@ It has these top-level messages:
 	GrantAddrFSResponse
 	RevokeAddrFSRequest
 	RevokeAddrFSResponse
+	ScrubFSRequest
+	ScrubFSResponse
+	CheckFSRequest
+	CheckFSResponse
+	RotateKeysRequest
+	RotateKeysResponse
+	CreateSnapshotRequest
+	CreateSnapshotResponse
+	ListSnapshotsRequest
+	ListSnapshotsResponse
+	DeleteSnapshotRequest
+	DeleteSnapshotResponse
+	RestoreSnapshotRequest
+	RestoreSnapshotResponse
+	CloneFSRequest
+	CloneFSResponse
+	ListDeletedRequest
+	ListDeletedResponse
+	UndeleteRequest
+	UndeleteResponse
+	SetQuotaRequest
+	SetQuotaResponse
 */
 package proto
 
@@ -129,6 +158,7 @@ type Attr struct {
 	Size   uint64 `protobuf:"varint,8,opt,name=size" json:"size,omitempty"`
 	Uid    uint32 `protobuf:"varint,9,opt,name=uid" json:"uid,omitempty"`
 	Gid    uint32 `protobuf:"varint,10,opt,name=gid" json:"gid,omitempty"`
+	Nlink  uint32 `protobuf:"varint,11,opt,name=nlink" json:"nlink,omitempty"`
 }
 
 func (m *Attr) Reset()                    { *m = Attr{} }
@@ -214,6 +244,7 @@ func (*ReadRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int
 type ReadResponse struct {
 	Inode   uint64 `protobuf:"varint,1,opt,name=inode" json:"inode,omitempty"`
 	Payload []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	Offset  int64  `protobuf:"varint,3,opt,name=offset" json:"offset,omitempty"`
 }
 
 func (m *ReadResponse) Reset()                    { *m = ReadResponse{} }
@@ -428,6 +459,36 @@ func (m *SymlinkResponse) GetAttr() *Attr {
 	return nil
 }
 
+// LinkRequest
+type LinkRequest struct {
+	Inode  uint64 `protobuf:"varint,1,opt,name=inode" json:"inode,omitempty"`
+	Parent uint64 `protobuf:"varint,2,opt,name=parent" json:"parent,omitempty"`
+	Name   string `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *LinkRequest) Reset()                    { *m = LinkRequest{} }
+func (m *LinkRequest) String() string            { return proto1.CompactTextString(m) }
+func (*LinkRequest) ProtoMessage()               {}
+func (*LinkRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+
+// LinkResponse
+type LinkResponse struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Attr *Attr  `protobuf:"bytes,2,opt,name=attr" json:"attr,omitempty"`
+}
+
+func (m *LinkResponse) Reset()                    { *m = LinkResponse{} }
+func (m *LinkResponse) String() string            { return proto1.CompactTextString(m) }
+func (*LinkResponse) ProtoMessage()               {}
+func (*LinkResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+
+func (m *LinkResponse) GetAttr() *Attr {
+	if m != nil {
+		return m.Attr
+	}
+	return nil
+}
+
 // ReadlinkRequest
 type ReadlinkRequest struct {
 	Inode uint64 `protobuf:"varint,1,opt,name=inode" json:"inode,omitempty"`
@@ -436,7 +497,7 @@ type ReadlinkRequest struct {
 func (m *ReadlinkRequest) Reset()                    { *m = ReadlinkRequest{} }
 func (m *ReadlinkRequest) String() string            { return proto1.CompactTextString(m) }
 func (*ReadlinkRequest) ProtoMessage()               {}
-func (*ReadlinkRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+func (*ReadlinkRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
 
 // ReadlinkResponse
 type ReadlinkResponse struct {
@@ -446,7 +507,7 @@ type ReadlinkResponse struct {
 func (m *ReadlinkResponse) Reset()                    { *m = ReadlinkResponse{} }
 func (m *ReadlinkResponse) String() string            { return proto1.CompactTextString(m) }
 func (*ReadlinkResponse) ProtoMessage()               {}
-func (*ReadlinkResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+func (*ReadlinkResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
 
 // Getxattr
 type GetxattrRequest struct {
@@ -459,7 +520,7 @@ type GetxattrRequest struct {
 func (m *GetxattrRequest) Reset()                    { *m = GetxattrRequest{} }
 func (m *GetxattrRequest) String() string            { return proto1.CompactTextString(m) }
 func (*GetxattrRequest) ProtoMessage()               {}
-func (*GetxattrRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
+func (*GetxattrRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
 
 type GetxattrResponse struct {
 	Xattr []byte `protobuf:"bytes,1,opt,name=xattr,proto3" json:"xattr,omitempty"`
@@ -468,7 +529,7 @@ type GetxattrResponse struct {
 func (m *GetxattrResponse) Reset()                    { *m = GetxattrResponse{} }
 func (m *GetxattrResponse) String() string            { return proto1.CompactTextString(m) }
 func (*GetxattrResponse) ProtoMessage()               {}
-func (*GetxattrResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
+func (*GetxattrResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
 
 // Setxattr
 type SetxattrRequest struct {
@@ -482,7 +543,7 @@ type SetxattrRequest struct {
 func (m *SetxattrRequest) Reset()                    { *m = SetxattrRequest{} }
 func (m *SetxattrRequest) String() string            { return proto1.CompactTextString(m) }
 func (*SetxattrRequest) ProtoMessage()               {}
-func (*SetxattrRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
+func (*SetxattrRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
 
 type SetxattrResponse struct {
 }
@@ -490,7 +551,7 @@ type SetxattrResponse struct {
 func (m *SetxattrResponse) Reset()                    { *m = SetxattrResponse{} }
 func (m *SetxattrResponse) String() string            { return proto1.CompactTextString(m) }
 func (*SetxattrResponse) ProtoMessage()               {}
-func (*SetxattrResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
+func (*SetxattrResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
 
 // Listxattr
 type ListxattrRequest struct {
@@ -502,7 +563,7 @@ type ListxattrRequest struct {
 func (m *ListxattrRequest) Reset()                    { *m = ListxattrRequest{} }
 func (m *ListxattrRequest) String() string            { return proto1.CompactTextString(m) }
 func (*ListxattrRequest) ProtoMessage()               {}
-func (*ListxattrRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
+func (*ListxattrRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{31} }
 
 type ListxattrResponse struct {
 	Xattr []byte `protobuf:"bytes,1,opt,name=xattr,proto3" json:"xattr,omitempty"`
@@ -511,7 +572,7 @@ type ListxattrResponse struct {
 func (m *ListxattrResponse) Reset()                    { *m = ListxattrResponse{} }
 func (m *ListxattrResponse) String() string            { return proto1.CompactTextString(m) }
 func (*ListxattrResponse) ProtoMessage()               {}
-func (*ListxattrResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
+func (*ListxattrResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{32} }
 
 // Removexattr
 type RemovexattrRequest struct {
@@ -522,7 +583,7 @@ type RemovexattrRequest struct {
 func (m *RemovexattrRequest) Reset()                    { *m = RemovexattrRequest{} }
 func (m *RemovexattrRequest) String() string            { return proto1.CompactTextString(m) }
 func (*RemovexattrRequest) ProtoMessage()               {}
-func (*RemovexattrRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{31} }
+func (*RemovexattrRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{33} }
 
 type RemovexattrResponse struct {
 }
@@ -530,7 +591,7 @@ type RemovexattrResponse struct {
 func (m *RemovexattrResponse) Reset()                    { *m = RemovexattrResponse{} }
 func (m *RemovexattrResponse) String() string            { return proto1.CompactTextString(m) }
 func (*RemovexattrResponse) ProtoMessage()               {}
-func (*RemovexattrResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{32} }
+func (*RemovexattrResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{34} }
 
 // Rename
 type RenameRequest struct {
@@ -538,12 +599,13 @@ type RenameRequest struct {
 	NewParent uint64 `protobuf:"varint,2,opt,name=newParent" json:"newParent,omitempty"`
 	OldName   string `protobuf:"bytes,3,opt,name=oldName" json:"oldName,omitempty"`
 	NewName   string `protobuf:"bytes,4,opt,name=newName" json:"newName,omitempty"`
+	Flags     uint32 `protobuf:"varint,5,opt,name=flags" json:"flags,omitempty"`
 }
 
 func (m *RenameRequest) Reset()                    { *m = RenameRequest{} }
 func (m *RenameRequest) String() string            { return proto1.CompactTextString(m) }
 func (*RenameRequest) ProtoMessage()               {}
-func (*RenameRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{33} }
+func (*RenameRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{35} }
 
 type RenameResponse struct {
 }
@@ -551,7 +613,7 @@ type RenameResponse struct {
 func (m *RenameResponse) Reset()                    { *m = RenameResponse{} }
 func (m *RenameResponse) String() string            { return proto1.CompactTextString(m) }
 func (*RenameResponse) ProtoMessage()               {}
-func (*RenameResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{34} }
+func (*RenameResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{36} }
 
 // Statfs
 type StatfsRequest struct {
@@ -560,23 +622,24 @@ type StatfsRequest struct {
 func (m *StatfsRequest) Reset()                    { *m = StatfsRequest{} }
 func (m *StatfsRequest) String() string            { return proto1.CompactTextString(m) }
 func (*StatfsRequest) ProtoMessage()               {}
-func (*StatfsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{35} }
+func (*StatfsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{37} }
 
 type StatfsResponse struct {
-	Blocks  uint64 `protobuf:"varint,1,opt,name=blocks" json:"blocks,omitempty"`
-	Bfree   uint64 `protobuf:"varint,2,opt,name=bfree" json:"bfree,omitempty"`
-	Bavail  uint64 `protobuf:"varint,3,opt,name=bavail" json:"bavail,omitempty"`
-	Files   uint64 `protobuf:"varint,4,opt,name=files" json:"files,omitempty"`
-	Ffree   uint64 `protobuf:"varint,5,opt,name=ffree" json:"ffree,omitempty"`
-	Bsize   uint32 `protobuf:"varint,6,opt,name=bsize" json:"bsize,omitempty"`
-	Namelen uint32 `protobuf:"varint,7,opt,name=namelen" json:"namelen,omitempty"`
-	Frsize  uint32 `protobuf:"varint,8,opt,name=frsize" json:"frsize,omitempty"`
+	Blocks    uint64 `protobuf:"varint,1,opt,name=blocks" json:"blocks,omitempty"`
+	Bfree     uint64 `protobuf:"varint,2,opt,name=bfree" json:"bfree,omitempty"`
+	Bavail    uint64 `protobuf:"varint,3,opt,name=bavail" json:"bavail,omitempty"`
+	Files     uint64 `protobuf:"varint,4,opt,name=files" json:"files,omitempty"`
+	Ffree     uint64 `protobuf:"varint,5,opt,name=ffree" json:"ffree,omitempty"`
+	Bsize     uint32 `protobuf:"varint,6,opt,name=bsize" json:"bsize,omitempty"`
+	Namelen   uint32 `protobuf:"varint,7,opt,name=namelen" json:"namelen,omitempty"`
+	Frsize    uint32 `protobuf:"varint,8,opt,name=frsize" json:"frsize,omitempty"`
+	Blocksize uint32 `protobuf:"varint,9,opt,name=blocksize" json:"blocksize,omitempty"`
 }
 
 func (m *StatfsResponse) Reset()                    { *m = StatfsResponse{} }
 func (m *StatfsResponse) String() string            { return proto1.CompactTextString(m) }
 func (*StatfsResponse) ProtoMessage()               {}
-func (*StatfsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{36} }
+func (*StatfsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{38} }
 
 // InitFs
 type InitFsRequest struct {
@@ -585,7 +648,7 @@ type InitFsRequest struct {
 func (m *InitFsRequest) Reset()                    { *m = InitFsRequest{} }
 func (m *InitFsRequest) String() string            { return proto1.CompactTextString(m) }
 func (*InitFsRequest) ProtoMessage()               {}
-func (*InitFsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{37} }
+func (*InitFsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{39} }
 
 type InitFsResponse struct {
 }
@@ -593,31 +656,78 @@ type InitFsResponse struct {
 func (m *InitFsResponse) Reset()                    { *m = InitFsResponse{} }
 func (m *InitFsResponse) String() string            { return proto1.CompactTextString(m) }
 func (*InitFsResponse) ProtoMessage()               {}
-func (*InitFsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{38} }
+func (*InitFsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{40} }
+
+// Seek
+type SeekRequest struct {
+	Inode  uint64 `protobuf:"varint,1,opt,name=inode" json:"inode,omitempty"`
+	Offset int64  `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+	Whence uint32 `protobuf:"varint,3,opt,name=whence" json:"whence,omitempty"`
+}
+
+func (m *SeekRequest) Reset()                    { *m = SeekRequest{} }
+func (m *SeekRequest) String() string            { return proto1.CompactTextString(m) }
+func (*SeekRequest) ProtoMessage()               {}
+func (*SeekRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{41} }
+
+type SeekResponse struct {
+	Offset int64 `protobuf:"varint,1,opt,name=offset" json:"offset,omitempty"`
+}
+
+func (m *SeekResponse) Reset()                    { *m = SeekResponse{} }
+func (m *SeekResponse) String() string            { return proto1.CompactTextString(m) }
+func (*SeekResponse) ProtoMessage()               {}
+func (*SeekResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{42} }
+
+// Watch
+type WatchRequest struct {
+}
+
+func (m *WatchRequest) Reset()                    { *m = WatchRequest{} }
+func (m *WatchRequest) String() string            { return proto1.CompactTextString(m) }
+func (*WatchRequest) ProtoMessage()               {}
+func (*WatchRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{43} }
+
+// Sent when an inode changes, or the entry name in it if it is a directory
+// and name is set
+type Invalidation struct {
+	Inode uint64 `protobuf:"varint,1,opt,name=inode" json:"inode,omitempty"`
+	Name  string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+}
+
+func (m *Invalidation) Reset()                    { *m = Invalidation{} }
+func (m *Invalidation) String() string            { return proto1.CompactTextString(m) }
+func (*Invalidation) ProtoMessage()               {}
+func (*Invalidation) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{44} }
 
 // Inode
 // This is used for serialization of the inode metadata
 // This is *not* used for api calls
 type InodeEntry struct {
-	Version   uint32            `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
-	IsDir     bool              `protobuf:"varint,2,opt,name=isDir" json:"isDir,omitempty"`
-	Attr      *Attr             `protobuf:"bytes,3,opt,name=attr" json:"attr,omitempty"`
-	Parent    uint64            `protobuf:"varint,4,opt,name=parent" json:"parent,omitempty"`
-	Inode     uint64            `protobuf:"varint,5,opt,name=inode" json:"inode,omitempty"`
-	NodeCount uint64            `protobuf:"varint,6,opt,name=nodeCount" json:"nodeCount,omitempty"`
-	IsLink    bool              `protobuf:"varint,7,opt,name=isLink" json:"isLink,omitempty"`
-	Target    string            `protobuf:"bytes,8,opt,name=target" json:"target,omitempty"`
-	Xattr     map[string][]byte `protobuf:"bytes,9,rep,name=xattr" json:"xattr,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value,proto3"`
-	Blocks    uint64            `protobuf:"varint,10,opt,name=blocks" json:"blocks,omitempty"`
-	BlockSize uint64            `protobuf:"varint,11,opt,name=blockSize" json:"blockSize,omitempty"`
-	LastBlock uint64            `protobuf:"varint,12,opt,name=lastBlock" json:"lastBlock,omitempty"`
-	FsId      []byte            `protobuf:"bytes,13,opt,name=fsId,proto3" json:"fsId,omitempty"`
+	Version      uint32            `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	IsDir        bool              `protobuf:"varint,2,opt,name=isDir" json:"isDir,omitempty"`
+	Attr         *Attr             `protobuf:"bytes,3,opt,name=attr" json:"attr,omitempty"`
+	Parent       uint64            `protobuf:"varint,4,opt,name=parent" json:"parent,omitempty"`
+	Inode        uint64            `protobuf:"varint,5,opt,name=inode" json:"inode,omitempty"`
+	NodeCount    uint64            `protobuf:"varint,6,opt,name=nodeCount" json:"nodeCount,omitempty"`
+	IsLink       bool              `protobuf:"varint,7,opt,name=isLink" json:"isLink,omitempty"`
+	Target       string            `protobuf:"bytes,8,opt,name=target" json:"target,omitempty"`
+	Xattr        map[string][]byte `protobuf:"bytes,9,rep,name=xattr" json:"xattr,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Blocks       uint64            `protobuf:"varint,10,opt,name=blocks" json:"blocks,omitempty"`
+	BlockSize    uint64            `protobuf:"varint,11,opt,name=blockSize" json:"blockSize,omitempty"`
+	LastBlock    uint64            `protobuf:"varint,12,opt,name=lastBlock" json:"lastBlock,omitempty"`
+	FsId         []byte            `protobuf:"bytes,13,opt,name=fsId,proto3" json:"fsId,omitempty"`
+	Origin       []byte            `protobuf:"bytes,14,opt,name=origin,proto3" json:"origin,omitempty"`
+	OriginTime   int64             `protobuf:"varint,15,opt,name=originTime" json:"originTime,omitempty"`
+	OriginBlocks uint64            `protobuf:"varint,16,opt,name=originBlocks" json:"originBlocks,omitempty"`
+	Truncated    int64             `protobuf:"varint,17,opt,name=truncated" json:"truncated,omitempty"`
+	BlockHashes  [][]byte          `protobuf:"bytes,18,rep,name=blockHashes,proto3" json:"blockHashes,omitempty"`
 }
 
 func (m *InodeEntry) Reset()                    { *m = InodeEntry{} }
 func (m *InodeEntry) String() string            { return proto1.CompactTextString(m) }
 func (*InodeEntry) ProtoMessage()               {}
-func (*InodeEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{39} }
+func (*InodeEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{45} }
 
 func (m *InodeEntry) GetAttr() *Attr {
 	if m != nil {
@@ -636,33 +746,36 @@ func (m *InodeEntry) GetXattr() map[string][]byte {
 // Tombstone
 // Stores information needed to keep track of deleted items
 type Tombstone struct {
-	Dtime  int64  `protobuf:"varint,1,opt,name=dtime" json:"dtime,omitempty"`
-	Qtime  int64  `protobuf:"varint,2,opt,name=qtime" json:"qtime,omitempty"`
-	FsId   []byte `protobuf:"bytes,3,opt,name=fsId,proto3" json:"fsId,omitempty"`
-	Inode  uint64 `protobuf:"varint,4,opt,name=inode" json:"inode,omitempty"`
-	Blocks uint64 `protobuf:"varint,5,opt,name=blocks" json:"blocks,omitempty"`
+	Dtime      int64    `protobuf:"varint,1,opt,name=dtime" json:"dtime,omitempty"`
+	Qtime      int64    `protobuf:"varint,2,opt,name=qtime" json:"qtime,omitempty"`
+	FsId       []byte   `protobuf:"bytes,3,opt,name=fsId,proto3" json:"fsId,omitempty"`
+	Inode      uint64   `protobuf:"varint,4,opt,name=inode" json:"inode,omitempty"`
+	Blocks     uint64   `protobuf:"varint,5,opt,name=blocks" json:"blocks,omitempty"`
+	FirstBlock uint64   `protobuf:"varint,6,opt,name=firstBlock" json:"firstBlock,omitempty"`
+	Hashes     [][]byte `protobuf:"bytes,7,rep,name=hashes,proto3" json:"hashes,omitempty"`
 }
 
 func (m *Tombstone) Reset()                    { *m = Tombstone{} }
 func (m *Tombstone) String() string            { return proto1.CompactTextString(m) }
 func (*Tombstone) ProtoMessage()               {}
-func (*Tombstone) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{40} }
+func (*Tombstone) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{46} }
 
 // DirEntry
 // This is used for the serialization of dir info in the group score
 // This is *not* used for api calls
 type DirEntry struct {
-	Version   uint32     `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
-	Name      string     `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
-	Id        []byte     `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
-	Tombstone *Tombstone `protobuf:"bytes,4,opt,name=tombstone" json:"tombstone,omitempty"`
-	Type      uint32     `protobuf:"varint,5,opt,name=type" json:"type,omitempty"`
+	Version   uint32        `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	Name      string        `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Id        []byte        `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	Tombstone *Tombstone    `protobuf:"bytes,4,opt,name=tombstone" json:"tombstone,omitempty"`
+	Type      uint32        `protobuf:"varint,5,opt,name=type" json:"type,omitempty"`
+	Rename    *RenameIntent `protobuf:"bytes,6,opt,name=rename" json:"rename,omitempty"`
 }
 
 func (m *DirEntry) Reset()                    { *m = DirEntry{} }
 func (m *DirEntry) String() string            { return proto1.CompactTextString(m) }
 func (*DirEntry) ProtoMessage()               {}
-func (*DirEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{41} }
+func (*DirEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{47} }
 
 func (m *DirEntry) GetTombstone() *Tombstone {
 	if m != nil {
@@ -671,19 +784,44 @@ func (m *DirEntry) GetTombstone() *Tombstone {
 	return nil
 }
 
+func (m *DirEntry) GetRename() *RenameIntent {
+	if m != nil {
+		return m.Rename
+	}
+	return nil
+}
+
+// RenameIntent
+// Stores what is needed to finish a rename that was interrupted
+type RenameIntent struct {
+	NewParent    []byte `protobuf:"bytes,1,opt,name=newParent,proto3" json:"newParent,omitempty"`
+	NewName      string `protobuf:"bytes,2,opt,name=newName" json:"newName,omitempty"`
+	Tsm          int64  `protobuf:"varint,3,opt,name=tsm" json:"tsm,omitempty"`
+	Replaced     []byte `protobuf:"bytes,4,opt,name=replaced,proto3" json:"replaced,omitempty"`
+	ReplacedType uint32 `protobuf:"varint,5,opt,name=replacedType" json:"replacedType,omitempty"`
+	Exchange     bool   `protobuf:"varint,6,opt,name=exchange" json:"exchange,omitempty"`
+}
+
+func (m *RenameIntent) Reset()                    { *m = RenameIntent{} }
+func (m *RenameIntent) String() string            { return proto1.CompactTextString(m) }
+func (*RenameIntent) ProtoMessage()               {}
+func (*RenameIntent) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{48} }
+
 // FileBlock
 // This is used for storing blocks in value store
 // This is *not* used for api calls
 type FileBlock struct {
-	Version  uint32 `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
-	Data     []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
-	Checksum uint32 `protobuf:"varint,3,opt,name=checksum" json:"checksum,omitempty"`
+	Version     uint32 `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	Data        []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Checksum    uint32 `protobuf:"varint,3,opt,name=checksum" json:"checksum,omitempty"`
+	Compression uint32 `protobuf:"varint,4,opt,name=compression" json:"compression,omitempty"`
+	Encryption  uint32 `protobuf:"varint,5,opt,name=encryption" json:"encryption,omitempty"`
 }
 
 func (m *FileBlock) Reset()                    { *m = FileBlock{} }
 func (m *FileBlock) String() string            { return proto1.CompactTextString(m) }
 func (*FileBlock) ProtoMessage()               {}
-func (*FileBlock) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{42} }
+func (*FileBlock) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{49} }
 
 // ModFS ...
 type ModFS struct {
@@ -694,18 +832,23 @@ type ModFS struct {
 func (m *ModFS) Reset()                    { *m = ModFS{} }
 func (m *ModFS) String() string            { return proto1.CompactTextString(m) }
 func (*ModFS) ProtoMessage()               {}
-func (*ModFS) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{43} }
+func (*ModFS) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{50} }
 
 // Request to create a new filesystem
 type CreateFSRequest struct {
-	Token  string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
-	FSName string `protobuf:"bytes,2,opt,name=FSName" json:"FSName,omitempty"`
+	Token       string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSName      string `protobuf:"bytes,2,opt,name=FSName" json:"FSName,omitempty"`
+	BlockSize   int64  `protobuf:"varint,3,opt,name=BlockSize" json:"BlockSize,omitempty"`
+	Compression string `protobuf:"bytes,4,opt,name=Compression" json:"Compression,omitempty"`
+	Encrypt     bool   `protobuf:"varint,5,opt,name=Encrypt" json:"Encrypt,omitempty"`
+	Dedup       bool   `protobuf:"varint,6,opt,name=Dedup" json:"Dedup,omitempty"`
+	Retention   string `protobuf:"bytes,7,opt,name=Retention" json:"Retention,omitempty"`
 }
 
 func (m *CreateFSRequest) Reset()                    { *m = CreateFSRequest{} }
 func (m *CreateFSRequest) String() string            { return proto1.CompactTextString(m) }
 func (*CreateFSRequest) ProtoMessage()               {}
-func (*CreateFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{44} }
+func (*CreateFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{51} }
 
 // Response from creating a new filesystem
 type CreateFSResponse struct {
@@ -715,7 +858,7 @@ type CreateFSResponse struct {
 func (m *CreateFSResponse) Reset()                    { *m = CreateFSResponse{} }
 func (m *CreateFSResponse) String() string            { return proto1.CompactTextString(m) }
 func (*CreateFSResponse) ProtoMessage()               {}
-func (*CreateFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{45} }
+func (*CreateFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{52} }
 
 // Request a list of all file systems for a given account
 type ListFSRequest struct {
@@ -725,7 +868,7 @@ type ListFSRequest struct {
 func (m *ListFSRequest) Reset()                    { *m = ListFSRequest{} }
 func (m *ListFSRequest) String() string            { return proto1.CompactTextString(m) }
 func (*ListFSRequest) ProtoMessage()               {}
-func (*ListFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{46} }
+func (*ListFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{53} }
 
 // Response for displaying a list of all an accounts file systems.
 type ListFSResponse struct {
@@ -735,7 +878,7 @@ type ListFSResponse struct {
 func (m *ListFSResponse) Reset()                    { *m = ListFSResponse{} }
 func (m *ListFSResponse) String() string            { return proto1.CompactTextString(m) }
 func (*ListFSResponse) ProtoMessage()               {}
-func (*ListFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{47} }
+func (*ListFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{54} }
 
 // Request to show the specific details about a file system
 type ShowFSRequest struct {
@@ -746,7 +889,7 @@ type ShowFSRequest struct {
 func (m *ShowFSRequest) Reset()                    { *m = ShowFSRequest{} }
 func (m *ShowFSRequest) String() string            { return proto1.CompactTextString(m) }
 func (*ShowFSRequest) ProtoMessage()               {}
-func (*ShowFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{48} }
+func (*ShowFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{55} }
 
 // Response for a specific file system for an account.
 type ShowFSResponse struct {
@@ -756,7 +899,7 @@ type ShowFSResponse struct {
 func (m *ShowFSResponse) Reset()                    { *m = ShowFSResponse{} }
 func (m *ShowFSResponse) String() string            { return proto1.CompactTextString(m) }
 func (*ShowFSResponse) ProtoMessage()               {}
-func (*ShowFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{49} }
+func (*ShowFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{56} }
 
 // Request to delete a specific file system
 type DeleteFSRequest struct {
@@ -767,7 +910,7 @@ type DeleteFSRequest struct {
 func (m *DeleteFSRequest) Reset()                    { *m = DeleteFSRequest{} }
 func (m *DeleteFSRequest) String() string            { return proto1.CompactTextString(m) }
 func (*DeleteFSRequest) ProtoMessage()               {}
-func (*DeleteFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{50} }
+func (*DeleteFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{57} }
 
 // Response from deleting a file system
 type DeleteFSResponse struct {
@@ -777,7 +920,7 @@ type DeleteFSResponse struct {
 func (m *DeleteFSResponse) Reset()                    { *m = DeleteFSResponse{} }
 func (m *DeleteFSResponse) String() string            { return proto1.CompactTextString(m) }
 func (*DeleteFSResponse) ProtoMessage()               {}
-func (*DeleteFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{51} }
+func (*DeleteFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{58} }
 
 // Request to update a specific file system's information
 type UpdateFSRequest struct {
@@ -789,7 +932,7 @@ type UpdateFSRequest struct {
 func (m *UpdateFSRequest) Reset()                    { *m = UpdateFSRequest{} }
 func (m *UpdateFSRequest) String() string            { return proto1.CompactTextString(m) }
 func (*UpdateFSRequest) ProtoMessage()               {}
-func (*UpdateFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{52} }
+func (*UpdateFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{59} }
 
 func (m *UpdateFSRequest) GetFilesys() *ModFS {
 	if m != nil {
@@ -806,7 +949,7 @@ type UpdateFSResponse struct {
 func (m *UpdateFSResponse) Reset()                    { *m = UpdateFSResponse{} }
 func (m *UpdateFSResponse) String() string            { return proto1.CompactTextString(m) }
 func (*UpdateFSResponse) ProtoMessage()               {}
-func (*UpdateFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{53} }
+func (*UpdateFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{60} }
 
 // Request grant an ip address access to a file system
 type GrantAddrFSRequest struct {
@@ -818,7 +961,7 @@ type GrantAddrFSRequest struct {
 func (m *GrantAddrFSRequest) Reset()                    { *m = GrantAddrFSRequest{} }
 func (m *GrantAddrFSRequest) String() string            { return proto1.CompactTextString(m) }
 func (*GrantAddrFSRequest) ProtoMessage()               {}
-func (*GrantAddrFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{54} }
+func (*GrantAddrFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{61} }
 
 // Response from granting ip address access to a file system
 type GrantAddrFSResponse struct {
@@ -828,7 +971,7 @@ type GrantAddrFSResponse struct {
 func (m *GrantAddrFSResponse) Reset()                    { *m = GrantAddrFSResponse{} }
 func (m *GrantAddrFSResponse) String() string            { return proto1.CompactTextString(m) }
 func (*GrantAddrFSResponse) ProtoMessage()               {}
-func (*GrantAddrFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{55} }
+func (*GrantAddrFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{62} }
 
 // Request revoke an ip address access to a file system
 type RevokeAddrFSRequest struct {
@@ -840,7 +983,7 @@ type RevokeAddrFSRequest struct {
 func (m *RevokeAddrFSRequest) Reset()                    { *m = RevokeAddrFSRequest{} }
 func (m *RevokeAddrFSRequest) String() string            { return proto1.CompactTextString(m) }
 func (*RevokeAddrFSRequest) ProtoMessage()               {}
-func (*RevokeAddrFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{56} }
+func (*RevokeAddrFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{63} }
 
 // Response from revoking ip address access to a file system
 type RevokeAddrFSResponse struct {
@@ -850,7 +993,252 @@ type RevokeAddrFSResponse struct {
 func (m *RevokeAddrFSResponse) Reset()                    { *m = RevokeAddrFSResponse{} }
 func (m *RevokeAddrFSResponse) String() string            { return proto1.CompactTextString(m) }
 func (*RevokeAddrFSResponse) ProtoMessage()               {}
-func (*RevokeAddrFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{57} }
+func (*RevokeAddrFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{64} }
+
+// Request to scrub a file system for orphaned data
+type ScrubFSRequest struct {
+	Token  string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid   string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+	DryRun bool   `protobuf:"varint,3,opt,name=DryRun" json:"DryRun,omitempty"`
+}
+
+func (m *ScrubFSRequest) Reset()                    { *m = ScrubFSRequest{} }
+func (m *ScrubFSRequest) String() string            { return proto1.CompactTextString(m) }
+func (*ScrubFSRequest) ProtoMessage()               {}
+func (*ScrubFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{65} }
+
+// Response from scrubbing a file system
+type ScrubFSResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *ScrubFSResponse) Reset()                    { *m = ScrubFSResponse{} }
+func (m *ScrubFSResponse) String() string            { return proto1.CompactTextString(m) }
+func (*ScrubFSResponse) ProtoMessage()               {}
+func (*ScrubFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{66} }
+
+// Request to check a file system for consistency
+type CheckFSRequest struct {
+	Token  string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid   string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+	Repair bool   `protobuf:"varint,3,opt,name=Repair" json:"Repair,omitempty"`
+}
+
+func (m *CheckFSRequest) Reset()                    { *m = CheckFSRequest{} }
+func (m *CheckFSRequest) String() string            { return proto1.CompactTextString(m) }
+func (*CheckFSRequest) ProtoMessage()               {}
+func (*CheckFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{67} }
+
+// Response from checking a file system
+type CheckFSResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *CheckFSResponse) Reset()                    { *m = CheckFSResponse{} }
+func (m *CheckFSResponse) String() string            { return proto1.CompactTextString(m) }
+func (*CheckFSResponse) ProtoMessage()               {}
+func (*CheckFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{68} }
+
+// Request to re-wrap the data keys with the current master key, this needs
+// the admin token
+type RotateKeysRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid  string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+}
+
+func (m *RotateKeysRequest) Reset()                    { *m = RotateKeysRequest{} }
+func (m *RotateKeysRequest) String() string            { return proto1.CompactTextString(m) }
+func (*RotateKeysRequest) ProtoMessage()               {}
+func (*RotateKeysRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{69} }
+
+// Response from rotating keys
+type RotateKeysResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *RotateKeysResponse) Reset()                    { *m = RotateKeysResponse{} }
+func (m *RotateKeysResponse) String() string            { return proto1.CompactTextString(m) }
+func (*RotateKeysResponse) ProtoMessage()               {}
+func (*RotateKeysResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{70} }
+
+// Request to snapshot a file system
+type CreateSnapshotRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid  string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+	Name  string `protobuf:"bytes,3,opt,name=Name" json:"Name,omitempty"`
+}
+
+func (m *CreateSnapshotRequest) Reset()                    { *m = CreateSnapshotRequest{} }
+func (m *CreateSnapshotRequest) String() string            { return proto1.CompactTextString(m) }
+func (*CreateSnapshotRequest) ProtoMessage()               {}
+func (*CreateSnapshotRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{71} }
+
+// Response from creating a snapshot
+type CreateSnapshotResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *CreateSnapshotResponse) Reset()                    { *m = CreateSnapshotResponse{} }
+func (m *CreateSnapshotResponse) String() string            { return proto1.CompactTextString(m) }
+func (*CreateSnapshotResponse) ProtoMessage()               {}
+func (*CreateSnapshotResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{72} }
+
+// Request to list the snapshots of a file system
+type ListSnapshotsRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid  string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+}
+
+func (m *ListSnapshotsRequest) Reset()                    { *m = ListSnapshotsRequest{} }
+func (m *ListSnapshotsRequest) String() string            { return proto1.CompactTextString(m) }
+func (*ListSnapshotsRequest) ProtoMessage()               {}
+func (*ListSnapshotsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{73} }
+
+// Response from listing snapshots
+type ListSnapshotsResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *ListSnapshotsResponse) Reset()                    { *m = ListSnapshotsResponse{} }
+func (m *ListSnapshotsResponse) String() string            { return proto1.CompactTextString(m) }
+func (*ListSnapshotsResponse) ProtoMessage()               {}
+func (*ListSnapshotsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{74} }
+
+// Request to delete a snapshot
+type DeleteSnapshotRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid  string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+	Name  string `protobuf:"bytes,3,opt,name=Name" json:"Name,omitempty"`
+}
+
+func (m *DeleteSnapshotRequest) Reset()                    { *m = DeleteSnapshotRequest{} }
+func (m *DeleteSnapshotRequest) String() string            { return proto1.CompactTextString(m) }
+func (*DeleteSnapshotRequest) ProtoMessage()               {}
+func (*DeleteSnapshotRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{75} }
+
+// Response from deleting a snapshot
+type DeleteSnapshotResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *DeleteSnapshotResponse) Reset()                    { *m = DeleteSnapshotResponse{} }
+func (m *DeleteSnapshotResponse) String() string            { return proto1.CompactTextString(m) }
+func (*DeleteSnapshotResponse) ProtoMessage()               {}
+func (*DeleteSnapshotResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{76} }
+
+// Request to roll a file system back to a snapshot
+type RestoreSnapshotRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid  string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+	Name  string `protobuf:"bytes,3,opt,name=Name" json:"Name,omitempty"`
+}
+
+func (m *RestoreSnapshotRequest) Reset()                    { *m = RestoreSnapshotRequest{} }
+func (m *RestoreSnapshotRequest) String() string            { return proto1.CompactTextString(m) }
+func (*RestoreSnapshotRequest) ProtoMessage()               {}
+func (*RestoreSnapshotRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{77} }
+
+// Response from restoring a snapshot
+type RestoreSnapshotResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *RestoreSnapshotResponse) Reset()                    { *m = RestoreSnapshotResponse{} }
+func (m *RestoreSnapshotResponse) String() string            { return proto1.CompactTextString(m) }
+func (*RestoreSnapshotResponse) ProtoMessage()               {}
+func (*RestoreSnapshotResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{78} }
+
+// Request to make a writable copy of a file system from one of its snapshots
+type CloneFSRequest struct {
+	Token    string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid     string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+	Snapshot string `protobuf:"bytes,3,opt,name=Snapshot" json:"Snapshot,omitempty"`
+	FSName   string `protobuf:"bytes,4,opt,name=FSName" json:"FSName,omitempty"`
+}
+
+func (m *CloneFSRequest) Reset()                    { *m = CloneFSRequest{} }
+func (m *CloneFSRequest) String() string            { return proto1.CompactTextString(m) }
+func (*CloneFSRequest) ProtoMessage()               {}
+func (*CloneFSRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{79} }
+
+// Response from cloning a file system, the id of the clone
+type CloneFSResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *CloneFSResponse) Reset()                    { *m = CloneFSResponse{} }
+func (m *CloneFSResponse) String() string            { return proto1.CompactTextString(m) }
+func (*CloneFSResponse) ProtoMessage()               {}
+func (*CloneFSResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{80} }
+
+// Request to list the removed files that can still be undeleted
+type ListDeletedRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid  string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+}
+
+func (m *ListDeletedRequest) Reset()                    { *m = ListDeletedRequest{} }
+func (m *ListDeletedRequest) String() string            { return proto1.CompactTextString(m) }
+func (*ListDeletedRequest) ProtoMessage()               {}
+func (*ListDeletedRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{81} }
+
+// Response from listing removed files
+type ListDeletedResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *ListDeletedResponse) Reset()                    { *m = ListDeletedResponse{} }
+func (m *ListDeletedResponse) String() string            { return proto1.CompactTextString(m) }
+func (*ListDeletedResponse) ProtoMessage()               {}
+func (*ListDeletedResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{82} }
+
+// Request to put back a removed file or directory
+type UndeleteRequest struct {
+	Token string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid  string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+	Path  string `protobuf:"bytes,3,opt,name=Path" json:"Path,omitempty"`
+}
+
+func (m *UndeleteRequest) Reset()                    { *m = UndeleteRequest{} }
+func (m *UndeleteRequest) String() string            { return proto1.CompactTextString(m) }
+func (*UndeleteRequest) ProtoMessage()               {}
+func (*UndeleteRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{83} }
+
+// Response from undeleting, the number of entries put back
+type UndeleteResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *UndeleteResponse) Reset()                    { *m = UndeleteResponse{} }
+func (m *UndeleteResponse) String() string            { return proto1.CompactTextString(m) }
+func (*UndeleteResponse) ProtoMessage()               {}
+func (*UndeleteResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{84} }
+
+// Request to set the quota of a filesystem, zero limits are no limit
+type SetQuotaRequest struct {
+	Token      string `protobuf:"bytes,1,opt,name=Token" json:"Token,omitempty"`
+	FSid       string `protobuf:"bytes,2,opt,name=FSid" json:"FSid,omitempty"`
+	Bytes      int64  `protobuf:"varint,3,opt,name=Bytes" json:"Bytes,omitempty"`
+	Inodes     int64  `protobuf:"varint,4,opt,name=Inodes" json:"Inodes,omitempty"`
+	SoftBytes  int64  `protobuf:"varint,5,opt,name=SoftBytes" json:"SoftBytes,omitempty"`
+	SoftInodes int64  `protobuf:"varint,6,opt,name=SoftInodes" json:"SoftInodes,omitempty"`
+	Grace      string `protobuf:"bytes,7,opt,name=Grace" json:"Grace,omitempty"`
+}
+
+func (m *SetQuotaRequest) Reset()                    { *m = SetQuotaRequest{} }
+func (m *SetQuotaRequest) String() string            { return proto1.CompactTextString(m) }
+func (*SetQuotaRequest) ProtoMessage()               {}
+func (*SetQuotaRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{85} }
+
+// Response from setting a quota
+type SetQuotaResponse struct {
+	Data string `protobuf:"bytes,1,opt,name=Data" json:"Data,omitempty"`
+}
+
+func (m *SetQuotaResponse) Reset()                    { *m = SetQuotaResponse{} }
+func (m *SetQuotaResponse) String() string            { return proto1.CompactTextString(m) }
+func (*SetQuotaResponse) ProtoMessage()               {}
+func (*SetQuotaResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{86} }
 
 func init() {
 	proto1.RegisterType((*DirEnt)(nil), "proto.DirEnt")
@@ -876,6 +1264,8 @@ func init() {
 	proto1.RegisterType((*ReadDirAllResponse)(nil), "proto.ReadDirAllResponse")
 	proto1.RegisterType((*SymlinkRequest)(nil), "proto.SymlinkRequest")
 	proto1.RegisterType((*SymlinkResponse)(nil), "proto.SymlinkResponse")
+	proto1.RegisterType((*LinkRequest)(nil), "proto.LinkRequest")
+	proto1.RegisterType((*LinkResponse)(nil), "proto.LinkResponse")
 	proto1.RegisterType((*ReadlinkRequest)(nil), "proto.ReadlinkRequest")
 	proto1.RegisterType((*ReadlinkResponse)(nil), "proto.ReadlinkResponse")
 	proto1.RegisterType((*GetxattrRequest)(nil), "proto.GetxattrRequest")
@@ -892,9 +1282,14 @@ func init() {
 	proto1.RegisterType((*StatfsResponse)(nil), "proto.StatfsResponse")
 	proto1.RegisterType((*InitFsRequest)(nil), "proto.InitFsRequest")
 	proto1.RegisterType((*InitFsResponse)(nil), "proto.InitFsResponse")
+	proto1.RegisterType((*SeekRequest)(nil), "proto.SeekRequest")
+	proto1.RegisterType((*SeekResponse)(nil), "proto.SeekResponse")
+	proto1.RegisterType((*WatchRequest)(nil), "proto.WatchRequest")
+	proto1.RegisterType((*Invalidation)(nil), "proto.Invalidation")
 	proto1.RegisterType((*InodeEntry)(nil), "proto.InodeEntry")
 	proto1.RegisterType((*Tombstone)(nil), "proto.Tombstone")
 	proto1.RegisterType((*DirEntry)(nil), "proto.DirEntry")
+	proto1.RegisterType((*RenameIntent)(nil), "proto.RenameIntent")
 	proto1.RegisterType((*FileBlock)(nil), "proto.FileBlock")
 	proto1.RegisterType((*ModFS)(nil), "proto.ModFS")
 	proto1.RegisterType((*CreateFSRequest)(nil), "proto.CreateFSRequest")
@@ -911,6 +1306,28 @@ func init() {
 	proto1.RegisterType((*GrantAddrFSResponse)(nil), "proto.GrantAddrFSResponse")
 	proto1.RegisterType((*RevokeAddrFSRequest)(nil), "proto.RevokeAddrFSRequest")
 	proto1.RegisterType((*RevokeAddrFSResponse)(nil), "proto.RevokeAddrFSResponse")
+	proto1.RegisterType((*ScrubFSRequest)(nil), "proto.ScrubFSRequest")
+	proto1.RegisterType((*ScrubFSResponse)(nil), "proto.ScrubFSResponse")
+	proto1.RegisterType((*CheckFSRequest)(nil), "proto.CheckFSRequest")
+	proto1.RegisterType((*CheckFSResponse)(nil), "proto.CheckFSResponse")
+	proto1.RegisterType((*RotateKeysRequest)(nil), "proto.RotateKeysRequest")
+	proto1.RegisterType((*RotateKeysResponse)(nil), "proto.RotateKeysResponse")
+	proto1.RegisterType((*CreateSnapshotRequest)(nil), "proto.CreateSnapshotRequest")
+	proto1.RegisterType((*CreateSnapshotResponse)(nil), "proto.CreateSnapshotResponse")
+	proto1.RegisterType((*ListSnapshotsRequest)(nil), "proto.ListSnapshotsRequest")
+	proto1.RegisterType((*ListSnapshotsResponse)(nil), "proto.ListSnapshotsResponse")
+	proto1.RegisterType((*DeleteSnapshotRequest)(nil), "proto.DeleteSnapshotRequest")
+	proto1.RegisterType((*DeleteSnapshotResponse)(nil), "proto.DeleteSnapshotResponse")
+	proto1.RegisterType((*RestoreSnapshotRequest)(nil), "proto.RestoreSnapshotRequest")
+	proto1.RegisterType((*RestoreSnapshotResponse)(nil), "proto.RestoreSnapshotResponse")
+	proto1.RegisterType((*CloneFSRequest)(nil), "proto.CloneFSRequest")
+	proto1.RegisterType((*CloneFSResponse)(nil), "proto.CloneFSResponse")
+	proto1.RegisterType((*ListDeletedRequest)(nil), "proto.ListDeletedRequest")
+	proto1.RegisterType((*ListDeletedResponse)(nil), "proto.ListDeletedResponse")
+	proto1.RegisterType((*UndeleteRequest)(nil), "proto.UndeleteRequest")
+	proto1.RegisterType((*UndeleteResponse)(nil), "proto.UndeleteResponse")
+	proto1.RegisterType((*SetQuotaRequest)(nil), "proto.SetQuotaRequest")
+	proto1.RegisterType((*SetQuotaResponse)(nil), "proto.SetQuotaResponse")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -942,6 +1359,11 @@ type ApiClient interface {
 	Rename(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*RenameResponse, error)
 	Statfs(ctx context.Context, in *StatfsRequest, opts ...grpc.CallOption) (*StatfsResponse, error)
 	InitFs(ctx context.Context, in *InitFsRequest, opts ...grpc.CallOption) (*InitFsResponse, error)
+	ReadStream(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (Api_ReadStreamClient, error)
+	WriteStream(ctx context.Context, opts ...grpc.CallOption) (Api_WriteStreamClient, error)
+	Seek(ctx context.Context, in *SeekRequest, opts ...grpc.CallOption) (*SeekResponse, error)
+	Link(ctx context.Context, in *LinkRequest, opts ...grpc.CallOption) (*LinkResponse, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Api_WatchClient, error)
 }
 
 type apiClient struct {
@@ -1114,6 +1536,122 @@ func (c *apiClient) InitFs(ctx context.Context, in *InitFsRequest, opts ...grpc.
 	return out, nil
 }
 
+func (c *apiClient) ReadStream(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (Api_ReadStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Api_serviceDesc.Streams[0], c.cc, "/proto.Api/ReadStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &apiReadStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Api_ReadStreamClient interface {
+	Recv() (*ReadResponse, error)
+	grpc.ClientStream
+}
+
+type apiReadStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *apiReadStreamClient) Recv() (*ReadResponse, error) {
+	m := new(ReadResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *apiClient) WriteStream(ctx context.Context, opts ...grpc.CallOption) (Api_WriteStreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Api_serviceDesc.Streams[1], c.cc, "/proto.Api/WriteStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &apiWriteStreamClient{stream}
+	return x, nil
+}
+
+type Api_WriteStreamClient interface {
+	Send(*WriteRequest) error
+	CloseAndRecv() (*WriteResponse, error)
+	grpc.ClientStream
+}
+
+type apiWriteStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *apiWriteStreamClient) Send(m *WriteRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *apiWriteStreamClient) CloseAndRecv() (*WriteResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(WriteResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *apiClient) Seek(ctx context.Context, in *SeekRequest, opts ...grpc.CallOption) (*SeekResponse, error) {
+	out := new(SeekResponse)
+	err := grpc.Invoke(ctx, "/proto.Api/Seek", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *apiClient) Link(ctx context.Context, in *LinkRequest, opts ...grpc.CallOption) (*LinkResponse, error) {
+	out := new(LinkResponse)
+	err := grpc.Invoke(ctx, "/proto.Api/Link", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *apiClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Api_WatchClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Api_serviceDesc.Streams[2], c.cc, "/proto.Api/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &apiWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Api_WatchClient interface {
+	Recv() (*Invalidation, error)
+	grpc.ClientStream
+}
+
+type apiWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *apiWatchClient) Recv() (*Invalidation, error) {
+	m := new(Invalidation)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for Api service
 
 type ApiServer interface {
@@ -1135,6 +1673,11 @@ type ApiServer interface {
 	Rename(context.Context, *RenameRequest) (*RenameResponse, error)
 	Statfs(context.Context, *StatfsRequest) (*StatfsResponse, error)
 	InitFs(context.Context, *InitFsRequest) (*InitFsResponse, error)
+	ReadStream(*ReadRequest, Api_ReadStreamServer) error
+	WriteStream(Api_WriteStreamServer) error
+	Seek(context.Context, *SeekRequest) (*SeekResponse, error)
+	Link(context.Context, *LinkRequest) (*LinkResponse, error)
+	Watch(*WatchRequest, Api_WatchServer) error
 }
 
 func RegisterApiServer(s *grpc.Server, srv ApiServer) {
@@ -1465,6 +2008,110 @@ func _Api_InitFs_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Api_ReadStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ApiServer).ReadStream(m, &apiReadStreamServer{stream})
+}
+
+type Api_ReadStreamServer interface {
+	Send(*ReadResponse) error
+	grpc.ServerStream
+}
+
+type apiReadStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *apiReadStreamServer) Send(m *ReadResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Api_WriteStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ApiServer).WriteStream(&apiWriteStreamServer{stream})
+}
+
+type Api_WriteStreamServer interface {
+	SendAndClose(*WriteResponse) error
+	Recv() (*WriteRequest, error)
+	grpc.ServerStream
+}
+
+type apiWriteStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *apiWriteStreamServer) SendAndClose(m *WriteResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *apiWriteStreamServer) Recv() (*WriteRequest, error) {
+	m := new(WriteRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Api_Seek_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SeekRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ApiServer).Seek(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Api/Seek",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ApiServer).Seek(ctx, req.(*SeekRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Api_Link_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ApiServer).Link(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Api/Link",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ApiServer).Link(ctx, req.(*LinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Api_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ApiServer).Watch(m, &apiWatchServer{stream})
+}
+
+type Api_WatchServer interface {
+	Send(*Invalidation) error
+	grpc.ServerStream
+}
+
+type apiWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *apiWatchServer) Send(m *Invalidation) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Api_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.Api",
 	HandlerType: (*ApiServer)(nil),
@@ -1541,8 +2188,32 @@ var _Api_serviceDesc = grpc.ServiceDesc{
 			MethodName: "InitFs",
 			Handler:    _Api_InitFs_Handler,
 		},
+		{
+			MethodName: "Seek",
+			Handler:    _Api_Seek_Handler,
+		},
+		{
+			MethodName: "Link",
+			Handler:    _Api_Link_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ReadStream",
+			Handler:       _Api_ReadStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WriteStream",
+			Handler:       _Api_WriteStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _Api_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams: []grpc.StreamDesc{},
 }
 
 // Client API for FileSystemAPI service
@@ -1555,6 +2226,17 @@ type FileSystemAPIClient interface {
 	UpdateFS(ctx context.Context, in *UpdateFSRequest, opts ...grpc.CallOption) (*UpdateFSResponse, error)
 	GrantAddrFS(ctx context.Context, in *GrantAddrFSRequest, opts ...grpc.CallOption) (*GrantAddrFSResponse, error)
 	RevokeAddrFS(ctx context.Context, in *RevokeAddrFSRequest, opts ...grpc.CallOption) (*RevokeAddrFSResponse, error)
+	ScrubFS(ctx context.Context, in *ScrubFSRequest, opts ...grpc.CallOption) (*ScrubFSResponse, error)
+	CheckFS(ctx context.Context, in *CheckFSRequest, opts ...grpc.CallOption) (*CheckFSResponse, error)
+	RotateKeys(ctx context.Context, in *RotateKeysRequest, opts ...grpc.CallOption) (*RotateKeysResponse, error)
+	CreateSnapshot(ctx context.Context, in *CreateSnapshotRequest, opts ...grpc.CallOption) (*CreateSnapshotResponse, error)
+	ListSnapshots(ctx context.Context, in *ListSnapshotsRequest, opts ...grpc.CallOption) (*ListSnapshotsResponse, error)
+	DeleteSnapshot(ctx context.Context, in *DeleteSnapshotRequest, opts ...grpc.CallOption) (*DeleteSnapshotResponse, error)
+	RestoreSnapshot(ctx context.Context, in *RestoreSnapshotRequest, opts ...grpc.CallOption) (*RestoreSnapshotResponse, error)
+	CloneFS(ctx context.Context, in *CloneFSRequest, opts ...grpc.CallOption) (*CloneFSResponse, error)
+	ListDeleted(ctx context.Context, in *ListDeletedRequest, opts ...grpc.CallOption) (*ListDeletedResponse, error)
+	Undelete(ctx context.Context, in *UndeleteRequest, opts ...grpc.CallOption) (*UndeleteResponse, error)
+	SetQuota(ctx context.Context, in *SetQuotaRequest, opts ...grpc.CallOption) (*SetQuotaResponse, error)
 }
 
 type fileSystemAPIClient struct {
@@ -1628,6 +2310,105 @@ func (c *fileSystemAPIClient) RevokeAddrFS(ctx context.Context, in *RevokeAddrFS
 	return out, nil
 }
 
+func (c *fileSystemAPIClient) ScrubFS(ctx context.Context, in *ScrubFSRequest, opts ...grpc.CallOption) (*ScrubFSResponse, error) {
+	out := new(ScrubFSResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/ScrubFS", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) CheckFS(ctx context.Context, in *CheckFSRequest, opts ...grpc.CallOption) (*CheckFSResponse, error) {
+	out := new(CheckFSResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/CheckFS", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) RotateKeys(ctx context.Context, in *RotateKeysRequest, opts ...grpc.CallOption) (*RotateKeysResponse, error) {
+	out := new(RotateKeysResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/RotateKeys", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) CreateSnapshot(ctx context.Context, in *CreateSnapshotRequest, opts ...grpc.CallOption) (*CreateSnapshotResponse, error) {
+	out := new(CreateSnapshotResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/CreateSnapshot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) ListSnapshots(ctx context.Context, in *ListSnapshotsRequest, opts ...grpc.CallOption) (*ListSnapshotsResponse, error) {
+	out := new(ListSnapshotsResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/ListSnapshots", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) DeleteSnapshot(ctx context.Context, in *DeleteSnapshotRequest, opts ...grpc.CallOption) (*DeleteSnapshotResponse, error) {
+	out := new(DeleteSnapshotResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/DeleteSnapshot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) RestoreSnapshot(ctx context.Context, in *RestoreSnapshotRequest, opts ...grpc.CallOption) (*RestoreSnapshotResponse, error) {
+	out := new(RestoreSnapshotResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/RestoreSnapshot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) CloneFS(ctx context.Context, in *CloneFSRequest, opts ...grpc.CallOption) (*CloneFSResponse, error) {
+	out := new(CloneFSResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/CloneFS", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) ListDeleted(ctx context.Context, in *ListDeletedRequest, opts ...grpc.CallOption) (*ListDeletedResponse, error) {
+	out := new(ListDeletedResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/ListDeleted", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) Undelete(ctx context.Context, in *UndeleteRequest, opts ...grpc.CallOption) (*UndeleteResponse, error) {
+	out := new(UndeleteResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/Undelete", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemAPIClient) SetQuota(ctx context.Context, in *SetQuotaRequest, opts ...grpc.CallOption) (*SetQuotaResponse, error) {
+	out := new(SetQuotaResponse)
+	err := grpc.Invoke(ctx, "/proto.FileSystemAPI/SetQuota", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for FileSystemAPI service
 
 type FileSystemAPIServer interface {
@@ -1638,6 +2419,17 @@ type FileSystemAPIServer interface {
 	UpdateFS(context.Context, *UpdateFSRequest) (*UpdateFSResponse, error)
 	GrantAddrFS(context.Context, *GrantAddrFSRequest) (*GrantAddrFSResponse, error)
 	RevokeAddrFS(context.Context, *RevokeAddrFSRequest) (*RevokeAddrFSResponse, error)
+	ScrubFS(context.Context, *ScrubFSRequest) (*ScrubFSResponse, error)
+	CheckFS(context.Context, *CheckFSRequest) (*CheckFSResponse, error)
+	RotateKeys(context.Context, *RotateKeysRequest) (*RotateKeysResponse, error)
+	CreateSnapshot(context.Context, *CreateSnapshotRequest) (*CreateSnapshotResponse, error)
+	ListSnapshots(context.Context, *ListSnapshotsRequest) (*ListSnapshotsResponse, error)
+	DeleteSnapshot(context.Context, *DeleteSnapshotRequest) (*DeleteSnapshotResponse, error)
+	RestoreSnapshot(context.Context, *RestoreSnapshotRequest) (*RestoreSnapshotResponse, error)
+	CloneFS(context.Context, *CloneFSRequest) (*CloneFSResponse, error)
+	ListDeleted(context.Context, *ListDeletedRequest) (*ListDeletedResponse, error)
+	Undelete(context.Context, *UndeleteRequest) (*UndeleteResponse, error)
+	SetQuota(context.Context, *SetQuotaRequest) (*SetQuotaResponse, error)
 }
 
 func RegisterFileSystemAPIServer(s *grpc.Server, srv FileSystemAPIServer) {
@@ -1770,6 +2562,204 @@ func _FileSystemAPI_RevokeAddrFS_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FileSystemAPI_ScrubFS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScrubFSRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).ScrubFS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/ScrubFS",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).ScrubFS(ctx, req.(*ScrubFSRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_CheckFS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckFSRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).CheckFS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/CheckFS",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).CheckFS(ctx, req.(*CheckFSRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_RotateKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RotateKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).RotateKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/RotateKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).RotateKeys(ctx, req.(*RotateKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_CreateSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).CreateSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/CreateSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).CreateSnapshot(ctx, req.(*CreateSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_ListSnapshots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSnapshotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).ListSnapshots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/ListSnapshots",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).ListSnapshots(ctx, req.(*ListSnapshotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_DeleteSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).DeleteSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/DeleteSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).DeleteSnapshot(ctx, req.(*DeleteSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_RestoreSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).RestoreSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/RestoreSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).RestoreSnapshot(ctx, req.(*RestoreSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_CloneFS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloneFSRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).CloneFS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/CloneFS",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).CloneFS(ctx, req.(*CloneFSRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_ListDeleted_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDeletedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).ListDeleted(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/ListDeleted",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).ListDeleted(ctx, req.(*ListDeletedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_Undelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UndeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).Undelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/Undelete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).Undelete(ctx, req.(*UndeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystemAPI_SetQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetQuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemAPIServer).SetQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.FileSystemAPI/SetQuota",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemAPIServer).SetQuota(ctx, req.(*SetQuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _FileSystemAPI_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.FileSystemAPI",
 	HandlerType: (*FileSystemAPIServer)(nil),
@@ -1802,106 +2792,198 @@ var _FileSystemAPI_serviceDesc = grpc.ServiceDesc{
 			MethodName: "RevokeAddrFS",
 			Handler:    _FileSystemAPI_RevokeAddrFS_Handler,
 		},
+		{
+			MethodName: "ScrubFS",
+			Handler:    _FileSystemAPI_ScrubFS_Handler,
+		},
+		{
+			MethodName: "CheckFS",
+			Handler:    _FileSystemAPI_CheckFS_Handler,
+		},
+		{
+			MethodName: "RotateKeys",
+			Handler:    _FileSystemAPI_RotateKeys_Handler,
+		},
+		{
+			MethodName: "CreateSnapshot",
+			Handler:    _FileSystemAPI_CreateSnapshot_Handler,
+		},
+		{
+			MethodName: "ListSnapshots",
+			Handler:    _FileSystemAPI_ListSnapshots_Handler,
+		},
+		{
+			MethodName: "DeleteSnapshot",
+			Handler:    _FileSystemAPI_DeleteSnapshot_Handler,
+		},
+		{
+			MethodName: "RestoreSnapshot",
+			Handler:    _FileSystemAPI_RestoreSnapshot_Handler,
+		},
+		{
+			MethodName: "CloneFS",
+			Handler:    _FileSystemAPI_CloneFS_Handler,
+		},
+		{
+			MethodName: "ListDeleted",
+			Handler:    _FileSystemAPI_ListDeleted_Handler,
+		},
+		{
+			MethodName: "Undelete",
+			Handler:    _FileSystemAPI_Undelete_Handler,
+		},
+		{
+			MethodName: "SetQuota",
+			Handler:    _FileSystemAPI_SetQuota_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{},
 }
 
 var fileDescriptor0 = []byte{
-	// 1523 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x9c, 0x58, 0xeb, 0x72, 0xd3, 0xd6,
-	0x13, 0xc7, 0xb7, 0xc4, 0x5e, 0x5b, 0xb1, 0x11, 0x97, 0xbf, 0xf1, 0xbf, 0x2d, 0x20, 0xda, 0x19,
-	0x66, 0x4a, 0xd3, 0x92, 0x32, 0x03, 0xcd, 0xf4, 0x42, 0x0a, 0xb5, 0x9b, 0x0e, 0x64, 0x18, 0x44,
-	0x0b, 0x9f, 0xda, 0x51, 0x62, 0x19, 0x34, 0xb1, 0x25, 0x23, 0xc9, 0x01, 0xf7, 0x1d, 0xfa, 0xb9,
-	0xaf, 0xd2, 0xe9, 0x5b, 0xf4, 0x8d, 0xba, 0x67, 0xcf, 0x5d, 0x56, 0xa8, 0xc9, 0xa7, 0xcc, 0xea,
-	0xec, 0x6f, 0x6f, 0x67, 0xf7, 0xec, 0xcf, 0x81, 0xde, 0x24, 0x49, 0x67, 0xd1, 0xd1, 0x6f, 0xc1,
-	0x3c, 0xda, 0x9e, 0xa7, 0x49, 0x9e, 0xb8, 0x0d, 0xfa, 0xe3, 0xdd, 0x81, 0x8d, 0x87, 0x51, 0xfa,
-	0x43, 0x9c, 0xbb, 0x1d, 0xa8, 0xc7, 0xc1, 0x2c, 0xec, 0x57, 0xae, 0x55, 0x6e, 0xb6, 0xdc, 0x2d,
-	0xd8, 0x98, 0x07, 0x69, 0x18, 0xe7, 0xfd, 0x2a, 0xca, 0x75, 0x76, 0x9a, 0x2f, 0xe7, 0x61, 0xbf,
-	0x86, 0x92, 0xe3, 0x7d, 0x0e, 0xc0, 0x51, 0x69, 0x14, 0x66, 0xee, 0x75, 0x53, 0x42, 0x7c, 0xed,
-	0x66, 0x7b, 0xc7, 0xe1, 0x6e, 0xb6, 0xf9, 0x81, 0xf7, 0x67, 0x05, 0xea, 0x7b, 0x79, 0x9e, 0xba,
-	0x0e, 0x34, 0xa2, 0x38, 0x19, 0x73, 0x37, 0x75, 0x26, 0x06, 0x79, 0x84, 0x5e, 0x99, 0x97, 0x1a,
-	0x13, 0x67, 0x24, 0xd6, 0xa4, 0x78, 0x44, 0x62, 0x9d, 0x44, 0x8c, 0xe9, 0x28, 0x25, 0xb9, 0x41,
-	0x32, 0xc6, 0x34, 0x63, 0xa6, 0x36, 0x58, 0x4c, 0x4c, 0xf9, 0x24, 0x98, 0x46, 0xe3, 0xfe, 0x26,
-	0x8a, 0x0d, 0x76, 0x98, 0x45, 0xbf, 0x87, 0xfd, 0x26, 0xf9, 0x69, 0x43, 0x6d, 0x81, 0x47, 0x2d,
-	0xd2, 0x44, 0xe1, 0x25, 0x0a, 0x40, 0xa9, 0xec, 0xc2, 0x96, 0x1f, 0xe6, 0x2c, 0xb6, 0xa7, 0xe1,
-	0xeb, 0x45, 0x98, 0xe5, 0xee, 0x15, 0xa8, 0x07, 0x28, 0x52, 0x84, 0xed, 0x9d, 0xb6, 0x48, 0x44,
-	0x46, 0xcf, 0x7d, 0x54, 0x09, 0x7b, 0x0b, 0xba, 0x0a, 0x9b, 0xcd, 0x93, 0x38, 0x0b, 0xdf, 0x01,
-	0xf6, 0xae, 0xc2, 0xd6, 0xc8, 0xf6, 0x64, 0x17, 0x83, 0x99, 0x1b, 0xad, 0x6f, 0x6e, 0x17, 0xda,
-	0x4f, 0xc3, 0x60, 0x5c, 0x6e, 0x8b, 0xd5, 0x2a, 0x99, 0x4c, 0xb2, 0x30, 0x17, 0x95, 0x95, 0xe5,
-	0xa0, 0xc2, 0x7a, 0xdb, 0xd0, 0xe1, 0x58, 0xe1, 0xa6, 0x00, 0xee, 0xc2, 0xe6, 0x3c, 0x58, 0x4e,
-	0x93, 0x80, 0x27, 0xda, 0xf1, 0xbe, 0x85, 0xce, 0xf3, 0x34, 0xca, 0xc3, 0x35, 0x9d, 0x19, 0xf8,
-	0x1a, 0xe1, 0xaf, 0x82, 0x23, 0xf0, 0xc2, 0x21, 0x22, 0xb2, 0x3c, 0xc8, 0x17, 0x19, 0x59, 0x68,
-	0x78, 0x23, 0xe8, 0x3c, 0x3e, 0xc6, 0x5e, 0x91, 0x0e, 0x74, 0xfb, 0x55, 0x64, 0xfb, 0x51, 0x73,
-	0x56, 0xa9, 0x39, 0x65, 0x55, 0x6a, 0xab, 0x55, 0xb9, 0x07, 0x8e, 0x30, 0x24, 0x3c, 0xd9, 0x6d,
-	0x2d, 0x91, 0xd5, 0x55, 0xe4, 0x8f, 0xe0, 0x3c, 0x48, 0xc3, 0x40, 0x27, 0x79, 0xe6, 0x18, 0xbe,
-	0x82, 0x2d, 0x69, 0xe9, 0x7d, 0x83, 0xf8, 0x0c, 0x9c, 0xa7, 0xe1, 0x2c, 0x39, 0x59, 0x2f, 0x08,
-	0xef, 0x1a, 0x6c, 0x49, 0xf5, 0x53, 0x0a, 0x8b, 0x06, 0x1f, 0x25, 0xc9, 0xf1, 0x62, 0xbe, 0x9e,
-	0x41, 0x0c, 0x5d, 0xaa, 0xbf, 0x6f, 0xe8, 0x1e, 0x9c, 0x67, 0x3d, 0x85, 0xb5, 0xdf, 0x9b, 0x4e,
-	0x4f, 0xe9, 0xf0, 0xbb, 0xe0, 0x9a, 0x3a, 0xc2, 0xc5, 0x1a, 0xef, 0xc7, 0x0b, 0x9c, 0xd2, 0xe5,
-	0x6c, 0x1a, 0xc5, 0xc7, 0xeb, 0xdd, 0x0e, 0x9e, 0xe6, 0x41, 0xfa, 0x12, 0x3b, 0xb2, 0x46, 0xb2,
-	0x98, 0xff, 0xba, 0x39, 0xff, 0x0d, 0x9a, 0xe1, 0x9f, 0x70, 0x86, 0xa5, 0x65, 0x5d, 0xc3, 0xb3,
-	0x5d, 0xfc, 0x35, 0xe8, 0xb2, 0xf4, 0xcc, 0x30, 0x0b, 0x05, 0xf0, 0xa0, 0xa7, 0x35, 0xb4, 0x3b,
-	0x11, 0x2b, 0xd5, 0xd8, 0x3b, 0xa0, 0x67, 0xe0, 0x6d, 0x70, 0xea, 0x43, 0x51, 0x08, 0xc8, 0x1c,
-	0x6d, 0xc7, 0xed, 0x41, 0x73, 0x9e, 0x64, 0x51, 0x1e, 0x25, 0x31, 0x4f, 0xd7, 0xbb, 0x0e, 0x3d,
-	0x6d, 0x4f, 0x0f, 0xfc, 0x5b, 0xf5, 0xb0, 0x74, 0xbc, 0x5f, 0xe9, 0x21, 0x5b, 0xdf, 0x25, 0x7f,
-	0x07, 0x17, 0xdc, 0x67, 0x67, 0xd5, 0x27, 0x53, 0x98, 0x4c, 0x83, 0x97, 0x99, 0x28, 0xb2, 0x0b,
-	0x3d, 0xbf, 0x10, 0x82, 0xb7, 0x07, 0xbd, 0x47, 0x51, 0xf6, 0x5f, 0x4e, 0x29, 0xb3, 0xea, 0x4a,
-	0x66, 0x7c, 0x0d, 0x61, 0xcb, 0x19, 0x26, 0xca, 0x53, 0xbb, 0xcd, 0x5a, 0x8e, 0x8d, 0xc8, 0xda,
-	0xd9, 0x79, 0x97, 0xe0, 0x82, 0x05, 0x11, 0x01, 0x3f, 0x67, 0xb3, 0xc9, 0xd4, 0xa4, 0x91, 0xf3,
-	0xd0, 0x4a, 0xa6, 0xe3, 0x27, 0x66, 0xab, 0xe0, 0xa7, 0x38, 0x7c, 0xf3, 0xc4, 0xdc, 0x9c, 0xf8,
-	0x18, 0xa2, 0xd6, 0x41, 0x20, 0xb6, 0x5a, 0x8b, 0x7d, 0x40, 0x1d, 0xfa, 0x50, 0x27, 0x7f, 0x3d,
-	0x36, 0xc5, 0xdc, 0xb0, 0x70, 0xd5, 0x05, 0xc7, 0xc7, 0x29, 0x9e, 0x64, 0xc2, 0x95, 0xf7, 0x47,
-	0x05, 0x07, 0x40, 0x7c, 0xd1, 0x6d, 0x73, 0x38, 0x4d, 0x8e, 0x8e, 0x33, 0xbd, 0x4a, 0x0f, 0x27,
-	0x69, 0x18, 0x0a, 0xb7, 0xec, 0x38, 0x38, 0x09, 0xa2, 0x29, 0x79, 0xa5, 0xe3, 0x49, 0x34, 0xc5,
-	0xf9, 0xaa, 0x2b, 0x91, 0xb4, 0x1b, 0x0a, 0x4c, 0xa5, 0xe6, 0xbb, 0x94, 0x85, 0x88, 0xf1, 0x4c,
-	0xc3, 0x98, 0xb6, 0xa9, 0xc3, 0xac, 0x4d, 0x52, 0xb5, 0x4f, 0x1d, 0x16, 0xe0, 0x7e, 0x1c, 0xe5,
-	0x43, 0x15, 0x20, 0xe6, 0x20, 0x3f, 0x88, 0x1c, 0xfe, 0xaa, 0x02, 0xec, 0xb3, 0x1a, 0xb3, 0xc1,
-	0x5e, 0x32, 0x93, 0x27, 0x21, 0x9a, 0xc0, 0xcb, 0xab, 0xc8, 0x16, 0x89, 0x32, 0x1c, 0x6f, 0x8a,
-	0xb7, 0xf9, 0x8e, 0xb1, 0x32, 0xe6, 0x51, 0xc5, 0xce, 0x2f, 0xaf, 0xa1, 0x6a, 0x8e, 0xd2, 0x83,
-	0x64, 0x81, 0x1a, 0x1b, 0x32, 0xf9, 0x28, 0x7b, 0x84, 0x43, 0x46, 0xe1, 0x37, 0x8d, 0x11, 0x6b,
-	0xd2, 0x15, 0x7c, 0x2a, 0x7b, 0xa4, 0x45, 0x8f, 0xcd, 0x07, 0xc2, 0x9b, 0x0e, 0x77, 0xfb, 0x05,
-	0x3b, 0xe6, 0x91, 0xeb, 0x42, 0x83, 0xf4, 0x47, 0xb2, 0xcf, 0xca, 0xd1, 0x96, 0x9f, 0xa6, 0x41,
-	0x96, 0x7f, 0xcf, 0x3e, 0xf7, 0x3b, 0xb2, 0xa5, 0x26, 0xd9, 0xfe, 0xb8, 0xef, 0xb0, 0x2e, 0x1c,
-	0xdc, 0x02, 0x30, 0x2c, 0xe2, 0x03, 0x74, 0x1c, 0x2e, 0xc5, 0x93, 0xaa, 0x66, 0x89, 0x56, 0xed,
-	0x6e, 0xf5, 0x5e, 0xc5, 0xfb, 0x05, 0x5a, 0xcf, 0x92, 0xd9, 0x61, 0x96, 0x27, 0x31, 0xf5, 0xf3,
-	0x98, 0x48, 0x4f, 0x45, 0x72, 0xa2, 0xd7, 0x06, 0x63, 0x92, 0x6e, 0xf8, 0x20, 0xaa, 0xca, 0xd4,
-	0x55, 0x0f, 0xf0, 0xc8, 0xa9, 0x52, 0xde, 0x2b, 0x68, 0x8a, 0x87, 0xb6, 0xe4, 0x3e, 0xec, 0x09,
-	0x07, 0xa8, 0x46, 0xd2, 0xea, 0x0d, 0x68, 0xe5, 0x32, 0x1c, 0xb2, 0xdc, 0xde, 0xe9, 0x89, 0x8a,
-	0xe9, 0x30, 0x25, 0x41, 0xe4, 0x03, 0xff, 0x35, 0xb4, 0x86, 0xd8, 0x6d, 0x54, 0x90, 0x52, 0x57,
-	0xe3, 0x20, 0x0f, 0x78, 0xc6, 0x6c, 0xae, 0x8f, 0x5e, 0x85, 0x18, 0xe5, 0x62, 0x26, 0xe6, 0xfa,
-	0x13, 0x68, 0x3c, 0x4e, 0xc6, 0x43, 0x9f, 0x29, 0x1e, 0x58, 0x9c, 0xd4, 0xe7, 0xbb, 0x8d, 0xcf,
-	0xe9, 0x17, 0xd0, 0xe5, 0x7b, 0x76, 0xe8, 0x1b, 0x73, 0xfd, 0x2c, 0x39, 0x0e, 0x63, 0x8d, 0x18,
-	0xfa, 0x07, 0xe6, 0xbe, 0xec, 0x69, 0x84, 0x5e, 0x70, 0x0f, 0x59, 0x30, 0xfc, 0xf1, 0xfd, 0x08,
-	0xf7, 0x25, 0x3e, 0x29, 0xa7, 0x59, 0xc4, 0xf3, 0x2d, 0x79, 0x5e, 0x8a, 0xbf, 0x85, 0x93, 0xfb,
-	0x2a, 0x79, 0x73, 0x6a, 0x44, 0xa8, 0x3d, 0xf4, 0x05, 0x81, 0x24, 0x6b, 0x52, 0xbb, 0xd4, 0xda,
-	0x36, 0x74, 0x1f, 0xe2, 0x14, 0xbe, 0x23, 0x43, 0xdb, 0x1e, 0xe6, 0xa7, 0xf5, 0x4b, 0x2d, 0x3e,
-	0x86, 0xee, 0xcf, 0xf3, 0x71, 0xb0, 0xae, 0x45, 0xf7, 0x43, 0xd8, 0x64, 0x17, 0x99, 0x2d, 0x33,
-	0x71, 0xf3, 0x1d, 0x71, 0xf3, 0x74, 0x41, 0xcc, 0xa1, 0x36, 0x57, 0xea, 0xf0, 0x3b, 0x70, 0x47,
-	0x69, 0x10, 0xe7, 0x7b, 0xe3, 0x71, 0xba, 0xa6, 0x4f, 0x94, 0x98, 0x36, 0x7f, 0x2e, 0xbd, 0x1b,
-	0x70, 0xc1, 0x32, 0x50, 0xea, 0xe5, 0x3e, 0x7b, 0xb2, 0x4f, 0xd0, 0xe2, 0x99, 0xdd, 0x7c, 0x0c,
-	0x17, 0x6d, 0x0b, 0x65, 0x7e, 0x76, 0xfe, 0x6e, 0x42, 0x6d, 0x6f, 0x1e, 0xb9, 0xbb, 0xb0, 0x29,
-	0x98, 0xbf, 0x7b, 0x49, 0x14, 0xc4, 0xfe, 0x15, 0x31, 0xb8, 0x5c, 0xfc, 0x2c, 0x9e, 0xc5, 0x73,
-	0x0c, 0x3b, 0x2a, 0x60, 0x47, 0xe5, 0xd8, 0xd1, 0x0a, 0xf6, 0x36, 0xd4, 0x19, 0x7f, 0x70, 0x5d,
-	0xa1, 0x61, 0xfc, 0x02, 0x18, 0x5c, 0xb0, 0xbe, 0x29, 0xc8, 0x1d, 0x68, 0x10, 0xf7, 0x76, 0xe5,
-	0xb9, 0xc9, 0xe4, 0x07, 0x17, 0xed, 0x8f, 0x26, 0x8a, 0x78, 0xb4, 0x42, 0x99, 0xf4, 0x5c, 0xa1,
-	0x2c, 0xaa, 0x8d, 0xa8, 0xbb, 0xb0, 0xc1, 0xe7, 0xcb, 0x95, 0x1a, 0x16, 0xa5, 0x1e, 0x5c, 0x2a,
-	0x7c, 0x35, 0x81, 0x7c, 0xe5, 0x2a, 0xa0, 0x45, 0x83, 0x15, 0xd0, 0x66, 0xbb, 0x1c, 0xc8, 0x09,
-	0xab, 0x02, 0x5a, 0x74, 0x57, 0x01, 0x6d, 0x56, 0x8b, 0xc0, 0x07, 0x00, 0x9a, 0x8a, 0xba, 0x7d,
-	0xa3, 0x76, 0x16, 0x83, 0x1d, 0x5c, 0x29, 0x39, 0x31, 0xaf, 0x52, 0x90, 0x47, 0xdd, 0x06, 0x16,
-	0x4d, 0xd5, 0x6d, 0x60, 0x73, 0x4c, 0xc4, 0x7e, 0x03, 0x4d, 0x49, 0x05, 0xdd, 0xcb, 0x86, 0x13,
-	0x13, 0xfd, 0xbf, 0x95, 0xef, 0x26, 0x5c, 0xb2, 0x3a, 0xd7, 0xe8, 0x17, 0x93, 0xe5, 0x28, 0x78,
-	0x91, 0xfe, 0x71, 0xb8, 0x5f, 0x84, 0xfb, 0xa7, 0xc0, 0xfd, 0x55, 0xf8, 0x7d, 0x68, 0x29, 0xe6,
-	0xe5, 0x4a, 0xbd, 0x22, 0x9d, 0x1b, 0xf4, 0x57, 0x0f, 0x94, 0x85, 0x21, 0xfb, 0xf9, 0xaa, 0x48,
-	0x96, 0x7b, 0xc5, 0xba, 0x60, 0xcb, 0xca, 0xa0, 0xec, 0xc8, 0xee, 0x1c, 0xb6, 0xb8, 0x8c, 0xce,
-	0x31, 0x48, 0x9a, 0xd1, 0x39, 0x16, 0xc3, 0x22, 0x20, 0x67, 0x54, 0x0a, 0x68, 0x51, 0x2e, 0x05,
-	0xb4, 0x69, 0x17, 0x07, 0x72, 0xaa, 0xa3, 0x80, 0x16, 0x15, 0x52, 0xc0, 0x02, 0x1f, 0x3a, 0xb7,
-	0xf3, 0x4f, 0x0d, 0x1c, 0xf6, 0x98, 0xfa, 0xcb, 0x2c, 0x0f, 0x67, 0x7b, 0x4f, 0xf6, 0xd9, 0x2d,
-	0xc8, 0x7d, 0xa4, 0x6e, 0xa1, 0xb0, 0xd2, 0xd4, 0x2d, 0x14, 0x17, 0x97, 0x68, 0x7e, 0x5a, 0x46,
-	0xba, 0xf9, 0xcd, 0xdd, 0xa5, 0x9b, 0xdf, 0xda, 0x58, 0x22, 0x77, 0xda, 0x3b, 0x3a, 0x77, 0x73,
-	0x69, 0xe9, 0xdc, 0xad, 0xe5, 0xc4, 0xdb, 0x46, 0x2e, 0x18, 0x15, 0x70, 0x61, 0x43, 0xa9, 0x80,
-	0x8b, 0x9b, 0x88, 0xc3, 0xe5, 0xba, 0x50, 0xf0, 0xc2, 0x3a, 0x52, 0xf0, 0xe2, 0x5e, 0xe1, 0x3d,
-	0x63, 0xac, 0x02, 0xd5, 0x33, 0xab, 0xfb, 0x45, 0xf5, 0x4c, 0xc9, 0xe6, 0x40, 0x3b, 0xfb, 0xec,
-	0xdf, 0x1f, 0xfa, 0xad, 0x77, 0x75, 0x87, 0xad, 0xac, 0x90, 0xc1, 0xff, 0x4b, 0xcf, 0xa4, 0xa9,
-	0xc3, 0x0d, 0x3a, 0xfd, 0xf2, 0xdf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x21, 0x01, 0x19, 0x6c, 0x61,
-	0x13, 0x00, 0x00,
+	// 2296 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x59, 0x5f, 0x73, 0xdb, 0xc6,
+	0x11, 0x2f, 0xc5, 0x3f, 0x22, 0x97, 0x20, 0x48, 0x41, 0xa6, 0x04, 0x5f, 0xfc, 0x47, 0x81, 0x9b,
+	0x56, 0x33, 0x71, 0xdc, 0x58, 0x49, 0xc7, 0xb1, 0xc7, 0x69, 0x23, 0x4b, 0x91, 0xa2, 0x56, 0x76,
+	0x5c, 0xc1, 0x99, 0xe4, 0xa9, 0x1d, 0x88, 0x3c, 0x4a, 0x18, 0x91, 0x00, 0x03, 0x1c, 0x65, 0x33,
+	0xaf, 0x7d, 0xec, 0xf4, 0x0b, 0xf4, 0xa9, 0x4f, 0xfd, 0x3c, 0x7d, 0xe8, 0x07, 0xea, 0xdc, 0x5f,
+	0xdc, 0x01, 0xa0, 0x03, 0xc7, 0x4f, 0x1c, 0xec, 0xdd, 0x6f, 0x77, 0x6f, 0x6f, 0x6f, 0xef, 0x77,
+	0x4b, 0x18, 0x4c, 0xe2, 0x64, 0x16, 0x8e, 0xfe, 0x16, 0xcc, 0xc3, 0x07, 0xf3, 0x24, 0x26, 0xb1,
+	0xd3, 0x64, 0x3f, 0xde, 0xe7, 0xd0, 0x3a, 0x0c, 0x93, 0xaf, 0x23, 0xe2, 0x58, 0xd0, 0x88, 0x82,
+	0x19, 0x76, 0x6b, 0x3b, 0xb5, 0xdd, 0x8e, 0x63, 0x43, 0x6b, 0x1e, 0x24, 0x38, 0x22, 0xee, 0xda,
+	0x4e, 0x6d, 0xb7, 0x41, 0x47, 0xc9, 0x72, 0x8e, 0xdd, 0xfa, 0x4e, 0x6d, 0xb7, 0xe7, 0xfd, 0x0e,
+	0x80, 0xa3, 0x92, 0x10, 0xa7, 0xce, 0x87, 0xfa, 0x97, 0x5b, 0xdb, 0xa9, 0xef, 0x76, 0xf7, 0x7a,
+	0xdc, 0xcc, 0x03, 0x3e, 0xe0, 0xfd, 0xa7, 0x06, 0x8d, 0x7d, 0x42, 0x12, 0xa7, 0x07, 0xcd, 0x30,
+	0x8a, 0xc7, 0xdc, 0x4c, 0x83, 0x7e, 0x06, 0x24, 0x9c, 0x61, 0x66, 0xa5, 0x4e, 0x3f, 0x67, 0xec,
+	0xb3, 0x2e, 0x3f, 0x47, 0xec, 0xb3, 0xc1, 0x3e, 0x6d, 0x68, 0x8d, 0x12, 0xf6, 0xdd, 0x64, 0xdf,
+	0x16, 0x34, 0x66, 0x54, 0x55, 0x8b, 0xfa, 0x44, 0x27, 0x5f, 0x07, 0xd3, 0x70, 0xec, 0xae, 0xef,
+	0xd4, 0x76, 0x9b, 0x74, 0x30, 0x0d, 0x7f, 0xc2, 0x6e, 0x9b, 0xd9, 0xe9, 0x42, 0x7d, 0x11, 0x8e,
+	0xdd, 0x0e, 0x9b, 0xd9, 0x85, 0xfa, 0x45, 0x38, 0x76, 0x41, 0xc2, 0xa2, 0x69, 0x18, 0x5d, 0xb9,
+	0x5d, 0xb6, 0xb2, 0x27, 0x60, 0xfb, 0x98, 0x50, 0x57, 0xcf, 0xf0, 0x8f, 0x0b, 0x9c, 0x12, 0xe7,
+	0x26, 0x34, 0x02, 0x42, 0x12, 0xe6, 0x70, 0x77, 0xaf, 0x2b, 0xd6, 0x25, 0x17, 0xc3, 0x4d, 0xae,
+	0x31, 0xec, 0x7d, 0xe8, 0x2b, 0x6c, 0x3a, 0x8f, 0xa3, 0x14, 0xbf, 0x05, 0xec, 0xdd, 0x05, 0xfb,
+	0xd8, 0xb4, 0x64, 0xc6, 0x86, 0xaa, 0x3b, 0xae, 0xae, 0xee, 0x09, 0x74, 0xcf, 0x70, 0x30, 0x2e,
+	0xd7, 0x45, 0x43, 0x17, 0x4f, 0x26, 0x29, 0x26, 0x22, 0xd0, 0x32, 0x3a, 0x2c, 0xce, 0xde, 0x1f,
+	0xc0, 0xe2, 0x58, 0x61, 0x26, 0x07, 0xee, 0xc3, 0xfa, 0x3c, 0x58, 0x4e, 0xe3, 0x80, 0x2f, 0xd4,
+	0xd2, 0xb4, 0x29, 0xfc, 0xf7, 0x49, 0x48, 0x70, 0x45, 0xe3, 0x9a, 0x3e, 0x8a, 0xb7, 0xbc, 0xbb,
+	0xd0, 0x13, 0x78, 0xe1, 0x80, 0x0d, 0xad, 0x94, 0x04, 0x64, 0x91, 0x32, 0x0d, 0x4d, 0xef, 0x18,
+	0xac, 0xe7, 0x57, 0x87, 0xa1, 0x8a, 0x54, 0x96, 0x9d, 0x35, 0x99, 0x9d, 0x2c, 0x77, 0xd7, 0x58,
+	0xee, 0xca, 0x28, 0xd5, 0x8b, 0x51, 0xfa, 0x02, 0x7a, 0x42, 0x91, 0xb0, 0x64, 0x66, 0xbd, 0x44,
+	0xae, 0x15, 0x91, 0xdf, 0x40, 0xef, 0x20, 0xc1, 0x01, 0xc1, 0xef, 0xed, 0xc3, 0x63, 0xb0, 0xa5,
+	0xa6, 0x77, 0x75, 0xe2, 0x13, 0xe8, 0x9d, 0xe1, 0x59, 0x7c, 0x5d, 0xcd, 0x09, 0x6f, 0x07, 0x6c,
+	0x39, 0x7d, 0x45, 0x60, 0x3f, 0x81, 0xde, 0x69, 0x1c, 0x5f, 0x2d, 0xe6, 0xd5, 0x14, 0x3e, 0x06,
+	0x5b, 0x4e, 0x7f, 0x57, 0xd7, 0x3d, 0xd8, 0xa0, 0x39, 0x76, 0x18, 0x26, 0xfb, 0xd3, 0xe9, 0x8a,
+	0x8c, 0x7f, 0x04, 0x8e, 0x3e, 0x47, 0x98, 0xa8, 0x50, 0x5e, 0x7e, 0x00, 0xdb, 0x5f, 0xce, 0xe8,
+	0x31, 0xae, 0xb6, 0x3b, 0x36, 0xb4, 0x48, 0x90, 0x5c, 0x88, 0x04, 0xee, 0xc8, 0xf2, 0xd0, 0xd0,
+	0xcb, 0x03, 0xad, 0x31, 0x3d, 0xef, 0x4f, 0xd0, 0x57, 0x9a, 0xb3, 0x18, 0xfe, 0xb2, 0x8d, 0x7f,
+	0x02, 0xdd, 0x53, 0xcd, 0xc5, 0xe2, 0x29, 0xc9, 0x57, 0x5c, 0xa6, 0x96, 0x79, 0xe8, 0x3d, 0x02,
+	0xeb, 0x54, 0x77, 0xa2, 0x72, 0xdc, 0x77, 0xa0, 0x4f, 0x63, 0x3a, 0x5d, 0x69, 0xd8, 0xf3, 0x60,
+	0x90, 0xcd, 0xc8, 0xd6, 0x28, 0x02, 0xc4, 0x0c, 0x78, 0x2f, 0x58, 0x2d, 0x7a, 0x13, 0xac, 0xac,
+	0x56, 0xb9, 0x28, 0xe8, 0xf5, 0xa5, 0xe7, 0x0c, 0xa0, 0x3d, 0x8f, 0xd3, 0x90, 0x84, 0x71, 0xc4,
+	0x63, 0xec, 0x7d, 0x08, 0x83, 0x4c, 0x5f, 0x56, 0x75, 0xde, 0xa8, 0xea, 0x66, 0x79, 0x7f, 0x65,
+	0xd5, 0xb4, 0xba, 0x49, 0x5e, 0x8c, 0x17, 0xdc, 0xa6, 0x55, 0xb4, 0x49, 0x27, 0x4c, 0xa6, 0xc1,
+	0x45, 0x2a, 0x76, 0xd6, 0x81, 0x81, 0x9f, 0x73, 0xc1, 0xdb, 0x87, 0xc1, 0x69, 0x98, 0xfe, 0x9c,
+	0x51, 0xb6, 0xb2, 0xb5, 0xc2, 0xca, 0xf8, 0xd5, 0xe8, 0xc1, 0x86, 0xa6, 0xa2, 0x7c, 0x69, 0x0f,
+	0xc1, 0xe1, 0xe7, 0xb2, 0xf2, 0xea, 0xbc, 0x21, 0x6c, 0x1a, 0x10, 0xe1, 0xf0, 0x84, 0x16, 0x04,
+	0x3a, 0x4d, 0x2a, 0xd9, 0x80, 0x4e, 0x3c, 0x1d, 0xbf, 0xd4, 0xf3, 0x73, 0x03, 0x3a, 0x11, 0x7e,
+	0xfd, 0x52, 0xcf, 0xad, 0x3e, 0xac, 0xc7, 0xd3, 0xf1, 0x0b, 0x95, 0x5e, 0x54, 0x10, 0xe1, 0xd7,
+	0x4c, 0xd0, 0x90, 0xd1, 0xd4, 0x83, 0x35, 0x00, 0x5b, 0xda, 0x11, 0x96, 0xfb, 0xd0, 0xf3, 0x49,
+	0x40, 0x26, 0xa9, 0xb0, 0xec, 0xfd, 0xbb, 0x06, 0xb6, 0x94, 0x64, 0x59, 0x74, 0x3e, 0x8d, 0x47,
+	0x57, 0x69, 0x76, 0xdb, 0x9f, 0x4f, 0x12, 0x8c, 0x85, 0x17, 0x74, 0x38, 0xb8, 0x0e, 0xc2, 0xa9,
+	0x5b, 0x97, 0xc3, 0x93, 0x70, 0x8a, 0x53, 0xb7, 0xa1, 0x3e, 0xd9, 0xec, 0xa6, 0x02, 0xb3, 0xc8,
+	0xf3, 0xeb, 0x9e, 0x7a, 0x1c, 0xcc, 0xf0, 0x14, 0x47, 0xec, 0xc2, 0xef, 0x51, 0x6d, 0x93, 0x44,
+	0x5d, 0xf9, 0x3d, 0xba, 0x6c, 0x6e, 0x9c, 0x8a, 0xd8, 0xc5, 0x4f, 0x7d, 0x3e, 0x89, 0x42, 0x72,
+	0xa4, 0x7c, 0x1e, 0x80, 0x2d, 0x05, 0x62, 0x59, 0x4f, 0xa1, 0xeb, 0x63, 0x7c, 0x55, 0xf1, 0x26,
+	0xb3, 0xa1, 0xf5, 0xfa, 0x12, 0x47, 0x23, 0xc9, 0x8b, 0xee, 0x80, 0xc5, 0xd1, 0x59, 0x00, 0xc4,
+	0xfc, 0x1a, 0xbb, 0x28, 0x6d, 0xb0, 0xbe, 0x0f, 0xc8, 0xe8, 0x52, 0xda, 0xff, 0x18, 0xac, 0x93,
+	0x88, 0x51, 0x88, 0x80, 0xa6, 0xd0, 0xdb, 0x53, 0xe0, 0x5f, 0x75, 0x80, 0x13, 0x3a, 0x4a, 0x4b,
+	0xe1, 0x92, 0x06, 0xe0, 0x1a, 0x27, 0x29, 0xcd, 0xbc, 0x9a, 0xcc, 0xef, 0x30, 0x3d, 0x0c, 0x79,
+	0x15, 0x68, 0xbf, 0xa5, 0x10, 0x69, 0xa5, 0x46, 0x45, 0x9a, 0x9b, 0x6d, 0xaa, 0x84, 0x89, 0xc7,
+	0xf8, 0x20, 0x5e, 0x44, 0xc4, 0x6d, 0xc9, 0x85, 0x87, 0x29, 0x2d, 0x40, 0x2c, 0xd8, 0x6d, 0xad,
+	0x3e, 0xb4, 0x59, 0xba, 0x7c, 0x2c, 0x13, 0xbc, 0xc3, 0xca, 0xf3, 0x2d, 0x61, 0x2d, 0x73, 0xf7,
+	0xc1, 0x0f, 0x74, 0x98, 0x7b, 0x9e, 0xa5, 0x05, 0x48, 0x7b, 0xec, 0xdb, 0xa7, 0x3b, 0xd5, 0x95,
+	0xa2, 0x69, 0x90, 0x92, 0x67, 0x54, 0xec, 0x5a, 0x32, 0x18, 0x93, 0xf4, 0x64, 0xec, 0xf6, 0x14,
+	0x05, 0x49, 0xc2, 0x8b, 0x30, 0x72, 0x6d, 0xf6, 0xed, 0x00, 0xf0, 0xef, 0x57, 0x94, 0x1f, 0xf6,
+	0xd9, 0xee, 0xdc, 0x00, 0x8b, 0xcb, 0x9e, 0x71, 0x6b, 0x03, 0xa9, 0x9a, 0x24, 0x8b, 0x68, 0x14,
+	0x10, 0x3c, 0x76, 0x37, 0xd8, 0xc4, 0x4d, 0xe8, 0x32, 0x07, 0xbe, 0x09, 0xd2, 0x4b, 0x9c, 0xba,
+	0xce, 0x4e, 0x7d, 0xd7, 0x42, 0xf7, 0x01, 0x34, 0x9f, 0xbb, 0x50, 0xbf, 0xc2, 0x4b, 0xb7, 0x66,
+	0x96, 0x1a, 0x46, 0x87, 0x9e, 0xac, 0x7d, 0x51, 0xf3, 0x7e, 0x82, 0xce, 0xab, 0x78, 0x76, 0x9e,
+	0x92, 0x38, 0x62, 0xc7, 0x7d, 0xcc, 0x78, 0x6a, 0x4d, 0xd2, 0xd8, 0x1f, 0x35, 0x92, 0x2b, 0x17,
+	0xc2, 0xeb, 0x94, 0x8a, 0x7d, 0x43, 0x9d, 0x09, 0xee, 0x2d, 0xdf, 0x0b, 0x07, 0x60, 0x12, 0x26,
+	0x32, 0x12, 0x6a, 0x33, 0x2e, 0xb9, 0xa7, 0xeb, 0xd4, 0x53, 0xef, 0x9f, 0x35, 0x68, 0x8b, 0x1b,
+	0xb2, 0x24, 0x2d, 0xcc, 0x2a, 0x09, 0xb0, 0x16, 0x4a, 0xd3, 0xf7, 0xa0, 0x43, 0xa4, 0xcf, 0xcc,
+	0x7c, 0x77, 0x6f, 0x20, 0x36, 0x2e, 0x5b, 0x8b, 0x24, 0xfe, 0xac, 0x0e, 0x38, 0xf7, 0xa0, 0x95,
+	0xb0, 0x3a, 0xc0, 0x5c, 0xe9, 0xee, 0x6d, 0x8a, 0xf9, 0xbc, 0x38, 0x9c, 0x44, 0x04, 0x47, 0xc4,
+	0x5b, 0x82, 0xa5, 0x7f, 0x9b, 0x05, 0x88, 0x55, 0x40, 0xbd, 0xde, 0xac, 0xc9, 0x1b, 0x98, 0xa4,
+	0x33, 0xc1, 0xfb, 0x07, 0xd0, 0x4e, 0xf0, 0x7c, 0x1a, 0x8c, 0x30, 0xbf, 0x93, 0x2d, 0xba, 0x95,
+	0x52, 0xf2, 0x2a, 0xf3, 0x66, 0x00, 0x6d, 0xfc, 0x66, 0x74, 0x19, 0x44, 0x17, 0xdc, 0x9f, 0xb6,
+	0x87, 0xa1, 0x73, 0x14, 0x4e, 0x31, 0x8b, 0x56, 0x69, 0x28, 0xc6, 0x01, 0x09, 0x04, 0x8b, 0x1d,
+	0x40, 0x7b, 0x74, 0x89, 0x47, 0x57, 0xe9, 0x62, 0x26, 0xee, 0xa9, 0x4d, 0xe8, 0x8e, 0xe2, 0xd9,
+	0x3c, 0xc1, 0x69, 0x9a, 0x5d, 0x1b, 0x0e, 0x00, 0x8e, 0x46, 0xc9, 0x72, 0xce, 0x8a, 0x3c, 0x2f,
+	0x87, 0x1f, 0x41, 0xf3, 0x79, 0x3c, 0x3e, 0xf2, 0xa9, 0xc6, 0x17, 0xc6, 0xa3, 0xc9, 0xe7, 0xec,
+	0x8a, 0x9f, 0xd8, 0x7f, 0xd4, 0xa0, 0xcf, 0xa9, 0xde, 0x91, 0xaf, 0x55, 0x94, 0x57, 0xf1, 0x15,
+	0x8e, 0x32, 0xc8, 0x91, 0xaf, 0xc5, 0x61, 0x03, 0x3a, 0xcf, 0xd4, 0x59, 0xa8, 0xcb, 0xec, 0x3c,
+	0xc8, 0x79, 0xc5, 0x0a, 0xf6, 0xd7, 0xdc, 0x2b, 0xe6, 0x52, 0x9b, 0xea, 0x3d, 0xc4, 0xe3, 0xc5,
+	0x9c, 0x07, 0x82, 0xea, 0x39, 0xc3, 0x34, 0xfa, 0x14, 0xb2, 0x2e, 0xd8, 0xe0, 0x20, 0x73, 0x26,
+	0xa3, 0x11, 0x87, 0x34, 0x22, 0xfc, 0x96, 0xbf, 0x03, 0x3d, 0x7a, 0x77, 0xad, 0x72, 0xd6, 0xbb,
+	0x03, 0xb6, 0x1c, 0x2f, 0xc5, 0xdf, 0x87, 0x9e, 0x7f, 0x19, 0xbf, 0x5e, 0xb9, 0x58, 0x0b, 0x1a,
+	0x47, 0xbe, 0x78, 0x2e, 0x31, 0x6d, 0x72, 0x76, 0xa9, 0xb6, 0x07, 0xd0, 0x3f, 0xc4, 0x53, 0x4c,
+	0x70, 0x45, 0x7d, 0x3b, 0x30, 0xc8, 0xe6, 0x97, 0x6a, 0x7c, 0x0e, 0xfd, 0xef, 0xe6, 0xe3, 0xa0,
+	0xaa, 0x46, 0xe7, 0x36, 0xac, 0xd3, 0x6c, 0x4a, 0x97, 0xa9, 0x38, 0x1e, 0x96, 0x48, 0x77, 0xb6,
+	0xf9, 0xd4, 0x60, 0xa6, 0xae, 0xd4, 0xe0, 0x1f, 0xc1, 0x39, 0x4e, 0x82, 0x88, 0xec, 0x8f, 0xc7,
+	0x49, 0x45, 0x9b, 0x16, 0x34, 0xe8, 0x6c, 0x41, 0xfb, 0xee, 0xc1, 0xa6, 0xa1, 0xa0, 0xd4, 0xca,
+	0x57, 0x94, 0x1b, 0x5c, 0xc7, 0x57, 0xf8, 0x17, 0x9b, 0xf9, 0x35, 0xdc, 0x30, 0x35, 0x94, 0xda,
+	0xf9, 0x12, 0x6c, 0x7f, 0x94, 0x2c, 0xce, 0x2b, 0x9a, 0xb0, 0xa1, 0x75, 0x98, 0x2c, 0xcf, 0x16,
+	0x9c, 0x19, 0xb5, 0xbd, 0xbb, 0xd0, 0x57, 0xf0, 0x55, 0xfa, 0x0f, 0xe8, 0x81, 0xac, 0xae, 0xff,
+	0x0c, 0xcf, 0x83, 0x30, 0xc9, 0xf4, 0x2b, 0x78, 0xa9, 0xfe, 0x4f, 0x61, 0xe3, 0x2c, 0x26, 0x01,
+	0xc1, 0x7f, 0xc6, 0xcb, 0xb4, 0x52, 0x4a, 0x79, 0xe0, 0xe8, 0x88, 0x52, 0xad, 0xcf, 0x60, 0xc8,
+	0x8f, 0x95, 0x1f, 0x05, 0xf3, 0xf4, 0x32, 0x26, 0x55, 0xe3, 0x9f, 0xd1, 0x2f, 0xef, 0x37, 0xb0,
+	0x95, 0xd7, 0x51, 0x6a, 0xeb, 0x33, 0xb8, 0x41, 0x0f, 0xa0, 0x9c, 0x55, 0x6d, 0x11, 0x1f, 0xc1,
+	0x30, 0x07, 0x5a, 0xb5, 0x0e, 0x7e, 0x7c, 0xde, 0x6f, 0x1d, 0x79, 0x1d, 0xa5, 0xb6, 0x0e, 0x60,
+	0xeb, 0x0c, 0xa7, 0x24, 0x4e, 0xde, 0xc7, 0xd8, 0x6f, 0x61, 0xbb, 0xa0, 0xa4, 0xd4, 0xda, 0xb7,
+	0x60, 0x1f, 0x4c, 0xe3, 0xa8, 0xea, 0xa9, 0x1f, 0x40, 0x5b, 0x2a, 0x74, 0xeb, 0x32, 0xd3, 0x44,
+	0x91, 0x66, 0xc5, 0x97, 0x65, 0x9a, 0x54, 0x58, 0x6a, 0xf1, 0x21, 0x38, 0x34, 0xe4, 0x3c, 0x16,
+	0xe3, 0x4a, 0xbb, 0x74, 0x0f, 0x36, 0x0d, 0x48, 0xa9, 0xde, 0xa7, 0xd0, 0xff, 0x2e, 0x1a, 0xb3,
+	0x29, 0x55, 0x03, 0xf6, 0x32, 0x20, 0x97, 0x22, 0x60, 0xb4, 0x5e, 0x29, 0x74, 0xa9, 0xfe, 0xbf,
+	0xd7, 0xd8, 0xa3, 0xeb, 0x2f, 0x8b, 0x98, 0x04, 0x95, 0x0c, 0xf4, 0xa0, 0xf9, 0x6c, 0x49, 0x70,
+	0x2a, 0xae, 0x2a, 0x1b, 0x5a, 0x8c, 0xf2, 0xa5, 0xa2, 0x63, 0xb7, 0x01, 0x1d, 0x3f, 0x9e, 0x10,
+	0x3e, 0x85, 0x37, 0xed, 0x1c, 0x00, 0x2a, 0x12, 0xd3, 0x5a, 0x92, 0x20, 0x1d, 0x27, 0xc1, 0x08,
+	0x67, 0x17, 0x55, 0xe6, 0x44, 0x99, 0x9f, 0x7b, 0xff, 0x05, 0xa8, 0xef, 0xcf, 0x43, 0xe7, 0x09,
+	0xac, 0x8b, 0x8e, 0x9b, 0x33, 0x14, 0xa5, 0xd9, 0xec, 0xde, 0xa1, 0xad, 0xbc, 0x58, 0xf0, 0xfc,
+	0x5f, 0x51, 0xec, 0x71, 0x0e, 0x7b, 0x5c, 0x8e, 0x3d, 0x2e, 0x60, 0x1f, 0x42, 0x83, 0x3e, 0x99,
+	0x1d, 0x47, 0xd1, 0x1f, 0xd5, 0x79, 0x43, 0x9b, 0x86, 0x4c, 0x41, 0x3e, 0x87, 0x26, 0xeb, 0x71,
+	0x39, 0x72, 0x5c, 0xef, 0x98, 0xa1, 0x1b, 0xa6, 0x50, 0x47, 0xb1, 0x7e, 0x95, 0x42, 0xe9, 0x6d,
+	0x30, 0x74, 0xc3, 0x14, 0x2a, 0xd4, 0x23, 0x68, 0xf1, 0x72, 0xe2, 0xc8, 0x19, 0x46, 0xeb, 0x0a,
+	0x0d, 0x73, 0x52, 0x1d, 0xc8, 0x5f, 0x99, 0x0a, 0x68, 0xb4, 0x9b, 0xd0, 0x30, 0x27, 0xd5, 0x81,
+	0xbc, 0x31, 0xa4, 0x80, 0x46, 0x5b, 0x09, 0x0d, 0x73, 0x52, 0x05, 0x3c, 0x00, 0xc8, 0x5a, 0x3e,
+	0x8e, 0xab, 0xc5, 0xce, 0xe8, 0x14, 0xa1, 0x9b, 0x25, 0x23, 0xfa, 0x56, 0x8a, 0x26, 0x4d, 0x96,
+	0x06, 0x46, 0x3b, 0x08, 0x6d, 0xe5, 0xc5, 0x0a, 0xfb, 0x25, 0xb4, 0x65, 0xf7, 0xc3, 0xd9, 0xd2,
+	0x8c, 0xe8, 0xe8, 0xed, 0x82, 0x5c, 0x87, 0xcb, 0x46, 0x86, 0xa3, 0xe5, 0x8b, 0xfe, 0xb0, 0x47,
+	0xdb, 0x05, 0xb9, 0x0e, 0xf7, 0xf3, 0x70, 0x7f, 0x05, 0xdc, 0x2f, 0xc2, 0xbf, 0x82, 0x8e, 0x6a,
+	0x36, 0x38, 0x72, 0x5e, 0xbe, 0x83, 0x81, 0xdc, 0xe2, 0x80, 0xd2, 0x70, 0x04, 0x5d, 0xbe, 0x99,
+	0x5c, 0xc7, 0x4d, 0x63, 0x83, 0x0d, 0x2d, 0xa8, 0x6c, 0xc8, 0xcc, 0x1c, 0xca, 0xf9, 0xb5, 0xcc,
+	0xd1, 0xfa, 0x12, 0x68, 0x98, 0x93, 0xea, 0x40, 0xde, 0x35, 0x50, 0x40, 0xa3, 0xad, 0x80, 0x86,
+	0x39, 0xa9, 0x0e, 0xe4, 0x6f, 0x77, 0x05, 0x34, 0xde, 0xf6, 0x68, 0x98, 0x93, 0x2a, 0xe0, 0x63,
+	0x9e, 0x72, 0x3e, 0x49, 0x70, 0x30, 0x7b, 0x87, 0x23, 0xfc, 0x69, 0xcd, 0x79, 0x0a, 0x5d, 0x76,
+	0x42, 0x05, 0xf6, 0x5d, 0x8e, 0xf2, 0x6e, 0x8d, 0x56, 0x0d, 0xda, 0x1d, 0x50, 0x26, 0xb5, 0x46,
+	0x03, 0xda, 0x34, 0x64, 0x7a, 0xa1, 0xa1, 0xaf, 0x6e, 0x05, 0xd1, 0xfa, 0x87, 0x68, 0xd3, 0x90,
+	0x29, 0xc8, 0xef, 0xa1, 0xc9, 0x7a, 0x0c, 0x99, 0x77, 0x5a, 0xc7, 0x41, 0x81, 0xf4, 0xb6, 0x03,
+	0x5d, 0xda, 0xde, 0xff, 0x3a, 0xd0, 0xa3, 0x64, 0xd7, 0x5f, 0xa6, 0x04, 0xcf, 0xf6, 0x5f, 0x9e,
+	0xd0, 0xdc, 0x94, 0xef, 0x05, 0x95, 0x9b, 0xb9, 0xd7, 0x0c, 0xda, 0x2e, 0xc8, 0x8d, 0x92, 0xc0,
+	0x1e, 0x0b, 0x59, 0x49, 0xd0, 0xdf, 0x16, 0x68, 0x98, 0x93, 0x1a, 0x19, 0xc1, 0xde, 0x05, 0x59,
+	0x46, 0xe8, 0x8f, 0x0a, 0x34, 0xcc, 0x49, 0xf5, 0xc3, 0x24, 0x1f, 0x00, 0xca, 0xe1, 0xdc, 0x0b,
+	0x02, 0x6d, 0x17, 0xe4, 0x3a, 0x5c, 0xd2, 0x79, 0x05, 0xcf, 0x3d, 0x17, 0xd0, 0x76, 0x41, 0xae,
+	0x9f, 0x24, 0x8d, 0xaa, 0xab, 0x93, 0x54, 0xe4, 0xff, 0x08, 0x95, 0x0d, 0x29, 0x3d, 0x27, 0x60,
+	0xe9, 0x5c, 0xdc, 0xc9, 0xce, 0x5d, 0x81, 0xe2, 0xa3, 0x0f, 0x4a, 0xc7, 0x8c, 0xba, 0xc8, 0x19,
+	0x77, 0x56, 0x17, 0x0d, 0x02, 0x8f, 0xb6, 0xf2, 0x62, 0x1d, 0x2b, 0xd8, 0xb4, 0xc2, 0x9a, 0xe4,
+	0x1c, 0x6d, 0xe5, 0xc5, 0x46, 0x51, 0x57, 0xb4, 0x39, 0x2b, 0xea, 0x79, 0xee, 0x8d, 0x6e, 0x96,
+	0x8c, 0x28, 0x25, 0xdf, 0xca, 0xbf, 0x49, 0x24, 0x19, 0x73, 0x6e, 0x19, 0xc9, 0x96, 0x63, 0x8e,
+	0xe8, 0xf6, 0x8a, 0x51, 0xa5, 0xf0, 0x94, 0xbf, 0x6e, 0xe5, 0x48, 0xea, 0x7c, 0xa0, 0x65, 0x60,
+	0x9e, 0x52, 0xa3, 0x5b, 0xe5, 0x83, 0xba, 0x7b, 0x26, 0xd5, 0x55, 0xee, 0x95, 0xb2, 0x68, 0x74,
+	0x7b, 0xc5, 0xa8, 0x52, 0x78, 0x06, 0xfd, 0x1c, 0x9d, 0x75, 0x6e, 0xab, 0xed, 0x2d, 0xe3, 0xca,
+	0xe8, 0xce, 0xaa, 0x61, 0x63, 0x13, 0x39, 0x51, 0xcd, 0x36, 0xd1, 0x60, 0xc2, 0x68, 0x2b, 0x2f,
+	0xd6, 0xf3, 0x59, 0x23, 0xa4, 0x2a, 0x9f, 0x8b, 0xbc, 0x16, 0xa1, 0xb2, 0x21, 0xe3, 0x58, 0x09,
+	0xd6, 0x99, 0x1d, 0x2b, 0x93, 0xc4, 0xa2, 0xed, 0x82, 0x3c, 0x77, 0x43, 0x32, 0x32, 0xa8, 0xdf,
+	0x90, 0x3a, 0x45, 0x45, 0xdb, 0x05, 0xb9, 0x84, 0x9f, 0xb7, 0xd8, 0xc8, 0x67, 0xff, 0x1f, 0x00,
+	0xe1, 0xd5, 0x79, 0x5d, 0x01, 0x1f, 0x00, 0x00,
 }